@@ -12,26 +12,32 @@ var addCmd = &cobra.Command{
 	Use:  "add <path> ...",
 	Args: cobra.MinimumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := configure(); err != nil {
+		r, err := openRepository()
+		if err != nil {
 			return err
 		}
-		return Add(args...)
+		return Add(r, args...)
 	},
 }
 
 // Add adds one or more file paths to the Index.
-func Add(paths ...string) error {
-	idx, err := g.ReadIndex()
+func Add(r *g.Repository, paths ...string) error {
+	idx, err := r.ReadIndex()
 	if err != nil {
 		return err
 	}
 	// get working directory files with idx status
-	wdFiles, err := g.FsStatus(g.Path())
+	wdFiles, err := r.FsStatus(r.Path())
 	if err != nil {
 		return err
 	}
 	var updates []*g.FileStatus
 	for _, p := range paths {
+		// pathspecs are relative to the current directory
+		p, err := r.Pathspec(p)
+		if err != nil {
+			return err
+		}
 		if p == "." {
 			// special case meaning add everything
 			for _, v := range wdFiles.Files() {
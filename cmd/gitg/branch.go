@@ -14,19 +14,20 @@ var branchCmd = &cobra.Command{
 	Use:  "branch <path> ...",
 	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := configure(); err != nil {
+		r, err := openRepository()
+		if err != nil {
 			return err
 		}
 		if len(args) == 0 {
 			// default to list branches
-			return ListBranches(os.Stdout)
+			return ListBranches(r, os.Stdout)
 		}
 		if len(args) == 1 {
 			if branchDelete {
-				return DeleteBranch(args[0])
+				return DeleteBranch(r, args[0])
 			} else {
 				// create a branch
-				return CreateBranch(args[0])
+				return CreateBranch(r, args[0])
 			}
 		}
 		return nil
@@ -35,33 +36,42 @@ var branchCmd = &cobra.Command{
 
 const DeleteBranchCheckedOutErrFmt = "error: Cannot delete branch '%s' checked out at '%s'"
 
-func DeleteBranch(name string) error {
+func DeleteBranch(r *g.Repository, name string) error {
 	// Delete Branch removes any branch that is not checked out
 	// @todo more correct semantics
-	currentBranch, err := g.CurrentBranch()
+	currentBranch, err := r.CurrentBranch()
 	if err != nil {
 		return err
 	}
 	if name == currentBranch {
-		return fmt.Errorf(DeleteBranchCheckedOutErrFmt, name, g.Path())
+		return fmt.Errorf(DeleteBranchCheckedOutErrFmt, name, r.Path())
 	}
-	return g.DeleteBranch(name)
+	return r.DeleteBranch(name)
 }
 
-func CreateBranch(name string) error {
-	return g.CreateBranch(name)
+func CreateBranch(r *g.Repository, name string) error {
+	return r.CreateBranch(name)
 }
 
-func ListBranches(o io.Writer) error {
+func ListBranches(r *g.Repository, o io.Writer) error {
 	var err error
-	currentBranch, err := g.CurrentBranch()
+	currentBranch, err := r.CurrentBranch()
 	if err != nil {
 		return err
 	}
-	branches, err := g.ListBranches()
+	branches, err := r.ListBranches()
 	if err != nil {
 		return err
 	}
+	if currentBranch == "" {
+		head, err := r.CurrentCommit()
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(o, "* (HEAD detached at %s)\n", head.AsHexString()[:7]); err != nil {
+			return err
+		}
+	}
 	for _, v := range branches {
 		if v == currentBranch {
 			_, err = o.Write([]byte(fmt.Sprintf("* %v\n", v)))
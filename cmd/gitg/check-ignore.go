@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/richardjennings/g"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	checkIgnoreVerbose bool
+	checkIgnoreStdin   bool
+	checkIgnoreNoIndex bool
+)
+
+// errNothingIgnored is returned by CheckIgnore when none of the paths are
+// ignored
+var errNothingIgnored = errors.New("error: no path is ignored")
+
+var checkIgnoreCmd = &cobra.Command{
+	Use: "check-ignore [<pathname>...]",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		if checkIgnoreStdin {
+			if len(args) != 0 {
+				return errors.New("fatal: cannot specify pathnames with --stdin")
+			}
+			scanner := bufio.NewScanner(os.Stdin)
+			for scanner.Scan() {
+				args = append(args, scanner.Text())
+			}
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+		} else if len(args) == 0 {
+			return errors.New("fatal: no path specified")
+		}
+		return CheckIgnore(r, os.Stdout, checkIgnoreVerbose, checkIgnoreNoIndex, args...)
+	},
+}
+
+// CheckIgnore writes each of paths, relative to the current directory, that
+// is ignored. When verbose is true the rule that matched is written before
+// the path as source:line:pattern, including negated rules that re-include
+// the path. Paths in the index are not ignored unless noIndex is true. An
+// error is returned when no path is ignored.
+func CheckIgnore(r *g.Repository, o io.Writer, verbose bool, noIndex bool, paths ...string) error {
+	var idx *g.Index
+	if !noIndex {
+		var err error
+		if idx, err = r.ReadIndex(); err != nil {
+			return err
+		}
+	}
+	ig, err := r.NewIgnorer()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, v := range paths {
+		p, err := r.Pathspec(v)
+		if err != nil {
+			return err
+		}
+		if idx != nil && idx.File(p) != nil {
+			// tracked files are not subject to the ignore rules
+			continue
+		}
+		isDir := strings.HasSuffix(v, "/")
+		if info, err := os.Stat(filepath.Join(r.Path(), p)); err == nil && info.IsDir() {
+			isDir = true
+		}
+		ignored, rule, err := ig.IsIgnored(p, isDir)
+		if err != nil {
+			return err
+		}
+		found = found || ignored
+		switch {
+		case verbose && rule != nil:
+			_, err = fmt.Fprintf(o, "%s:%d:%s\t%s\n", rule.Source, rule.Line, rule.Pattern, v)
+		case ignored:
+			_, err = fmt.Fprintln(o, v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !found {
+		return errNothingIgnored
+	}
+	return nil
+}
+
+func init() {
+	checkIgnoreCmd.Flags().BoolVarP(&checkIgnoreVerbose, "verbose", "v", false, "--verbose")
+	checkIgnoreCmd.Flags().BoolVar(&checkIgnoreStdin, "stdin", false, "--stdin")
+	checkIgnoreCmd.Flags().BoolVar(&checkIgnoreNoIndex, "no-index", false, "--no-index")
+	rootCmd.AddCommand(checkIgnoreCmd)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/richardjennings/g"
@@ -16,14 +17,15 @@ var commitMessage string
 var commitCmd = &cobra.Command{
 	Use: "commit",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := configure(); err != nil {
+		r, err := openRepository()
+		if err != nil {
 			log.Fatalln(err)
 		}
 		var msg []byte
 		if cmd.Flags().Changed("message") {
 			msg = []byte(commitMessage)
 		}
-		sha, err := Commit(msg)
+		sha, err := Commit(r, msg)
 		if err != nil {
 			return err
 		}
@@ -33,40 +35,56 @@ var commitCmd = &cobra.Command{
 }
 
 // Commit writes a git commit object from the files in the index
-func Commit(message []byte) (g.Sha, error) {
+func Commit(r *g.Repository, message []byte) (g.Sha, error) {
 	commit := &g.Commit{
-		Author:        fmt.Sprintf("%s <%s>", g.AuthorName(), g.AuthorEmail()),
+		Author:        fmt.Sprintf("%s <%s>", r.AuthorName(), r.AuthorEmail()),
 		AuthoredTime:  time.Now(),
-		Committer:     fmt.Sprintf("%s <%s>", g.CommitterName(), g.CommitterEmail()),
+		Committer:     fmt.Sprintf("%s <%s>", r.CommitterName(), r.CommitterEmail()),
 		CommittedTime: time.Now(),
 	}
 	if message != nil {
 		commit.Message = message
 	} else {
-		// empty commit file
-		if err := os.WriteFile(g.EditorFile(), []byte{}, 0600); err != nil {
+		// the commit file starts with the message prepared by a merge in
+		// progress, if any
+		prepared, err := r.MergeMessage()
+		if err != nil {
+			return g.Sha{}, err
+		}
+		if err := os.WriteFile(r.EditorFile(), prepared, 0600); err != nil {
 			log.Fatalln(err)
 		}
-		ed, args := g.Editor()
-		args = append(args, g.EditorFile())
+		ed, args := r.Editor()
+		args = append(args, r.EditorFile())
 		cmd := exec.Command(ed, args...)
 		cmd.Stdin = os.Stdin
 		cmd.Stdout = os.Stdout
-		err := cmd.Run()
-		if err != nil {
+		if err := cmd.Run(); err != nil {
 			log.Fatalln(err)
 		}
-		msg, err := os.ReadFile(args[0])
+		msg, err := os.ReadFile(r.EditorFile())
 		if err != nil {
 			log.Fatalln(msg)
 		}
-		commit.Message = msg
+		commit.Message = stripComments(msg)
 	}
 
 	if len(commit.Message) == 0 {
 		return g.Sha{}, errors.New("aborting commit due to empty commit message")
 	}
-	return g.CreateCommit(commit)
+	return r.CreateCommit(commit)
+}
+
+// stripComments removes the lines starting with # from a message written in
+// the editor, and the blank lines left at its end
+func stripComments(msg []byte) []byte {
+	var lines [][]byte
+	for _, v := range bytes.SplitAfter(msg, []byte("\n")) {
+		if !bytes.HasPrefix(v, []byte("#")) {
+			lines = append(lines, v)
+		}
+	}
+	return bytes.TrimRight(bytes.Join(lines, nil), "\n")
 }
 
 func init() {
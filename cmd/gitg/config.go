@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/richardjennings/g"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+)
+
+var (
+	configGet    bool
+	configGetAll bool
+	configAdd    bool
+	configUnset  bool
+	configList   bool
+	configGlobal bool
+	configLocal  bool
+	configFile   string
+)
+
+var configCmd = &cobra.Command{
+	Use:  "config [<name> [<value>]]",
+	Args: cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if configGlobal && configLocal {
+			return errors.New("error: only one config file at a time")
+		}
+		// --file and --global can be used outside of a repository
+		var r *g.Repository
+		if configFile == "" && !configGlobal {
+			var err error
+			if r, err = openRepository(); err != nil {
+				return err
+			}
+		}
+		switch {
+		case configList:
+			if len(args) != 0 {
+				return errors.New("error: wrong number of arguments, should be 0")
+			}
+			return ConfigList(r, os.Stdout)
+		case configGet || configGetAll:
+			if len(args) != 1 {
+				return errors.New("error: wrong number of arguments, should be 1")
+			}
+			return ConfigGet(r, os.Stdout, args[0], configGetAll)
+		case configUnset:
+			if len(args) != 1 {
+				return errors.New("error: wrong number of arguments, should be 1")
+			}
+			return g.UnsetConfig(configWriteFile(r), args[0])
+		case configAdd:
+			if len(args) != 2 {
+				return errors.New("error: wrong number of arguments, should be 2")
+			}
+			return g.AddConfig(configWriteFile(r), args[0], args[1])
+		case len(args) == 1:
+			return ConfigGet(r, os.Stdout, args[0], false)
+		case len(args) == 2:
+			return g.SetConfig(configWriteFile(r), args[0], args[1])
+		}
+		return cmd.Usage()
+	},
+}
+
+// configReadSource returns the config selected by --file, --global or
+// --local, otherwise the merged config of r.
+func configReadSource(r *g.Repository) (*g.GitConfig, error) {
+	switch {
+	case configFile != "":
+		return g.ReadGitConfigFile(configFile, g.ConfigScopeLocal)
+	case configGlobal:
+		c := &g.GitConfig{}
+		for _, v := range g.GlobalConfigFiles() {
+			f, err := g.ReadGitConfigFile(v, g.ConfigScopeGlobal)
+			if err != nil {
+				return nil, err
+			}
+			c.Entries = append(c.Entries, f.Entries...)
+		}
+		return c, nil
+	case configLocal:
+		return g.ReadGitConfigFile(r.LocalConfigFile(), g.ConfigScopeLocal)
+	}
+	return r.GitConfig(), nil
+}
+
+// configWriteFile returns the config file selected by --file or --global,
+// otherwise the config file of r.
+func configWriteFile(r *g.Repository) string {
+	switch {
+	case configFile != "":
+		return configFile
+	case configGlobal:
+		return g.GlobalConfigFile()
+	}
+	return r.LocalConfigFile()
+}
+
+// ConfigGet writes the last value of key, or every value when all is true.
+// An error is returned when key is not set.
+func ConfigGet(r *g.Repository, o io.Writer, key string, all bool) error {
+	c, err := configReadSource(r)
+	if err != nil {
+		return err
+	}
+	values := c.GetAll(key)
+	if len(values) == 0 {
+		return g.ErrConfigKeyNotFound
+	}
+	if !all {
+		values = values[len(values)-1:]
+	}
+	for _, v := range values {
+		if _, err := fmt.Fprintln(o, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfigList writes every config variable as name=value
+func ConfigList(r *g.Repository, o io.Writer) error {
+	c, err := configReadSource(r)
+	if err != nil {
+		return err
+	}
+	for _, v := range c.Entries {
+		line := v.Key() + "=" + v.Value
+		if v.NoValue {
+			line = v.Key()
+		}
+		if _, err := fmt.Fprintln(o, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	configCmd.Flags().BoolVar(&configGet, "get", false, "--get <name>")
+	configCmd.Flags().BoolVar(&configGetAll, "get-all", false, "--get-all <name>")
+	configCmd.Flags().BoolVar(&configAdd, "add", false, "--add <name> <value>")
+	configCmd.Flags().BoolVar(&configUnset, "unset", false, "--unset <name>")
+	configCmd.Flags().BoolVarP(&configList, "list", "l", false, "--list")
+	configCmd.Flags().BoolVar(&configGlobal, "global", false, "--global")
+	configCmd.Flags().BoolVar(&configLocal, "local", false, "--local")
+	configCmd.Flags().StringVarP(&configFile, "file", "f", "", "--file <file>")
+	rootCmd.AddCommand(configCmd)
+}
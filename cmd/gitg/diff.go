@@ -0,0 +1,599 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/richardjennings/g"
+	"github.com/richardjennings/g/diff"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	diffStaged     bool
+	diffStat       bool
+	diffNameStatus bool
+	diffContext    int
+	diffAlgorithm  string
+	diffPatience   bool
+	diffHistogram  bool
+	diffColor      string
+	// diffFindRenames and diffFindCopies are the similarity thresholds
+	// given with -M and -C
+	diffFindRenames      string
+	diffFindCopies       string
+	diffFindCopiesHarder bool
+	diffNoRenames        bool
+)
+
+const (
+	colorReset = "\x1b[m"
+	colorMeta  = "\x1b[1m"
+	colorFrag  = "\x1b[36m"
+	colorOld   = "\x1b[31m"
+	colorNew   = "\x1b[32m"
+	// diffStatWidth is the width of a --stat line, as git uses when the
+	// output is not a terminal
+	diffStatWidth = 80
+)
+
+type (
+	// DiffOptions configures the output of Diff and, embedded, which
+	// renamed and copied files are found
+	DiffOptions struct {
+		g.DiffOptions
+		// Staged compares the index to a commit instead of the working
+		// tree to the index
+		Staged     bool
+		Stat       bool
+		NameStatus bool
+		// Context is the number of unchanged lines around each change
+		Context   int
+		Algorithm diff.Algorithm
+		Color     bool
+	}
+	// diffFile is a DiffEntry with its content and edit script
+	diffFile struct {
+		*g.DiffEntry
+		old, new []string
+		edits    []diff.Edit
+		// binary is true when either side is binary
+		binary    bool
+		oldBinary bool
+		newBinary bool
+		oldSize   int
+		newSize   int
+	}
+)
+
+var diffCmd = &cobra.Command{
+	Use: "diff [<commit> [<commit>]] [-- <path>...]",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		revs, pathspecs := args, []string(nil)
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			revs, pathspecs = args[:dash], args[dash:]
+		}
+		opts := DiffOptions{Staged: diffStaged, Stat: diffStat, NameStatus: diffNameStatus, Context: diffContext}
+		if !cmd.Flags().Changed("unified") {
+			opts.Context = 3
+			if v, ok := r.GitConfig().Get("diff.context"); ok {
+				if opts.Context, err = strconv.Atoi(v); err != nil || opts.Context < 0 {
+					return fmt.Errorf("fatal: bad config variable 'diff.context': %s", v)
+				}
+			}
+		}
+		algorithm := diffAlgorithm
+		switch {
+		case diffPatience:
+			algorithm = "patience"
+		case diffHistogram:
+			algorithm = "histogram"
+		case algorithm == "":
+			algorithm, _ = r.GitConfig().Get("diff.algorithm")
+		}
+		if algorithm != "" {
+			if opts.Algorithm, err = diff.ParseAlgorithm(algorithm); err != nil {
+				return err
+			}
+		}
+		if opts.Color, err = useColor(r, diffColor, "color.diff"); err != nil {
+			return err
+		}
+		if opts.DiffOptions, err = findRenames(cmd, r, "diff"); err != nil {
+			return err
+		}
+		return Diff(r, os.Stdout, opts, revs, pathspecs...)
+	},
+}
+
+// findRenames returns the rename detection asked for by the -M, -C,
+// --find-copies-harder and --no-renames flags of cmd, or otherwise configured
+// by the renames and renameLimit variables of the first of sections that
+// sets them. Renames are detected by default.
+func findRenames(cmd *cobra.Command, r *g.Repository, sections ...string) (g.DiffOptions, error) {
+	opts := g.DiffOptions{Renames: true}
+	for _, section := range sections {
+		key := section + ".renames"
+		v, ok := r.GitConfig().Get(key)
+		if !ok {
+			continue
+		}
+		switch strings.ToLower(v) {
+		case "copy", "copies":
+			opts.Copies = true
+		default:
+			opts.Renames = r.GitConfig().Bool(key, true)
+		}
+		break
+	}
+	if diffNoRenames {
+		opts = g.DiffOptions{}
+	}
+	var err error
+	for _, section := range sections {
+		key := section + ".renameLimit"
+		v, ok := r.GitConfig().Get(key)
+		if !ok {
+			continue
+		}
+		if opts.RenameLimit, err = strconv.Atoi(v); err != nil {
+			return opts, fmt.Errorf("fatal: bad config variable '%s': %s", key, v)
+		}
+		if opts.RenameLimit <= 0 {
+			// as in git, a limit of 0 is no limit
+			opts.RenameLimit = -1
+		}
+		break
+	}
+	if f := cmd.Flags().Lookup("find-renames"); f != nil && f.Changed {
+		opts.Renames = true
+		if opts.Threshold, err = parseSimilarity(diffFindRenames); err != nil {
+			return opts, err
+		}
+	}
+	if f := cmd.Flags().Lookup("find-copies"); f != nil && f.Changed {
+		opts.Renames, opts.Copies = true, true
+		if opts.Threshold, err = parseSimilarity(diffFindCopies); err != nil {
+			return opts, err
+		}
+	}
+	if diffFindCopiesHarder {
+		opts.Renames, opts.Copies, opts.FindCopiesHarder = true, true, true
+	}
+	return opts, nil
+}
+
+// parseSimilarity parses the similarity of -M<n> as a percentage. Like git,
+// digits without a % sign are a fraction, so that 5 is 50% and 05 is 5%.
+func parseSimilarity(s string) (int, error) {
+	num, scale, dot := 0, 1, false
+	for i, c := range s {
+		switch {
+		case c == '.' && !dot:
+			scale, dot = 1, true
+		case c == '%' && i == len(s)-1:
+			if !dot {
+				scale = 1
+			}
+			scale *= 100
+		case c >= '0' && c <= '9':
+			if scale < 100000 {
+				scale *= 10
+				num = num*10 + int(c-'0')
+			}
+		default:
+			return 0, fmt.Errorf("error: invalid similarity: %s", s)
+		}
+	}
+	if num >= scale {
+		return 100, nil
+	}
+	return num * 100 / scale, nil
+}
+
+// useColor decides whether to colour output from the --color flag, the
+// config key and color.ui, colouring a terminal by default
+func useColor(r *g.Repository, flag string, key string) (bool, error) {
+	when := flag
+	if when == "" {
+		when, _ = r.GitConfig().Get(key)
+	}
+	if when == "" {
+		when, _ = r.GitConfig().Get("color.ui")
+	}
+	switch strings.ToLower(when) {
+	case "always", "true", "yes", "on":
+		return true, nil
+	case "never", "false", "no", "off":
+		return false, nil
+	case "", "auto":
+		info, err := os.Stdout.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, nil
+	}
+	return false, fmt.Errorf("error: invalid color value: %s", when)
+}
+
+// Diff writes the differences between the working tree and the index, or
+// between a commit, HEAD by default, and the index when opts.Staged is set,
+// or between two commits when two revisions are given. pathspecs, relative
+// to the current directory, limit the paths compared.
+func Diff(r *g.Repository, o io.Writer, opts DiffOptions, revs []string, pathspecs ...string) error {
+	var entries []*g.DiffEntry
+	var err error
+	switch {
+	case len(revs) == 2:
+		a, err := r.ResolveRevision(revs[0])
+		if err != nil {
+			return err
+		}
+		b, err := r.ResolveRevision(revs[1])
+		if err != nil {
+			return err
+		}
+		entries, err = r.DiffTrees(a, b, opts.DiffOptions)
+		if err != nil {
+			return err
+		}
+	case len(revs) > 2:
+		return errors.New("fatal: too many revisions")
+	case opts.Staged:
+		var rev string
+		if len(revs) == 1 {
+			rev = revs[0]
+		}
+		commit, err := resolveCommit(r, rev)
+		if err != nil {
+			return err
+		}
+		if entries, err = r.DiffIndex(commit, opts.DiffOptions); err != nil {
+			return err
+		}
+	case len(revs) == 1:
+		return errors.New("fatal: comparing the working tree to a commit is not supported")
+	default:
+		if entries, err = r.DiffWorktree(); err != nil {
+			return err
+		}
+	}
+	var paths []string
+	for _, v := range pathspecs {
+		p, err := r.Pathspec(v)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, p)
+	}
+	var files []*diffFile
+	for _, v := range entries {
+		if len(paths) > 0 && !g.MatchPathspec(v.OldPath, paths) && !g.MatchPathspec(v.NewPath, paths) {
+			continue
+		}
+		if v.Status == g.DiffUnmerged && !opts.NameStatus {
+			// a path in conflict has no content to compare
+			if !opts.Stat {
+				if _, err := fmt.Fprintf(o, "* Unmerged path %s\n", v.NewPath); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if opts.NameStatus {
+			var err error
+			if v.Status == g.DiffRenamed || v.Status == g.DiffCopied {
+				_, err = fmt.Fprintf(o, "%s%03d\t%s\t%s\n", v.Status, v.Similarity, v.OldPath, v.NewPath)
+			} else {
+				_, err = fmt.Fprintf(o, "%s\t%s\n", v.Status, v.NewPath)
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		f, err := newDiffFile(r, v, opts.Algorithm)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	if opts.Stat {
+		return writeDiffStat(o, files)
+	}
+	for _, v := range files {
+		if err := writeDiffPatch(o, v, opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newDiffFile(r *g.Repository, e *g.DiffEntry, algorithm diff.Algorithm) (*diffFile, error) {
+	old, new, err := r.DiffContent(e)
+	if err != nil {
+		return nil, err
+	}
+	f := &diffFile{DiffEntry: e, oldSize: len(old), newSize: len(new), oldBinary: diff.IsBinary(old), newBinary: diff.IsBinary(new)}
+	f.old, f.new = diff.SplitLines(old), diff.SplitLines(new)
+	if f.oldBinary || f.newBinary {
+		f.binary = true
+		return f, nil
+	}
+	f.edits = diff.Lines(f.old, f.new, algorithm)
+	return f, nil
+}
+
+// writeDiffPatch writes f as a git style patch. A change of file type is
+// written as the removal of the old file and the addition of the new one.
+func writeDiffPatch(o io.Writer, f *diffFile, opts DiffOptions) error {
+	if f.Status == g.DiffTypeChanged {
+		removed := *f.DiffEntry
+		removed.Status, removed.NewSha, removed.NewMode = g.DiffDeleted, g.Sha{}, 0
+		added := *f.DiffEntry
+		added.Status, added.OldSha, added.OldMode = g.DiffAdded, g.Sha{}, 0
+		for _, v := range []*diffFile{
+			{DiffEntry: &removed, old: f.old, edits: deleteAll(f.old), binary: f.oldBinary},
+			{DiffEntry: &added, new: f.new, edits: insertAll(f.new), binary: f.newBinary},
+		} {
+			if err := writeDiffPatch(o, v, opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	meta := func(format string, a ...any) error {
+		for _, line := range strings.Split(fmt.Sprintf(format, a...), "\n") {
+			if opts.Color {
+				line = colorMeta + line + colorReset
+			}
+			if _, err := fmt.Fprintln(o, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	oldName, newName := "a/"+f.OldPath, "b/"+f.NewPath
+	if err := meta("diff --git %s %s", oldName, newName); err != nil {
+		return err
+	}
+	index := fmt.Sprintf("index %s..%s", abbrev(f.OldSha), abbrev(f.NewSha))
+	var err error
+	switch f.Status {
+	case g.DiffAdded:
+		oldName = "/dev/null"
+		err = meta("new file mode %s", f.NewMode)
+	case g.DiffDeleted:
+		newName = "/dev/null"
+		err = meta("deleted file mode %s", f.OldMode)
+	default:
+		if f.OldMode != f.NewMode {
+			err = meta("old mode %s\nnew mode %s", f.OldMode, f.NewMode)
+		} else {
+			index += " " + f.NewMode.String()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if f.Status == g.DiffRenamed || f.Status == g.DiffCopied {
+		verb := "rename"
+		if f.Status == g.DiffCopied {
+			verb = "copy"
+		}
+		if err := meta("similarity index %d%%\n%s from %s\n%s to %s", f.Similarity, verb, f.OldPath, verb, f.NewPath); err != nil {
+			return err
+		}
+	}
+	if f.OldSha.Matches(f.NewSha) {
+		// only the mode changed
+		return nil
+	}
+	if err := meta("%s", index); err != nil {
+		return err
+	}
+	if f.binary {
+		_, err := fmt.Fprintf(o, "Binary files %s and %s differ\n", oldName, newName)
+		return err
+	}
+	hunks := diff.Hunks(f.old, f.new, f.edits, opts.Context)
+	if len(hunks) == 0 {
+		return nil
+	}
+	if err := meta("--- %s\n+++ %s", oldName, newName); err != nil {
+		return err
+	}
+	for _, h := range hunks {
+		header := h.Header()
+		if opts.Color {
+			header = colorFrag + header + colorReset
+		}
+		if context := h.FunctionContext(f.old); context != "" {
+			header += " " + context
+		}
+		if _, err := fmt.Fprintln(o, header); err != nil {
+			return err
+		}
+		for _, v := range h.Lines {
+			text, newline := strings.CutSuffix(v.Text, "\n")
+			line := v.Op.Prefix() + text
+			if opts.Color && v.Op != diff.Equal {
+				color := colorNew
+				if v.Op == diff.Delete {
+					color = colorOld
+				}
+				line = color + line + colorReset
+			}
+			if !newline {
+				line += "\n\\ No newline at end of file"
+			}
+			if _, err := fmt.Fprintln(o, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func deleteAll(lines []string) []diff.Edit {
+	return diff.Lines(lines, nil, diff.Myers)
+}
+
+func insertAll(lines []string) []diff.Edit {
+	return diff.Lines(nil, lines, diff.Myers)
+}
+
+// abbrev returns the abbreviated hex of sha, or zeros when it is unset
+func abbrev(sha g.Sha) string {
+	if !sha.IsSet() {
+		return "0000000"
+	}
+	return sha.AsHexString()[:7]
+}
+
+// writeDiffStat writes a line per file with the number of changed lines and
+// a graph of insertions and deletions, then a summary line
+func writeDiffStat(o io.Writer, files []*diffFile) error {
+	if len(files) == 0 {
+		return nil
+	}
+	nameWidth, numberWidth, maxChange := 0, 0, 0
+	var totalInsertions, totalDeletions int
+	for _, v := range files {
+		nameWidth = max(nameWidth, len(statName(v.DiffEntry)))
+		if v.binary {
+			numberWidth = max(numberWidth, 3)
+			continue
+		}
+		insertions, deletions := diff.Stat(v.edits)
+		totalInsertions += insertions
+		totalDeletions += deletions
+		maxChange = max(maxChange, insertions+deletions)
+		numberWidth = max(numberWidth, len(strconv.Itoa(insertions+deletions)))
+	}
+	graphWidth := diffStatWidth - nameWidth - numberWidth - 6
+	for _, v := range files {
+		if v.binary {
+			if _, err := fmt.Fprintf(o, " %-*s | Bin %d -> %d bytes\n", nameWidth, statName(v.DiffEntry), v.oldSize, v.newSize); err != nil {
+				return err
+			}
+			continue
+		}
+		insertions, deletions := diff.Stat(v.edits)
+		changed := insertions + deletions
+		if maxChange > graphWidth {
+			insertions, deletions = scaleStat(insertions, deletions, graphWidth, maxChange)
+		}
+		graph := strings.Repeat("+", insertions) + strings.Repeat("-", deletions)
+		line := fmt.Sprintf(" %-*s | %*d %s", nameWidth, statName(v.DiffEntry), numberWidth, changed, graph)
+		if _, err := fmt.Fprintln(o, strings.TrimRight(line, " ")); err != nil {
+			return err
+		}
+	}
+	summary := fmt.Sprintf(" %d %s changed", len(files), plural(len(files), "file", "files"))
+	if totalInsertions > 0 || totalDeletions == 0 {
+		summary += fmt.Sprintf(", %d %s(+)", totalInsertions, plural(totalInsertions, "insertion", "insertions"))
+	}
+	if totalDeletions > 0 || totalInsertions == 0 {
+		summary += fmt.Sprintf(", %d %s(-)", totalDeletions, plural(totalDeletions, "deletion", "deletions"))
+	}
+	_, err := fmt.Fprintln(o, summary)
+	return err
+}
+
+// statName returns the path of e shown by --stat. A renamed or copied path is
+// shown as old => new, with the directories they share outside braces as git
+// does, as in dir/{old => new}.
+func statName(e *g.DiffEntry) string {
+	if e.Status != g.DiffRenamed && e.Status != g.DiffCopied {
+		return e.NewPath
+	}
+	a, b := e.OldPath, e.NewPath
+	// at reads a path as a C string, with a terminating NUL
+	at := func(s string, i int) byte {
+		if i < len(s) {
+			return s[i]
+		}
+		return 0
+	}
+	prefix := 0
+	for i := 0; i < len(a) && i < len(b) && a[i] == b[i]; i++ {
+		if a[i] == '/' {
+			prefix = i + 1
+		}
+	}
+	// the common suffix starts at a slash, which may be the one ending the
+	// prefix
+	suffix := 0
+	adjust := 0
+	if prefix > 0 {
+		adjust = 1
+	}
+	for i, j := len(a), len(b); i >= prefix-adjust && j >= prefix-adjust && at(a, i) == at(b, j); i, j = i-1, j-1 {
+		if at(a, i) == '/' {
+			suffix = len(a) - i
+		}
+	}
+	if prefix+suffix == 0 {
+		return a + " => " + b
+	}
+	middle := func(s string) string {
+		if prefix+suffix > len(s) {
+			return ""
+		}
+		return s[prefix : len(s)-suffix]
+	}
+	return a[:prefix] + "{" + middle(a) + " => " + middle(b) + "}" + a[len(a)-suffix:]
+}
+
+// scaleStat scales the insertions and deletions of a file to fit width,
+// where maxChange is the most lines changed in any file, as git does
+func scaleStat(insertions int, deletions int, width int, maxChange int) (int, int) {
+	scale := func(n int) int {
+		if n == 0 {
+			return 0
+		}
+		return 1 + n*(width-1)/maxChange
+	}
+	total := scale(insertions + deletions)
+	if total < 2 && insertions > 0 && deletions > 0 {
+		total = 2
+	}
+	if insertions < deletions {
+		insertions = scale(insertions)
+		return insertions, total - insertions
+	}
+	deletions = scale(deletions)
+	return total - deletions, deletions
+}
+
+func plural(n int, one string, many string) string {
+	if n == 1 {
+		return one
+	}
+	return many
+}
+
+func init() {
+	diffCmd.Flags().BoolVar(&diffStaged, "staged", false, "--staged")
+	diffCmd.Flags().BoolVar(&diffStaged, "cached", false, "--cached")
+	diffCmd.Flags().BoolVar(&diffStat, "stat", false, "--stat")
+	diffCmd.Flags().BoolVar(&diffNameStatus, "name-status", false, "--name-status")
+	diffCmd.Flags().IntVarP(&diffContext, "unified", "U", 3, "-U<n>")
+	diffCmd.Flags().StringVar(&diffAlgorithm, "diff-algorithm", "", "--diff-algorithm")
+	diffCmd.Flags().BoolVar(&diffPatience, "patience", false, "--patience")
+	diffCmd.Flags().BoolVar(&diffHistogram, "histogram", false, "--histogram")
+	diffCmd.Flags().StringVarP(&diffFindRenames, "find-renames", "M", "", "-M[=<n>]")
+	diffCmd.Flags().Lookup("find-renames").NoOptDefVal = "50%"
+	diffCmd.Flags().StringVarP(&diffFindCopies, "find-copies", "C", "", "-C[=<n>]")
+	diffCmd.Flags().Lookup("find-copies").NoOptDefVal = "50%"
+	diffCmd.Flags().BoolVar(&diffFindCopiesHarder, "find-copies-harder", false, "--find-copies-harder")
+	diffCmd.Flags().BoolVar(&diffNoRenames, "no-renames", false, "--no-renames")
+	diffCmd.Flags().StringVar(&diffColor, "color", "", "--color[=<when>]")
+	diffCmd.Flags().Lookup("color").NoOptDefVal = "always"
+	rootCmd.AddCommand(diffCmd)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var gcCmd = &cobra.Command{
+	Use:  "gc",
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		return r.GC()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+}
@@ -8,15 +8,13 @@ import (
 var initCmd = &cobra.Command{
 	Use: "init",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := configure(); err != nil {
-			return err
-		}
-		return Init()
+		_, err := Init(pathFlag)
+		return err
 	},
 }
 
-func Init() error {
-	return g.Init()
+func Init(path string) (*g.Repository, error) {
+	return g.Init(path, options()...)
 }
 
 func init() {
@@ -16,12 +16,9 @@ import (
 func Test_DefaultBranch(t *testing.T) {
 	dir := testDir(t)
 	defer func() { _ = os.RemoveAll(dir) }()
-	testConfigure(t, dir)
-	if err := Init(); err != nil {
-		t.Fatal(err)
-	}
+	r := testInit(t, dir)
 
-	actual, err := g.CurrentBranch()
+	actual, err := r.CurrentBranch()
 	assert.NoError(t, err)
 	expected := "main"
 	assert.Equal(t, expected, actual)
@@ -30,16 +27,13 @@ func Test_DefaultBranch(t *testing.T) {
 func Test_End_To_End(t *testing.T) {
 	dir := testDir(t)
 	defer func() { _ = os.RemoveAll(dir) }()
-	testConfigure(t, dir)
 
 	// git init
-	if err := Init(); err != nil {
-		t.Fatal(err)
-	}
+	r := testInit(t, dir)
 
 	// list branches - after init there are none
 	// git branch
-	testBranchLs(t, "")
+	testBranchLs(t, r, "")
 
 	// write a file
 	// echo "hello" > hello
@@ -47,27 +41,27 @@ func Test_End_To_End(t *testing.T) {
 
 	// status should have an object
 	// git status --porcelain
-	testStatus(t, "?? hello\n")
+	testStatus(t, r, "?? hello\n")
 
 	// add the file to the index
 	// git add .
-	testAdd(t, ".", 1)
-	files := testListFiles(t, g.ObjectPath(), false)
+	testAdd(t, r, ".", 1)
+	files := testListFiles(t, r.ObjectPath(), false)
 	assert.Equal(t, 1, len(files))
 
 	// status should be added
 	// git status --porcelain
-	testStatus(t, "A  hello\n")
+	testStatus(t, r, "A  hello\n")
 
 	// create commit
 	// git commit -m "test"
-	testCommit(t, []byte("78"))
+	testCommit(t, r, []byte("78"))
 
 	// list branches - main should now show up as it has a commit
 	// git branch
-	testBranchLs(t, "* main\n")
+	testBranchLs(t, r, "* main\n")
 
-	files = testListFiles(t, g.ObjectPath(), false)
+	files = testListFiles(t, r.ObjectPath(), false)
 	// blob, tree object, commit object
 	assert.Equal(t, 3, len(files))
 
@@ -78,85 +72,465 @@ func Test_End_To_End(t *testing.T) {
 
 	// status should be modified
 	// git status porcelain
-	testStatus(t, " M hello\n")
+	testStatus(t, r, " M hello\n")
 
 	// add the file to the index
 	// git add hello
-	testAdd(t, "hello", 1)
+	testAdd(t, r, "hello", 1)
 
-	testStatus(t, "M  hello\n")
+	testStatus(t, r, "M  hello\n")
 
 	// git commit
-	testCommit(t, []byte("104"))
+	testCommit(t, r, []byte("104"))
 
 	// status should be empty
 	// git status --porcelain
-	testStatus(t, "")
+	testStatus(t, r, "")
 
 	// create a branch called test
 	// git branch test
-	assert.Nil(t, CreateBranch("test"))
+	assert.Nil(t, CreateBranch(r, "test"))
 
 	// check it is now listed
 	// git branch
-	testBranchLs(t, "* main\n  test\n")
+	testBranchLs(t, r, "* main\n  test\n")
 
 	// trying to delete current checkout branch gives error
 	// git branch -d main
-	err := DeleteBranch("main")
+	err := DeleteBranch(r, "main")
 	assert.Equal(t, fmt.Sprintf(DeleteBranchCheckedOutErrFmt, "main", dir), err.Error())
 
 	// delete test branch
 	// git branch -d test
-	assert.Nil(t, DeleteBranch("test"))
+	assert.Nil(t, DeleteBranch(r, "test"))
 
 	// should be just main left
 	// git branch
-	testBranchLs(t, "* main\n")
-	testLog(t)
+	testBranchLs(t, r, "* main\n")
+	testLog(t, r)
+
+	// hierarchical branch names
+	// git branch feature/login
+	assert.Nil(t, CreateBranch(r, "feature/login"))
+	testBranchLs(t, r, "  feature/login\n* main\n")
+	assert.NotNil(t, CreateBranch(r, "feature"))
+	assert.Nil(t, DeleteBranch(r, "feature/login"))
+	testBranchLs(t, r, "* main\n")
 
 	// create a branch called test2
 	// git branch test2
-	assert.Nil(t, CreateBranch("test2"))
+	assert.Nil(t, CreateBranch(r, "test2"))
 
 	// add a file to main and commit
 	// echo "world" > world
 	writeFile(t, dir, "world", []byte("world"))
 
 	// git add world
-	testAdd(t, "world", 2)
+	testAdd(t, r, "world", 2)
 	// git commit
-	testCommit(t, []byte("143"))
+	testCommit(t, r, []byte("143"))
 	// git status --porcelain
-	testStatus(t, "")
+	testStatus(t, r, "")
 
 	// test2 branch does not include world, switch to it and check status
 	// git switch test2
-	testSwitchBranch(t, "test2")
+	testSwitchBranch(t, r, "test2")
 
 	// git status --porcelain
-	testStatus(t, "")
+	testStatus(t, r, "")
 
 	// switch back to main, should get file back
-	testSwitchBranch(t, "main")
-	testStatus(t, "")
+	testSwitchBranch(t, r, "main")
+	testStatus(t, r, "")
 
 	// test restore staged
 	writeFile(t, dir, "o", []byte("o"))
-	testAdd(t, "o", 3)
-	testStatus(t, "A  o\n")
-	testRestore(t, "o", true)
-	testStatus(t, "?? o\n")
+	testAdd(t, r, "o", 3)
+	testStatus(t, r, "A  o\n")
+	testRestore(t, r, "o", true)
+	testStatus(t, r, "?? o\n")
 
 	// test restore
-	testAdd(t, "o", 3)
-	testCommit(t, []byte("oo"))
-	testStatus(t, "")
+	testAdd(t, r, "o", 3)
+	testCommit(t, r, []byte("oo"))
+	testStatus(t, r, "")
 	writeFile(t, dir, "o", []byte("ok"))
-	testStatus(t, " M o\n")
-	testRestore(t, "o", false)
-	testStatus(t, "")
+	testStatus(t, r, " M o\n")
+	testRestore(t, r, "o", false)
+	testStatus(t, r, "")
+
+	// test detached HEAD
+	// git switch --detach <sha>
+	mainSha, err := r.CurrentCommit()
+	assert.Nil(t, err)
+	assert.Nil(t, SwitchDetached(r, mainSha.AsHexString()))
+	testBranchLs(t, r, fmt.Sprintf("* (HEAD detached at %s)\n  main\n  test2\n", mainSha.AsHexString()[:7]))
+	testStatus(t, r, "")
+	writeFile(t, dir, "detached", []byte("detached"))
+	testAdd(t, r, "detached", 4)
+	testStatus(t, r, "A  detached\n")
+	detachedSha := testCommit(t, r, []byte("detached"))
+	testStatus(t, r, "")
+	head, err := r.CurrentCommit()
+	assert.Nil(t, err)
+	assert.Equal(t, detachedSha, head)
+	assert.Contains(t, string(testLog(t, r)), detachedSha.AsHexString())
+	assert.Contains(t, string(testLog(t, r)), mainSha.AsHexString())
+	// main is not moved by a commit on a detached HEAD
+	mainHead, err := r.HeadSHA("main")
+	assert.Nil(t, err)
+	assert.Equal(t, mainSha, mainHead)
+	// switching back to main removes the file committed whilst detached
+	testSwitchBranch(t, r, "main")
+	testStatus(t, r, "")
+	testBranchLs(t, r, "* main\n  test2\n")
+
+	// git rev-parse
+	testRevParse(t, r, []string{"HEAD"}, mainSha.AsHexString()+"\n")
+	testRevParse(t, r, []string{detachedSha.AsHexString()[:7] + "^"}, mainSha.AsHexString()+"\n")
+	testRevParse(t, r, []string{"main.." + detachedSha.AsHexString()}, detachedSha.AsHexString()+"\n^"+mainSha.AsHexString()+"\n")
+
+	// git reflog
+	testRevParse(t, r, []string{"HEAD@{1}"}, detachedSha.AsHexString()+"\n")
+	testRevParse(t, r, []string{"@{-1}"}, detachedSha.AsHexString()+"\n")
+	buf := bytes.NewBuffer(nil)
+	assert.Nil(t, Reflog(r, buf, "HEAD"))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, fmt.Sprintf("%s HEAD@{0}: checkout: moving from %s to main", mainSha.AsHexString()[:7], detachedSha.AsHexString()), lines[0])
+	assert.Equal(t, fmt.Sprintf("%s HEAD@{1}: commit: detached", detachedSha.AsHexString()[:7]), lines[1])
+	assert.Equal(t, fmt.Sprintf("%s HEAD@{2}: checkout: moving from main to %s", mainSha.AsHexString()[:7], mainSha.AsHexString()), lines[2])
+
+	// git config
+	assert.Nil(t, r.SetConfig("test.name", "value"))
+	assert.Nil(t, r.AddConfig("test.name", "other"))
+	testConfigGet(t, r, "test.name", false, "other\n")
+	testConfigGet(t, r, "test.name", true, "value\nother\n")
+	assert.Error(t, r.UnsetConfig("test.name"))
+	assert.ErrorIs(t, ConfigGet(r, bytes.NewBuffer(nil), "test.missing", false), g.ErrConfigKeyNotFound)
+
+	// pathspecs are relative to the directory the repository is opened from
+	// cd sub && git add c && git status .
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	writeFile(t, dir, "sub/c", []byte("c"))
+	writeFile(t, dir, "d", []byte("d"))
+	sr, err := g.Open(filepath.Join(dir, "sub"))
+	assert.Nil(t, err)
+	assert.Nil(t, Add(sr, "c"))
+	buf = bytes.NewBuffer(nil)
+	assert.Nil(t, Status(sr, buf, g.DiffOptions{Renames: true}, "."))
+	assert.Equal(t, "A  sub/c\n", buf.String())
+	testStatus(t, r, "A  sub/c\n?? d\n")
+	assert.Error(t, Add(sr, "../../outside"))
+
+	// git check-ignore -v
+	writeFile(t, dir, ".gitignore", []byte("*.log\nd\n"))
+	writeFile(t, dir, "sub/.gitignore", []byte("!keep.log\n"))
+	buf = bytes.NewBuffer(nil)
+	assert.Nil(t, CheckIgnore(sr, buf, true, false, "x.log", "keep.log", "c", "e"))
+	assert.Equal(t, ".gitignore:1:*.log\tx.log\nsub/.gitignore:1:!keep.log\tkeep.log\n", buf.String())
+	buf = bytes.NewBuffer(nil)
+	assert.Nil(t, CheckIgnore(r, buf, false, false, "d", "sub/x.log", "sub/keep.log"))
+	assert.Equal(t, "d\nsub/x.log\n", buf.String())
+	// files in the index are only matched with --no-index
+	assert.ErrorIs(t, CheckIgnore(sr, bytes.NewBuffer(nil), false, false, "c", "e"), errNothingIgnored)
+	writeFile(t, dir, ".gitignore", []byte("c\n"))
+	buf = bytes.NewBuffer(nil)
+	assert.Nil(t, CheckIgnore(sr, buf, false, true, "c"))
+	assert.Equal(t, "c\n", buf.String())
+}
+
+func Test_Diff(t *testing.T) {
+	dir := testDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	r := testInit(t, dir)
+
+	writeFile(t, dir, "a", []byte("1\n2\n3\n"))
+	testAdd(t, r, ".", 1)
+	first := testCommit(t, r, []byte("first"))
+
+	// git diff
+	writeFile(t, dir, "a", []byte("1\ntwo\n3\n"))
+	buf := bytes.NewBuffer(nil)
+	assert.Nil(t, Diff(r, buf, DiffOptions{Context: 3}, nil))
+	expected := "diff --git a/a b/a\n" +
+		"index 01e79c3..d8eb098 100644\n" +
+		"--- a/a\n" +
+		"+++ b/a\n" +
+		"@@ -1,3 +1,3 @@\n" +
+		" 1\n" +
+		"-2\n" +
+		"+two\n" +
+		" 3\n"
+	assert.Equal(t, expected, buf.String())
+
+	// nothing is staged yet
+	buf = bytes.NewBuffer(nil)
+	assert.Nil(t, Diff(r, buf, DiffOptions{Context: 3, Staged: true}, nil))
+	assert.Equal(t, "", buf.String())
+
+	// git diff --staged --name-status
+	writeFile(t, dir, "b", []byte("b"))
+	testAdd(t, r, ".", 2)
+	buf = bytes.NewBuffer(nil)
+	assert.Nil(t, Diff(r, buf, DiffOptions{Staged: true, NameStatus: true}, nil))
+	assert.Equal(t, "M\ta\nA\tb\n", buf.String())
+
+	// git diff --stat first HEAD
+	second := testCommit(t, r, []byte("second"))
+	buf = bytes.NewBuffer(nil)
+	assert.Nil(t, Diff(r, buf, DiffOptions{Stat: true}, []string{first.String(), second.String()}))
+	expected = " a | 2 +-\n" +
+		" b | 1 +\n" +
+		" 2 files changed, 2 insertions(+), 1 deletion(-)\n"
+	assert.Equal(t, expected, buf.String())
+
+	// git mv b d/b
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "d"), 0755))
+	assert.Nil(t, os.Rename(filepath.Join(dir, "b"), filepath.Join(dir, "d", "b")))
+	idx, err := r.ReadIndex()
+	assert.Nil(t, err)
+	assert.Nil(t, idx.Rm("b"))
+	assert.Nil(t, idx.Write())
+	testAdd(t, r, "d/b", 2)
+	testStatus(t, r, "R  b -> d/b\n")
+	buf = bytes.NewBuffer(nil)
+	assert.Nil(t, Diff(r, buf, DiffOptions{Staged: true, NameStatus: true, DiffOptions: g.DiffOptions{Renames: true}}, nil))
+	assert.Equal(t, "R100\tb\td/b\n", buf.String())
+	buf = bytes.NewBuffer(nil)
+	assert.Nil(t, Diff(r, buf, DiffOptions{Staged: true, Stat: true, DiffOptions: g.DiffOptions{Renames: true}}, nil))
+	assert.Equal(t, " b => d/b | 0\n 1 file changed, 0 insertions(+), 0 deletions(-)\n", buf.String())
+}
+
+func Test_Merge(t *testing.T) {
+	dir := testDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	r := testInit(t, dir)
+
+	writeFile(t, dir, "a", []byte("1\n2\n3\n"))
+	testAdd(t, r, ".", 1)
+	first := testCommit(t, r, []byte("first"))
+	assert.Nil(t, r.CreateBranch("topic"))
+	testSwitchBranch(t, r, "topic")
+	writeFile(t, dir, "b", []byte("b\n"))
+	testAdd(t, r, ".", 2)
+	topic := testCommit(t, r, []byte("topic"))
+
+	// git merge topic
+	testSwitchBranch(t, r, "main")
+	buf := bytes.NewBuffer(nil)
+	assert.Nil(t, Merge(r, buf, "topic", nil, g.MergeOptions{Name: "topic"}))
+	expected := "Updating " + first.String()[:7] + ".." + topic.String()[:7] + "\n" +
+		"Fast-forward\n" +
+		" b | 1 +\n" +
+		" 1 file changed, 1 insertion(+)\n" +
+		" create mode 100644 b\n"
+	assert.Equal(t, expected, buf.String())
+	buf = bytes.NewBuffer(nil)
+	assert.Nil(t, Merge(r, buf, "topic", nil, g.MergeOptions{Name: "topic"}))
+	assert.Equal(t, "Already up to date.\n", buf.String())
+
+	// diverged branches are merged by a merge commit
+	writeFile(t, dir, "a", []byte("one\n2\n3\n"))
+	testAdd(t, r, ".", 2)
+	testCommit(t, r, []byte("main"))
+	testSwitchBranch(t, r, "topic")
+	writeFile(t, dir, "a", []byte("1\n2\nthree\n"))
+	testAdd(t, r, ".", 2)
+	testCommit(t, r, []byte("three"))
+	testSwitchBranch(t, r, "main")
+	buf = bytes.NewBuffer(nil)
+	assert.Nil(t, Merge(r, buf, "topic", nil, g.MergeOptions{Name: "topic"}))
+	expected = "Auto-merging a\n" +
+		"Merge made by the 'ort' strategy.\n" +
+		" a | 2 +-\n" +
+		" 1 file changed, 1 insertion(+), 1 deletion(-)\n"
+	assert.Equal(t, expected, buf.String())
+	sha, err := r.CurrentCommit()
+	assert.Nil(t, err)
+	c, err := r.ReadCommit(sha)
+	assert.Nil(t, err)
+	assert.Equal(t, "Merge branch 'topic'\n", string(c.Message))
+	assert.Len(t, c.Parents, 2)
+	b, err := os.ReadFile(filepath.Join(dir, "a"))
+	assert.Nil(t, err)
+	assert.Equal(t, "one\n2\nthree\n", string(b))
+
+	// conflicting changes are left for the user to resolve
+	writeFile(t, dir, "a", []byte("ours\n2\nthree\n"))
+	testAdd(t, r, ".", 2)
+	testCommit(t, r, []byte("ours"))
+	testSwitchBranch(t, r, "topic")
+	writeFile(t, dir, "a", []byte("theirs\n2\nthree\n"))
+	testAdd(t, r, ".", 2)
+	testCommit(t, r, []byte("theirs"))
+	testSwitchBranch(t, r, "main")
+	buf = bytes.NewBuffer(nil)
+	err = Merge(r, buf, "topic", nil, g.MergeOptions{Name: "topic"})
+	assert.EqualError(t, err, "Automatic merge failed; fix conflicts and then commit the result.")
+	assert.Equal(t, "Auto-merging a\nCONFLICT (content): Merge conflict in a\n", buf.String())
+	b, err = os.ReadFile(filepath.Join(dir, "a"))
+	assert.Nil(t, err)
+	assert.Equal(t, "<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> topic\n2\nthree\n", string(b))
+	testStatus(t, r, "UU a\n")
+	buf = bytes.NewBuffer(nil)
+	assert.Nil(t, Diff(r, buf, DiffOptions{Staged: true}, nil))
+	assert.Equal(t, "* Unmerged path a\n", buf.String())
+
+	// adding the resolved file concludes the merge
+	writeFile(t, dir, "a", []byte("both\n2\nthree\n"))
+	testAdd(t, r, "a", 2)
+	testStatus(t, r, "M  a\n")
+	sha = testCommit(t, r, []byte("resolved"))
+	c, err = r.ReadCommit(sha)
+	assert.Nil(t, err)
+	assert.Len(t, c.Parents, 2)
+}
+
+func Test_Reset(t *testing.T) {
+	dir := testDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	r := testInit(t, dir)
+
+	writeFile(t, dir, "a", []byte("a\n"))
+	testAdd(t, r, ".", 1)
+	first := testCommit(t, r, []byte("first"))
+	writeFile(t, dir, "a", []byte("a2\n"))
+	writeFile(t, dir, "b", []byte("b\n"))
+	testAdd(t, r, ".", 2)
+	testCommit(t, r, []byte("second"))
+
+	// git reset HEAD~1
+	buf := bytes.NewBuffer(nil)
+	assert.Nil(t, Reset(r, buf, "HEAD~1", g.ResetMixed))
+	assert.Equal(t, "Unstaged changes after reset:\nM\ta\n", buf.String())
+	testStatus(t, r, " M a\n?? b\n")
+	sha, err := r.CurrentCommit()
+	assert.Nil(t, err)
+	assert.Equal(t, first, sha)
+
+	// git reset ORIG_HEAD -- b
+	assert.Nil(t, Reset(r, bytes.NewBuffer(nil), "ORIG_HEAD", g.ResetMixed, "b"))
+	testStatus(t, r, " M a\nA  b\n")
+	assert.EqualError(t, Reset(r, bytes.NewBuffer(nil), "", g.ResetHard, "b"), "fatal: Cannot do hard reset with paths.")
+
+	// git reset --hard
+	buf = bytes.NewBuffer(nil)
+	assert.Nil(t, Reset(r, buf, "", g.ResetHard))
+	assert.Equal(t, "HEAD is now at "+first.String()[:7]+" first\n", buf.String())
+	testStatus(t, r, "")
+}
+
+func Test_Rm(t *testing.T) {
+	dir := testDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	r := testInit(t, dir)
+
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "d"), 0755))
+	writeFile(t, dir, "a", []byte("a\n"))
+	writeFile(t, dir, "b", []byte("b\n"))
+	writeFile(t, dir, "d/c", []byte("c\n"))
+	testAdd(t, r, ".", 3)
+	testCommit(t, r, []byte("first"))
+
+	// git rm b a
+	buf := bytes.NewBuffer(nil)
+	assert.Nil(t, Rm(r, buf, g.RmOptions{}, "b", "a"))
+	assert.Equal(t, "rm 'a'\nrm 'b'\n", buf.String())
+	testStatus(t, r, "D  a\nD  b\n")
+
+	// git rm d
+	assert.EqualError(t, Rm(r, bytes.NewBuffer(nil), g.RmOptions{}, "d"), "fatal: not removing 'd' recursively without -r")
+
+	// git rm -r --cached d
+	writeFile(t, dir, "d/c", []byte("changed\n"))
+	assert.EqualError(t, Rm(r, bytes.NewBuffer(nil), g.RmOptions{Recursive: true}, "d"), "error: the following file has local modifications:\n    d/c\n(use --cached to keep the file, or -f to force removal)")
+	buf = bytes.NewBuffer(nil)
+	assert.Nil(t, Rm(r, buf, g.RmOptions{Recursive: true, Cached: true}, "d"))
+	assert.Equal(t, "rm 'd/c'\n", buf.String())
+	testStatus(t, r, "D  a\nD  b\nD  d/c\n?? d/c\n")
+}
+
+func Test_Mv(t *testing.T) {
+	dir := testDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	r := testInit(t, dir)
+
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "d"), 0755))
+	writeFile(t, dir, "a", []byte("a\n"))
+	writeFile(t, dir, "b", []byte("b\n"))
+	writeFile(t, dir, "d/c", []byte("c\n"))
+	testAdd(t, r, ".", 3)
+	testCommit(t, r, []byte("first"))
+
+	// git mv a b
+	assert.EqualError(t, Mv(r, false, "b", "a"), "fatal: destination exists, source=a, destination=b")
+
+	// git mv a b d
+	assert.Nil(t, Mv(r, false, "d", "a", "b"))
+	testStatus(t, r, "R  a -> d/a\nR  b -> d/b\n")
+	for _, v := range []string{"d/a", "d/b"} {
+		_, err := os.Stat(filepath.Join(dir, v))
+		assert.Nil(t, err)
+	}
+
+	// git mv d e
+	assert.Nil(t, Mv(r, false, "e", "d"))
+	testStatus(t, r, "R  a -> e/a\nR  b -> e/b\nR  d/c -> e/c\n")
+}
 
+func Test_Stash(t *testing.T) {
+	dir := testDir(t)
+	defer func() { _ = os.RemoveAll(dir) }()
+	r := testInit(t, dir)
+
+	writeFile(t, dir, "a", []byte("a\n"))
+	testAdd(t, r, ".", 1)
+	first := testCommit(t, r, []byte("first"))
+	assert.Nil(t, CreateBranch(r, "other"))
+	writeFile(t, dir, "a", []byte("a2\n"))
+	testAdd(t, r, ".", 1)
+	testCommit(t, r, []byte("second"))
+
+	// local changes prevent a switch until they are stashed
+	writeFile(t, dir, "a", []byte("a3\n"))
+	assert.EqualError(t, SwitchBranch(r, "other"), "error: Your local changes to the following files would be overwritten by checkout:\n\ta\nPlease commit your changes or stash them before you switch branches.\nAborting")
+	buf := bytes.NewBuffer(nil)
+	assert.Nil(t, StashPush(r, buf, []byte("work")))
+	assert.Equal(t, "Saved working directory and index state On main: work\n", buf.String())
+	testStatus(t, r, "")
+	testSwitchBranch(t, r, "other")
+	testSwitchBranch(t, r, "main")
+
+	// git stash list
+	buf = bytes.NewBuffer(nil)
+	assert.Nil(t, StashList(r, buf))
+	assert.Equal(t, "stash@{0}: On main: work\n", buf.String())
+
+	// git stash show
+	buf = bytes.NewBuffer(nil)
+	assert.Nil(t, StashShow(r, buf, "", false))
+	assert.Equal(t, " a | 2 +-\n 1 file changed, 1 insertion(+), 1 deletion(-)\n", buf.String())
+
+	// git stash pop stash@{0}
+	buf = bytes.NewBuffer(nil)
+	sha, err := r.StashCommit(0)
+	assert.Nil(t, err)
+	assert.Nil(t, StashPop(r, buf, "stash@{0}", false))
+	assert.Equal(t, " M a\nDropped stash@{0} ("+sha.AsHexString()+")\n", buf.String())
+	assert.EqualError(t, StashDrop(r, bytes.NewBuffer(nil), ""), "No stash entries found.")
+
+	// a conflicting entry is kept
+	assert.Nil(t, StashPush(r, bytes.NewBuffer(nil), nil))
+	assert.Nil(t, SwitchDetached(r, first.AsHexString()))
+	writeFile(t, dir, "a", []byte("a4\n"))
+	testAdd(t, r, ".", 1)
+	testCommit(t, r, []byte("third"))
+	buf = bytes.NewBuffer(nil)
+	assert.EqualError(t, StashPop(r, buf, "", false), "The stash entry is kept in case you need it again.")
+	assert.Equal(t, "Auto-merging a\nCONFLICT (content): Merge conflict in a\nUU a\n", buf.String())
+	buf = bytes.NewBuffer(nil)
+	assert.Nil(t, StashList(r, buf))
+	assert.Contains(t, buf.String(), "stash@{0}: WIP on main: ")
 }
 
 func testDir(t *testing.T) string {
@@ -167,14 +541,12 @@ func testDir(t *testing.T) string {
 	return dir
 }
 
-func testConfigure(t *testing.T, path string) {
-	opts := []g.Opt{
-		g.WithGitDirectory(g.DefaultGitDirectory),
-		g.WithPath(path),
-	}
-	if err := g.Configure(opts...); err != nil {
+func testInit(t *testing.T, path string) *g.Repository {
+	r, err := g.Init(path, g.WithGitDirectory(g.DefaultGitDirectory))
+	if err != nil {
 		t.Fatal(err)
 	}
+	return r
 }
 
 func testListFiles(t *testing.T, path string, dirs bool) []string {
@@ -194,39 +566,39 @@ func testListFiles(t *testing.T, path string, dirs bool) []string {
 	return files
 }
 
-func testAdd(t *testing.T, path string, numIdxFiles int) {
-	if err := Add(path); err != nil {
+func testAdd(t *testing.T, r *g.Repository, path string, numIdxFiles int) {
+	if err := Add(r, path); err != nil {
 		t.Fatal(err)
 	}
-	files, err := LsFiles()
+	files, err := LsFiles(r)
 	if err != nil {
 		t.Fatal(err)
 	}
 	assert.Len(t, files, numIdxFiles)
 }
 
-func testStatus(t *testing.T, expected string) {
+func testStatus(t *testing.T, r *g.Repository, expected string) {
 	buf := bytes.NewBuffer(nil)
-	if err := Status(buf); err != nil {
+	if err := Status(r, buf, g.DiffOptions{Renames: true}); err != nil {
 		t.Fatal(err)
 	}
 	assert.Equal(t, expected, buf.String())
 }
 
-func testRestore(t *testing.T, path string, staged bool) {
-	if err := g.Restore(path, staged); err != nil {
+func testRestore(t *testing.T, r *g.Repository, path string, staged bool) {
+	if err := r.Restore(path, staged); err != nil {
 		t.Fatal(err)
 	}
 }
 
-func testCommit(t *testing.T, message []byte) g.Sha {
-	sha, err := Commit(message)
+func testCommit(t *testing.T, r *g.Repository, message []byte) g.Sha {
+	sha, err := Commit(r, message)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	// read object
-	c, err := g.ReadCommit(sha)
+	c, err := r.ReadCommit(sha)
 	if err != nil {
 		t.Error(err)
 		return sha
@@ -242,26 +614,40 @@ func testCommit(t *testing.T, message []byte) g.Sha {
 	return sha
 }
 
-func testLog(t *testing.T) []byte {
+func testConfigGet(t *testing.T, r *g.Repository, key string, all bool, expected string) {
 	buf := bytes.NewBuffer(nil)
-	err := Log(buf)
+	if err := ConfigGet(r, buf, key, all); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, expected, buf.String())
+}
+
+func testLog(t *testing.T, r *g.Repository) []byte {
+	buf := bytes.NewBuffer(nil)
+	err := Log(r, buf)
 	if err != nil {
 		t.Fatal(err)
 	}
 	return buf.Bytes()
 }
 
-func testBranchLs(t *testing.T, expected string) {
+func testBranchLs(t *testing.T, r *g.Repository, expected string) {
 	buf := bytes.NewBuffer(nil)
-	err := ListBranches(buf)
+	err := ListBranches(r, buf)
 	if err != nil {
 		t.Fatal(err)
 	}
 	assert.Equal(t, expected, buf.String())
 }
 
-func testSwitchBranch(t *testing.T, branch string) {
-	if err := SwitchBranch(branch); err != nil {
+func testRevParse(t *testing.T, r *g.Repository, revs []string, expected string) {
+	buf := bytes.NewBuffer(nil)
+	assert.Nil(t, RevParse(r, buf, revs...))
+	assert.Equal(t, expected, buf.String())
+}
+
+func testSwitchBranch(t *testing.T, r *g.Repository, branch string) {
+	if err := SwitchBranch(r, branch); err != nil {
 		t.Fatal(err)
 	}
 }
@@ -13,17 +13,18 @@ var logCmd = &cobra.Command{
 	Use:  "log",
 	Args: cobra.ExactArgs(0),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := configure(); err != nil {
+		r, err := openRepository()
+		if err != nil {
 			return err
 		}
-		cmdPath, cmdArgs := g.Pager()
+		cmdPath, cmdArgs := r.Pager()
 		c := exec.Command(cmdPath, cmdArgs...)
 		w, err := c.StdinPipe()
 		if err != nil {
 			return err
 		}
 		c.Stdout = os.Stdout
-		err = Log(w)
+		err = Log(r, w)
 		if err != nil {
 			return err
 		}
@@ -33,16 +34,15 @@ var logCmd = &cobra.Command{
 }
 
 // Log prints out the commit log for the current branch
-func Log(o io.Writer) error {
-	branch, err := g.CurrentBranch()
+func Log(r *g.Repository, o io.Writer) error {
+	commitSha, err := r.CurrentCommit()
 	if err != nil {
 		return err
 	}
-	commitSha, err := g.HeadSHA(branch)
-	if err != nil {
-		return err
+	if !commitSha.IsSet() {
+		return nil
 	}
-	for c, err := g.ReadCommit(commitSha); c != nil && err == nil; c, err = g.ReadCommit(c.Parents[0]) {
+	for c, err := r.ReadCommit(commitSha); c != nil && err == nil; c, err = r.ReadCommit(c.Parents[0]) {
 		_, _ = fmt.Fprintf(o, "commit %s\nAuthor: %s <%s>\nDate:   %s\n\n%8s\n", c.Sha, c.Author, c.AuthorEmail, c.AuthoredTime.String(), c.Message)
 		if len(c.Parents) == 0 {
 			break
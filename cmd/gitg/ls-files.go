@@ -9,10 +9,11 @@ import (
 var lsFilesCmd = &cobra.Command{
 	Use: "ls-files",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := configure(); err != nil {
+		r, err := openRepository()
+		if err != nil {
 			return err
 		}
-		files, err := LsFiles()
+		files, err := LsFiles(r)
 		if err != nil {
 			return err
 		}
@@ -24,8 +25,8 @@ var lsFilesCmd = &cobra.Command{
 }
 
 // LsFiles returns a list of files in the index
-func LsFiles() ([]string, error) {
-	idx, err := g.ReadIndex()
+func LsFiles(r *g.Repository) ([]string, error) {
+	idx, err := r.ReadIndex()
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/richardjennings/g"
+	"github.com/richardjennings/g/diff"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"slices"
+	"time"
+)
+
+var (
+	mergeNoFastForward   bool
+	mergeFastForwardOnly bool
+	mergeMessage         string
+	mergeConflictStyle   string
+)
+
+var mergeCmd = &cobra.Command{
+	Use:  "merge <commit>",
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		opts, err := contentMergeOptions(r, mergeConflictStyle)
+		if err != nil {
+			return err
+		}
+		opts.Name, opts.NoFastForward, opts.FastForwardOnly = args[0], mergeNoFastForward, mergeFastForwardOnly
+		var msg []byte
+		if cmd.Flags().Changed("message") {
+			msg = []byte(mergeMessage)
+		}
+		return Merge(r, os.Stdout, args[0], msg, opts)
+	},
+}
+
+// contentMergeOptions returns the options merging the content of files: the
+// conflict style given by style, or merge.conflictStyle, and diff.algorithm
+func contentMergeOptions(r *g.Repository, style string) (g.MergeOptions, error) {
+	var opts g.MergeOptions
+	var err error
+	if style == "" {
+		style, _ = r.GitConfig().Get("merge.conflictStyle")
+	}
+	if style != "" {
+		if opts.Style, err = diff.ParseConflictStyle(style); err != nil {
+			return opts, err
+		}
+	}
+	if algorithm, ok := r.GitConfig().Get("diff.algorithm"); ok {
+		if opts.Algorithm, err = diff.ParseAlgorithm(algorithm); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// Merge merges the commit rev into HEAD, writing what was done to o as git
+// merge does. Without a message the merge commit is described by the branch or
+// commit merged.
+func Merge(r *g.Repository, o io.Writer, rev string, message []byte, opts g.MergeOptions) error {
+	sha, err := r.ResolveRevision(rev)
+	if err != nil {
+		return fmt.Errorf("merge: %s - not something we can merge", rev)
+	}
+	head, err := r.CurrentCommit()
+	if err != nil {
+		return err
+	}
+	if message == nil {
+		if message, err = defaultMergeMessage(r, rev); err != nil {
+			return err
+		}
+	}
+	commit := &g.Commit{
+		Author:        fmt.Sprintf("%s <%s>", r.AuthorName(), r.AuthorEmail()),
+		AuthoredTime:  time.Now(),
+		Committer:     fmt.Sprintf("%s <%s>", r.CommitterName(), r.CommitterEmail()),
+		CommittedTime: time.Now(),
+		Message:       message,
+	}
+	result, err := r.Merge(sha, commit, opts)
+	if err != nil {
+		return err
+	}
+	switch {
+	case result.UpToDate:
+		_, err := fmt.Fprintln(o, "Already up to date.")
+		return err
+	case result.FastForward:
+		if !head.IsSet() {
+			return nil
+		}
+		if _, err := fmt.Fprintf(o, "Updating %s..%s\nFast-forward\n", abbrev(head), abbrev(sha)); err != nil {
+			return err
+		}
+		return writeMergeStat(r, o, head, sha, opts.Algorithm)
+	}
+	for _, v := range result.Messages {
+		if _, err := fmt.Fprintln(o, v); err != nil {
+			return err
+		}
+	}
+	if len(result.Conflicts) > 0 {
+		return errors.New("Automatic merge failed; fix conflicts and then commit the result.")
+	}
+	if _, err := fmt.Fprintln(o, "Merge made by the 'ort' strategy."); err != nil {
+		return err
+	}
+	return writeMergeStat(r, o, head, result.Commit, opts.Algorithm)
+}
+
+// defaultMergeMessage describes merging rev into the current branch as git
+// does, naming the current branch unless it is main or master
+func defaultMergeMessage(r *g.Repository, rev string) ([]byte, error) {
+	branches, err := r.ListBranches()
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(branches, rev) {
+		return []byte(fmt.Sprintf("Merge commit '%s'", rev)), nil
+	}
+	msg := fmt.Sprintf("Merge branch '%s'", rev)
+	current, err := r.CurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+	switch current {
+	case "main", "master":
+	case "":
+		msg += " into HEAD"
+	default:
+		msg += " into " + current
+	}
+	return []byte(msg), nil
+}
+
+// writeMergeStat writes the diffstat of the changes merged from commit a to
+// commit b, followed by the files created, deleted and renamed and the modes
+// changed
+func writeMergeStat(r *g.Repository, o io.Writer, a g.Sha, b g.Sha, algorithm diff.Algorithm) error {
+	entries, err := r.DiffTrees(a, b, g.DiffOptions{Renames: true})
+	if err != nil {
+		return err
+	}
+	var files []*diffFile
+	for _, v := range entries {
+		f, err := newDiffFile(r, v, algorithm)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	if err := writeDiffStat(o, files); err != nil {
+		return err
+	}
+	for _, v := range entries {
+		var err error
+		switch {
+		case v.Status == g.DiffAdded:
+			_, err = fmt.Fprintf(o, " create mode %s %s\n", v.NewMode, v.NewPath)
+		case v.Status == g.DiffDeleted:
+			_, err = fmt.Fprintf(o, " delete mode %s %s\n", v.OldMode, v.OldPath)
+		case v.Status == g.DiffRenamed:
+			_, err = fmt.Fprintf(o, " rename %s (%d%%)\n", statName(v), v.Similarity)
+		case v.OldMode != v.NewMode:
+			_, err = fmt.Fprintf(o, " mode change %s => %s %s\n", v.OldMode, v.NewMode, v.NewPath)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	mergeCmd.Flags().BoolVar(&mergeNoFastForward, "no-ff", false, "--no-ff")
+	mergeCmd.Flags().BoolVar(&mergeFastForwardOnly, "ff-only", false, "--ff-only")
+	mergeCmd.Flags().StringVarP(&mergeMessage, "message", "m", "", "--message")
+	mergeCmd.Flags().StringVar(&mergeConflictStyle, "conflict", "", "--conflict <style>")
+	rootCmd.AddCommand(mergeCmd)
+}
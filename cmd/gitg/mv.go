@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"github.com/richardjennings/g"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+)
+
+var mvForce bool
+
+var mvCmd = &cobra.Command{
+	Use:  "mv [-f] <source>... <destination>",
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		return Mv(r, mvForce, args[len(args)-1], args[:len(args)-1]...)
+	},
+}
+
+// Mv moves the files or directories sources to dst, all relative to the
+// current directory. More than one source is moved inside dst, which must
+// then be a directory.
+func Mv(r *g.Repository, force bool, dst string, sources ...string) error {
+	target, err := r.Pathspec(dst)
+	if err != nil {
+		return err
+	}
+	if len(sources) > 1 {
+		if fi, err := os.Stat(filepath.Join(r.Path(), target)); err != nil || !fi.IsDir() {
+			return fmt.Errorf("fatal: destination '%s' is not a directory", dst)
+		}
+	}
+	for _, v := range sources {
+		src, err := r.Pathspec(v)
+		if err != nil {
+			return err
+		}
+		if err := r.Mv(src, target, force); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	mvCmd.Flags().BoolVarP(&mvForce, "force", "f", false, "--force")
+	rootCmd.AddCommand(mvCmd)
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var packRefsCmd = &cobra.Command{
+	Use:  "pack-refs",
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		return r.PackRefs()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(packRefsCmd)
+}
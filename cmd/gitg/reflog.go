@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"github.com/richardjennings/g"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+)
+
+var reflogCmd = &cobra.Command{
+	Use:  "reflog [<ref>]",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		name := "HEAD"
+		if len(args) == 1 {
+			name = args[0]
+		}
+		return Reflog(r, os.Stdout, name)
+	},
+}
+
+// Reflog writes the reflog entries of the ref name, most recent first
+func Reflog(r *g.Repository, o io.Writer, name string) error {
+	ref, err := r.ReflogRef(name)
+	if err != nil {
+		return err
+	}
+	entries, err := r.ReadReflog(ref)
+	if err != nil {
+		return err
+	}
+	for i, v := range entries {
+		if _, err := fmt.Fprintf(o, "%s %s@{%d}: %s\n", v.New.AsHexString()[:7], name, i, v.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(reflogCmd)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"github.com/richardjennings/g"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+)
+
+var (
+	repackPrune   bool
+	repackNoDelta bool
+)
+
+var repackCmd = &cobra.Command{
+	Use:  "repack",
+	Args: cobra.ExactArgs(0),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		return Repack(r, os.Stdout, repackPrune, !repackNoDelta)
+	},
+}
+
+// Repack writes the loose objects to a new pack file, printing the pack name.
+// When prune is set the loose copies of the packed objects are removed.
+func Repack(r *g.Repository, o io.Writer, prune bool, deltas bool) error {
+	shas, err := r.LooseObjects()
+	if err != nil {
+		return err
+	}
+	if len(shas) == 0 {
+		_, err = fmt.Fprintln(o, "Nothing new to pack.")
+		return err
+	}
+	name, err := r.WritePack(shas, deltas)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(o, name); err != nil {
+		return err
+	}
+	if prune {
+		return r.PruneLooseObjects(shas)
+	}
+	return nil
+}
+
+func init() {
+	repackCmd.Flags().BoolVarP(&repackPrune, "delete", "d", false, "--delete")
+	repackCmd.Flags().BoolVar(&repackNoDelta, "no-delta", false, "--no-delta")
+	rootCmd.AddCommand(repackCmd)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/richardjennings/g"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+)
+
+var (
+	resetSoft  bool
+	resetMixed bool
+	resetHard  bool
+)
+
+var resetCmd = &cobra.Command{
+	Use: "reset [--soft | --mixed | --hard] [<commit>] [--] [<pathspec>...]",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		mode := g.ResetMixed
+		switch {
+		case resetSoft && resetHard, resetSoft && resetMixed, resetMixed && resetHard:
+			return errors.New("fatal: --soft, --mixed and --hard are mutually exclusive")
+		case resetSoft:
+			mode = g.ResetSoft
+		case resetHard:
+			mode = g.ResetHard
+		}
+		// the first argument is the commit unless it is a path
+		var rev string
+		pathspecs := args
+		if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+			if dash > 1 {
+				return errors.New("fatal: only one commit can be given before --")
+			}
+			if dash == 1 {
+				rev = args[0]
+			}
+			pathspecs = args[dash:]
+		} else if len(args) > 0 {
+			if _, err := r.ResolveRevision(args[0]); err == nil {
+				rev, pathspecs = args[0], args[1:]
+			}
+		}
+		return Reset(r, os.Stdout, rev, mode, pathspecs...)
+	},
+}
+
+// Reset moves the current branch to the commit rev, HEAD by default, and
+// resets the index, and the working tree for g.ResetHard, as mode asks. When
+// pathspecs are given, relative to the current directory, only the index
+// entries of the paths they match are reset. What remains changed in the
+// working tree is written to o, as git reset does.
+func Reset(r *g.Repository, o io.Writer, rev string, mode g.ResetMode, pathspecs ...string) error {
+	if len(pathspecs) > 0 {
+		switch mode {
+		case g.ResetSoft:
+			return errors.New("fatal: Cannot do soft reset with paths.")
+		case g.ResetHard:
+			return errors.New("fatal: Cannot do hard reset with paths.")
+		}
+		var paths []string
+		for _, v := range pathspecs {
+			p, err := r.Pathspec(v)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, p)
+		}
+		if err := r.ResetPaths(rev, paths); err != nil {
+			return err
+		}
+		return writeUnstaged(r, o)
+	}
+	if err := r.Reset(rev, mode); err != nil {
+		return err
+	}
+	switch mode {
+	case g.ResetMixed:
+		return writeUnstaged(r, o)
+	case g.ResetHard:
+		sha, err := r.CurrentCommit()
+		if err != nil || !sha.IsSet() {
+			return err
+		}
+		c, err := r.ReadCommit(sha)
+		if err != nil {
+			return err
+		}
+		subject, _, _ := bytes.Cut(bytes.TrimSpace(c.Message), []byte("\n"))
+		_, err = fmt.Fprintf(o, "HEAD is now at %s %s\n", abbrev(sha), subject)
+		return err
+	}
+	return nil
+}
+
+// writeUnstaged writes the paths that differ between the index and the
+// working tree after a reset
+func writeUnstaged(r *g.Repository, o io.Writer) error {
+	entries, err := r.DiffWorktree()
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	if _, err := fmt.Fprintln(o, "Unstaged changes after reset:"); err != nil {
+		return err
+	}
+	for _, v := range entries {
+		if _, err := fmt.Fprintf(o, "%s\t%s\n", v.Status, v.NewPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	resetCmd.Flags().BoolVar(&resetSoft, "soft", false, "--soft")
+	resetCmd.Flags().BoolVar(&resetMixed, "mixed", false, "--mixed")
+	resetCmd.Flags().BoolVar(&resetHard, "hard", false, "--hard")
+	rootCmd.AddCommand(resetCmd)
+}
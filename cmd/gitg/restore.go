@@ -1,7 +1,6 @@
 package main
 
 import (
-	"github.com/richardjennings/g"
 	"github.com/spf13/cobra"
 )
 
@@ -11,10 +10,15 @@ var restoreCmd = &cobra.Command{
 	Use:  "restore",
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := configure(); err != nil {
+		r, err := openRepository()
+		if err != nil {
 			return err
 		}
-		return g.Restore(args[0], restoreStaged)
+		path, err := r.Pathspec(args[0])
+		if err != nil {
+			return err
+		}
+		return r.Restore(path, restoreStaged)
 	},
 }
 
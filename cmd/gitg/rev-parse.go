@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/richardjennings/g"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+)
+
+var (
+	revParseShort  bool
+	revParseVerify bool
+)
+
+var revParseCmd = &cobra.Command{
+	Use:  "rev-parse <revision> ...",
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		return RevParse(r, os.Stdout, args...)
+	},
+}
+
+// RevParse writes the Sha of each revision. Ranges are written as the
+// included commits followed by the excluded commits prefixed with ^.
+func RevParse(r *g.Repository, o io.Writer, revs ...string) error {
+	if revParseVerify {
+		if len(revs) != 1 {
+			return errors.New("fatal: Needed a single revision")
+		}
+		sha, err := r.ResolveRevision(revs[0])
+		if err != nil {
+			return errors.New("fatal: Needed a single revision")
+		}
+		return writeRevision(o, "", sha)
+	}
+	for _, rev := range revs {
+		rr, err := r.ResolveRange(rev)
+		if err != nil {
+			return err
+		}
+		for _, sha := range rr.Include {
+			if err := writeRevision(o, "", sha); err != nil {
+				return err
+			}
+		}
+		for _, sha := range rr.Exclude {
+			if err := writeRevision(o, "^", sha); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func writeRevision(o io.Writer, prefix string, sha g.Sha) error {
+	s := sha.AsHexString()
+	if revParseShort {
+		s = s[:7]
+	}
+	_, err := fmt.Fprintf(o, "%s%s\n", prefix, s)
+	return err
+}
+
+func init() {
+	revParseCmd.Flags().BoolVar(&revParseShort, "short", false, "--short")
+	revParseCmd.Flags().BoolVar(&revParseVerify, "verify", false, "--verify")
+	rootCmd.AddCommand(revParseCmd)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"github.com/richardjennings/g"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+)
+
+var (
+	rmCached    bool
+	rmRecursive bool
+	rmForce     bool
+)
+
+var rmCmd = &cobra.Command{
+	Use:  "rm [--cached] [-r] [-f] <pathspec>...",
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		return Rm(r, os.Stdout, g.RmOptions{Cached: rmCached, Recursive: rmRecursive, Force: rmForce}, args...)
+	},
+}
+
+// Rm removes the files matching pathspecs, relative to the current
+// directory, from the index and the working tree as opts asks, writing the
+// paths removed to o.
+func Rm(r *g.Repository, o io.Writer, opts g.RmOptions, pathspecs ...string) error {
+	var paths []string
+	for _, v := range pathspecs {
+		p, err := r.Pathspec(v)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, p)
+	}
+	removed, err := r.Rm(paths, opts)
+	if err != nil {
+		return err
+	}
+	for _, v := range removed {
+		if _, err := fmt.Fprintf(o, "rm '%s'\n", v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	rmCmd.Flags().BoolVar(&rmCached, "cached", false, "--cached")
+	rmCmd.Flags().BoolVarP(&rmRecursive, "recursive", "r", false, "-r")
+	rmCmd.Flags().BoolVarP(&rmForce, "force", "f", false, "--force")
+	rootCmd.AddCommand(rmCmd)
+}
@@ -4,25 +4,44 @@ import (
 	"github.com/richardjennings/g"
 	"github.com/spf13/cobra"
 	"log"
+	"os"
 )
 
 var (
-	gitDirectoryFlag string
-	pathFlag         string
-	rootCmd          = &cobra.Command{}
+	gitDirectoryFlag    string
+	pathFlag            string
+	noOptionalLocksFlag bool
+	rootCmd             = &cobra.Command{}
 )
 
 func init() {
 	rootCmd.PersistentFlags().StringVar(&gitDirectoryFlag, "git-directory", g.DefaultGitDirectory, "--git-directory")
 	rootCmd.PersistentFlags().StringVar(&pathFlag, "path", g.DefaultPath, "--path")
+	rootCmd.PersistentFlags().BoolVar(&noOptionalLocksFlag, "no-optional-locks", false, "--no-optional-locks")
 }
 
-func configure() error {
-	opts := []g.Opt{
+func options() []g.Opt {
+	return []g.Opt{
 		g.WithGitDirectory(gitDirectoryFlag),
-		g.WithPath(pathFlag),
 	}
-	return g.Configure(opts...)
+}
+
+// optionalLocks returns false when commands should not write to the
+// repository unless asked to, such as status refreshing the index
+func optionalLocks() bool {
+	return !noOptionalLocksFlag && os.Getenv("GIT_OPTIONAL_LOCKS") != "0"
+}
+
+func openRepository() (*g.Repository, error) {
+	return g.Open(pathFlag, options()...)
+}
+
+// resolveCommit resolves a revision, defaulting to the current commit.
+func resolveCommit(r *g.Repository, target string) (g.Sha, error) {
+	if target == "" {
+		return r.CurrentCommit()
+	}
+	return r.ResolveRevision(target)
 }
 
 func Execute() {
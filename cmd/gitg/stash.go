@@ -0,0 +1,258 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/richardjennings/g"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	stashMessage string
+	stashIndex   bool
+	stashPatch   bool
+)
+
+var stashCmd = &cobra.Command{
+	Use:  "stash",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		return StashPush(r, os.Stdout, nil)
+	},
+}
+
+var stashPushCmd = &cobra.Command{
+	Use:  "push [-m <message>]",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		var msg []byte
+		if cmd.Flags().Changed("message") {
+			msg = []byte(stashMessage)
+		}
+		return StashPush(r, os.Stdout, msg)
+	},
+}
+
+var stashListCmd = &cobra.Command{
+	Use:  "list",
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		return StashList(r, os.Stdout)
+	},
+}
+
+var stashShowCmd = &cobra.Command{
+	Use:  "show [-p] [<stash>]",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		return StashShow(r, os.Stdout, stashArg(args), stashPatch)
+	},
+}
+
+var stashApplyCmd = &cobra.Command{
+	Use:  "apply [--index] [<stash>]",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		_, err = StashApply(r, os.Stdout, stashArg(args), stashIndex)
+		return err
+	},
+}
+
+var stashPopCmd = &cobra.Command{
+	Use:  "pop [--index] [<stash>]",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		return StashPop(r, os.Stdout, stashArg(args), stashIndex)
+	},
+}
+
+var stashDropCmd = &cobra.Command{
+	Use:  "drop [<stash>]",
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		return StashDrop(r, os.Stdout, stashArg(args))
+	},
+}
+
+// StashPush saves the local changes as a stash entry and resets them, as git
+// stash push does. Without a message the entry is described by HEAD.
+func StashPush(r *g.Repository, o io.Writer, message []byte) error {
+	commit := &g.Commit{
+		Author:        fmt.Sprintf("%s <%s>", r.AuthorName(), r.AuthorEmail()),
+		AuthoredTime:  time.Now(),
+		Committer:     fmt.Sprintf("%s <%s>", r.CommitterName(), r.CommitterEmail()),
+		CommittedTime: time.Now(),
+		Message:       message,
+	}
+	sha, err := r.StashPush(commit)
+	if err != nil {
+		return err
+	}
+	if !sha.IsSet() {
+		_, err := fmt.Fprintln(o, "No local changes to save")
+		return err
+	}
+	_, err = fmt.Fprintf(o, "Saved working directory and index state %s\n", commit.Message)
+	return err
+}
+
+// StashList writes the stash entries, most recent first
+func StashList(r *g.Repository, o io.Writer) error {
+	entries, err := r.ReadReflog(g.DefaultStashRef)
+	if err != nil {
+		return err
+	}
+	for i, v := range entries {
+		if _, err := fmt.Fprintf(o, "stash@{%d}: %s\n", i, v.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StashShow writes the changes saved by the stash entry named by stash,
+// stash@{0} when empty, relative to the commit it was saved on, as a
+// diffstat or, when patch is true, a patch
+func StashShow(r *g.Repository, o io.Writer, stash string, patch bool) error {
+	n, err := parseStash(stash)
+	if err != nil {
+		return err
+	}
+	sha, err := r.StashCommit(n)
+	if err != nil {
+		return err
+	}
+	c, err := r.ReadCommit(sha)
+	if err != nil {
+		return err
+	}
+	if len(c.Parents) == 0 {
+		return fmt.Errorf("error: '%s' is not a stash-like commit", sha)
+	}
+	opts := DiffOptions{DiffOptions: g.DiffOptions{Renames: true}, Stat: !patch, Context: 3}
+	return Diff(r, o, opts, []string{c.Parents[0].AsHexString(), sha.AsHexString()})
+}
+
+// StashApply applies the stash entry named by stash, stash@{0} when empty,
+// writing the files merged and the resulting status to o. When index is
+// true the changes saved from the index are restored to it. It reports
+// whether the entry applied without conflicts.
+func StashApply(r *g.Repository, o io.Writer, stash string, index bool) (bool, error) {
+	n, err := parseStash(stash)
+	if err != nil {
+		return false, err
+	}
+	opts, err := contentMergeOptions(r, "")
+	if err != nil {
+		return false, err
+	}
+	result, err := r.StashApply(n, index, opts)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range result.Messages {
+		if _, err := fmt.Fprintln(o, v); err != nil {
+			return false, err
+		}
+	}
+	return len(result.Conflicts) == 0, Status(r, o, g.DiffOptions{Renames: true})
+}
+
+// StashPop applies the stash entry named by stash, stash@{0} when empty, and
+// drops it unless it left conflicts
+func StashPop(r *g.Repository, o io.Writer, stash string, index bool) error {
+	applied, err := StashApply(r, o, stash, index)
+	if err != nil {
+		return err
+	}
+	if !applied {
+		return errors.New("The stash entry is kept in case you need it again.")
+	}
+	return StashDrop(r, o, stash)
+}
+
+// StashDrop removes the stash entry named by stash, stash@{0} when empty
+func StashDrop(r *g.Repository, o io.Writer, stash string) error {
+	n, err := parseStash(stash)
+	if err != nil {
+		return err
+	}
+	sha, err := r.StashDrop(n)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(stash, "@{") {
+		stash = fmt.Sprintf("%s@{%d}", g.DefaultStashRef, n)
+	}
+	_, err = fmt.Fprintf(o, "Dropped %s (%s)\n", stash, sha.AsHexString())
+	return err
+}
+
+// stashArg returns the stash entry named by args, which is empty for the
+// most recent
+func stashArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
+
+// parseStash returns n for a stash entry named stash@{n}, refs/stash@{n} or
+// n. An empty name is stash@{0}.
+func parseStash(stash string) (int, error) {
+	if stash == "" {
+		return 0, nil
+	}
+	s := stash
+	if inner, ok := strings.CutPrefix(strings.TrimPrefix(s, "refs/"), "stash@{"); ok && strings.HasSuffix(inner, "}") {
+		s = strings.TrimSuffix(inner, "}")
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("error: %s is not a valid reference", stash)
+	}
+	return n, nil
+}
+
+func init() {
+	stashPushCmd.Flags().StringVarP(&stashMessage, "message", "m", "", "-m <message>")
+	stashShowCmd.Flags().BoolVarP(&stashPatch, "patch", "p", false, "--patch")
+	for _, v := range []*cobra.Command{stashApplyCmd, stashPopCmd} {
+		v.Flags().BoolVar(&stashIndex, "index", false, "--index")
+	}
+	stashCmd.AddCommand(stashPushCmd, stashListCmd, stashShowCmd, stashApplyCmd, stashPopCmd, stashDropCmd)
+	rootCmd.AddCommand(stashCmd)
+}
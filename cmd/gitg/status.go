@@ -6,30 +6,93 @@ import (
 	"github.com/spf13/cobra"
 	"io"
 	"os"
+	"sort"
 )
 
 var statusCmd = &cobra.Command{
-	Use: "status",
+	Use: "status [<pathspec>...]",
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := configure(); err != nil {
+		r, err := openRepository()
+		if err != nil {
 			return err
 		}
-		return Status(os.Stdout)
+		if optionalLocks() {
+			// refresh the stat data in the index so that files are not
+			// hashed again by the next status
+			if err := r.RefreshIndex(); err != nil {
+				return err
+			}
+		}
+		opts, err := findRenames(cmd, r, "status", "diff")
+		if err != nil {
+			return err
+		}
+		return Status(r, os.Stdout, opts, args...)
 	},
 }
 
 // Status currently displays the file statuses comparing the working directory
-// to the index and the index to the last commit (if any).
-func Status(o io.Writer) error {
-	files, err := g.CurrentStatus()
+// to the index and the index to the last commit (if any), with files renamed
+// or copied in the index found as renames asks, and files left in conflict by
+// a merge with the stages they have. When pathspecs are given,
+// relative to the current directory, only the files they match are
+// displayed.
+func Status(r *g.Repository, o io.Writer, renames g.DiffOptions, pathspecs ...string) error {
+	var paths []string
+	for _, v := range pathspecs {
+		p, err := r.Pathspec(v)
+		if err != nil {
+			return err
+		}
+		paths = append(paths, p)
+	}
+	files, err := r.CurrentStatus()
 	if err != nil {
 		return err
 	}
-	for _, v := range files.Files() {
+	if renames.Renames || renames.Copies {
+		if err := r.DetectRenames(files, renames); err != nil {
+			return err
+		}
+	}
+	// changes are listed by path, then untracked files, as git does. A
+	// file removed from the index but kept in the working tree is in both.
+	list := append([]*g.FileStatus(nil), files.Files()...)
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path() < list[j].Path()
+	})
+	var untracked []string
+	for _, v := range list {
 		if v.IndexStatus() == g.NotUpdated && v.WorkingDirectoryStatus() == g.IndexAndWorkingTreeMatch {
 			continue
 		}
-		if _, err := fmt.Fprintf(o, "%s%s %s\n", v.IndexStatus().StatusString(), v.WorkingDirectoryStatus().StatusString(), v.Path()); err != nil {
+		if len(paths) > 0 && !g.MatchPathspec(v.Path(), paths) && (v.OrigPath() == "" || !g.MatchPathspec(v.OrigPath(), paths)) {
+			continue
+		}
+		if v.IndexStatus() == g.UnmergedInIndex {
+			if _, err := fmt.Fprintf(o, "%s %s\n", v.Unmerged().StatusString(), v.Path()); err != nil {
+				return err
+			}
+			continue
+		}
+		worktree := v.WorkingDirectoryStatus()
+		if worktree == g.Untracked {
+			untracked = append(untracked, v.Path())
+			if v.IndexStatus() == g.UntrackedInIndex {
+				continue
+			}
+			worktree = g.IndexAndWorkingTreeMatch
+		}
+		path := v.Path()
+		if v.OrigPath() != "" {
+			path = v.OrigPath() + " -> " + path
+		}
+		if _, err := fmt.Fprintf(o, "%s%s %s\n", v.IndexStatus().StatusString(), worktree.StatusString(), path); err != nil {
+			return err
+		}
+	}
+	for _, v := range untracked {
+		if _, err := fmt.Fprintf(o, "?? %s\n", v); err != nil {
 			return err
 		}
 	}
@@ -37,5 +100,8 @@ func Status(o io.Writer) error {
 }
 
 func init() {
+	statusCmd.Flags().StringVar(&diffFindRenames, "find-renames", "", "--find-renames[=<n>]")
+	statusCmd.Flags().Lookup("find-renames").NoOptDefVal = "50%"
+	statusCmd.Flags().BoolVar(&diffNoRenames, "no-renames", false, "--no-renames")
 	rootCmd.AddCommand(statusCmd)
 }
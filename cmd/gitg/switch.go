@@ -1,31 +1,60 @@
 package main
 
 import (
+	"fmt"
 	"github.com/richardjennings/g"
 	"github.com/spf13/cobra"
+	"strings"
 )
 
+var switchDetach bool
+
 var switchCmd = &cobra.Command{
 	Use:  "switch",
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if err := configure(); err != nil {
+		r, err := openRepository()
+		if err != nil {
 			return err
 		}
-		return SwitchBranch(args[0])
+		if switchDetach {
+			return SwitchDetached(r, args[0])
+		}
+		return SwitchBranch(r, args[0])
 	},
 }
 
-func SwitchBranch(name string) error {
-	errFiles, err := g.SwitchBranch(name)
+func SwitchBranch(r *g.Repository, name string) error {
+	errFiles, err := r.SwitchBranch(name)
+	if err != nil {
+		return err
+	}
+	return checkoutError(errFiles)
+}
+
+// SwitchDetached switches to a commit detaching HEAD
+func SwitchDetached(r *g.Repository, target string) error {
+	sha, err := resolveCommit(r, target)
 	if err != nil {
 		return err
 	}
-	// @todo print out errFiles
-	_ = errFiles
-	return nil
+	errFiles, err := r.SwitchDetached(sha)
+	if err != nil {
+		return err
+	}
+	return checkoutError(errFiles)
+}
+
+// checkoutError returns the error reporting the files whose local changes
+// prevented a switch, if any
+func checkoutError(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	return fmt.Errorf("error: Your local changes to the following files would be overwritten by checkout:\n\t%s\nPlease commit your changes or stash them before you switch branches.\nAborting", strings.Join(paths, "\n\t"))
 }
 
 func init() {
+	switchCmd.Flags().BoolVarP(&switchDetach, "detach", "d", false, "--detach <commit>")
 	rootCmd.AddCommand(switchCmd)
 }
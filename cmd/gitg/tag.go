@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/richardjennings/g"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	tagDelete    bool
+	tagAnnotated bool
+	tagMessage   string
+)
+
+var tagCmd = &cobra.Command{
+	Use:  "tag [<name> [<commit>]]",
+	Args: cobra.MaximumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		r, err := openRepository()
+		if err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			return ListTags(r, os.Stdout)
+		}
+		if tagDelete {
+			return DeleteTag(r, args[0])
+		}
+		var target string
+		if len(args) == 2 {
+			target = args[1]
+		}
+		if tagAnnotated || cmd.Flags().Changed("message") {
+			return CreateAnnotatedTag(r, args[0], target, []byte(tagMessage))
+		}
+		return CreateTag(r, args[0], target)
+	},
+}
+
+// ListTags writes the names of all tags
+func ListTags(r *g.Repository, o io.Writer) error {
+	tags, err := r.ListTags()
+	if err != nil {
+		return err
+	}
+	for _, v := range tags {
+		if _, err := fmt.Fprintln(o, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateTag creates a lightweight tag for target, or the current commit when
+// target is empty.
+func CreateTag(r *g.Repository, name string, target string) error {
+	sha, err := resolveCommit(r, target)
+	if err != nil {
+		return err
+	}
+	return r.CreateTag(name, sha, nil)
+}
+
+// CreateAnnotatedTag creates an annotated tag for target, or the current
+// commit when target is empty.
+func CreateAnnotatedTag(r *g.Repository, name string, target string, message []byte) error {
+	if len(message) == 0 {
+		return errors.New("fatal: no tag message")
+	}
+	sha, err := resolveCommit(r, target)
+	if err != nil {
+		return err
+	}
+	return r.CreateTag(name, sha, &g.Tag{
+		Tagger:      r.CommitterName(),
+		TaggerEmail: r.CommitterEmail(),
+		TaggedTime:  time.Now(),
+		Message:     message,
+	})
+}
+
+func DeleteTag(r *g.Repository, name string) error {
+	return r.DeleteTag(name)
+}
+
+func init() {
+	tagCmd.Flags().BoolVarP(&tagDelete, "delete", "d", false, "--delete <tag>")
+	tagCmd.Flags().BoolVarP(&tagAnnotated, "annotate", "a", false, "--annotate")
+	tagCmd.Flags().StringVarP(&tagMessage, "message", "m", "", "--message")
+	rootCmd.AddCommand(tagCmd)
+}
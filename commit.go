@@ -1,21 +1,32 @@
 package g
 
-// CreateCommit writes the Commit provided in the Object Store
-func CreateCommit(commit *Commit) (Sha, error) {
-	idx, err := ReadIndex()
+import "errors"
+
+// CreateCommit writes the Commit provided in the Object Store. While a merge
+// is in progress the merged commits are also parents, and the merge is
+// concluded.
+func (r *Repository) CreateCommit(commit *Commit) (Sha, error) {
+	idx, err := r.ReadIndex()
 	if err != nil {
 		return Sha{}, err
 	}
-	root := ObjectTree(idx.Files())
-	tree, err := root.WriteTree()
+	if len(idx.Unmerged()) > 0 {
+		return Sha{}, errors.New("error: Committing is not possible because you have unmerged files.")
+	}
+	root := r.ObjectTree(idx.Files())
+	tree, err := r.WriteTree(root)
 	if err != nil {
 		return Sha{}, err
 	}
-	previousCommits, err := PreviousCommits()
+	previousCommits, err := r.PreviousCommits()
 	if err != nil {
 		return Sha{}, err
 	}
 	commit.Tree = tree
 	commit.Parents = previousCommits
-	return writeCommit(commit)
+	sha, err := r.writeCommit(commit, "")
+	if err != nil {
+		return Sha{}, err
+	}
+	return sha, r.removeMergeState()
 }
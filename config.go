@@ -1,10 +1,11 @@
 package g
 
 import (
-	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 )
 
 const (
@@ -15,32 +16,38 @@ const (
 	DefaultObjectsDirectory   = "objects"
 	DefaultRefsDirectory      = "refs"
 	DefaultRefsHeadsDirectory = "heads"
+	DefaultRefsTagsDirectory  = "tags"
+	DefaultLogsDirectory      = "logs"
 	DefaultBranchName         = "main"
 	DefaultEditor             = "vim"
-	DefaultPackedRefsFile     = "info/refs"
+	DefaultPackedRefsFile     = "packed-refs"
+	DefaultConfigFile         = "config"
 	DefaultPackfileDirectory  = "pack"
 	DefaultGitIgnoreFileName  = ".gitignore"
+	DefaultMergeHeadFile      = "MERGE_HEAD"
+	DefaultMergeMsgFile       = "MERGE_MSG"
+	DefaultMergeModeFile      = "MERGE_MODE"
+	DefaultOrigHeadFile       = "ORIG_HEAD"
+	DefaultStashRef           = "refs/stash"
 )
 
-var config = &Cnf{
-	GitDirectory:       DefaultGitDirectory,
-	Path:               DefaultPath,
-	HeadFile:           DefaultHeadFile,
-	IndexFile:          DefaultIndexFile,
-	ObjectsDirectory:   DefaultObjectsDirectory,
-	RefsDirectory:      DefaultRefsDirectory,
-	RefsHeadsDirectory: DefaultRefsHeadsDirectory,
-	PackedRefsFile:     DefaultPackedRefsFile,
-	PackfileDirectory:  DefaultPackfileDirectory,
-	DefaultBranch:      DefaultBranchName,
-	Editor:             DefaultEditor,
-	GitIgnoreFileName:  DefaultGitIgnoreFileName,
-}
-
 type (
+	// Repository is a git repository returned by Open or Init. Operations
+	// on a repository are methods of it, so that several repositories can
+	// be used at once from different goroutines.
+	Repository struct {
+		config *Cnf
+		// prefix is the subdirectory of the working tree that the
+		// repository was opened from, used to resolve pathspecs
+		prefix string
+		// mu guards config.GitConfig, which is read again when a config
+		// file is written
+		mu sync.RWMutex
+	}
 	Cnf struct {
 		// GitDirector configures where the name of the git directory
-		// This is usually .git
+		// This is usually .git, or an absolute path when the git directory
+		// is outside of the working tree
 		GitDirectory string
 		// Path configures where the Git Directory to interact with is
 		// relative to the present working directory. This is usually .
@@ -51,25 +58,35 @@ type (
 		ObjectsDirectory   string
 		RefsDirectory      string
 		RefsHeadsDirectory string
+		RefsTagsDirectory  string
 		PackedRefsFile     string
 		PackfileDirectory  string
 		DefaultBranch      string
-		GitIgnore          [][]byte
 		Editor             string
 		EditorArgs         []string
 		GitIgnoreFileName  string
+		// GitConfig is read from the system, global and repository git
+		// config files by Open
+		GitConfig *GitConfig
 	}
 	Opt func(m *Cnf) error
 )
 
-func WithPath(path string) Opt {
-	return func(c *Cnf) error {
-		path, err := filepath.Abs(path)
-		if err != nil {
-			return err
-		}
-		c.Path = path
-		return nil
+func defaultConfig() *Cnf {
+	return &Cnf{
+		GitDirectory:       DefaultGitDirectory,
+		Path:               DefaultPath,
+		HeadFile:           DefaultHeadFile,
+		IndexFile:          DefaultIndexFile,
+		ObjectsDirectory:   DefaultObjectsDirectory,
+		RefsDirectory:      DefaultRefsDirectory,
+		RefsHeadsDirectory: DefaultRefsHeadsDirectory,
+		RefsTagsDirectory:  DefaultRefsTagsDirectory,
+		PackedRefsFile:     DefaultPackedRefsFile,
+		PackfileDirectory:  DefaultPackfileDirectory,
+		DefaultBranch:      DefaultBranchName,
+		Editor:             DefaultEditor,
+		GitIgnoreFileName:  DefaultGitIgnoreFileName,
 	}
 }
 
@@ -80,121 +97,228 @@ func WithGitDirectory(name string) Opt {
 	}
 }
 
-func Configure(opts ...Opt) error {
+// Open returns the Repository containing path. The git directory is found by
+// discovery, see discoverRepository, so path may be a subdirectory of the
+// working tree.
+func Open(path string, opts ...Opt) (*Repository, error) {
+	cnf, err := newConfig(path, opts...)
+	if err != nil {
+		return nil, err
+	}
+	workTree, gitDir, err := discoverRepository(cnf.Path, cnf.GitDirectory)
+	if err != nil {
+		return nil, err
+	}
+	// the prefix is the subdirectory of the working tree that path is in
+	var prefix string
+	if rel, err := filepath.Rel(workTree, cnf.Path); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+		prefix = filepath.ToSlash(rel)
+	}
+	cnf.Path = workTree
+	cnf.GitDirectory = gitDir
+	r, err := newRepository(cnf)
+	if err != nil {
+		return nil, err
+	}
+	r.prefix = prefix
+	return r, nil
+}
 
-	for _, opt := range opts {
-		if err := opt(config); err != nil {
-			return err
-		}
+// newConfig returns the configuration of a repository with its working
+// directory at path
+func newConfig(path string, opts ...Opt) (*Cnf, error) {
+	cnf := defaultConfig()
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
 	}
-	if config.Path == DefaultPath {
-		p, err := filepath.Abs(DefaultPath)
-		if err != nil {
-			return err
+	cnf.Path = path
+	for _, opt := range opts {
+		if err := opt(cnf); err != nil {
+			return nil, err
 		}
-		config.Path = p
 	}
+	return cnf, nil
+}
 
-	// read .gitignore
-	// @todo there can be multiple, and some of the rules are relative to those
-	// files ...
-	config.GitIgnore = make([][]byte, 0)
-	file, err := os.Open(config.GitIgnoreFileName)
+// newRepository returns a Repository for cnf, reading its git config
+func newRepository(cnf *Cnf) (*Repository, error) {
+	r := &Repository{config: cnf}
+	gitConfig, err := r.ReadGitConfig()
 	if err != nil {
-		return nil
+		return nil, err
 	}
-	defer func() { _ = file.Close() }()
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		config.GitIgnore = append(config.GitIgnore, scanner.Bytes())
+	r.config.GitConfig = gitConfig
+
+	return r, nil
+}
+
+// GitConfig returns the git configuration read from the system, global and
+// repository git config files
+func (r *Repository) GitConfig() *GitConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.config.GitConfig
+}
+
+func (r *Repository) Path() string {
+	return r.config.Path
+}
+
+func (r *Repository) GitPath() string {
+	if filepath.IsAbs(r.config.GitDirectory) {
+		return r.config.GitDirectory
 	}
-	return nil
+	return filepath.Join(r.config.Path, r.config.GitDirectory)
+}
+
+func (r *Repository) ObjectPath() string {
+	return filepath.Join(r.GitPath(), r.config.ObjectsDirectory)
 }
 
-func Path() string {
-	return config.Path
+func (r *Repository) WorkingDirectory() string {
+	return r.config.Path + string(filepath.Separator)
 }
 
-func GitPath() string {
-	return filepath.Join(config.Path, config.GitDirectory)
+func (r *Repository) IndexFilePath() string {
+	return filepath.Join(r.GitPath(), r.config.IndexFile)
 }
 
-func ObjectPath() string {
-	return filepath.Join(config.Path, config.GitDirectory, config.ObjectsDirectory)
+func (r *Repository) RefsDirectory() string {
+	return filepath.Join(r.GitPath(), r.config.RefsDirectory)
 }
 
-func WorkingDirectory() string {
-	return config.Path + string(filepath.Separator)
+func (r *Repository) RefsHeadPrefix() string {
+	return filepath.Join(r.config.RefsDirectory, r.config.RefsHeadsDirectory) + string(os.PathSeparator)
 }
 
-func IndexFilePath() string {
-	return filepath.Join(config.Path, config.GitDirectory, config.IndexFile)
+func (r *Repository) RefsHeadsDirectory() string {
+	return filepath.Join(r.GitPath(), r.config.RefsDirectory, r.config.RefsHeadsDirectory)
 }
 
-func RefsDirectory() string {
-	return filepath.Join(config.Path, config.GitDirectory, config.RefsDirectory)
+func (r *Repository) RefsTagsDirectory() string {
+	return filepath.Join(r.GitPath(), r.config.RefsDirectory, r.config.RefsTagsDirectory)
 }
 
-func RefsHeadPrefix() string {
-	return filepath.Join(config.RefsDirectory, config.RefsHeadsDirectory) + string(os.PathSeparator)
+func (r *Repository) PackedRefsFile() string {
+	return filepath.Join(r.GitPath(), r.config.PackedRefsFile)
 }
 
-func RefsHeadsDirectory() string {
-	return filepath.Join(config.Path, config.GitDirectory, config.RefsDirectory, config.RefsHeadsDirectory)
+func (r *Repository) ObjectPackfileDirectory() string {
+	return filepath.Join(r.GitPath(), r.config.ObjectsDirectory, r.config.PackfileDirectory)
 }
 
-func PackedRefsFile() string {
-	return filepath.Join(config.Path, config.GitDirectory, config.PackedRefsFile)
+func (r *Repository) GitHeadPath() string {
+	return filepath.Join(r.GitPath(), r.config.HeadFile)
 }
 
-func ObjectPackfileDirectory() string {
-	return filepath.Join(config.Path, config.GitDirectory, config.ObjectsDirectory, config.PackfileDirectory)
+// MergeHeadPath returns the path of the file holding the commits being
+// merged while a merge is in progress
+func (r *Repository) MergeHeadPath() string {
+	return filepath.Join(r.GitPath(), DefaultMergeHeadFile)
 }
 
-func GitHeadPath() string {
-	return filepath.Join(config.Path, config.GitDirectory, config.HeadFile)
+// MergeMsgPath returns the path of the file holding the message prepared for
+// the commit concluding a merge
+func (r *Repository) MergeMsgPath() string {
+	return filepath.Join(r.GitPath(), DefaultMergeMsgFile)
 }
 
-func Pager() (string, []string) {
+func (r *Repository) LocalConfigFile() string {
+	return filepath.Join(r.GitPath(), DefaultConfigFile)
+}
+
+// Pager returns the pager command from GIT_PAGER, core.pager or PAGER,
+// defaulting to less
+func (r *Repository) Pager() (string, []string) {
+	if cmd, args, ok := r.configCommand("GIT_PAGER", "core.pager", "PAGER"); ok {
+		return cmd, args
+	}
 	return "/usr/bin/less", []string{"-X", "-F"}
 }
 
-func Editor() (string, []string) {
-	return config.Editor, config.EditorArgs
+// Editor returns the editor command from GIT_EDITOR, core.editor, VISUAL or
+// EDITOR, defaulting to the configured Editor
+func (r *Repository) Editor() (string, []string) {
+	if cmd, args, ok := r.configCommand("GIT_EDITOR", "core.editor", "VISUAL", "EDITOR"); ok {
+		return cmd, args
+	}
+	return r.config.Editor, r.config.EditorArgs
+}
+
+// configCommand returns the first command found in the environment variable
+// env, the git config key, then the fallback environment variables, split
+// into the command and its arguments.
+func (r *Repository) configCommand(env string, key string, fallback ...string) (string, []string, bool) {
+	value, ok := os.LookupEnv(env)
+	if !ok {
+		value, ok = r.GitConfig().Get(key)
+	}
+	for _, v := range fallback {
+		if ok {
+			break
+		}
+		value, ok = os.LookupEnv(v)
+	}
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return "", nil, false
+	}
+	return fields[0], fields[1:], true
 }
 
-func EditorFile() string {
-	return fmt.Sprintf("%s/COMMIT_EDITMSG", GitPath())
+// configValue returns the value of the first environment variable or git
+// config key in names that is set, where git config keys contain a dot.
+func (r *Repository) configValue(names ...string) (string, bool) {
+	for _, v := range names {
+		if strings.Contains(v, ".") {
+			if value, ok := r.GitConfig().Get(v); ok {
+				return value, true
+			}
+		} else if value, ok := os.LookupEnv(v); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func (r *Repository) EditorFile() string {
+	return fmt.Sprintf("%s/COMMIT_EDITMSG", r.GitPath())
 }
 
-func AuthorName() string {
-	if v, ok := os.LookupEnv("GIT_AUTHOR_NAME"); ok {
+func (r *Repository) AuthorName() string {
+	if v, ok := r.configValue("GIT_AUTHOR_NAME", "author.name", "user.name"); ok {
 		return v
 	}
 	return "default"
 }
 
-func AuthorEmail() string {
-	if v, ok := os.LookupEnv("GIT_AUTHOR_EMAIL"); ok {
+func (r *Repository) AuthorEmail() string {
+	if v, ok := r.configValue("GIT_AUTHOR_EMAIL", "author.email", "user.email", "EMAIL"); ok {
 		return v
 	}
 	return "default@default.com"
 }
 
-func CommitterName() string {
-	if v, ok := os.LookupEnv("GIT_COMMITTER_NAME"); ok {
+func (r *Repository) CommitterName() string {
+	if v, ok := r.configValue("GIT_COMMITTER_NAME", "committer.name", "user.name"); ok {
 		return v
 	}
-	return AuthorName()
+	return r.AuthorName()
 }
 
-func CommitterEmail() string {
-	if v, ok := os.LookupEnv("GIT_COMMITTER_EMAIL"); ok {
+func (r *Repository) CommitterEmail() string {
+	if v, ok := r.configValue("GIT_COMMITTER_EMAIL", "committer.email", "user.email", "EMAIL"); ok {
 		return v
 	}
-	return AuthorEmail()
+	return r.AuthorEmail()
 }
 
-func DefaultBranch() string {
-	return config.DefaultBranch
+// DefaultBranch returns init.defaultBranch, defaulting to the configured
+// DefaultBranch
+func (r *Repository) DefaultBranch() string {
+	if v, ok := r.GitConfig().Get("init.defaultBranch"); ok && v != "" {
+		return v
+	}
+	return r.config.DefaultBranch
 }
@@ -0,0 +1,232 @@
+package g
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// ErrConfigKeyNotFound is returned when getting or unsetting a key that is
+// not set
+var ErrConfigKeyNotFound = errors.New("error: key not found")
+
+// GlobalConfigFile returns the global git config file that is written to,
+// ~/.gitconfig unless only the XDG config file exists, or GIT_CONFIG_GLOBAL
+// when it is set.
+func GlobalConfigFile() string {
+	files := GlobalConfigFiles()
+	if len(files) == 1 {
+		return files[0]
+	}
+	home, xdg := files[len(files)-1], files[0]
+	if _, err := os.Stat(home); errors.Is(err, fs.ErrNotExist) {
+		if _, err := os.Stat(xdg); err == nil {
+			return xdg
+		}
+	}
+	return home
+}
+
+// SetConfig sets key to value in the git config file at path, replacing the
+// existing value. An error is returned if key has several values.
+func SetConfig(path string, key string, value string) error {
+	return editConfig(path, key, func(b []byte, entries []*ConfigEntry, sections []*configSection) ([]byte, error) {
+		switch len(entries) {
+		case 0:
+			return addConfigEntry(b, key, value, entries, sections), nil
+		case 1:
+			line := formatConfigEntry(configKeyName(key), value)
+			return spliceConfig(b, entries[0].start, entries[0].end, line), nil
+		default:
+			return nil, fmt.Errorf("warning: %s has multiple values", key)
+		}
+	})
+}
+
+// AddConfig adds value to the multi-valued key in the git config file at
+// path, keeping the existing values.
+func AddConfig(path string, key string, value string) error {
+	return editConfig(path, key, func(b []byte, entries []*ConfigEntry, sections []*configSection) ([]byte, error) {
+		return addConfigEntry(b, key, value, entries, sections), nil
+	})
+}
+
+// UnsetConfig removes key from the git config file at path. An error is
+// returned if key has several values, and ErrConfigKeyNotFound if it is not
+// set.
+func UnsetConfig(path string, key string) error {
+	return editConfig(path, key, func(b []byte, entries []*ConfigEntry, sections []*configSection) ([]byte, error) {
+		switch len(entries) {
+		case 0:
+			return nil, ErrConfigKeyNotFound
+		case 1:
+			start, end := entries[0].start, entries[0].end
+			// remove the whole line when nothing else is on it
+			lineStart := strings.LastIndexByte(string(b[:start]), '\n') + 1
+			if strings.TrimSpace(string(b[lineStart:start])) == "" {
+				start = lineStart
+				if end < len(b) {
+					end++
+				}
+			} else {
+				start = lineStart + len(strings.TrimRight(string(b[lineStart:start]), " \t"))
+			}
+			return spliceConfig(b, start, end, ""), nil
+		default:
+			return nil, fmt.Errorf("warning: %s has multiple values", key)
+		}
+	})
+}
+
+// editConfig rewrites the git config file at path whilst holding its lock.
+// edit is given the current content, the entries for key and the section
+// headers of the file, and returns the new content. Comments and formatting
+// outside of the edited lines are kept.
+func editConfig(path string, key string, edit func([]byte, []*ConfigEntry, []*configSection) ([]byte, error)) error {
+	section, subsection, name, err := parseConfigKey(key)
+	if err != nil {
+		return err
+	}
+	lock, err := newLockFile(path)
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	p := &configParser{b: b, line: 1, path: path}
+	var entries []*ConfigEntry
+	for {
+		entry, err := p.next()
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Section == section && entry.Subsection == subsection && entry.Name == name {
+			entries = append(entries, entry)
+		}
+	}
+	b, err = edit(b, entries, p.sections)
+	if err != nil {
+		return err
+	}
+	if _, err := lock.Write(b); err != nil {
+		return err
+	}
+	return lock.Commit()
+}
+
+// SetConfig sets key to value in the repository config file
+func (r *Repository) SetConfig(key string, value string) error {
+	if err := SetConfig(r.LocalConfigFile(), key, value); err != nil {
+		return err
+	}
+	return r.reloadGitConfig()
+}
+
+// AddConfig adds value to the multi-valued key in the repository config file
+func (r *Repository) AddConfig(key string, value string) error {
+	if err := AddConfig(r.LocalConfigFile(), key, value); err != nil {
+		return err
+	}
+	return r.reloadGitConfig()
+}
+
+// UnsetConfig removes key from the repository config file
+func (r *Repository) UnsetConfig(key string) error {
+	if err := UnsetConfig(r.LocalConfigFile(), key); err != nil {
+		return err
+	}
+	return r.reloadGitConfig()
+}
+
+// reloadGitConfig re-reads the git config once a config file has changed
+func (r *Repository) reloadGitConfig() error {
+	c, err := r.ReadGitConfig()
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.config.GitConfig = c
+	return nil
+}
+
+// addConfigEntry adds key = value after the last value of key, or at the end
+// of the last section for key, or in a new section at the end of the file.
+func addConfigEntry(b []byte, key string, value string, entries []*ConfigEntry, sections []*configSection) []byte {
+	line := formatConfigEntry(configKeyName(key), value)
+	if len(entries) > 0 {
+		end := entries[len(entries)-1].end
+		return spliceConfig(b, end, end, "\n\t"+line)
+	}
+	section, subsection, _, _ := parseConfigKey(key)
+	var last *configSection
+	for _, v := range sections {
+		if v.section == section && v.subsection == subsection {
+			last = v
+		}
+	}
+	if last != nil {
+		// insert after the last non blank line of the section, which ends at
+		// the next section header or the end of the file
+		end := len(b)
+		for _, v := range sections {
+			if v.start > last.start {
+				end = v.start
+				break
+			}
+		}
+		at := last.end + len(strings.TrimRight(string(b[last.end:end]), " \t\r\n"))
+		if at == len(b) {
+			return spliceConfig(b, at, at, "\n\t"+line+"\n")
+		}
+		return spliceConfig(b, at, at, "\n\t"+line)
+	}
+	var prefix string
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		prefix = "\n"
+	}
+	return append(b, []byte(prefix+formatConfigSection(key)+"\n\t"+line+"\n")...)
+}
+
+// spliceConfig replaces b[start:end] with s
+func spliceConfig(b []byte, start int, end int, s string) []byte {
+	out := make([]byte, 0, len(b)-(end-start)+len(s))
+	out = append(out, b[:start]...)
+	out = append(out, s...)
+	return append(out, b[end:]...)
+}
+
+// configKeyName returns the variable name of key as it was given
+func configKeyName(key string) string {
+	return key[strings.LastIndexByte(key, '.')+1:]
+}
+
+// formatConfigSection returns the section header for key, such as
+// [branch "main"]
+func formatConfigSection(key string) string {
+	first := strings.IndexByte(key, '.')
+	last := strings.LastIndexByte(key, '.')
+	if first == last {
+		return "[" + key[:first] + "]"
+	}
+	subsection := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(key[first+1 : last])
+	return fmt.Sprintf("[%s \"%s\"]", key[:first], subsection)
+}
+
+// formatConfigEntry returns a name = value line, quoting and escaping the
+// value so that it reads back unchanged
+func formatConfigEntry(name string, value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\b", `\b`).Replace(value)
+	if value != strings.TrimSpace(value) || strings.ContainsAny(value, "#;") {
+		escaped = `"` + escaped + `"`
+	}
+	return name + " = " + escaped
+}
@@ -0,0 +1,92 @@
+package g
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	e(os.WriteFile(path, []byte(`# comment
+[core]
+	editor = "code --wait"  ; trailing comment
+	bare
+
+[remote "origin"]
+	url = a
+	fetch = one
+	fetch = two
+[alias] st = status
+`), 0644), t)
+	e(SetConfig(path, "core.editor", "vim"), t)
+	e(SetConfig(path, "core.autocrlf", "false"), t)
+	e(SetConfig(path, "remote.origin.url", "b"), t)
+	e(AddConfig(path, "remote.origin.fetch", "three"), t)
+	e(UnsetConfig(path, "core.bare"), t)
+	e(UnsetConfig(path, "alias.st"), t)
+	e(SetConfig(path, "alias.co", "checkout"), t)
+	e(SetConfig(path, "branch.feature/x.remote", " spaced # \"value\"\t"), t)
+	if err := SetConfig(path, "remote.origin.fetch", "four"); err == nil {
+		t.Error("expected an error setting a key with multiple values")
+	}
+	if err := UnsetConfig(path, "remote.origin.fetch"); err == nil {
+		t.Error("expected an error unsetting a key with multiple values")
+	}
+	if err := UnsetConfig(path, "core.missing"); !errors.Is(err, ErrConfigKeyNotFound) {
+		t.Errorf("expected ErrConfigKeyNotFound, got %v", err)
+	}
+	b, err := os.ReadFile(path)
+	e(err, t)
+	expected := `# comment
+[core]
+	editor = vim
+	autocrlf = false
+
+[remote "origin"]
+	url = b
+	fetch = one
+	fetch = two
+	fetch = three
+[alias]
+	co = checkout
+[branch "feature/x"]
+	remote = " spaced # \"value\"\t"
+`
+	if string(b) != expected {
+		t.Errorf("config = %q, want %q", b, expected)
+	}
+	c, err := ReadGitConfigFile(path, ConfigScopeLocal)
+	e(err, t)
+	if v, _ := c.Get("branch.feature/x.remote"); v != " spaced # \"value\"\t" {
+		t.Errorf("branch.feature/x.remote = %q", v)
+	}
+	if v := c.GetAll("remote.origin.fetch"); len(v) != 3 {
+		t.Errorf("remote.origin.fetch = %q", v)
+	}
+}
+
+func TestSetConfigNewFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "git", "config")
+	e(SetConfig(path, "user.name", "test"), t)
+	e(AddConfig(path, "user.email", "test@test.com"), t)
+	b, err := os.ReadFile(path)
+	e(err, t)
+	if expected := "[user]\n\tname = test\n\temail = test@test.com\n"; string(b) != expected {
+		t.Errorf("config = %q, want %q", b, expected)
+	}
+}
+
+func TestSetConfigLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	e(os.WriteFile(path+lockFileSuffix, nil, 0644), t)
+	var lockErr *LockError
+	if err := SetConfig(path, "user.name", "test"); !errors.As(err, &lockErr) {
+		t.Errorf("expected a LockError, got %v", err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Error("expected the config file not to be written")
+	}
+}
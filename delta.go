@@ -0,0 +1,243 @@
+package g
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// deltaReader streams the result of applying a pack file delta to the content
+// of its base object. Copy instructions are served from the base content and
+// insert instructions are read from the delta stream as they are reached.
+type deltaReader struct {
+	base    []byte
+	delta   io.ReadCloser
+	r       *bufio.Reader
+	pending []byte
+	insert  [0x7f]byte
+	length  int // expected length of the result
+	n       int // bytes of the result produced so far
+}
+
+func newDeltaReader(base []byte, factory func() (io.ReadCloser, error)) (io.ReadCloser, error) {
+	delta, err := factory()
+	if err != nil {
+		return nil, err
+	}
+	d := &deltaReader{base: base, delta: delta, r: bufio.NewReader(delta)}
+	baseLength, err := readDeltaLength(d.r)
+	if err != nil {
+		_ = delta.Close()
+		return nil, err
+	}
+	if baseLength != len(base) {
+		_ = delta.Close()
+		return nil, fmt.Errorf("delta base length %d does not match base object length %d", baseLength, len(base))
+	}
+	if d.length, err = readDeltaLength(d.r); err != nil {
+		_ = delta.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *deltaReader) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	d.n += n
+	return n, nil
+}
+
+// next decodes the next delta instruction into pending.
+func (d *deltaReader) next() error {
+	cmd, err := d.r.ReadByte()
+	if errors.Is(err, io.EOF) {
+		if d.n != d.length {
+			return fmt.Errorf("delta produced %d bytes, expected %d", d.n, d.length)
+		}
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case cmd&0b10000000 != 0:
+		// copy from base, the low 4 bits flag which offset bytes follow and
+		// the next 3 bits flag which size bytes follow.
+		var offset, size int
+		for i := 0; i < 7; i++ {
+			if cmd&(1<<i) == 0 {
+				continue
+			}
+			b, err := d.r.ReadByte()
+			if err != nil {
+				return err
+			}
+			if i < 4 {
+				offset |= int(b) << (8 * i)
+			} else {
+				size |= int(b) << (8 * (i - 4))
+			}
+		}
+		if size == 0 {
+			size = 0x10000
+		}
+		if offset+size > len(d.base) {
+			return fmt.Errorf("delta copy %d+%d out of bounds of base length %d", offset, size, len(d.base))
+		}
+		d.pending = d.base[offset : offset+size]
+	case cmd != 0:
+		// insert the next cmd bytes of the delta
+		if _, err := io.ReadFull(d.r, d.insert[:cmd]); err != nil {
+			return err
+		}
+		d.pending = d.insert[:cmd]
+	default:
+		return errors.New("invalid delta instruction 0")
+	}
+	if d.n+len(d.pending) > d.length {
+		return fmt.Errorf("delta produced more than %d bytes", d.length)
+	}
+	return nil
+}
+
+func (d *deltaReader) Close() error {
+	return d.delta.Close()
+}
+
+// readDeltaLength reads a little endian base 128 length from a delta header.
+func readDeltaLength(r io.ByteReader) (int, error) {
+	var l int
+	for shift := 0; ; shift += 7 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		l |= int(b&0b01111111) << shift
+		if b&0b10000000 == 0 {
+			return l, nil
+		}
+	}
+}
+
+// readDeltaTargetLength returns the length of the Object produced by applying
+// the delta streamed by factory.
+func readDeltaTargetLength(factory func() (io.ReadCloser, error)) (int, error) {
+	r, err := factory()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = r.Close() }()
+	buf := bufio.NewReader(r)
+	if _, err := readDeltaLength(buf); err != nil {
+		return 0, err
+	}
+	return readDeltaLength(buf)
+}
+
+// deltaBlockLength is the length of the blocks of the base content that are
+// indexed when searching for copies.
+const deltaBlockLength = 16
+
+// computeDelta returns a delta that produces target when applied to base.
+// Matching blocks of base are emitted as copy instructions and everything
+// else is emitted as insert instructions.
+func computeDelta(base []byte, target []byte) []byte {
+	delta := appendDeltaLength(nil, len(base))
+	delta = appendDeltaLength(delta, len(target))
+
+	// index the offsets of each block of base by content
+	blocks := make(map[string]int)
+	for i := 0; i+deltaBlockLength <= len(base); i += deltaBlockLength {
+		if _, ok := blocks[string(base[i:i+deltaBlockLength])]; !ok {
+			blocks[string(base[i:i+deltaBlockLength])] = i
+		}
+	}
+
+	var insert []byte
+	for i := 0; i < len(target); {
+		offset, ok := -1, false
+		if i+deltaBlockLength <= len(target) {
+			offset, ok = blocks[string(target[i:i+deltaBlockLength])]
+		}
+		if !ok {
+			insert = append(insert, target[i])
+			i++
+			continue
+		}
+		// extend the match backwards into pending inserts and forwards for
+		// as long as base and target agree.
+		start := i
+		for offset > 0 && len(insert) > 0 && base[offset-1] == insert[len(insert)-1] {
+			offset--
+			start--
+			insert = insert[:len(insert)-1]
+		}
+		end := i + deltaBlockLength
+		for end < len(target) && offset+end-start < len(base) && base[offset+end-start] == target[end] {
+			end++
+		}
+		delta = appendDeltaInsert(delta, insert)
+		insert = insert[:0]
+		delta = appendDeltaCopy(delta, offset, end-start)
+		i = end
+	}
+	return appendDeltaInsert(delta, insert)
+}
+
+// appendDeltaLength appends l as a little endian base 128 delta header length.
+func appendDeltaLength(b []byte, l int) []byte {
+	for l >= 0b10000000 {
+		b = append(b, byte(l)|0b10000000)
+		l >>= 7
+	}
+	return append(b, byte(l))
+}
+
+// appendDeltaInsert appends insert instructions for data, which are limited
+// to 127 bytes each.
+func appendDeltaInsert(b []byte, data []byte) []byte {
+	for len(data) > 0 {
+		n := min(len(data), 0x7f)
+		b = append(b, byte(n))
+		b = append(b, data[:n]...)
+		data = data[n:]
+	}
+	return b
+}
+
+// appendDeltaCopy appends copy instructions for size bytes of the base from
+// offset, which are limited to 0x10000 bytes each.
+func appendDeltaCopy(b []byte, offset int, size int) []byte {
+	for size > 0 {
+		n := min(size, 0x10000)
+		cmd := byte(0b10000000)
+		var args []byte
+		for i := 0; i < 4; i++ {
+			if v := byte(offset >> (8 * i)); v != 0 {
+				cmd |= 1 << i
+				args = append(args, v)
+			}
+		}
+		// a size of 0x10000 is encoded by omitting the size bytes
+		if n != 0x10000 {
+			for i := 0; i < 3; i++ {
+				if v := byte(n >> (8 * i)); v != 0 {
+					cmd |= 1 << (4 + i)
+					args = append(args, v)
+				}
+			}
+		}
+		b = append(b, cmd)
+		b = append(b, args...)
+		offset += n
+		size -= n
+	}
+	return b
+}
@@ -0,0 +1,247 @@
+package g
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+type (
+	// DiffStatus is the kind of change of a DiffEntry, as shown by git diff
+	// --name-status
+	DiffStatus byte
+	// DiffEntry is a path that differs between two trees, a tree and the
+	// index, or the index and the working tree. The Sha and Mode of a side
+	// without the path are unset.
+	DiffEntry struct {
+		Status  DiffStatus
+		OldPath string
+		NewPath string
+		OldSha  Sha
+		NewSha  Sha
+		OldMode FileMode
+		NewMode FileMode
+		// Similarity is the percentage of the content of OldPath kept in
+		// NewPath when the entry is renamed or copied
+		Similarity int
+		// worktree is true when the new side is read from the working tree
+		// rather than the object store
+		worktree bool
+	}
+	// DiffOptions configures how the paths that differ are found
+	DiffOptions struct {
+		// Renames pairs added paths with deleted paths of similar content
+		Renames bool
+		// Copies also pairs added paths with modified paths they are similar
+		// to, implying Renames
+		Copies bool
+		// FindCopiesHarder also pairs added paths with unmodified paths
+		// when Copies is set
+		FindCopiesHarder bool
+		// Threshold is the similarity, as a percentage, from which paths are
+		// paired. Zero means DefaultRenameThreshold.
+		Threshold int
+		// RenameLimit is the most added, or sources of, paths that are
+		// paired by similarity rather than only when identical. Zero means
+		// DefaultRenameLimit and below zero there is no limit.
+		RenameLimit int
+	}
+)
+
+const (
+	DiffAdded       DiffStatus = 'A'
+	DiffDeleted     DiffStatus = 'D'
+	DiffModified    DiffStatus = 'M'
+	DiffTypeChanged DiffStatus = 'T'
+	DiffRenamed     DiffStatus = 'R'
+	DiffCopied      DiffStatus = 'C'
+	// DiffUnmerged is a path left in conflict by a merge, which has no
+	// Sha or Mode on the side of the index
+	DiffUnmerged DiffStatus = 'U'
+)
+
+func (s DiffStatus) String() string {
+	return string(s)
+}
+
+// DiffTrees returns the paths that differ between the trees of commits a and
+// b, with renamed and copied paths paired as opts asks. An unset Sha is an
+// empty tree.
+func (r *Repository) DiffTrees(a Sha, b Sha, opts DiffOptions) ([]*DiffEntry, error) {
+	old, err := r.treeFiles(a)
+	if err != nil {
+		return nil, err
+	}
+	new, err := r.treeFiles(b)
+	if err != nil {
+		return nil, err
+	}
+	return r.diffFiles(old, new, opts)
+}
+
+// DiffIndex returns the paths that differ between the tree of commit and the
+// index, as git diff --staged does, with renamed and copied paths paired as
+// opts asks. A path left in conflict by a merge is a DiffUnmerged entry.
+func (r *Repository) DiffIndex(commit Sha, opts DiffOptions) ([]*DiffEntry, error) {
+	old, err := r.treeFiles(commit)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	new := make(map[string]*fileInfo)
+	var unmerged []string
+	for _, v := range idx.Files() {
+		if v.Unmerged() != 0 {
+			delete(old, v.path)
+			unmerged = append(unmerged, v.path)
+			continue
+		}
+		new[v.path] = v.index
+	}
+	entries, err := r.diffFiles(old, new, opts)
+	if err != nil {
+		return nil, err
+	}
+	return addUnmerged(entries, unmerged), nil
+}
+
+// DiffWorktree returns the paths in the index that differ in the working
+// tree. Untracked files are not included, so no path is renamed or copied. A
+// path left in conflict by a merge is a DiffUnmerged entry.
+func (r *Repository) DiffWorktree() ([]*DiffEntry, error) {
+	status, err := r.FsStatus(r.Path())
+	if err != nil {
+		return nil, err
+	}
+	old := make(map[string]*fileInfo)
+	new := make(map[string]*fileInfo)
+	var unmerged []string
+	for _, v := range status.Files() {
+		if v.Unmerged() != 0 {
+			unmerged = append(unmerged, v.path)
+			continue
+		}
+		if v.index == nil {
+			continue
+		}
+		old[v.path] = v.index
+		switch v.wdStatus {
+		case IndexAndWorkingTreeMatch:
+			new[v.path] = v.index
+		case WorktreeChangedSinceIndex, TypeChangedInWorktreeSinceIndex:
+			sha := v.index.Sha
+			if v.wd.Mode != ModeGitlink {
+				if sha, err = r.HashBlob(v.path); err != nil {
+					return nil, err
+				}
+			}
+			new[v.path] = &fileInfo{Sha: sha, Mode: v.wd.Mode}
+		}
+	}
+	entries := compareFiles(old, new)
+	for _, v := range entries {
+		v.worktree = v.Status != DiffDeleted
+	}
+	return addUnmerged(entries, unmerged), nil
+}
+
+// addUnmerged adds an entry for each of the unmerged paths to entries, sorted
+// by path
+func addUnmerged(entries []*DiffEntry, unmerged []string) []*DiffEntry {
+	if len(unmerged) == 0 {
+		return entries
+	}
+	for _, v := range unmerged {
+		entries = append(entries, &DiffEntry{Status: DiffUnmerged, OldPath: v, NewPath: v})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].NewPath < entries[j].NewPath
+	})
+	return entries
+}
+
+// treeFiles returns the files of the tree of commit keyed by path
+func (r *Repository) treeFiles(commit Sha) (map[string]*fileInfo, error) {
+	files := make(map[string]*fileInfo)
+	if !commit.IsSet() {
+		return files, nil
+	}
+	committed, err := r.CommittedFiles(commit)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range committed {
+		files[v.path] = v.commit
+	}
+	return files, nil
+}
+
+// diffFiles returns the differences between the files of two sides keyed by
+// path, pairing renamed and copied paths as opts asks
+func (r *Repository) diffFiles(old map[string]*fileInfo, new map[string]*fileInfo, opts DiffOptions) ([]*DiffEntry, error) {
+	entries := compareFiles(old, new)
+	if !opts.Renames && !opts.Copies {
+		return entries, nil
+	}
+	return r.findRenames(entries, old, opts)
+}
+
+// compareFiles compares the files of two sides keyed by path and returns the
+// differences sorted by path
+func compareFiles(old map[string]*fileInfo, new map[string]*fileInfo) []*DiffEntry {
+	var entries []*DiffEntry
+	for path, o := range old {
+		n, ok := new[path]
+		switch {
+		case !ok:
+			entries = append(entries, &DiffEntry{Status: DiffDeleted, OldPath: path, NewPath: path, OldSha: o.Sha, OldMode: o.Mode})
+		case o.Mode.fileType() != n.Mode.fileType():
+			entries = append(entries, &DiffEntry{Status: DiffTypeChanged, OldPath: path, NewPath: path, OldSha: o.Sha, NewSha: n.Sha, OldMode: o.Mode, NewMode: n.Mode})
+		case !o.Sha.Matches(n.Sha) || o.Mode != n.Mode:
+			entries = append(entries, &DiffEntry{Status: DiffModified, OldPath: path, NewPath: path, OldSha: o.Sha, NewSha: n.Sha, OldMode: o.Mode, NewMode: n.Mode})
+		}
+	}
+	for path, n := range new {
+		if _, ok := old[path]; !ok {
+			entries = append(entries, &DiffEntry{Status: DiffAdded, OldPath: path, NewPath: path, NewSha: n.Sha, NewMode: n.Mode})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].NewPath < entries[j].NewPath
+	})
+	return entries
+}
+
+// DiffContent returns the old and new content of e. A side without the path
+// has no content, a symlink has its target and a submodule a line naming its
+// commit.
+func (r *Repository) DiffContent(e *DiffEntry) ([]byte, []byte, error) {
+	old, err := r.diffSideContent(e.OldPath, e.OldSha, e.OldMode, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	new, err := r.diffSideContent(e.NewPath, e.NewSha, e.NewMode, e.worktree)
+	if err != nil {
+		return nil, nil, err
+	}
+	return old, new, nil
+}
+
+func (r *Repository) diffSideContent(path string, sha Sha, mode FileMode, worktree bool) ([]byte, error) {
+	switch {
+	case !sha.IsSet() || mode == 0:
+		return nil, nil
+	case mode == ModeGitlink:
+		return []byte(fmt.Sprintf("Subproject commit %s\n", sha)), nil
+	case worktree && mode == ModeSymlink:
+		target, err := os.Readlink(filepath.Join(r.Path(), path))
+		return []byte(target), err
+	case worktree:
+		return os.ReadFile(filepath.Join(r.Path(), path))
+	}
+	return r.readBlob(sha)
+}
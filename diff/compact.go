@@ -0,0 +1,310 @@
+package diff
+
+// The weights of git's indent heuristic, which were tuned against a corpus
+// of human-judged diffs.
+const (
+	maxIndent                       = 200
+	maxBlanks                       = 20
+	maxSliding                      = 100
+	startOfFilePenalty              = 1
+	endOfFilePenalty                = 21
+	totalBlankWeight                = -30
+	postBlankWeight                 = 6
+	relativeIndentPenalty           = -4
+	relativeIndentWithBlankPenalty  = 10
+	relativeOutdentPenalty          = 24
+	relativeOutdentWithBlankPenalty = 17
+	relativeDedentPenalty           = 23
+	relativeDedentWithBlankPenalty  = 17
+	indentWeight                    = 60
+)
+
+type (
+	// changedLines marks the lines of one text that an edit script deletes
+	// or inserts
+	changedLines struct {
+		lines   []string
+		changed []bool
+	}
+	// group is a run of changed lines, start to end, which is empty between
+	// two unchanged lines. The nth group of each text is between the same
+	// pair of equal lines.
+	group struct {
+		start int
+		end   int
+	}
+	// splitMeasurement describes the lines around a split before line
+	// split. An indent of -1 is a blank line, or no line at all.
+	splitMeasurement struct {
+		endOfFile  bool
+		indent     int
+		preBlank   int
+		preIndent  int
+		postBlank  int
+		postIndent int
+	}
+	// splitScore is the score of placing a group of changes, lower is better
+	splitScore struct {
+		effectiveIndent int
+		penalty         int
+	}
+)
+
+// compact returns edits, the edit script between a and b, with each group of
+// changed lines slid as far as it can go, then back up to line up with a
+// group of changes in the other text when it can, or else to where the
+// indent heuristic scores it best, as git does. Deletions are listed before
+// the insertions they are next to.
+func compact(a []string, b []string, edits []Edit) []Edit {
+	old := &changedLines{lines: a, changed: make([]bool, len(a))}
+	new := &changedLines{lines: b, changed: make([]bool, len(b))}
+	for _, v := range edits {
+		switch v.Op {
+		case Delete:
+			old.changed[v.Old] = true
+		case Insert:
+			new.changed[v.New] = true
+		}
+	}
+	old.compact(new)
+	new.compact(old)
+
+	return changedEdits(old.changed, new.changed)
+}
+
+// compact slides the groups of c, keeping the group of other that is
+// between the same equal lines in step
+func (c *changedLines) compact(other *changedLines) {
+	g, o := c.first(), other.first()
+	for {
+		if g.end > g.start {
+			// slide the group up and then down as far as it goes, which
+			// may join it to the groups either side, until it stops growing
+			var earliestEnd int
+			matchingEnd := -1
+			for size := -1; size != g.end-g.start; {
+				size = g.end - g.start
+				for c.slideUp(&g) {
+					other.previous(&o)
+				}
+				earliestEnd = g.end
+				matchingEnd = -1
+				if o.end > o.start {
+					matchingEnd = g.end
+				}
+				for c.slideDown(&g) {
+					other.next(&o)
+					if o.end > o.start {
+						matchingEnd = g.end
+					}
+				}
+			}
+			if g.end == earliestEnd {
+				// the group cannot slide
+			} else if matchingEnd != -1 {
+				for o.end == o.start {
+					c.slideUp(&g)
+					other.previous(&o)
+				}
+			} else {
+				// place the group where its ends split the text best
+				best := c.bestSplit(g, earliestEnd)
+				for g.end > best {
+					c.slideUp(&g)
+					other.previous(&o)
+				}
+			}
+		}
+		if !c.next(&g) {
+			return
+		}
+		other.next(&o)
+	}
+}
+
+// bestSplit returns where g, which can slide up until it ends at
+// earliestEnd, is best ended according to git's indent heuristic. The last
+// of the best scoring positions is chosen.
+func (c *changedLines) bestSplit(g group, earliestEnd int) int {
+	size := g.end - g.start
+	shift := max(earliestEnd, g.end-size-1, g.end-maxSliding)
+	best := -1
+	var bestScore splitScore
+	for ; shift <= g.end; shift++ {
+		var score splitScore
+		score.add(c.measureSplit(shift))
+		score.add(c.measureSplit(shift - size))
+		if best == -1 || score.compare(bestScore) <= 0 {
+			best, bestScore = shift, score
+		}
+	}
+	return best
+}
+
+// first returns the group before the first unchanged line
+func (c *changedLines) first() group {
+	g := group{}
+	for g.end < len(c.lines) && c.changed[g.end] {
+		g.end++
+	}
+	return g
+}
+
+// next moves g to the group after the unchanged line that ends it, returning
+// false when it is the last
+func (c *changedLines) next(g *group) bool {
+	if g.end == len(c.lines) {
+		return false
+	}
+	g.start = g.end + 1
+	for g.end = g.start; g.end < len(c.lines) && c.changed[g.end]; g.end++ {
+	}
+	return true
+}
+
+// previous moves g to the group before the unchanged line that starts it,
+// returning false when it is the first
+func (c *changedLines) previous(g *group) bool {
+	if g.start == 0 {
+		return false
+	}
+	g.end = g.start - 1
+	for g.start = g.end; g.start > 0 && c.changed[g.start-1]; g.start-- {
+	}
+	return true
+}
+
+// slideDown moves g down a line when the line after it is the same as its
+// first, joining it to the group that follows, and reports whether it moved
+func (c *changedLines) slideDown(g *group) bool {
+	if g.end == len(c.lines) || c.lines[g.start] != c.lines[g.end] {
+		return false
+	}
+	c.changed[g.start], c.changed[g.end] = false, true
+	g.start++
+	for g.end++; g.end < len(c.lines) && c.changed[g.end]; g.end++ {
+	}
+	return true
+}
+
+// slideUp moves g up a line when the line before it is the same as its
+// last, joining it to the group before, and reports whether it moved
+func (c *changedLines) slideUp(g *group) bool {
+	if g.start == 0 || c.lines[g.start-1] != c.lines[g.end-1] {
+		return false
+	}
+	g.start--
+	g.end--
+	c.changed[g.start], c.changed[g.end] = true, false
+	for ; g.start > 0 && c.changed[g.start-1]; g.start-- {
+	}
+	return true
+}
+
+// measureSplit measures the lines around a split before line split
+func (c *changedLines) measureSplit(split int) splitMeasurement {
+	m := splitMeasurement{indent: -1, preIndent: -1, postIndent: -1}
+	if split >= len(c.lines) {
+		m.endOfFile = true
+	} else {
+		m.indent = indent(c.lines[split])
+	}
+	for i := split - 1; i >= 0; i-- {
+		if m.preIndent = indent(c.lines[i]); m.preIndent != -1 {
+			break
+		}
+		if m.preBlank++; m.preBlank == maxBlanks {
+			m.preIndent = 0
+			break
+		}
+	}
+	for i := split + 1; i < len(c.lines); i++ {
+		if m.postIndent = indent(c.lines[i]); m.postIndent != -1 {
+			break
+		}
+		if m.postBlank++; m.postBlank == maxBlanks {
+			m.postIndent = 0
+			break
+		}
+	}
+	return m
+}
+
+// indent returns the width of the leading whitespace of line, with tabs
+// stopping every 8 columns, or -1 when the line is blank
+func indent(line string) int {
+	n := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case ' ':
+			n++
+		case '\t':
+			n += 8 - n%8
+		case '\n', '\v', '\f', '\r':
+		default:
+			return n
+		}
+		if n >= maxIndent {
+			return maxIndent
+		}
+	}
+	return -1
+}
+
+// add adds the score of the split m to s
+func (s *splitScore) add(m splitMeasurement) {
+	if m.preIndent == -1 && m.preBlank == 0 {
+		s.penalty += startOfFilePenalty
+	}
+	if m.endOfFile {
+		s.penalty += endOfFilePenalty
+	}
+	postBlank := 0
+	if m.indent == -1 {
+		postBlank = 1 + m.postBlank
+	}
+	totalBlank := m.preBlank + postBlank
+	s.penalty += totalBlankWeight * totalBlank
+	s.penalty += postBlankWeight * postBlank
+
+	indent := m.indent
+	if indent == -1 {
+		indent = m.postIndent
+	}
+	anyBlanks := totalBlank != 0
+	s.effectiveIndent += indent
+
+	switch {
+	case indent == -1 || m.preIndent == -1 || indent == m.preIndent:
+	case indent > m.preIndent:
+		if anyBlanks {
+			s.penalty += relativeIndentWithBlankPenalty
+		} else {
+			s.penalty += relativeIndentPenalty
+		}
+	case m.postIndent != -1 && m.postIndent > indent:
+		if anyBlanks {
+			s.penalty += relativeOutdentWithBlankPenalty
+		} else {
+			s.penalty += relativeOutdentPenalty
+		}
+	default:
+		if anyBlanks {
+			s.penalty += relativeDedentWithBlankPenalty
+		} else {
+			s.penalty += relativeDedentPenalty
+		}
+	}
+}
+
+// compare returns less than zero when s is a better score than t, and zero
+// when they are as good
+func (s splitScore) compare(t splitScore) int {
+	cmp := 0
+	if s.effectiveIndent > t.effectiveIndent {
+		cmp = 1
+	} else if s.effectiveIndent < t.effectiveIndent {
+		cmp = -1
+	}
+	return indentWeight*cmp + s.penalty - t.penalty
+}
@@ -0,0 +1,153 @@
+// Package diff computes line based differences between two texts and
+// formats them as unified hunks.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type (
+	// Op is the operation of an Edit
+	Op uint8
+	// Edit is a single line of an edit script. Old is the index of the line
+	// in the old text for Equal and Delete, New is the index of the line in
+	// the new text for Equal and Insert, and both are -1 otherwise.
+	Edit struct {
+		Op  Op
+		Old int
+		New int
+	}
+	// Algorithm selects how the edit script is computed
+	Algorithm uint8
+)
+
+const (
+	Equal Op = iota
+	Delete
+	Insert
+)
+
+const (
+	// Myers finds a minimal edit script
+	Myers Algorithm = iota
+	// Patience anchors the edit script on lines that are unique in both
+	// texts, which often reads better for reordered code
+	Patience
+	// Histogram anchors the edit script on the least frequent common lines,
+	// extending patience to lines that are not unique
+	Histogram
+)
+
+// binaryProbe is how much of a file is checked for a NUL byte, as git does
+const binaryProbe = 8000
+
+// ParseAlgorithm returns the Algorithm called name, as it is given to
+// git diff --diff-algorithm
+func ParseAlgorithm(name string) (Algorithm, error) {
+	switch strings.ToLower(name) {
+	case "myers", "default", "minimal":
+		return Myers, nil
+	case "patience":
+		return Patience, nil
+	case "histogram":
+		return Histogram, nil
+	}
+	return 0, fmt.Errorf("error: option diff-algorithm accepts \"myers\", \"minimal\", \"patience\" and \"histogram\"")
+}
+
+func (a Algorithm) String() string {
+	switch a {
+	case Patience:
+		return "patience"
+	case Histogram:
+		return "histogram"
+	default:
+		return "myers"
+	}
+}
+
+// SplitLines splits b into lines, each keeping its trailing newline. The last
+// line has no newline when b does not end with one.
+func SplitLines(b []byte) []string {
+	var lines []string
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			lines = append(lines, string(b))
+			break
+		}
+		lines = append(lines, string(b[:i+1]))
+		b = b[i+1:]
+	}
+	return lines
+}
+
+// IsBinary returns true when b looks like binary content, meaning there is a
+// NUL byte in the first 8000 bytes
+func IsBinary(b []byte) bool {
+	if len(b) > binaryProbe {
+		b = b[:binaryProbe]
+	}
+	return bytes.IndexByte(b, 0) >= 0
+}
+
+// Lines returns the edit script that turns the lines of a into the lines of
+// b using algorithm, with the changes slid into place as git places them
+// with its default indent heuristic
+func Lines(a []string, b []string, algorithm Algorithm) []Edit {
+	var edits []Edit
+	switch algorithm {
+	case Patience:
+		// as in git, patience and histogram match their anchors before any
+		// common prefix or suffix
+		edits = patience(a, b)
+	case Histogram:
+		edits = histogram(a, b)
+	default:
+		// myers trims the texts itself, as which lines it matches depends
+		// on how often they occur in the whole of each text
+		edits = myers(a, b)
+	}
+	return compact(a, b, edits)
+}
+
+// shift offsets the line indexes of edits by old and new
+func shift(edits []Edit, old int, new int) []Edit {
+	for i := range edits {
+		if edits[i].Old >= 0 {
+			edits[i].Old += old
+		}
+		if edits[i].New >= 0 {
+			edits[i].New += new
+		}
+	}
+	return edits
+}
+
+// replace returns the edit script deleting every line of a and inserting
+// every line of b
+func replace(a []string, b []string) []Edit {
+	edits := make([]Edit, 0, len(a)+len(b))
+	for i := range a {
+		edits = append(edits, Edit{Op: Delete, Old: i, New: -1})
+	}
+	for i := range b {
+		edits = append(edits, Edit{Op: Insert, Old: -1, New: i})
+	}
+	return edits
+}
+
+// Stat returns the number of inserted and deleted lines of edits
+func Stat(edits []Edit) (insertions int, deletions int) {
+	for _, v := range edits {
+		switch v.Op {
+		case Insert:
+			insertions++
+		case Delete:
+			deletions++
+		}
+	}
+	return insertions, deletions
+}
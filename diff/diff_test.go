@@ -0,0 +1,285 @@
+package diff
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// apply checks that edits turns a into b
+func apply(t *testing.T, a []string, b []string, edits []Edit) {
+	t.Helper()
+	var old, new []string
+	for _, v := range edits {
+		switch v.Op {
+		case Equal:
+			if a[v.Old] != b[v.New] {
+				t.Fatalf("equal edit of different lines %q and %q", a[v.Old], b[v.New])
+			}
+			old = append(old, a[v.Old])
+			new = append(new, b[v.New])
+		case Delete:
+			old = append(old, a[v.Old])
+		case Insert:
+			new = append(new, b[v.New])
+		}
+	}
+	if strings.Join(old, "") != strings.Join(a, "") || strings.Join(new, "") != strings.Join(b, "") {
+		t.Fatalf("edits do not cover the texts: %v", edits)
+	}
+}
+
+func TestLines(t *testing.T) {
+	for _, tt := range []struct {
+		a, b    string
+		changes int
+	}{
+		{"", "", 0},
+		{"a\n", "", 1},
+		{"", "a\n", 1},
+		{"a\nb\nc\n", "a\nb\nc\n", 0},
+		{"a\nb\nc\na\nb\nb\na\n", "c\nb\na\nb\na\nc\n", 5},
+		{"a\nb\nc\n", "a\nx\nc\n", 2},
+		{"a\nb", "a\nb\n", 2},
+		{"x\na\nb\nc\nx\n", "a\nb\nc\nx\n", 1},
+		{"1\n2\n3\n4\n5\n", "5\n4\n3\n2\n1\n", 8},
+	} {
+		a, b := SplitLines([]byte(tt.a)), SplitLines([]byte(tt.b))
+		for _, algorithm := range []Algorithm{Myers, Patience, Histogram} {
+			edits := Lines(a, b, algorithm)
+			apply(t, a, b, edits)
+			insertions, deletions := Stat(edits)
+			if algorithm == Myers && insertions+deletions != tt.changes {
+				t.Errorf("%q to %q: myers made %d changes, want %d", tt.a, tt.b, insertions+deletions, tt.changes)
+			}
+		}
+	}
+}
+
+func TestMyersMinimal(t *testing.T) {
+	// the edit script of short texts is as small as their longest common
+	// subsequence allows, when no line is common enough to be left out
+	rnd := rand.New(rand.NewSource(1))
+	text := func() []string {
+		var lines []string
+		for c := 'a'; c < 'g'; c++ {
+			for i := rnd.Intn(3); i > 0; i-- {
+				lines = append(lines, string(c)+"\n")
+			}
+		}
+		rnd.Shuffle(len(lines), func(i, j int) { lines[i], lines[j] = lines[j], lines[i] })
+		return lines
+	}
+	for i := 0; i < 1000; i++ {
+		a, b := text(), text()
+		lcs := make([][]int, len(a)+1)
+		for x := range lcs {
+			lcs[x] = make([]int, len(b)+1)
+		}
+		for x := len(a) - 1; x >= 0; x-- {
+			for y := len(b) - 1; y >= 0; y-- {
+				if a[x] == b[y] {
+					lcs[x][y] = lcs[x+1][y+1] + 1
+				} else {
+					lcs[x][y] = max(lcs[x+1][y], lcs[x][y+1])
+				}
+			}
+		}
+		edits := Lines(a, b, Myers)
+		apply(t, a, b, edits)
+		insertions, deletions := Stat(edits)
+		if want := len(a) + len(b) - 2*lcs[0][0]; insertions+deletions != want {
+			t.Errorf("%q to %q: myers made %d changes, want %d", a, b, insertions+deletions, want)
+		}
+	}
+}
+
+func TestMyersLargeRewrite(t *testing.T) {
+	// rewriting every line of a large file needs neither quadratic memory
+	// nor time, whichever algorithm falls back to myers
+	var a, b, c []string
+	for i := 0; i < 20000; i++ {
+		a = append(a, fmt.Sprintf("old line %d\n", i))
+		b = append(b, fmt.Sprintf("new line %d\n", i))
+		if i%2 == 0 {
+			c = append(c, a[i])
+		} else {
+			c = append(c, b[i])
+		}
+	}
+	for _, algorithm := range []Algorithm{Myers, Patience, Histogram} {
+		edits := Lines(a, b, algorithm)
+		apply(t, a, b, edits)
+		if insertions, deletions := Stat(edits); insertions != len(b) || deletions != len(a) {
+			t.Errorf("%s made %d insertions and %d deletions, want %d and %d", algorithm, insertions, deletions, len(b), len(a))
+		}
+	}
+	// nor does rewriting every other line, which is still minimal
+	edits := Lines(a, c, Myers)
+	apply(t, a, c, edits)
+	if insertions, deletions := Stat(edits); insertions != len(c)/2 || deletions != len(a)/2 {
+		t.Errorf("myers made %d insertions and %d deletions, want %d and %d", insertions, deletions, len(c)/2, len(a)/2)
+	}
+}
+
+func TestPatienceAnchorsUniqueLines(t *testing.T) {
+	// myers matches the braces, patience keeps the functions whole
+	a := SplitLines([]byte("func a() {\n\treturn 1\n}\n\nfunc c() {\n\treturn 3\n}\n"))
+	b := SplitLines([]byte("func a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 2\n}\n\nfunc c() {\n\treturn 3\n}\n"))
+	for _, algorithm := range []Algorithm{Patience, Histogram} {
+		hunks := Hunks(a, b, Lines(a, b, algorithm), 0)
+		if len(hunks) != 1 {
+			t.Fatalf("%s: got %d hunks", algorithm, len(hunks))
+		}
+		var added string
+		for _, v := range hunks[0].Lines {
+			added += v.Op.Prefix() + v.Text
+		}
+		if added != "+func b() {\n+\treturn 2\n+}\n+\n" {
+			t.Errorf("%s: got hunk\n%s", algorithm, added)
+		}
+	}
+}
+
+func TestHunks(t *testing.T) {
+	var old, new []string
+	for i := 1; i <= 20; i++ {
+		line := strings.Repeat("x", i) + "\n"
+		old = append(old, line)
+		switch i {
+		case 2:
+			new = append(new, "changed\n")
+		case 10:
+		case 12:
+			new = append(new, line, "inserted\n")
+		default:
+			new = append(new, line)
+		}
+	}
+	hunks := Hunks(old, new, Lines(old, new, Myers), 3)
+	var headers []string
+	for _, v := range hunks {
+		headers = append(headers, v.Header())
+	}
+	// the changes at 10 and 12 are close enough to share a hunk
+	expected := "@@ -1,5 +1,5 @@,@@ -7,9 +7,9 @@"
+	if strings.Join(headers, ",") != expected {
+		t.Errorf("got %s, want %s", strings.Join(headers, ","), expected)
+	}
+
+	// hunks at the start and end of a file, and of an empty file
+	for _, tt := range []struct {
+		a, b   string
+		header string
+	}{
+		{"", "a\n", "@@ -0,0 +1 @@"},
+		{"a\n", "", "@@ -1 +0,0 @@"},
+		{"a\nb\n", "b\n", "@@ -1,2 +1 @@"},
+		{"a\nb\nc\nd\ne\n", "a\nb\nc\nd\n", "@@ -2,4 +2,3 @@"},
+	} {
+		a, b := SplitLines([]byte(tt.a)), SplitLines([]byte(tt.b))
+		hunks := Hunks(a, b, Lines(a, b, Myers), 3)
+		if len(hunks) != 1 || hunks[0].Header() != tt.header {
+			t.Errorf("%q to %q: got %v, want %s", tt.a, tt.b, hunks, tt.header)
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	// a change is slid next to the change in the other text it can line up
+	// with, and otherwise to where the indent heuristic scores it best, as
+	// git shows it
+	for _, tt := range []struct {
+		a, b, diff string
+	}{
+		{"x\ny\ny\nz\n", "x\ny\nw\nz\n", " x\n y\n-y\n+w\n z\n"},
+		{"x\ny\ny\nz\n", "x\ny\nz\n", " x\n y\n-y\n z\n"},
+		{"a\n\nb\n\nc\n", "a\n\nc\n", " a\n \n-b\n-\n c\n"},
+		{"\tx\n}\n\ty\n", "\tx\n}\n}\n\ty\n", " \tx\n+}\n }\n \ty\n"},
+	} {
+		a, b := SplitLines([]byte(tt.a)), SplitLines([]byte(tt.b))
+		for _, algorithm := range []Algorithm{Myers, Patience, Histogram} {
+			var diff strings.Builder
+			for _, v := range Lines(a, b, algorithm) {
+				switch v.Op {
+				case Insert:
+					diff.WriteString(v.Op.Prefix() + b[v.New])
+				default:
+					diff.WriteString(v.Op.Prefix() + a[v.Old])
+				}
+			}
+			if diff.String() != tt.diff {
+				t.Errorf("%q to %q: %s diff is %q, want %q", tt.a, tt.b, algorithm, diff.String(), tt.diff)
+			}
+		}
+	}
+}
+
+func TestIsBinary(t *testing.T) {
+	if IsBinary([]byte("text\n")) || !IsBinary([]byte("a\x00b")) {
+		t.Error("binary detection failed")
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	for _, tt := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"a\n", "", 0},
+		{"a\nb\n", "a\nb\n", 100},
+		{"a\nb\n", "a\r\nb\r\n", 66},
+		{"a\nb\nc\nd\n", "a\nb\n", 50},
+		{"a\nb\n", "b\na\n", 100},
+		{strings.Repeat("x", 128), strings.Repeat("x", 64), 50},
+	} {
+		if actual := Similarity([]byte(tt.a), []byte(tt.b)); actual != tt.expected {
+			t.Errorf("%q and %q: expected %d got %d", tt.a, tt.b, tt.expected, actual)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base := "1\n2\n3\n4\n5\n6\n7\n8\n9\n"
+	for _, tt := range []struct {
+		name         string
+		ours, theirs string
+		style        ConflictStyle
+		expected     string
+		conflicts    int
+	}{
+		{"one side", "1\n2\n3\nx\n5\n6\n7\n8\n9\n", base, ConflictMerge, "1\n2\n3\nx\n5\n6\n7\n8\n9\n", 0},
+		{"both sides", "1\nx\n3\n4\n5\n6\n7\n8\n9\n", "1\n2\n3\n4\n5\n6\n7\ny\n9\n", ConflictMerge, "1\nx\n3\n4\n5\n6\n7\ny\n9\n", 0},
+		{"same change", "1\nx\n3\n4\n5\n6\n7\n8\n9\n", "1\nx\n3\n4\n5\n6\n7\n8\n9\n", ConflictMerge, "1\nx\n3\n4\n5\n6\n7\n8\n9\n", 0},
+		{
+			"conflict", "1\n2\nx\n4\n5\n6\n7\n8\n9\n", "1\n2\ny\n4\n5\n6\n7\n8\n9\n", ConflictMerge,
+			"1\n2\n<<<<<<< ours\nx\n=======\ny\n>>>>>>> theirs\n4\n5\n6\n7\n8\n9\n", 1,
+		},
+		{
+			"diff3", "1\n2\nx\n4\n5\n6\n7\n8\n9\n", "1\n2\ny\n4\n5\n6\n7\n8\n9\n", ConflictDiff3,
+			"1\n2\n<<<<<<< ours\nx\n||||||| base\n3\n=======\ny\n>>>>>>> theirs\n4\n5\n6\n7\n8\n9\n", 1,
+		},
+		{
+			// lines changed the same way by both sides are left out
+			"zealous", "1\n2\nx\nz\n5\n6\n7\n8\n9\n", "1\n2\ny\nz\n5\n6\n7\n8\n9\n", ConflictMerge,
+			"1\n2\n<<<<<<< ours\nx\n=======\ny\n>>>>>>> theirs\nz\n5\n6\n7\n8\n9\n", 1,
+		},
+		{
+			// conflicts separated by few unchanged lines are joined
+			"joined", "x\n2\n3\nx\n5\n6\n7\n8\n9\n", "y\n2\n3\ny\n5\n6\n7\n8\n9\n", ConflictMerge,
+			"<<<<<<< ours\nx\n2\n3\nx\n=======\ny\n2\n3\ny\n>>>>>>> theirs\n5\n6\n7\n8\n9\n", 1,
+		},
+		{
+			"no newline", "1\n2\n3\n4\n5\n6\n7\n8\nx", "1\n2\n3\n4\n5\n6\n7\n8\ny", ConflictMerge,
+			"1\n2\n3\n4\n5\n6\n7\n8\n<<<<<<< ours\nx\n=======\ny\n>>>>>>> theirs\n", 1,
+		},
+	} {
+		opts := MergeOptions{Style: tt.style, Ours: "ours", Base: "base", Theirs: "theirs"}
+		actual, conflicts := Merge(SplitLines([]byte(base)), SplitLines([]byte(tt.ours)), SplitLines([]byte(tt.theirs)), opts)
+		if string(actual) != tt.expected || conflicts != tt.conflicts {
+			t.Errorf("%s: expected %d conflicts in %q got %d in %q", tt.name, tt.conflicts, tt.expected, conflicts, actual)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package diff
+
+// histogramMaxChain is the number of occurrences in the old text above which
+// a line is too common to anchor on, as in git and JGit
+const histogramMaxChain = 64
+
+// histogram returns an edit script anchored on the longest common region,
+// or the region whose rarest line occurs least often in a when that is
+// rarer than the longest found so far, scanning b in order. The lines before
+// and after the region are diffed recursively. When every common line is
+// too frequent it falls back to myers.
+func histogram(a []string, b []string) []Edit {
+	if len(a) == 0 || len(b) == 0 {
+		return replace(a, b)
+	}
+	occurrences := make(map[string][]int)
+	for i, v := range a {
+		occurrences[v] = append(occurrences[v], i)
+	}
+	var best struct {
+		a, b, length, count int
+	}
+	// git starts from an empty region that it counts as one line long
+	best.length, best.count = 1, histogramMaxChain+1
+	found, common := false, false
+	for bi := 0; bi < len(b); {
+		next := bi + 1
+		indexes := occurrences[b[bi]]
+		if len(indexes) > 0 {
+			common = true
+		}
+		if len(indexes) == 0 || len(indexes) > best.count {
+			bi = next
+			continue
+		}
+		for k := 0; k < len(indexes); {
+			// extend the region around a[ai] == b[bi] in both directions,
+			// keeping the count of its rarest line
+			as, bs := indexes[k], bi
+			count := len(indexes)
+			for as > 0 && bs > 0 && a[as-1] == b[bs-1] {
+				as--
+				bs--
+				count = min(count, len(occurrences[a[as]]))
+			}
+			ae, be := indexes[k]+1, bi+1
+			for ae < len(a) && be < len(b) && a[ae] == b[be] {
+				count = min(count, len(occurrences[a[ae]]))
+				ae++
+				be++
+			}
+			if length := ae - as; length > best.length || count < best.count {
+				best.a, best.b, best.length, best.count = as, bs, length, count
+				found = true
+			}
+			// lines of b already inside a region need not be tried again,
+			// nor the lines of a
+			next = max(next, be)
+			for k < len(indexes) && indexes[k] < ae {
+				k++
+			}
+		}
+		bi = next
+	}
+	if common && best.count > histogramMaxChain {
+		return myers(a, b)
+	}
+	if !found {
+		return replace(a, b)
+	}
+	edits := histogram(a[:best.a], b[:best.b])
+	for i := 0; i < best.length; i++ {
+		edits = append(edits, Edit{Op: Equal, Old: best.a + i, New: best.b + i})
+	}
+	ae, be := best.a+best.length, best.b+best.length
+	return append(edits, shift(histogram(a[ae:], b[be:]), ae, be)...)
+}
@@ -0,0 +1,258 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// conflictMarkerSize is the length of the <, =, | and > runs of conflict
+// markers
+const conflictMarkerSize = 7
+
+// mergeConflictGap is the most unchanged lines between two conflicts that are
+// shown as a single conflict, as git does
+const mergeConflictGap = 3
+
+type (
+	// ConflictStyle is how a conflict is written by Merge
+	ConflictStyle uint8
+	// MergeOptions configures Merge
+	MergeOptions struct {
+		Algorithm Algorithm
+		Style     ConflictStyle
+		// Ours, Base and Theirs label the sides of a conflict
+		Ours   string
+		Base   string
+		Theirs string
+	}
+	// mergeChunk is a region of the merged text. A conflict has the lines
+	// of each side, any other chunk only the lines of ours, which are the
+	// result.
+	mergeChunk struct {
+		conflict bool
+		// resolved is true for a region changed by one side, or by both
+		// in the same way, rather than left unchanged
+		resolved bool
+		base     []string
+		ours     []string
+		theirs   []string
+	}
+)
+
+const (
+	// ConflictMerge writes the lines of each side of a conflict, with
+	// lines that both sides changed the same way outside the markers
+	ConflictMerge ConflictStyle = iota
+	// ConflictDiff3 also writes the lines of the base of a conflict
+	ConflictDiff3
+)
+
+// ParseConflictStyle parses the value of merge.conflictStyle
+func ParseConflictStyle(style string) (ConflictStyle, error) {
+	switch style {
+	case "merge":
+		return ConflictMerge, nil
+	case "diff3":
+		return ConflictDiff3, nil
+	}
+	return 0, fmt.Errorf("error: unknown style '%s' given for 'merge.conflictstyle'", style)
+}
+
+// Merge merges the changes made from base to ours and from base to theirs,
+// all split into lines with SplitLines. Regions changed by only one side, or
+// by both in the same way, take that change. Regions changed differently are
+// conflicts, written between conflict markers. It returns the merged content
+// and the number of conflicts.
+func Merge(base []string, ours []string, theirs []string, opts MergeOptions) ([]byte, int) {
+	chunks := mergeChunks(base, ours, theirs, opts.Algorithm)
+	if opts.Style == ConflictMerge {
+		chunks = joinConflicts(refineConflicts(chunks, opts.Algorithm))
+	}
+	var b strings.Builder
+	conflicts := 0
+	for _, v := range chunks {
+		if !v.conflict {
+			for _, line := range v.ours {
+				b.WriteString(line)
+			}
+			continue
+		}
+		conflicts++
+		writeMarker(&b, '<', opts.Ours)
+		writeLines(&b, v.ours)
+		if opts.Style == ConflictDiff3 {
+			writeMarker(&b, '|', opts.Base)
+			writeLines(&b, v.base)
+		}
+		writeMarker(&b, '=', "")
+		writeLines(&b, v.theirs)
+		writeMarker(&b, '>', opts.Theirs)
+	}
+	return []byte(b.String()), conflicts
+}
+
+// mergeChunks splits the three texts into chunks, alternating between lines
+// unchanged by both sides and regions that either side changed, which are
+// resolved when only one side changed them or both did the same
+func mergeChunks(base []string, ours []string, theirs []string, algorithm Algorithm) []mergeChunk {
+	inOurs := matches(base, Lines(base, ours, algorithm))
+	inTheirs := matches(base, Lines(base, theirs, algorithm))
+	var chunks []mergeChunk
+	i, o, t := 0, 0, 0
+	for i < len(base) || o < len(ours) || t < len(theirs) {
+		// lines that neither side changed
+		start := i
+		for i < len(base) && inOurs[i] == o && inTheirs[i] == t {
+			i, o, t = i+1, o+1, t+1
+		}
+		if i > start {
+			chunks = append(chunks, mergeChunk{base: base[start:i], ours: base[start:i]})
+			continue
+		}
+		// a changed region ends at the next base line kept by both sides
+		end := i
+		for end < len(base) && (inOurs[end] < 0 || inTheirs[end] < 0) {
+			end++
+		}
+		oursEnd, theirsEnd := len(ours), len(theirs)
+		if end < len(base) {
+			oursEnd, theirsEnd = inOurs[end], inTheirs[end]
+		}
+		chunks = append(chunks, resolveChunk(base[i:end], ours[o:oursEnd], theirs[t:theirsEnd]))
+		i, o, t = end, oursEnd, theirsEnd
+	}
+	return chunks
+}
+
+// matches returns the line of the other text that each line of base is kept
+// as by edits, or -1 when it is deleted
+func matches(base []string, edits []Edit) []int {
+	m := make([]int, len(base))
+	for i := range m {
+		m[i] = -1
+	}
+	for _, v := range edits {
+		if v.Op == Equal {
+			m[v.Old] = v.New
+		}
+	}
+	return m
+}
+
+// resolveChunk returns the chunk of a region changed by either side
+func resolveChunk(base []string, ours []string, theirs []string) mergeChunk {
+	switch {
+	case equalLines(base, ours):
+		return mergeChunk{resolved: true, base: base, ours: theirs}
+	case equalLines(base, theirs), equalLines(ours, theirs):
+		return mergeChunk{resolved: true, base: base, ours: ours}
+	}
+	return mergeChunk{conflict: true, base: base, ours: ours, theirs: theirs}
+}
+
+// refineConflicts splits each conflict around the lines that both sides
+// changed it to, leaving only the lines that differ in conflict. The lines in
+// common are not a change of either side.
+func refineConflicts(chunks []mergeChunk, algorithm Algorithm) []mergeChunk {
+	var refined []mergeChunk
+	for _, c := range chunks {
+		if !c.conflict {
+			refined = append(refined, c)
+			continue
+		}
+		edits := Lines(c.ours, c.theirs, algorithm)
+		for i := 0; i < len(edits); {
+			if edits[i].Op == Equal {
+				start := i
+				for i < len(edits) && edits[i].Op == Equal {
+					i++
+				}
+				lines := c.ours[edits[start].Old : edits[i-1].Old+1]
+				refined = append(refined, mergeChunk{ours: lines})
+				continue
+			}
+			var ours, theirs []string
+			for ; i < len(edits) && edits[i].Op != Equal; i++ {
+				if edits[i].Op == Delete {
+					ours = append(ours, c.ours[edits[i].Old])
+				} else {
+					theirs = append(theirs, c.theirs[edits[i].New])
+				}
+			}
+			refined = append(refined, mergeChunk{conflict: true, base: c.base, ours: ours, theirs: theirs})
+		}
+	}
+	return refined
+}
+
+// joinConflicts joins conflicts separated by no more than mergeConflictGap
+// lines that are not a change of either side into one conflict
+func joinConflicts(chunks []mergeChunk) []mergeChunk {
+	var joined []mergeChunk
+	for i := 0; i < len(chunks); i++ {
+		c := chunks[i]
+		if len(joined) == 0 || !joined[len(joined)-1].conflict || c.resolved {
+			joined = append(joined, c)
+			continue
+		}
+		last := &joined[len(joined)-1]
+		if c.conflict {
+			last.ours = concatLines(last.ours, c.ours)
+			last.theirs = concatLines(last.theirs, c.theirs)
+			continue
+		}
+		// the unchanged lines up to the next conflict
+		var gap []string
+		j := i
+		for ; j < len(chunks) && !chunks[j].conflict && !chunks[j].resolved; j++ {
+			gap = append(gap, chunks[j].ours...)
+		}
+		if j == len(chunks) || !chunks[j].conflict || len(gap) > mergeConflictGap {
+			joined = append(joined, c)
+			continue
+		}
+		last.ours = concatLines(last.ours, gap, chunks[j].ours)
+		last.theirs = concatLines(last.theirs, gap, chunks[j].theirs)
+		i = j
+	}
+	return joined
+}
+
+func concatLines(lines ...[]string) []string {
+	var c []string
+	for _, v := range lines {
+		c = append(c, v...)
+	}
+	return c
+}
+
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeLines writes lines, ending the last with a newline if it has none so
+// that a conflict marker starts a line
+func writeLines(b *strings.Builder, lines []string) {
+	for _, v := range lines {
+		b.WriteString(v)
+	}
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		b.WriteByte('\n')
+	}
+}
+
+func writeMarker(b *strings.Builder, marker byte, label string) {
+	b.WriteString(strings.Repeat(string(marker), conflictMarkerSize))
+	if label != "" {
+		b.WriteString(" " + label)
+	}
+	b.WriteByte('\n')
+}
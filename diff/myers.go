@@ -0,0 +1,379 @@
+package diff
+
+const (
+	// myersMinCost is the least number of edits the search for the middle of
+	// an edit script is allowed before giving up on it being minimal
+	myersMinCost = 256
+	// myersSnake is the length of a run of equal lines that is good enough
+	// to split at once the search is past myersMinCost edits
+	myersSnake = 20
+	// myersMaxEqual is the number of times a line may occur in the other
+	// text above which it is too common to be worth matching
+	myersMaxEqual = 1024
+	// myersScanWindow is how far the lines either side of a common line are
+	// looked at to decide whether it is worth matching
+	myersScanWindow = 100
+)
+
+type (
+	// myersDiff is the state of the linear space variation of the algorithm
+	// of Eugene Myers, "An O(ND) Difference Algorithm and Its Variations".
+	// a and b are the lines kept to be matched, at aIndex and bIndex in the
+	// texts, and aChanged and bChanged mark the lines of the texts deleted
+	// and inserted. forward and backward hold the furthest reaching x of
+	// each diagonal k, offset by len(b)+1, for the search from each end of a
+	// range.
+	myersDiff struct {
+		a        []string
+		b        []string
+		aIndex   []int
+		bIndex   []int
+		aChanged []bool
+		bChanged []bool
+		forward  []int
+		backward []int
+		maxCost  int
+	}
+)
+
+// myers returns an edit script using the divide and conquer algorithm of
+// Eugene Myers, which finds the middle snake of the edit script in linear
+// space and recurses either side of it, as git does. Lines with no match in
+// the other text are left out of the search, and past a cost that grows
+// with the square root of the size of the texts the search gives up on a
+// minimal edit script and splits at a long run of equal lines or at the
+// furthest point reached.
+func myers(a []string, b []string) []Edit {
+	n, m := len(a), len(b)
+	prefix := 0
+	for prefix < n && prefix < m && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < n-prefix && suffix < m-prefix && a[n-1-suffix] == b[m-1-suffix] {
+		suffix++
+	}
+	d := &myersDiff{aChanged: make([]bool, n), bChanged: make([]bool, m)}
+	d.a, d.aIndex = d.keep(a, b, d.aChanged, prefix, n-suffix)
+	d.b, d.bIndex = d.keep(b, a, d.bChanged, prefix, m-suffix)
+	d.forward = make([]int, len(d.a)+len(d.b)+3)
+	d.backward = make([]int, len(d.a)+len(d.b)+3)
+	d.maxCost = max(bogoSqrt(len(d.a)+len(d.b)+3), myersMinCost)
+	d.compare(0, len(d.a), 0, len(d.b), false)
+	return changedEdits(d.aChanged, d.bChanged)
+}
+
+// keep returns the lines of text between lo and hi worth matching with
+// other, and their indexes, marking the rest as changed. A line is left out
+// when other does not have it, or when it is common in other and surrounded
+// mostly by lines that are left out.
+func (d *myersDiff) keep(text []string, other []string, changed []bool, lo int, hi int) ([]string, []int) {
+	count := make(map[string]int)
+	for _, v := range other {
+		count[v]++
+	}
+	limit := min(bogoSqrt(len(text)), myersMaxEqual)
+	// 0 for a line without a match, 2 for a common line and 1 otherwise
+	matches := make([]int, hi)
+	for i := lo; i < hi; i++ {
+		switch c := count[text[i]]; {
+		case c == 0:
+		case c >= limit:
+			matches[i] = 2
+		default:
+			matches[i] = 1
+		}
+	}
+	var lines []string
+	var indexes []int
+	for i := lo; i < hi; i++ {
+		if matches[i] == 1 || (matches[i] == 2 && !unmatchedAround(matches, i, lo, hi-1)) {
+			lines = append(lines, text[i])
+			indexes = append(indexes, i)
+		} else {
+			changed[i] = true
+		}
+	}
+	return lines, indexes
+}
+
+// unmatchedAround reports whether the common line i is between runs of
+// lines without a match or common lines, mostly without a match, up to
+// myersScanWindow lines long and within start and end
+func unmatchedAround(matches []int, i int, start int, end int) bool {
+	start, end = max(start, i-myersScanWindow), min(end, i+myersScanWindow)
+	before, commonBefore := 0, 1
+	for r := 1; i-r >= start; r++ {
+		if matches[i-r] == 0 {
+			before++
+		} else if matches[i-r] == 2 {
+			commonBefore++
+		} else {
+			break
+		}
+	}
+	if before == 0 {
+		return false
+	}
+	after, commonAfter := 0, 1
+	for r := 1; i+r <= end; r++ {
+		if matches[i+r] == 0 {
+			after++
+		} else if matches[i+r] == 2 {
+			commonAfter++
+		} else {
+			break
+		}
+	}
+	if after == 0 {
+		return false
+	}
+	unmatched, common := before+after, commonBefore+commonAfter
+	return common*4 < common+unmatched
+}
+
+// compare marks the lines changed turning a[aLo:aHi] into b[bLo:bHi]. When
+// minimal the edit script is minimal whatever it costs.
+func (d *myersDiff) compare(aLo int, aHi int, bLo int, bHi int, minimal bool) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+	switch {
+	case aLo == aHi:
+		for i := bLo; i < bHi; i++ {
+			d.bChanged[d.bIndex[i]] = true
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.aChanged[d.aIndex[i]] = true
+		}
+	default:
+		x, y, minLo, minHi := d.split(aLo, aHi, bLo, bHi, minimal)
+		d.compare(aLo, x, bLo, y, minLo)
+		d.compare(x, aHi, y, bHi, minHi)
+	}
+}
+
+// split returns a point (x, y) on an edit script turning a[aLo:aHi] into
+// b[bLo:bHi], which neither starts nor ends with an equal line, by searching
+// forward from the start and backward from the end until the paths meet.
+// Unless minimal, past maxCost edits it returns the furthest point either
+// search reached, or sooner a point after a long run of equal lines, and
+// whether the edit scripts either side of it need to be minimal.
+func (d *myersDiff) split(aLo int, aHi int, bLo int, bHi int, minimal bool) (int, int, bool, bool) {
+	off := len(d.b) + 1
+	fwd, bwd := d.forward, d.backward
+	// the diagonals of the range, and those the searches start on
+	kMin, kMax := aLo-bHi, aHi-bLo
+	fMid, bMid := aLo-bLo, aHi-bHi
+	odd := (fMid-bMid)&1 != 0
+	fMin, fMax, bMin, bMax := fMid, fMid, bMid, bMid
+	fwd[off+fMid] = aLo
+	bwd[off+bMid] = aHi
+	for cost := 1; ; cost++ {
+		snake := false
+		// extend the forward search by one edit, marking the diagonals just
+		// outside of it as unreachable
+		if fMin > kMin {
+			fMin--
+			fwd[off+fMin-1] = -1
+		} else {
+			fMin++
+		}
+		if fMax < kMax {
+			fMax++
+			fwd[off+fMax+1] = -1
+		} else {
+			fMax--
+		}
+		for k := fMax; k >= fMin; k -= 2 {
+			x := fwd[off+k+1]
+			if fwd[off+k-1] >= x {
+				x = fwd[off+k-1] + 1
+			}
+			start := x
+			y := x - k
+			for x < aHi && y < bHi && d.a[x] == d.b[y] {
+				x++
+				y++
+			}
+			if x-start > myersSnake {
+				snake = true
+			}
+			fwd[off+k] = x
+			if odd && bMin <= k && k <= bMax && bwd[off+k] <= x {
+				return x, y, true, true
+			}
+		}
+
+		// and the backward search
+		if bMin > kMin {
+			bMin--
+			bwd[off+bMin-1] = aHi + 1
+		} else {
+			bMin++
+		}
+		if bMax < kMax {
+			bMax++
+			bwd[off+bMax+1] = aHi + 1
+		} else {
+			bMax--
+		}
+		for k := bMax; k >= bMin; k -= 2 {
+			x := bwd[off+k+1] - 1
+			if bwd[off+k-1] < bwd[off+k+1] {
+				x = bwd[off+k-1]
+			}
+			start := x
+			y := x - k
+			for x > aLo && y > bLo && d.a[x-1] == d.b[y-1] {
+				x--
+				y--
+			}
+			if start-x > myersSnake {
+				snake = true
+			}
+			bwd[off+k] = x
+			if !odd && fMin <= k && k <= fMax && x <= fwd[off+k] {
+				return x, y, true, true
+			}
+		}
+
+		if minimal {
+			continue
+		}
+		if snake && cost > myersMinCost {
+			if x, y, ok := d.forwardSnake(aLo, aHi, bLo, bHi, fMin, fMax, fMid, cost); ok {
+				return x, y, true, false
+			}
+			if x, y, ok := d.backwardSnake(aLo, aHi, bLo, bHi, bMin, bMax, bMid, cost); ok {
+				return x, y, false, true
+			}
+		}
+		if cost < d.maxCost {
+			continue
+		}
+		// give up on a minimal edit script and split at the point that is
+		// furthest from the end it was searched from
+		fBest, fx := -1, 0
+		for k := fMax; k >= fMin; k -= 2 {
+			x := min(fwd[off+k], aHi)
+			y := x - k
+			if y > bHi {
+				x, y = bHi+k, bHi
+			}
+			if x+y > fBest {
+				fBest, fx = x+y, x
+			}
+		}
+		bBest, bx := aHi+bHi+1, 0
+		for k := bMax; k >= bMin; k -= 2 {
+			x := max(bwd[off+k], aLo)
+			y := x - k
+			if y < bLo {
+				x, y = bLo+k, bLo
+			}
+			if x+y < bBest {
+				bBest, bx = x+y, x
+			}
+		}
+		if aHi+bHi-bBest < fBest-(aLo+bLo) {
+			return fx, fBest - fx, true, false
+		}
+		return bx, bBest - bx, false, true
+	}
+}
+
+// forwardSnake returns the point reached by the forward search after at
+// least myersSnake equal lines that has made the most progress for its
+// distance from the middle diagonal, when that is more than 4 lines for
+// each of cost edits
+func (d *myersDiff) forwardSnake(aLo int, aHi int, bLo int, bHi int, kMin int, kMax int, kMid int, cost int) (int, int, bool) {
+	off := len(d.b) + 1
+	best, bx, by := 0, 0, 0
+	for k := kMax; k >= kMin; k -= 2 {
+		x := d.forward[off+k]
+		y := x - k
+		v := x - aLo + y - bLo - abs(k-kMid)
+		if v <= 4*cost || v <= best || x < aLo+myersSnake || x >= aHi || y < bLo+myersSnake || y >= bHi {
+			continue
+		}
+		if d.equalRun(x-myersSnake, y-myersSnake) {
+			best, bx, by = v, x, y
+		}
+	}
+	return bx, by, best > 0
+}
+
+// backwardSnake is forwardSnake for the backward search, returning a point
+// before at least myersSnake equal lines
+func (d *myersDiff) backwardSnake(aLo int, aHi int, bLo int, bHi int, kMin int, kMax int, kMid int, cost int) (int, int, bool) {
+	off := len(d.b) + 1
+	best, bx, by := 0, 0, 0
+	for k := kMax; k >= kMin; k -= 2 {
+		x := d.backward[off+k]
+		y := x - k
+		v := aHi - x + bHi - y - abs(k-kMid)
+		if v <= 4*cost || v <= best || x <= aLo || x > aHi-myersSnake || y <= bLo || y > bHi-myersSnake {
+			continue
+		}
+		if d.equalRun(x, y) {
+			best, bx, by = v, x, y
+		}
+	}
+	return bx, by, best > 0
+}
+
+// equalRun reports whether the myersSnake lines from a[x] and b[y] are equal
+func (d *myersDiff) equalRun(x int, y int) bool {
+	for i := 0; i < myersSnake; i++ {
+		if d.a[x+i] != d.b[y+i] {
+			return false
+		}
+	}
+	return true
+}
+
+// changedEdits returns the edit script deleting the lines of the old text
+// and inserting the lines of the new text marked as changed, listing
+// deletions before the insertions they are next to
+func changedEdits(aChanged []bool, bChanged []bool) []Edit {
+	edits := make([]Edit, 0, max(len(aChanged), len(bChanged)))
+	for i, j := 0, 0; i < len(aChanged) || j < len(bChanged); {
+		switch {
+		case i < len(aChanged) && aChanged[i]:
+			edits = append(edits, Edit{Op: Delete, Old: i, New: -1})
+			i++
+		case j < len(bChanged) && bChanged[j]:
+			edits = append(edits, Edit{Op: Insert, Old: -1, New: j})
+			j++
+		default:
+			edits = append(edits, Edit{Op: Equal, Old: i, New: j})
+			i++
+			j++
+		}
+	}
+	return edits
+}
+
+// bogoSqrt returns a power of two close to the square root of n, as git
+// approximates the cost allowed to find the middle of an edit script
+func bogoSqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+	return i
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
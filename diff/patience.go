@@ -0,0 +1,113 @@
+package diff
+
+import "sort"
+
+// patience returns an edit script anchored on the lines that appear exactly
+// once in both a and b. The longest run of such lines that is in the same
+// order in both texts is matched, and the gaps between them are diffed
+// recursively. Without unique lines it falls back to myers.
+func patience(a []string, b []string) []Edit {
+	if len(a) == 0 || len(b) == 0 {
+		return replace(a, b)
+	}
+	type count struct {
+		a, b   int
+		aIndex int
+		bIndex int
+	}
+	counts := make(map[string]*count)
+	for i, v := range a {
+		c, ok := counts[v]
+		if !ok {
+			c = &count{}
+			counts[v] = c
+		}
+		c.a++
+		c.aIndex = i
+	}
+	for i, v := range b {
+		if c, ok := counts[v]; ok {
+			c.b++
+			c.bIndex = i
+		}
+	}
+	var unique []match
+	for _, c := range counts {
+		if c.a == 1 && c.b == 1 {
+			unique = append(unique, match{a: c.aIndex, b: c.bIndex})
+		}
+	}
+	if len(unique) == 0 {
+		return myers(a, b)
+	}
+	sort.Slice(unique, func(i, j int) bool { return unique[i].a < unique[j].a })
+	return anchored(a, b, longestIncreasing(unique), patience)
+}
+
+// match is a pair of equal lines, at index a of the old text and b of the
+// new text
+type match struct {
+	a int
+	b int
+}
+
+// longestIncreasing returns the longest subsequence of matches, which are
+// ordered by a, that is also increasing in b, using patience sorting
+func longestIncreasing(matches []match) []match {
+	// tails[i] is the index of the smallest b ending an increasing run of
+	// length i+1, and prev links each match to the one before it in its run
+	var tails []int
+	prev := make([]int, len(matches))
+	for i, v := range matches {
+		j := sort.Search(len(tails), func(j int) bool { return matches[tails[j]].b > v.b })
+		if j > 0 {
+			prev[i] = tails[j-1]
+		} else {
+			prev[i] = -1
+		}
+		if j == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[j] = i
+		}
+	}
+	run := make([]match, len(tails))
+	for i, k := len(tails)-1, tails[len(tails)-1]; i >= 0; i, k = i-1, prev[k] {
+		run[i] = matches[k]
+	}
+	return run
+}
+
+// anchored returns the edit script matching each of anchors, which are in
+// order in both a and b, and diffing the lines between them with diff. As
+// git does, the equal lines before an anchor are matched to it before those
+// after the previous one, which decides where a change between repeated
+// lines is placed.
+func anchored(a []string, b []string, anchors []match, diff func([]string, []string) []Edit) []Edit {
+	var edits []Edit
+	ai, bi := 0, 0
+	for i := 0; ; i++ {
+		nextA, nextB := len(a), len(b)
+		if i < len(anchors) {
+			nextA, nextB = anchors[i].a, anchors[i].b
+			for nextA > ai && nextB > bi && a[nextA-1] == b[nextB-1] {
+				nextA--
+				nextB--
+			}
+		}
+		for ai < nextA && bi < nextB && a[ai] == b[bi] {
+			edits = append(edits, Edit{Op: Equal, Old: ai, New: bi})
+			ai++
+			bi++
+		}
+		if ai < nextA || bi < nextB {
+			edits = append(edits, shift(diff(a[ai:nextA], b[bi:nextB]), ai, bi)...)
+		}
+		if i == len(anchors) {
+			return edits
+		}
+		for ai, bi = nextA, nextB; ai <= anchors[i].a; ai, bi = ai+1, bi+1 {
+			edits = append(edits, Edit{Op: Equal, Old: ai, New: bi})
+		}
+	}
+}
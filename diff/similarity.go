@@ -0,0 +1,59 @@
+package diff
+
+// similarityChunk is the most bytes counted as one chunk by Similarity
+const similarityChunk = 64
+
+// Chunks is the number of bytes of a text in each of its distinct chunks,
+// kept so that a text compared with many others is split only once
+type Chunks struct {
+	counts map[string]int
+	size   int
+}
+
+// Similarity returns how much of the content of a is kept in b, as a
+// percentage of the larger of the two. Like git's rename detection it
+// compares chunks of up to 64 bytes ending at a newline rather than lines,
+// and ignores a carriage return before a newline in text.
+func Similarity(a []byte, b []byte) int {
+	return NewChunks(a).Similarity(NewChunks(b))
+}
+
+// NewChunks splits b into the chunks compared by Similarity
+func NewChunks(b []byte) *Chunks {
+	c := &Chunks{counts: make(map[string]int), size: len(b)}
+	text := !IsBinary(b)
+	chunk := make([]byte, 0, similarityChunk)
+	for i, v := range b {
+		if text && v == '\r' && i+1 < len(b) && b[i+1] == '\n' {
+			continue
+		}
+		chunk = append(chunk, v)
+		if len(chunk) < similarityChunk && v != '\n' {
+			continue
+		}
+		c.counts[string(chunk)] += len(chunk)
+		chunk = chunk[:0]
+	}
+	if len(chunk) > 0 {
+		c.counts[string(chunk)] += len(chunk)
+	}
+	return c
+}
+
+// Size returns the length of the text c was split from
+func (c *Chunks) Size() int {
+	return c.size
+}
+
+// Similarity returns how much of the text of c is kept in the text of b, as
+// Similarity does
+func (c *Chunks) Similarity(b *Chunks) int {
+	if c.size == 0 || b.size == 0 {
+		return 0
+	}
+	copied := 0
+	for k, n := range b.counts {
+		copied += min(n, c.counts[k])
+	}
+	return copied * 100 / max(c.size, b.size)
+}
@@ -0,0 +1,152 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+type (
+	// Hunk is a group of changed lines with the unchanged lines around them.
+	// OldStart and NewStart are the 1-based line numbers of the first line
+	// of the hunk, or of the line before it when the hunk has no lines on
+	// that side.
+	Hunk struct {
+		OldStart int
+		OldLines int
+		NewStart int
+		NewLines int
+		Lines    []Line
+	}
+	// Line is a line of a Hunk. Text keeps its newline, so the last line of
+	// a file without a trailing newline has none.
+	Line struct {
+		Op   Op
+		Text string
+	}
+)
+
+// Hunks groups edits, the edit script between a and b, into hunks with
+// context unchanged lines around each change. Changes separated by no more
+// than twice context unchanged lines share a hunk.
+func Hunks(a []string, b []string, edits []Edit, context int) []Hunk {
+	if context < 0 {
+		context = 0
+	}
+	var hunks []Hunk
+	// the number of lines of each text before edits[counted]
+	oldPos, newPos, counted := 0, 0, 0
+	for i := 0; i < len(edits); {
+		if edits[i].Op == Equal {
+			i++
+			continue
+		}
+		// the hunk starts context lines before the first change and ends
+		// when more than twice context unchanged lines follow a change
+		start := max(i-context, 0)
+		end := i
+		for end < len(edits) {
+			if edits[end].Op != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].Op == Equal {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				end = min(end+context, len(edits))
+				break
+			}
+			end = run
+		}
+		for ; counted < start; counted++ {
+			if edits[counted].Op != Insert {
+				oldPos++
+			}
+			if edits[counted].Op != Delete {
+				newPos++
+			}
+		}
+		hunks = append(hunks, newHunk(a, b, edits[start:end], oldPos, newPos))
+		i = end
+	}
+	return hunks
+}
+
+// newHunk returns the hunk of edits, which follow oldPos lines of a and
+// newPos lines of b
+func newHunk(a []string, b []string, edits []Edit, oldPos int, newPos int) Hunk {
+	// the position in each text is that of the first line on that side, or
+	// the number of lines before the hunk when it has none
+	h := Hunk{OldStart: oldPos, NewStart: newPos}
+	for _, v := range edits {
+		switch v.Op {
+		case Equal:
+			h.Lines = append(h.Lines, Line{Op: Equal, Text: a[v.Old]})
+			h.OldLines++
+			h.NewLines++
+		case Delete:
+			h.Lines = append(h.Lines, Line{Op: Delete, Text: a[v.Old]})
+			h.OldLines++
+		case Insert:
+			h.Lines = append(h.Lines, Line{Op: Insert, Text: b[v.New]})
+			h.NewLines++
+		}
+	}
+	if h.OldLines > 0 {
+		h.OldStart++
+	}
+	if h.NewLines > 0 {
+		h.NewStart++
+	}
+	return h
+}
+
+// Header returns the @@ line of the hunk, leaving out line counts of 1
+func (h Hunk) Header() string {
+	return fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.OldStart, h.OldLines), hunkRange(h.NewStart, h.NewLines))
+}
+
+// FunctionContext returns the line of a, the old text of h, that the hunk
+// is in, as git shows after the @@ line by default: the nearest line before
+// the hunk that starts with a letter, _ or $. It returns an empty string
+// when there is none.
+func (h Hunk) FunctionContext(a []string) string {
+	start := h.OldStart - 1
+	if h.OldLines == 0 {
+		start = h.OldStart
+	}
+	for i := min(start, len(a)) - 1; i >= 0; i-- {
+		line := a[i]
+		if line == "" {
+			continue
+		}
+		if c := line[0]; c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+			// git cuts the line to 80 bytes before trimming its end
+			if len(line) > 80 {
+				line = line[:80]
+			}
+			return strings.TrimRight(line, " \t\r\n\v\f")
+		}
+	}
+	return ""
+}
+
+func hunkRange(start int, lines int) string {
+	if lines == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, lines)
+}
+
+// Prefix returns the character that starts a line of a unified diff
+func (op Op) Prefix() string {
+	switch op {
+	case Delete:
+		return "-"
+	case Insert:
+		return "+"
+	default:
+		return " "
+	}
+}
@@ -0,0 +1,160 @@
+package g
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const gitFilePrefix = "gitdir: "
+
+// discoverRepository finds the working tree and git directory for the
+// directory start. GIT_DIR names the git directory, with the working tree
+// from GIT_WORK_TREE or start. Otherwise start and each of its parents are
+// checked for name, which is either a git directory or a file containing
+// "gitdir: <path>", stopping before any directory in
+// GIT_CEILING_DIRECTORIES. GIT_WORK_TREE overrides the working tree of a
+// discovered repository.
+func discoverRepository(start string, name string) (string, string, error) {
+	workTree, hasWorkTree := os.LookupEnv("GIT_WORK_TREE")
+	if hasWorkTree {
+		workTree = absPath(start, workTree)
+	}
+	if gitDir, ok := os.LookupEnv("GIT_DIR"); ok && gitDir != "" {
+		gitDir = absPath(start, gitDir)
+		if !isGitDirectory(gitDir) {
+			return "", "", fmt.Errorf("fatal: not a git repository: '%s'", gitDir)
+		}
+		if !hasWorkTree {
+			workTree = start
+		}
+		return workTree, gitDir, nil
+	}
+	ceilings := ceilingDirectories(start)
+	for dir := start; ; {
+		gitDir, err := readGitLink(filepath.Join(dir, name))
+		if err != nil {
+			return "", "", err
+		}
+		if gitDir != "" {
+			if !hasWorkTree {
+				workTree = dir
+			}
+			return workTree, gitDir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir || ceilings[parent] {
+			break
+		}
+		dir = parent
+	}
+	return "", "", fmt.Errorf("fatal: not a git repository (or any of the parent directories): %s", name)
+}
+
+// readGitLink returns path when it is a git directory, or the git directory
+// that path refers to when it is a gitdir: file. An empty string is returned
+// when path is neither.
+func readGitLink(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	if info.IsDir() {
+		if isGitDirectory(path) {
+			return path, nil
+		}
+		return "", nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	line, _, _ := bytes.Cut(b, []byte("\n"))
+	target, ok := strings.CutPrefix(strings.TrimRight(string(line), "\r"), gitFilePrefix)
+	if !ok || target == "" {
+		return "", fmt.Errorf("fatal: invalid gitfile format: %s", path)
+	}
+	target = absPath(filepath.Dir(path), target)
+	if !isGitDirectory(target) {
+		return "", fmt.Errorf("fatal: not a git repository: %s", target)
+	}
+	return target, nil
+}
+
+// isGitDirectory reports whether path looks like a git directory, having a
+// HEAD file and an objects directory
+func isGitDirectory(path string) bool {
+	if info, err := os.Stat(filepath.Join(path, DefaultHeadFile)); err != nil || info.IsDir() {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(path, DefaultObjectsDirectory))
+	return err == nil && info.IsDir()
+}
+
+// ceilingDirectories returns the absolute directories listed in
+// GIT_CEILING_DIRECTORIES that discovery from start must not enter. start
+// itself is always checked.
+func ceilingDirectories(start string) map[string]bool {
+	ceilings := make(map[string]bool)
+	for _, v := range filepath.SplitList(os.Getenv("GIT_CEILING_DIRECTORIES")) {
+		if v == "" || !filepath.IsAbs(v) {
+			continue
+		}
+		v = filepath.Clean(v)
+		if v != start {
+			ceilings[v] = true
+		}
+	}
+	return ceilings
+}
+
+// absPath returns path made absolute relative to dir
+func absPath(dir string, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(dir, path)
+}
+
+// Prefix returns the subdirectory of the working tree that the repository was
+// opened from, which is empty at the top of the working tree
+func (r *Repository) Prefix() string {
+	return r.prefix
+}
+
+// Pathspec resolves path, which is relative to the directory the repository
+// was opened from, to a path relative to the top of the working tree. An
+// error is returned if path is outside the working tree.
+func (r *Repository) Pathspec(path string) (string, error) {
+	var rel string
+	if filepath.IsAbs(path) {
+		var err error
+		if rel, err = filepath.Rel(r.Path(), path); err != nil {
+			return "", err
+		}
+	} else {
+		rel = filepath.Join(filepath.FromSlash(r.prefix), path)
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("fatal: %s: '%s' is outside repository at '%s'", path, path, r.Path())
+	}
+	return rel, nil
+}
+
+// MatchPathspec reports whether path is one of pathspecs, resolved by
+// Pathspec, or inside one of them
+func MatchPathspec(path string, pathspecs []string) bool {
+	for _, v := range pathspecs {
+		if v == "." || path == v || strings.HasPrefix(path, v+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
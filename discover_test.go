@@ -0,0 +1,109 @@
+package g
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenDiscovery(t *testing.T) {
+	unsetenv(t, "GIT_DIR", "GIT_WORK_TREE", "GIT_CEILING_DIRECTORIES")
+	dir := t.TempDir()
+	_, err := Init(dir)
+	e(err, t)
+	sub := filepath.Join(dir, "a", "b")
+	e(os.MkdirAll(sub, 0755), t)
+
+	r, err := Open(sub)
+	e(err, t)
+	if r.Path() != dir || r.GitPath() != filepath.Join(dir, DefaultGitDirectory) {
+		t.Errorf("opened %s with git directory %s", r.Path(), r.GitPath())
+	}
+	if r.Prefix() != "a/b" {
+		t.Errorf("prefix = %s", r.Prefix())
+	}
+	for path, expected := range map[string]string{
+		"c":                          filepath.Join("a", "b", "c"),
+		".":                          filepath.Join("a", "b"),
+		"../c":                       filepath.Join("a", "c"),
+		"../..":                      ".",
+		filepath.Join(dir, "a", "d"): filepath.Join("a", "d"),
+	} {
+		actual, err := r.Pathspec(path)
+		e(err, t)
+		if actual != expected {
+			t.Errorf("pathspec %s = %s, want %s", path, actual, expected)
+		}
+	}
+	if _, err := r.Pathspec("../../../c"); err == nil {
+		t.Error("expected an error for a path outside the repository")
+	}
+
+	// discovery does not enter a ceiling directory
+	t.Setenv("GIT_CEILING_DIRECTORIES", dir)
+	if _, err := Open(sub); err == nil {
+		t.Error("expected no repository below the ceiling directory")
+	}
+	t.Setenv("GIT_CEILING_DIRECTORIES", filepath.Dir(dir))
+	if _, err := Open(sub); err != nil {
+		t.Errorf("expected a repository below the ceiling directory: %v", err)
+	}
+	if _, err := Open(dir); err != nil {
+		t.Errorf("expected the ceiling directory itself to be checked: %v", err)
+	}
+}
+
+func TestOpenGitFile(t *testing.T) {
+	unsetenv(t, "GIT_DIR", "GIT_WORK_TREE", "GIT_CEILING_DIRECTORIES")
+	dir := t.TempDir()
+	gitDir := filepath.Join(dir, "repo.git")
+	_, err := Init(dir, WithGitDirectory("repo.git"))
+	e(err, t)
+	work := filepath.Join(dir, "work")
+	e(os.MkdirAll(filepath.Join(work, "sub"), 0755), t)
+	e(os.WriteFile(filepath.Join(work, DefaultGitDirectory), []byte("gitdir: ../repo.git\n"), 0644), t)
+
+	r, err := Open(filepath.Join(work, "sub"))
+	e(err, t)
+	if r.Path() != work || r.GitPath() != gitDir || r.Prefix() != "sub" {
+		t.Errorf("opened %s with git directory %s and prefix %s", r.Path(), r.GitPath(), r.Prefix())
+	}
+	if r.IndexFilePath() != filepath.Join(gitDir, DefaultIndexFile) {
+		t.Errorf("index = %s", r.IndexFilePath())
+	}
+
+	e(os.WriteFile(filepath.Join(work, DefaultGitDirectory), []byte("nonsense\n"), 0644), t)
+	if _, err := Open(work); err == nil {
+		t.Error("expected an error for an invalid gitfile")
+	}
+}
+
+func TestOpenEnvironment(t *testing.T) {
+	unsetenv(t, "GIT_DIR", "GIT_WORK_TREE", "GIT_CEILING_DIRECTORIES")
+	dir := t.TempDir()
+	gitDir := filepath.Join(dir, "repo.git")
+	_, err := Init(dir, WithGitDirectory("repo.git"))
+	e(err, t)
+	work := filepath.Join(dir, "work")
+	e(os.MkdirAll(filepath.Join(work, "sub"), 0755), t)
+
+	// without GIT_WORK_TREE the directory opened is the working tree
+	t.Setenv("GIT_DIR", gitDir)
+	r, err := Open(filepath.Join(work, "sub"))
+	e(err, t)
+	if r.Path() != filepath.Join(work, "sub") || r.GitPath() != gitDir || r.Prefix() != "" {
+		t.Errorf("opened %s with git directory %s and prefix %s", r.Path(), r.GitPath(), r.Prefix())
+	}
+
+	t.Setenv("GIT_WORK_TREE", work)
+	r, err = Open(filepath.Join(work, "sub"))
+	e(err, t)
+	if r.Path() != work || r.GitPath() != gitDir || r.Prefix() != "sub" {
+		t.Errorf("opened %s with git directory %s and prefix %s", r.Path(), r.GitPath(), r.Prefix())
+	}
+
+	t.Setenv("GIT_DIR", filepath.Join(dir, "missing"))
+	if _, err := Open(work); err == nil {
+		t.Error("expected an error for a missing GIT_DIR")
+	}
+}
@@ -0,0 +1,75 @@
+package g
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileModes(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Init(dir, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+	e(os.WriteFile(filepath.Join(dir, "target"), []byte("t"), 0644), t)
+	e(os.WriteFile(filepath.Join(dir, "run.sh"), []byte("#!/bin/sh\n"), 0755), t)
+	e(os.Symlink("target", filepath.Join(dir, "link")), t)
+	assertAddFiles(t, r, []string{"target", "run.sh", "link"})
+	commit := &Commit{
+		Author:        "tester <tester@test.com>",
+		AuthoredTime:  time.Now(),
+		Committer:     "tester <tester@test.com>",
+		CommittedTime: time.Now(),
+		Message:       []byte("modes"),
+	}
+	sha := assertCreateCommit(t, r, commit)
+
+	// the tree records each mode and the symlink as its target
+	files, err := r.CommittedFiles(sha)
+	e(err, t)
+	modes := make(map[string]FileMode)
+	for _, v := range files {
+		modes[v.path] = v.commit.Mode
+	}
+	for path, mode := range map[string]FileMode{"target": ModeRegular, "run.sh": ModeExecutable, "link": ModeSymlink} {
+		if modes[path] != mode {
+			t.Errorf("expected %s to have mode %s got %s", path, mode, modes[path])
+		}
+	}
+	linkSha, err := r.HashBlob("link")
+	e(err, t)
+	targetObj, err := r.ReadObject(linkSha)
+	e(err, t)
+	content, err := readObjectContent(targetObj)
+	e(err, t)
+	if string(content) != "target" {
+		t.Errorf("expected the symlink blob to be its target got %q", content)
+	}
+	assertStatus(t, r, nil, map[string]WDStatus{"target": IndexAndWorkingTreeMatch, "run.sh": IndexAndWorkingTreeMatch, "link": IndexAndWorkingTreeMatch})
+
+	// the executable bit is a modification and a change of file type is
+	// a type change
+	e(os.Chmod(filepath.Join(dir, "target"), 0755), t)
+	e(os.Remove(filepath.Join(dir, "link")), t)
+	e(os.WriteFile(filepath.Join(dir, "link"), []byte("target"), 0644), t)
+	assertStatus(t, r, nil, map[string]WDStatus{"target": WorktreeChangedSinceIndex, "link": TypeChangedInWorktreeSinceIndex})
+	assertAddFiles(t, r, []string{"target", "link"})
+	assertStatus(t, r, map[string]IndexStatus{"target": UpdatedInIndex, "link": TypeChangedInIndex}, nil)
+
+	// checkout writes the modes back
+	e(r.CreateBranch("other"), t)
+	commit.Message = []byte("change modes")
+	_ = assertCreateCommit(t, r, commit)
+	assertSwitchBranch(t, r, "other", assertNoErrorFiles)
+	info, err := os.Lstat(filepath.Join(dir, "link"))
+	e(err, t)
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Error("expected link to be checked out as a symlink")
+	}
+	info, err = os.Lstat(filepath.Join(dir, "target"))
+	e(err, t)
+	if info.Mode()&0111 != 0 {
+		t.Error("expected target to be checked out without the executable bit")
+	}
+	assertStatus(t, r, nil, map[string]WDStatus{"target": IndexAndWorkingTreeMatch, "run.sh": IndexAndWorkingTreeMatch, "link": IndexAndWorkingTreeMatch})
+}
@@ -17,8 +17,8 @@ const (
 	// index is newer than that of the commit
 	UpdatedInIndex
 
-	// TypeChangedInIndex mentioned in the Git docs but not implemented
-	// here - file type changed (regular file, symbolic link or submodule)
+	// TypeChangedInIndex means that the file type in the index, regular
+	// file, symbolic link or submodule, differs from that of the commit
 	TypeChangedInIndex
 
 	// AddedInIndex means that the file is in the index but not in the
@@ -28,15 +28,50 @@ const (
 	// DeletedInIndex means that the file has been removed from the index
 	DeletedInIndex
 
-	// RenamedInIndex - @todo I do not understand how to implement this
+	// RenamedInIndex means that the file is in the index but not in the
+	// commit, and has the content of a file removed from the index. It is
+	// only set by DetectRenames.
 	RenamedInIndex
 
-	// CopiedInIndex - @todo not sure about this one either
-	// - copied (if config option status.renames is set to "copies")
+	// CopiedInIndex means that the file is in the index but not in the
+	// commit, and has the content of another file of the commit. It is only
+	// set by DetectRenames when copies are detected.
 	CopiedInIndex
 
 	// UntrackedInIndex means that the file is not in the Index
 	UntrackedInIndex
+
+	// UnmergedInIndex means that the file was left in conflict by a merge,
+	// with entries at merge stages rather than a merged entry. Which stages
+	// are given by FileStatus.Unmerged.
+	UnmergedInIndex
+)
+
+// The UnmergedStatus of a file is the set of merge stages it has entries at,
+// 1 for the common ancestor, 2 for ours and 4 for theirs
+const (
+	// BothDeleted means that only the common ancestor has the file
+	BothDeleted UnmergedStatus = iota + 1
+
+	// AddedByUs means that only ours has the file
+	AddedByUs
+
+	// DeletedByThem means that the file was modified in ours and deleted in
+	// theirs
+	DeletedByThem
+
+	// AddedByThem means that only theirs has the file
+	AddedByThem
+
+	// DeletedByUs means that the file was deleted in ours and modified in
+	// theirs
+	DeletedByUs
+
+	// BothAdded means that ours and theirs added different files
+	BothAdded
+
+	// BothModified means that ours and theirs modified the file differently
+	BothModified
 )
 
 const (
@@ -48,7 +83,9 @@ const (
 	// a newer modification time than the file in the index
 	WorktreeChangedSinceIndex
 
-	// TypeChangedInWorktreeSinceIndex is not implemented
+	// TypeChangedInWorktreeSinceIndex means the file in the working
+	// directory is of a different type, regular file, symbolic link or
+	// submodule, than in the index
 	TypeChangedInWorktreeSinceIndex
 
 	// DeletedInWorktree means that the file has been removed from the working
@@ -74,18 +111,32 @@ type (
 		index     *fileInfo
 		wd        *fileInfo
 		commit    *fileInfo
+		// origPath is the path in the commit that a renamed or copied file
+		// came from
+		origPath string
+		// stale is true when the working tree file matches the index entry
+		// by content but not by stat data, so the entry can be refreshed
+		stale bool
+		// stages are the common ancestor, ours and theirs versions of a file
+		// left in conflict by a merge, which has no index entry
+		stages [3]*fileInfo
 	}
 	fileInfo struct {
 		Sha   Sha
+		Mode  FileMode
 		Finfo os.FileInfo
 	}
 	FfileSet struct {
 		files []*FileStatus
 		idx   map[string]*FileStatus
+		// worktreeStatus decides the status of a file in both the index and
+		// the working tree
+		worktreeStatus func(f *FileStatus) (WDStatus, error)
 	}
-	IndexStatus uint8
-	WDStatus    uint8
-	Finfo       struct {
+	IndexStatus    uint8
+	WDStatus       uint8
+	UnmergedStatus uint8
+	Finfo          struct {
 		CTimeS uint32
 		CTimeN uint32
 		MTimeS uint32
@@ -123,6 +174,31 @@ func (is IndexStatus) StatusString() string {
 		return "C"
 	case UntrackedInIndex:
 		return "?"
+	case UnmergedInIndex:
+		return "U"
+	default:
+		return ""
+	}
+}
+
+// StatusString returns the two letter code git status --short shows for an
+// unmerged file
+func (us UnmergedStatus) StatusString() string {
+	switch us {
+	case BothDeleted:
+		return "DD"
+	case AddedByUs:
+		return "AU"
+	case DeletedByThem:
+		return "UD"
+	case AddedByThem:
+		return "UA"
+	case DeletedByUs:
+		return "DU"
+	case BothAdded:
+		return "AA"
+	case BothModified:
+		return "UU"
 	default:
 		return ""
 	}
@@ -149,21 +225,50 @@ func (wds WDStatus) StatusString() string {
 	}
 }
 
-// Ls recursively lists files in path that are not ignored
-func Ls(path string) ([]*FileStatus, error) {
+// Ls recursively lists files in path that are not ignored. Ignored
+// directories, and the git directory, are not walked into. A directory
+// containing a repository is listed as a submodule rather than walked into.
+func (r *Repository) Ls(path string) ([]*FileStatus, error) {
 	var files []*FileStatus
+	ig, err := r.NewIgnorer()
+	if err != nil {
+		return nil, err
+	}
 	if err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(r.Path(), path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		ignored, _, err := ig.IsIgnored(rel, info.IsDir())
 		if err != nil {
 			return err
 		}
 		if info.IsDir() {
+			if ignored {
+				return filepath.SkipDir
+			}
+			if _, err := os.Lstat(filepath.Join(path, DefaultGitDirectory)); err == nil {
+				// a nested repository is a submodule, listed as itself
+				files = append(files, &FileStatus{
+					path: rel,
+					wd:   &fileInfo{Mode: ModeGitlink, Finfo: info},
+				})
+				return filepath.SkipDir
+			}
 			return nil
 		}
 		// do not add ignored files
-		if !IsIgnored(path, config.GitIgnore) {
+		if !ignored {
 			files = append(files, &FileStatus{
-				path: strings.TrimPrefix(path, WorkingDirectory()),
+				path: strings.TrimPrefix(path, r.WorkingDirectory()),
 				wd: &fileInfo{
+					Mode:  fileModeOf(info),
 					Finfo: info,
 				},
 			})
@@ -196,8 +301,41 @@ func (f FileStatus) WorkingDirectoryStatus() WDStatus {
 	return f.wdStatus
 }
 
+// OrigPath returns the path that a file renamed or copied in the index came
+// from, or an empty string
+func (f FileStatus) OrigPath() string {
+	return f.origPath
+}
+
+// Unmerged returns which merge stages a file left in conflict by a merge has,
+// or 0 when the file is merged
+func (f FileStatus) Unmerged() UnmergedStatus {
+	var us UnmergedStatus
+	for i, v := range f.stages {
+		if v != nil {
+			us |= 1 << i
+		}
+	}
+	return us
+}
+
+// NewFfileSet returns the status of the files in a commit, the index and the
+// working tree. A file in both the index and the working tree is modified
+// when their stat data differs.
 func NewFfileSet(c []*FileStatus, i []*FileStatus, w []*FileStatus) (*FfileSet, error) {
-	fs := &FfileSet{}
+	return newFfileSet(c, i, w, func(f *FileStatus) (WDStatus, error) {
+		if status, ok := modeStatus(f.index.Mode, f.wd.Mode); ok {
+			return status, nil
+		}
+		if changed, _ := compareStat(f.index.Finfo, f.wd.Finfo); changed {
+			return WorktreeChangedSinceIndex, nil
+		}
+		return IndexAndWorkingTreeMatch, nil
+	})
+}
+
+func newFfileSet(c []*FileStatus, i []*FileStatus, w []*FileStatus, worktreeStatus func(*FileStatus) (WDStatus, error)) (*FfileSet, error) {
+	fs := &FfileSet{worktreeStatus: worktreeStatus}
 	fs.idx = make(map[string]*FileStatus)
 	for _, v := range c {
 		fs.idx[v.path] = v
@@ -210,14 +348,26 @@ func NewFfileSet(c []*FileStatus, i []*FileStatus, w []*FileStatus) (*FfileSet,
 
 func (f *FfileSet) updateStatus() error {
 	for _, v := range f.files {
+		if v.Unmerged() != 0 {
+			// the file needs to be added to the index to resolve the
+			// conflict, or removed when it is deleted
+			v.idxStatus = UnmergedInIndex
+			v.wdStatus = WorktreeChangedSinceIndex
+			if v.wd == nil {
+				v.wdStatus = DeletedInWorktree
+			}
+			continue
+		}
 		// worktree status
 		switch true {
 		case v.index != nil && v.wd == nil:
 			v.wdStatus = DeletedInWorktree
-		case v.index != nil && v.wd != nil && v.index.Finfo.ModTime().Compare(v.wd.Finfo.ModTime()) == 0:
-			v.wdStatus = IndexAndWorkingTreeMatch
-		case v.index != nil && v.wd != nil && v.index.Finfo.ModTime().Compare(v.wd.Finfo.ModTime()) != 0:
-			v.wdStatus = WorktreeChangedSinceIndex
+		case v.index != nil && v.wd != nil:
+			status, err := f.worktreeStatus(v)
+			if err != nil {
+				return err
+			}
+			v.wdStatus = status
 		case v.index == nil && v.wd != nil:
 			v.wdStatus = Untracked
 		case v.commit != nil && v.index == nil && v.wd == nil:
@@ -232,9 +382,11 @@ func (f *FfileSet) updateStatus() error {
 			v.idxStatus = UntrackedInIndex
 		case v.commit != nil && v.index == nil:
 			v.idxStatus = DeletedInIndex
-		case v.commit != nil && v.index != nil && !v.index.Sha.Matches(v.commit.Sha):
+		case v.commit != nil && v.index != nil && v.index.Mode.fileType() != v.commit.Mode.fileType():
+			v.idxStatus = TypeChangedInIndex
+		case v.commit != nil && v.index != nil && (!v.index.Sha.Matches(v.commit.Sha) || v.index.Mode != v.commit.Mode):
 			v.idxStatus = UpdatedInIndex
-		case v.commit != nil && v.index != nil && v.index.Sha.Matches(v.commit.Sha):
+		case v.commit != nil && v.index != nil:
 			v.idxStatus = NotUpdated
 		case v.commit == nil && v.index != nil:
 			v.idxStatus = AddedInIndex
@@ -245,6 +397,42 @@ func (f *FfileSet) updateStatus() error {
 	return nil
 }
 
+// modeStatus returns the status of a working tree file with mode whose index
+// entry has mode index when the modes alone decide it: a change of type, or
+// of the executable bit, whatever the content
+func modeStatus(index FileMode, wd FileMode) (WDStatus, bool) {
+	switch {
+	case index.fileType() != wd.fileType():
+		return TypeChangedInWorktreeSinceIndex, true
+	case index != wd:
+		return WorktreeChangedSinceIndex, true
+	}
+	return IndexAndWorkingTreeMatch, false
+}
+
+// compareStat compares the stat data of an index entry with that of the
+// working tree file. changed is true when any of it differs, and
+// sizeChanged when the size differs, meaning the content must have changed.
+func compareStat(index os.FileInfo, wd os.FileInfo) (changed bool, sizeChanged bool) {
+	i, err := newItem(index, Sha{}, "")
+	if err != nil {
+		return true, false
+	}
+	w, err := newItem(wd, Sha{}, "")
+	if err != nil {
+		return true, false
+	}
+	if i.Size != w.Size {
+		return true, true
+	}
+	changed = i.MTimeS != w.MTimeS || i.MTimeN != w.MTimeN ||
+		i.CTimeS != w.CTimeS || i.CTimeN != w.CTimeN ||
+		i.Ino != w.Ino || i.Dev != w.Dev ||
+		i.Uid != w.Uid || i.Gid != w.Gid ||
+		i.Mode != w.Mode
+	return changed, false
+}
+
 func (f *FfileSet) mergeFiles(files []*FileStatus, ciw int) {
 	for _, v := range files {
 		v := v
@@ -255,6 +443,7 @@ func (f *FfileSet) mergeFiles(files []*FileStatus, ciw int) {
 				ff.commit = v.commit
 			case 2:
 				ff.index = v.index
+				ff.stages = v.stages
 			case 3:
 				ff.wd = v.wd
 			}
@@ -265,6 +454,17 @@ func (f *FfileSet) mergeFiles(files []*FileStatus, ciw int) {
 	}
 }
 
+// remove removes the file with path from the set
+func (f *FfileSet) remove(path string) {
+	delete(f.idx, path)
+	for i, v := range f.files {
+		if v.path == path {
+			f.files = append(f.files[:i], f.files[i+1:]...)
+			return
+		}
+	}
+}
+
 func (f *FfileSet) Files() []*FileStatus {
 	return f.files
 }
@@ -313,6 +513,29 @@ func (is IndexStatus) String() string {
 		return "CopiedInIndex"
 	case UntrackedInIndex:
 		return "UntrackedInIndex"
+	case UnmergedInIndex:
+		return "UnmergedInIndex"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func (us UnmergedStatus) String() string {
+	switch us {
+	case BothDeleted:
+		return "BothDeleted"
+	case AddedByUs:
+		return "AddedByUs"
+	case DeletedByThem:
+		return "DeletedByThem"
+	case AddedByThem:
+		return "AddedByThem"
+	case DeletedByUs:
+		return "DeletedByUs"
+	case BothAdded:
+		return "BothAdded"
+	case BothModified:
+		return "BothModified"
 	default:
 		return "UNKNOWN"
 	}
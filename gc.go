@@ -0,0 +1,84 @@
+package g
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// GC packs all loose refs and loose objects, removing the loose copies of
+// the objects that were packed.
+func (r *Repository) GC() error {
+	if err := r.PackRefs(); err != nil {
+		return err
+	}
+	shas, err := r.LooseObjects()
+	if err != nil {
+		return err
+	}
+	if len(shas) == 0 {
+		return nil
+	}
+	if _, err := r.WritePack(shas, true); err != nil {
+		return err
+	}
+	return r.PruneLooseObjects(shas)
+}
+
+// LooseObjects lists the Sha of every object stored as a loose file in the
+// objects directory.
+func (r *Repository) LooseObjects() ([]Sha, error) {
+	var shas []Sha
+	dirs, err := os.ReadDir(r.ObjectPath())
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range dirs {
+		if !d.IsDir() || len(d.Name()) != 2 {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(r.ObjectPath(), d.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			if f.IsDir() || len(f.Name()) != 38 {
+				continue
+			}
+			sha, err := ShaFromHexString(d.Name() + f.Name())
+			if err != nil {
+				// not an object file
+				continue
+			}
+			shas = append(shas, sha)
+		}
+	}
+	return shas, nil
+}
+
+// PruneLooseObjects removes the loose files of the objects identified by shas
+// along with any object directories left empty.
+func (r *Repository) PruneLooseObjects(shas []Sha) error {
+	dirs := make(map[string]struct{})
+	for _, sha := range shas {
+		if err := os.Remove(r.objectPath(sha)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		dirs[filepath.Dir(r.objectPath(sha))] = struct{}{}
+	}
+	for dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		if len(entries) == 0 {
+			if err := os.Remove(dir); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
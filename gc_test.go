@@ -0,0 +1,102 @@
+package g
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGC(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Init(dir, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+
+	// commit a few versions of similar files so that there are deltas
+	var lines []string
+	for i := 0; i < 300; i++ {
+		lines = append(lines, fmt.Sprintf("this is line %d of the file", i))
+	}
+	for i := 0; i < 5; i++ {
+		lines[i*50] = fmt.Sprintf("changed in commit %d", i)
+		e(os.WriteFile(filepath.Join(dir, "a"), []byte(strings.Join(lines, "\n")), 0644), t)
+		e(os.WriteFile(filepath.Join(dir, "b"), []byte(strings.Join(lines[i:], "\n")), 0644), t)
+		assertAddFiles(t, r, []string{"a", "b"})
+		assertCreateCommit(t, r, &Commit{
+			Author:        "tester <tester@test.com>",
+			AuthoredTime:  time.Now(),
+			Committer:     "tester <tester@test.com>",
+			CommittedTime: time.Now(),
+			Message:       []byte(fmt.Sprintf("commit %d", i)),
+		})
+	}
+
+	loose, err := r.LooseObjects()
+	e(err, t)
+	contents := make(map[string][]byte)
+	types := make(map[string]objectType)
+	for _, sha := range loose {
+		obj, err := r.ReadObject(sha)
+		e(err, t)
+		content, err := readObjectContent(obj)
+		e(err, t)
+		contents[sha.String()] = content
+		types[sha.String()] = obj.Typ
+	}
+
+	e(r.GC(), t)
+
+	remaining, err := r.LooseObjects()
+	e(err, t)
+	if len(remaining) != 0 {
+		t.Errorf("expected no loose objects after gc, got %d", len(remaining))
+	}
+	for _, sha := range loose {
+		obj, err := r.ReadObject(sha)
+		e(err, t)
+		if obj == nil {
+			t.Fatalf("object %s not found after gc", sha)
+		}
+		content, err := readObjectContent(obj)
+		e(err, t)
+		if obj.Typ != types[sha.String()] {
+			t.Errorf("type of %s = %d, want %d", sha, obj.Typ, types[sha.String()])
+		}
+		if !bytes.Equal(content, contents[sha.String()]) {
+			t.Errorf("content of %s changed after gc", sha)
+		}
+	}
+	assertCurrentBranch(t, r, "main")
+
+	// when git is available check that it agrees the pack is valid
+	if _, err := exec.LookPath("git"); err == nil {
+		packs, err := filepath.Glob(filepath.Join(r.ObjectPackfileDirectory(), "*.idx"))
+		e(err, t)
+		if len(packs) != 1 {
+			t.Fatalf("expected 1 pack, got %d", len(packs))
+		}
+		out, err := exec.Command("git", "verify-pack", "-v", packs[0]).CombinedOutput()
+		if err != nil {
+			t.Fatalf("git verify-pack: %s %s", err, out)
+		}
+		if !strings.Contains(string(out), "chain length = 1") {
+			t.Errorf("expected pack to contain deltas:\n%s", out)
+		}
+		// the index written by gc is the one git builds from the pack
+		idx := filepath.Join(t.TempDir(), "pack.idx")
+		if out, err := exec.Command("git", "index-pack", "-o", idx, strings.TrimSuffix(packs[0], ".idx")+".pack").CombinedOutput(); err != nil {
+			t.Fatalf("git index-pack: %s %s", err, out)
+		}
+		expected, err := os.ReadFile(idx)
+		e(err, t)
+		actual, err := os.ReadFile(packs[0])
+		e(err, t)
+		if !bytes.Equal(actual, expected) {
+			t.Error("pack index differs from the one written by git index-pack")
+		}
+	}
+}
@@ -0,0 +1,549 @@
+package g
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ConfigScopeSystem ConfigScope = iota
+	ConfigScopeGlobal
+	ConfigScopeLocal
+)
+
+// maxConfigIncludeDepth limits nested include and includeIf files, which also
+// stops an include cycle.
+const maxConfigIncludeDepth = 10
+
+type (
+	// ConfigScope is where a configuration value was read from
+	ConfigScope int
+	// GitConfig is the merged configuration read from the system, global and
+	// repository git config files. Entries are in the order they were read,
+	// so that later entries override earlier ones.
+	GitConfig struct {
+		Entries []*ConfigEntry
+		// repo is used to evaluate the gitdir: and onbranch: conditions of
+		// includeIf, which do not hold without a repository
+		repo *Repository
+	}
+	// ConfigEntry is a single variable from a git config file. Section and
+	// Name are lower case, Subsection is case-sensitive. NoValue is true for
+	// a variable written without =, which is a boolean true.
+	ConfigEntry struct {
+		Section    string
+		Subsection string
+		Name       string
+		Value      string
+		NoValue    bool
+		Scope      ConfigScope
+		File       string
+		// Line and EndLine are the first and last line of the variable,
+		// which differ when the value is continued with a backslash
+		Line    int
+		EndLine int
+		// start and end are the offsets of the variable in the file, from
+		// its name to the end of its last line
+		start int
+		end   int
+	}
+	// configSection is a section header in a git config file, from the
+	// offset of the opening [ to the offset following the closing ]
+	configSection struct {
+		section    string
+		subsection string
+		start      int
+		end        int
+	}
+	// configParser parses the content of a single git config file
+	configParser struct {
+		b          []byte
+		i          int
+		line       int
+		path       string
+		section    string
+		subsection string
+		sections   []*configSection
+	}
+)
+
+func (s ConfigScope) String() string {
+	switch s {
+	case ConfigScopeSystem:
+		return "system"
+	case ConfigScopeGlobal:
+		return "global"
+	case ConfigScopeLocal:
+		return "local"
+	default:
+		return "unknown"
+	}
+}
+
+// Key returns the canonical name of the entry such as user.name or
+// branch.main.remote
+func (e *ConfigEntry) Key() string {
+	if e.Subsection != "" {
+		return e.Section + "." + e.Subsection + "." + e.Name
+	}
+	return e.Section + "." + e.Name
+}
+
+// SystemConfigFile returns the path of the system git config file, which is
+// empty when GIT_CONFIG_NOSYSTEM is set.
+func SystemConfigFile() string {
+	if v, ok := os.LookupEnv("GIT_CONFIG_NOSYSTEM"); ok && configBool(v, true) {
+		return ""
+	}
+	if v, ok := os.LookupEnv("GIT_CONFIG_SYSTEM"); ok {
+		return v
+	}
+	return "/etc/gitconfig"
+}
+
+// GlobalConfigFiles returns the paths of the global git config files in the
+// order they are read, $XDG_CONFIG_HOME/git/config then ~/.gitconfig, or
+// GIT_CONFIG_GLOBAL when it is set.
+func GlobalConfigFiles() []string {
+	if v, ok := os.LookupEnv("GIT_CONFIG_GLOBAL"); ok {
+		return []string{v}
+	}
+	var files []string
+	home, _ := os.UserHomeDir()
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" && home != "" {
+		xdg = filepath.Join(home, ".config")
+	}
+	if xdg != "" {
+		files = append(files, filepath.Join(xdg, "git", "config"))
+	}
+	if home != "" {
+		files = append(files, filepath.Join(home, ".gitconfig"))
+	}
+	return files
+}
+
+// ReadGitConfig reads and merges the system, global and repository git config
+// files. Missing files are skipped.
+func (r *Repository) ReadGitConfig() (*GitConfig, error) {
+	c := &GitConfig{repo: r}
+	if path := SystemConfigFile(); path != "" {
+		if err := c.readFile(path, ConfigScopeSystem, 0); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range GlobalConfigFiles() {
+		if err := c.readFile(path, ConfigScopeGlobal, 0); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.readFile(r.LocalConfigFile(), ConfigScopeLocal, 0); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ReadGitConfigFile reads a single git config file, following its includes.
+func ReadGitConfigFile(path string, scope ConfigScope) (*GitConfig, error) {
+	c := &GitConfig{}
+	if err := c.readFile(path, scope, 0); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Get returns the last value of key, such as user.name
+func (c *GitConfig) Get(key string) (string, bool) {
+	values := c.GetAll(key)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// GetAll returns every value of the multi-valued key in the order read
+func (c *GitConfig) GetAll(key string) []string {
+	section, subsection, name, err := parseConfigKey(key)
+	if c == nil || err != nil {
+		return nil
+	}
+	var values []string
+	for _, v := range c.Entries {
+		if v.Section == section && v.Subsection == subsection && v.Name == name {
+			values = append(values, v.Value)
+		}
+	}
+	return values
+}
+
+// Bool returns the last value of key interpreted as a git boolean, or def
+// when key is not set or is not a boolean.
+func (c *GitConfig) Bool(key string, def bool) bool {
+	section, subsection, name, err := parseConfigKey(key)
+	if c == nil || err != nil {
+		return def
+	}
+	for i := len(c.Entries) - 1; i >= 0; i-- {
+		v := c.Entries[i]
+		if v.Section == section && v.Subsection == subsection && v.Name == name {
+			if v.NoValue {
+				return true
+			}
+			return configBool(v.Value, def)
+		}
+	}
+	return def
+}
+
+// configBool interprets a git boolean value
+func configBool(value string, def bool) bool {
+	switch strings.ToLower(value) {
+	case "true", "yes", "on", "1":
+		return true
+	case "false", "no", "off", "0", "":
+		return false
+	}
+	return def
+}
+
+// parseConfigKey splits a key such as branch.main.remote into its section,
+// subsection and name. The subsection is everything between the first and
+// last dot and keeps its case.
+func parseConfigKey(key string) (string, string, string, error) {
+	first := strings.IndexByte(key, '.')
+	last := strings.LastIndexByte(key, '.')
+	if first <= 0 || last == len(key)-1 {
+		return "", "", "", fmt.Errorf("error: key does not contain a section: %s", key)
+	}
+	section := strings.ToLower(key[:first])
+	name := strings.ToLower(key[last+1:])
+	var subsection string
+	if first != last {
+		subsection = key[first+1 : last]
+	}
+	if !isConfigName(name) {
+		return "", "", "", fmt.Errorf("error: invalid key: %s", key)
+	}
+	return section, subsection, name, nil
+}
+
+// isConfigName returns true for a valid variable name, which starts with a
+// letter and contains only letters, digits and -
+func isConfigName(name string) bool {
+	for i, c := range name {
+		if !isConfigAlpha(byte(c)) && (i == 0 || (!isConfigDigit(byte(c)) && c != '-')) {
+			return false
+		}
+	}
+	return name != ""
+}
+
+func isConfigAlpha(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isConfigDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// readFile appends the entries of the config file at path, and of the files
+// it includes, to c.
+func (c *GitConfig) readFile(path string, scope ConfigScope, depth int) error {
+	if depth > maxConfigIncludeDepth {
+		return fmt.Errorf("fatal: exceeded maximum include depth (%d) while including %s", maxConfigIncludeDepth, path)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	p := &configParser{b: b, line: 1, path: path}
+	for {
+		entry, err := p.next()
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			return nil
+		}
+		entry.Scope = scope
+		c.Entries = append(c.Entries, entry)
+		if include, ok := c.includePath(entry); ok {
+			if err := c.readFile(include, scope, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// includePath returns the file included by an include.path entry, or by an
+// includeIf.<condition>.path entry whose condition holds.
+func (c *GitConfig) includePath(e *ConfigEntry) (string, bool) {
+	if e.Name != "path" || e.NoValue || e.Value == "" {
+		return "", false
+	}
+	switch {
+	case e.Section == "include" && e.Subsection == "":
+	case e.Section == "includeif" && c.includeCondition(e.Subsection, e.File):
+	default:
+		return "", false
+	}
+	path := expandConfigPath(e.Value)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(e.File), path)
+	}
+	return path, true
+}
+
+// includeCondition evaluates an includeIf condition, supporting gitdir:,
+// gitdir/i: and onbranch:. Other conditions are false.
+func (c *GitConfig) includeCondition(condition string, file string) bool {
+	kind, pattern, ok := strings.Cut(condition, ":")
+	if !ok || pattern == "" || c.repo == nil {
+		return false
+	}
+	switch kind {
+	case "gitdir", "gitdir/i":
+		if strings.HasPrefix(pattern, "./") {
+			pattern = filepath.Join(filepath.Dir(file), pattern[2:])
+		}
+		pattern = expandConfigPath(pattern)
+		if !filepath.IsAbs(pattern) {
+			pattern = "**/" + pattern
+		}
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+		gitDir := filepath.ToSlash(c.repo.GitPath())
+		fold := kind == "gitdir/i"
+		return wildmatch(filepath.ToSlash(pattern), gitDir, fold) ||
+			wildmatch(filepath.ToSlash(pattern), gitDir+"/", fold)
+	case "onbranch":
+		branch, _, err := c.repo.readHead()
+		if err != nil || branch == "" {
+			return false
+		}
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+		return wildmatch(pattern, branch, false)
+	}
+	return false
+}
+
+// expandConfigPath expands a leading ~/ to the home directory
+func expandConfigPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
+
+func (p *configParser) error() error {
+	return fmt.Errorf("fatal: bad config line %d in file %s", p.line, p.path)
+}
+
+// next returns the next variable in the file, or nil at the end of the file
+func (p *configParser) next() (*ConfigEntry, error) {
+	if p.i == 0 && strings.HasPrefix(string(p.b), "\xef\xbb\xbf") {
+		p.i = 3
+	}
+	for p.i < len(p.b) {
+		c := p.b[p.i]
+		switch {
+		case c == '\n':
+			p.line++
+			p.i++
+		case c == ' ' || c == '\t' || c == '\r':
+			p.i++
+		case c == '#' || c == ';':
+			p.skipLine()
+		case c == '[':
+			if err := p.parseSection(); err != nil {
+				return nil, err
+			}
+		case isConfigAlpha(c):
+			if p.section == "" {
+				return nil, p.error()
+			}
+			return p.parseVariable()
+		default:
+			return nil, p.error()
+		}
+	}
+	return nil, nil
+}
+
+func (p *configParser) skipLine() {
+	for p.i < len(p.b) && p.b[p.i] != '\n' {
+		p.i++
+	}
+}
+
+// parseSection parses a section header of the form [section],
+// [section "subsection"] or the deprecated [section.subsection]
+func (p *configParser) parseSection() error {
+	header := p.i
+	p.i++
+	start := p.i
+	for p.i < len(p.b) && (isConfigAlpha(p.b[p.i]) || isConfigDigit(p.b[p.i]) || p.b[p.i] == '-' || p.b[p.i] == '.') {
+		p.i++
+	}
+	name := string(p.b[start:p.i])
+	if name == "" || p.i >= len(p.b) {
+		return p.error()
+	}
+	p.section = strings.ToLower(name)
+	p.subsection = ""
+	if p.b[p.i] == ']' {
+		p.i++
+		if section, subsection, ok := strings.Cut(p.section, "."); ok {
+			p.section, p.subsection = section, subsection
+		}
+		p.sections = append(p.sections, &configSection{section: p.section, subsection: p.subsection, start: header, end: p.i})
+		return nil
+	}
+	if strings.Contains(name, ".") {
+		return p.error()
+	}
+	for p.i < len(p.b) && (p.b[p.i] == ' ' || p.b[p.i] == '\t') {
+		p.i++
+	}
+	if p.i >= len(p.b) || p.b[p.i] != '"' {
+		return p.error()
+	}
+	p.i++
+	var sub []byte
+	for {
+		if p.i >= len(p.b) || p.b[p.i] == '\n' {
+			return p.error()
+		}
+		c := p.b[p.i]
+		p.i++
+		if c == '"' {
+			break
+		}
+		if c == '\\' {
+			if p.i >= len(p.b) || p.b[p.i] == '\n' {
+				return p.error()
+			}
+			c = p.b[p.i]
+			p.i++
+		}
+		sub = append(sub, c)
+	}
+	if p.i >= len(p.b) || p.b[p.i] != ']' {
+		return p.error()
+	}
+	p.i++
+	p.subsection = string(sub)
+	p.sections = append(p.sections, &configSection{section: p.section, subsection: p.subsection, start: header, end: p.i})
+	return nil
+}
+
+// parseVariable parses a name = value line. Values may be quoted, contain
+// escapes and be continued onto the following line with a backslash.
+func (p *configParser) parseVariable() (*ConfigEntry, error) {
+	entry := &ConfigEntry{
+		Section:    p.section,
+		Subsection: p.subsection,
+		File:       p.path,
+		Line:       p.line,
+		start:      p.i,
+	}
+	start := p.i
+	for p.i < len(p.b) && (isConfigAlpha(p.b[p.i]) || isConfigDigit(p.b[p.i]) || p.b[p.i] == '-') {
+		p.i++
+	}
+	entry.Name = strings.ToLower(string(p.b[start:p.i]))
+	for p.i < len(p.b) && (p.b[p.i] == ' ' || p.b[p.i] == '\t' || p.b[p.i] == '\r') {
+		p.i++
+	}
+	if p.i >= len(p.b) || p.b[p.i] == '\n' || p.b[p.i] == '#' || p.b[p.i] == ';' {
+		p.skipLine()
+		entry.NoValue = true
+		entry.EndLine = p.line
+		entry.end = p.i
+		return entry, nil
+	}
+	if p.b[p.i] != '=' {
+		return nil, p.error()
+	}
+	p.i++
+	value, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	entry.Value = value
+	entry.EndLine = p.line
+	entry.end = p.i
+	return entry, nil
+}
+
+func (p *configParser) parseValue() (string, error) {
+	var value []byte
+	quoted := false
+	// length of the value excluding trailing unquoted whitespace
+	length := 0
+	for p.i < len(p.b) && (p.b[p.i] == ' ' || p.b[p.i] == '\t') {
+		p.i++
+	}
+	for p.i < len(p.b) {
+		c := p.b[p.i]
+		if c == '\n' {
+			if quoted {
+				return "", p.error()
+			}
+			break
+		}
+		p.i++
+		switch {
+		case !quoted && (c == '#' || c == ';'):
+			p.skipLine()
+		case c == '\\':
+			if p.i >= len(p.b) {
+				return "", p.error()
+			}
+			e := p.b[p.i]
+			p.i++
+			switch e {
+			case '\n':
+				p.line++
+				continue
+			case 'n':
+				e = '\n'
+			case 't':
+				e = '\t'
+			case 'b':
+				e = '\b'
+			case '\\', '"':
+			default:
+				return "", p.error()
+			}
+			value = append(value, e)
+			length = len(value)
+		case c == '"':
+			quoted = !quoted
+		case !quoted && (c == ' ' || c == '\t' || c == '\r'):
+			value = append(value, c)
+		default:
+			value = append(value, c)
+			length = len(value)
+		}
+		if quoted {
+			length = len(value)
+		}
+	}
+	if quoted {
+		return "", p.error()
+	}
+	return string(value[:length]), nil
+}
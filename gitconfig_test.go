@@ -0,0 +1,185 @@
+package g
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadGitConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	e(os.WriteFile(path, []byte(`# comment
+[core]
+	editor = "code --wait"  ; trailing comment
+	bare
+	autocrlf = false
+[Section "Sub \"Q\" \\ x"]
+	Key = value with  spaces   # comment
+	multi = a
+	multi = "b # not comment"
+	esc = tab\there\nnewline \"q\" back\\slash
+	cont = first \
+second
+	quoted = "  lead and trail  "
+	empty =
+[old.SubSection]
+	x = 1
+[alias] st = status
+`), 0644), t)
+	c, err := ReadGitConfigFile(path, ConfigScopeLocal)
+	e(err, t)
+	// the expected values are those listed by git config -f <file> --list
+	var actual []string
+	for _, v := range c.Entries {
+		if v.NoValue {
+			actual = append(actual, v.Key())
+		} else {
+			actual = append(actual, v.Key()+"="+v.Value)
+		}
+	}
+	expected := []string{
+		"core.editor=code --wait",
+		"core.bare",
+		"core.autocrlf=false",
+		`section.Sub "Q" \ x.key=value with  spaces`,
+		`section.Sub "Q" \ x.multi=a`,
+		`section.Sub "Q" \ x.multi=b # not comment`,
+		"section.Sub \"Q\" \\ x.esc=tab\there\nnewline \"q\" back\\slash",
+		`section.Sub "Q" \ x.cont=first second`,
+		`section.Sub "Q" \ x.quoted=  lead and trail  `,
+		`section.Sub "Q" \ x.empty=`,
+		"old.subsection.x=1",
+		"alias.st=status",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("entries = %q, want %q", actual, expected)
+	}
+
+	if v, _ := c.Get("CORE.Editor"); v != "code --wait" {
+		t.Errorf("core.editor = %q", v)
+	}
+	if v := c.GetAll(`Section.Sub "Q" \ x.MULTI`); !reflect.DeepEqual(v, []string{"a", "b # not comment"}) {
+		t.Errorf("multi = %q", v)
+	}
+	if _, ok := c.Get(`section.sub "q" \ x.multi`); ok {
+		t.Error("expected subsections to be case-sensitive")
+	}
+	if !c.Bool("core.bare", false) || c.Bool("core.autocrlf", true) || !c.Bool("core.missing", true) {
+		t.Error("unexpected boolean values")
+	}
+	cont := c.Entries[7]
+	if cont.Line != 11 || cont.EndLine != 12 {
+		t.Errorf("cont lines = %d-%d, want 11-12", cont.Line, cont.EndLine)
+	}
+
+	for _, content := range []string{
+		"key = value\n",
+		"[core\n",
+		"[core \"sub]\n",
+		"[core]\n\tkey = \"unterminated\n",
+		"[core]\n\tkey = bad \\x escape\n",
+		"[core]\n\t1key = value\n",
+	} {
+		e(os.WriteFile(path, []byte(content), 0644), t)
+		if _, err := ReadGitConfigFile(path, ConfigScopeLocal); err == nil {
+			t.Errorf("expected an error parsing %q", content)
+		}
+	}
+}
+
+func TestReadGitConfig(t *testing.T) {
+	dir := t.TempDir()
+	home := filepath.Join(dir, "home")
+	e(os.MkdirAll(filepath.Join(home, ".config", "git"), 0755), t)
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", "")
+	system := filepath.Join(dir, "gitconfig")
+	t.Setenv("GIT_CONFIG_SYSTEM", system)
+	unsetenv(t, "GIT_CONFIG_GLOBAL", "GIT_CONFIG_NOSYSTEM", "GIT_AUTHOR_NAME", "GIT_AUTHOR_EMAIL", "GIT_COMMITTER_NAME", "GIT_COMMITTER_EMAIL", "EMAIL", "GIT_EDITOR", "VISUAL", "EDITOR")
+
+	repo := filepath.Join(dir, "work", "repo")
+	e(os.MkdirAll(repo, 0755), t)
+	r, err := Init(repo, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+
+	e(os.WriteFile(system, []byte("[user]\n\tname = system\n\temail = system@test.com\n[core]\n\teditor = nano\n"), 0644), t)
+	e(os.WriteFile(filepath.Join(home, ".config", "git", "config"), []byte("[user]\n\tname = xdg\n"), 0644), t)
+	e(os.WriteFile(filepath.Join(home, ".gitconfig"), []byte(
+		"[user]\n\tname = global\n"+
+			"[init]\n\tdefaultBranch = trunk\n"+
+			"[include]\n\tpath = ~/included\n"+
+			"[includeIf \"gitdir:work/\"]\n\tpath = work.inc\n"+
+			"[includeIf \"gitdir:/elsewhere/\"]\n\tpath = never.inc\n"+
+			"[includeIf \"onbranch:feature/\"]\n\tpath = branch.inc\n"), 0644), t)
+	e(os.WriteFile(filepath.Join(home, "included"), []byte("[core]\n\teditor = code --wait\n"), 0644), t)
+	e(os.WriteFile(filepath.Join(home, "work.inc"), []byte("[user]\n\temail = work@test.com\n[include]\n\tpath = work.inc\n"), 0644), t)
+	e(os.WriteFile(filepath.Join(home, "never.inc"), []byte("[user]\n\temail = never@test.com\n"), 0644), t)
+	e(os.WriteFile(filepath.Join(home, "branch.inc"), []byte("[user]\n\temail = branch@test.com\n"), 0644), t)
+	if _, err := Open(repo, WithGitDirectory(DefaultGitDirectory)); err == nil {
+		t.Fatal("expected an error for an include cycle")
+	}
+	e(os.WriteFile(filepath.Join(home, "work.inc"), []byte("[user]\n\temail = work@test.com\n"), 0644), t)
+	e(os.WriteFile(r.LocalConfigFile(), []byte("[user]\n\tname = local\n"), 0644), t)
+	r, err = Open(repo, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+
+	c := r.GitConfig()
+	if v := c.GetAll("user.name"); !reflect.DeepEqual(v, []string{"system", "xdg", "global", "local"}) {
+		t.Errorf("user.name = %v", v)
+	}
+	scopes := map[string]ConfigScope{}
+	for _, v := range c.Entries {
+		scopes[v.Key()+"="+v.Value] = v.Scope
+	}
+	if scopes["user.name=system"] != ConfigScopeSystem || scopes["user.name=global"] != ConfigScopeGlobal || scopes["user.name=local"] != ConfigScopeLocal {
+		t.Errorf("unexpected scopes %v", scopes)
+	}
+	if r.AuthorName() != "local" || r.CommitterName() != "local" {
+		t.Errorf("name = %s, %s", r.AuthorName(), r.CommitterName())
+	}
+	if r.AuthorEmail() != "work@test.com" || r.CommitterEmail() != "work@test.com" {
+		t.Errorf("email = %s, %s", r.AuthorEmail(), r.CommitterEmail())
+	}
+	if cmd, args := r.Editor(); cmd != "code" || !reflect.DeepEqual(args, []string{"--wait"}) {
+		t.Errorf("editor = %s %v", cmd, args)
+	}
+	if r.DefaultBranch() != "trunk" {
+		t.Errorf("default branch = %s", r.DefaultBranch())
+	}
+
+	// environment variables take priority over config
+	t.Setenv("GIT_AUTHOR_NAME", "env")
+	t.Setenv("GIT_EDITOR", "vi")
+	if r.AuthorName() != "env" || r.CommitterName() != "local" {
+		t.Errorf("name = %s, %s", r.AuthorName(), r.CommitterName())
+	}
+	if cmd, _ := r.Editor(); cmd != "vi" {
+		t.Errorf("editor = %s", cmd)
+	}
+
+	// onbranch includes depend on the checked out branch
+	e(r.UpdateHead("feature/x"), t)
+	r, err = Open(repo, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+	if r.AuthorEmail() != "branch@test.com" {
+		t.Errorf("email = %s", r.AuthorEmail())
+	}
+
+	// the system config can be disabled
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	r, err = Open(repo, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+	if v := r.GitConfig().GetAll("user.name"); !reflect.DeepEqual(v, []string{"xdg", "global", "local"}) {
+		t.Errorf("user.name = %v", v)
+	}
+}
+
+// unsetenv unsets environment variables for the duration of a test
+func unsetenv(t *testing.T, names ...string) {
+	for _, v := range names {
+		t.Setenv(v, "")
+		e(os.Unsetenv(v), t)
+	}
+}
@@ -2,74 +2,285 @@ package g
 
 import (
 	"bytes"
-	"fmt"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
 	"strings"
 )
 
-func IsIgnored(path string, rules [][]byte) bool {
+type (
+	// IgnoreRule is a pattern read from a gitignore file
+	IgnoreRule struct {
+		// Source is the file the rule was read from
+		Source string
+		// Line is the line number of the rule in Source
+		Line int
+		// Pattern is the rule as it was written, without trailing spaces
+		Pattern string
+		// base is the directory, relative to the working tree, of the
+		// .gitignore file that the rule is relative to
+		base     string
+		glob     string
+		negate   bool
+		dirOnly  bool
+		anchored bool
+	}
+	// Ignorer matches paths against the gitignore rules of a working tree.
+	// The rules of core.excludesFile and info/exclude are read up front and
+	// the .gitignore of each directory when a path in it is first matched,
+	// so an Ignorer checking many paths reads each file once.
+	Ignorer struct {
+		repo    *Repository
+		fold    bool
+		exclude []*IgnoreRule
+		dirs    map[string][]*IgnoreRule
+	}
+)
 
-	// make the path relative
-	path = strings.TrimPrefix(path, Path())
+// IsIgnored returns true when path, relative to the working tree, is ignored
+// by the gitignore rules, as Ignorer.IsIgnored does. An Ignorer from
+// NewIgnorer should be used to check many paths.
+func (r *Repository) IsIgnored(path string, isDir bool) (bool, *IgnoreRule, error) {
+	ig, err := r.NewIgnorer()
+	if err != nil {
+		return false, nil, err
+	}
+	return ig.IsIgnored(path, isDir)
+}
 
-	// ignore the git directory regardless
-	if strings.HasPrefix(path, fmt.Sprintf("/%s/", config.GitDirectory)) {
-		return true
+// ExcludesFile returns the file of ignore rules that apply to every
+// repository, core.excludesFile or $XDG_CONFIG_HOME/git/ignore
+func (r *Repository) ExcludesFile() string {
+	if v, ok := r.GitConfig().Get("core.excludesFile"); ok && v != "" {
+		return expandConfigPath(v)
+	}
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		xdg = filepath.Join(home, ".config")
 	}
+	return filepath.Join(xdg, "git", "ignore")
+}
+
+// InfoExcludeFile returns the info/exclude file of the git directory
+func (r *Repository) InfoExcludeFile() string {
+	return filepath.Join(r.GitPath(), "info", "exclude")
+}
 
-	for _, v := range rules {
-		prefixMatch := false
-		dirMatch := false
+// NewIgnorer returns an Ignorer for the working tree, reading the ignore
+// rules that apply to every path
+func (r *Repository) NewIgnorer() (*Ignorer, error) {
+	ig := &Ignorer{
+		repo: r,
+		fold: r.GitConfig().Bool("core.ignoreCase", false),
+		dirs: make(map[string][]*IgnoreRule),
+	}
+	if file := r.ExcludesFile(); file != "" {
+		rules, err := readIgnoreFile(file, file, "")
+		if err != nil {
+			return nil, err
+		}
+		ig.exclude = append(ig.exclude, rules...)
+	}
+	rules, err := readIgnoreFile(r.InfoExcludeFile(), r.worktreeRel(r.InfoExcludeFile()), "")
+	if err != nil {
+		return nil, err
+	}
+	ig.exclude = append(ig.exclude, rules...)
+	return ig, nil
+}
+
+// IsIgnored returns true when name, relative to the working tree, is ignored,
+// along with the rule that decided it. The rule is a negated one when it
+// re-includes name, and nil when no rule matches or name is in the git
+// directory, which is always ignored. A path in an ignored directory is
+// ignored whatever the rules for the path itself, as git does not look
+// inside excluded directories.
+func (ig *Ignorer) IsIgnored(name string, isDir bool) (bool, *IgnoreRule, error) {
+	name = strings.Trim(filepath.ToSlash(name), "/")
+	if name == "" || name == "." {
+		return false, nil, nil
+	}
+	if ig.isGitDirectory(name) {
+		return true, nil, nil
+	}
+	components := strings.Split(name, "/")
+	for i := range components {
+		last := i == len(components)-1
+		rule, err := ig.match(strings.Join(components[:i+1], "/"), !last || isDir)
+		if err != nil {
+			return false, nil, err
+		}
+		if last {
+			return rule != nil && !rule.negate, rule, nil
+		}
+		if rule != nil && !rule.negate {
+			return true, rule, nil
+		}
+	}
+	return false, nil, nil
+}
+
+// isGitDirectory returns true when name is, or is in, the git directory
+func (ig *Ignorer) isGitDirectory(name string) bool {
+	rel := ig.repo.worktreeRel(ig.repo.GitPath())
+	return name == rel || strings.HasPrefix(name, rel+"/")
+}
+
+// worktreeRel returns path relative to the working tree with slash
+// separators, or path itself when it is not below the working tree
+func (r *Repository) worktreeRel(path string) string {
+	rel, err := filepath.Rel(r.Path(), path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return filepath.ToSlash(rel)
+}
 
-		if len(v) == 0 {
-			// blank line separator
-			continue
+// match returns the last rule that matches name, taking .gitignore files in
+// deeper directories over shallower ones, and those over info/exclude and
+// core.excludesFile. It returns nil when no rule matches.
+func (ig *Ignorer) match(name string, isDir bool) (*IgnoreRule, error) {
+	var levels [][]*IgnoreRule
+	dir := path.Dir(name)
+	for {
+		if dir == "." {
+			dir = ""
 		}
-		if v[0] == '#' {
-			// comment
-			continue
+		rules, err := ig.directoryRules(dir)
+		if err != nil {
+			return nil, err
 		}
-		if v[0] == '\\' && v[1] == '#' {
-			// escaped #
-			v = v[1:]
+		levels = append(levels, rules)
+		if dir == "" {
+			break
 		}
-		for i, vv := range v {
-			// allow escaped spaces
-			if vv == '\\' && v[i+1] == ' ' && i < len(v)-1 {
-				v = append(v[:i], v[:i+1]...)
-			}
+		dir = path.Dir(dir)
+	}
+	levels = append(levels, ig.exclude)
+	for _, rules := range levels {
+		if rule := matchIgnoreRules(rules, name, isDir, ig.fold); rule != nil {
+			return rule, nil
 		}
-		if v[0] == '/' {
-			// starts with /
-			prefixMatch = true
-		} else if l := bytes.LastIndex(v, []byte{'/'}); l > -1 && (l < len(v)-1 || l == 0) {
-			// of has / in it but not the end
-			prefixMatch = true
-			// easier to add explicit '/'
-			v = append([]byte{'/'}, v...)
+	}
+	return nil, nil
+}
+
+// directoryRules returns the rules of the .gitignore file in dir, reading
+// it the first time
+func (ig *Ignorer) directoryRules(dir string) ([]*IgnoreRule, error) {
+	if rules, ok := ig.dirs[dir]; ok {
+		return rules, nil
+	}
+	source := path.Join(dir, ig.repo.config.GitIgnoreFileName)
+	rules, err := readIgnoreFile(filepath.Join(ig.repo.Path(), filepath.FromSlash(source)), source, dir)
+	if err != nil {
+		return nil, err
+	}
+	ig.dirs[dir] = rules
+	return rules, nil
+}
+
+// readIgnoreFile reads the rules of the gitignore file at path, reporting
+// them as read from source. A missing file has no rules.
+func readIgnoreFile(path string, source string, base string) ([]*IgnoreRule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
 		}
-		if v[len(v)-1] == '/' {
-			dirMatch = true
+		return nil, err
+	}
+	return parseIgnoreRules(b, source, base), nil
+}
+
+// parseIgnoreRules parses the gitignore content b read from source. The
+// rules are relative to the directory base of the working tree.
+func parseIgnoreRules(b []byte, source string, base string) []*IgnoreRule {
+	var rules []*IgnoreRule
+	for i, line := range bytes.Split(b, []byte{'\n'}) {
+		if rule := parseIgnoreRule(string(bytes.TrimSuffix(line, []byte{'\r'}))); rule != nil {
+			rule.Source = source
+			rule.Line = i + 1
+			rule.base = base
+			rules = append(rules, rule)
 		}
+	}
+	return rules
+}
 
-		// check for suffix match
-		if !prefixMatch && !dirMatch {
-			// other things to check before using suffix ...
-			if bytes.HasSuffix([]byte(path), v) {
-				return true
-			}
+// parseIgnoreRule parses a line of a gitignore file, returning nil for blank
+// lines and comments
+func parseIgnoreRule(line string) *IgnoreRule {
+	if line == "" || line[0] == '#' {
+		return nil
+	}
+	rule := &IgnoreRule{}
+	// trailing spaces are removed unless they are escaped with a backslash
+	end := len(line)
+	for end > 0 && line[end-1] == ' ' {
+		if end > 1 && line[end-2] == '\\' {
+			break
 		}
+		end--
+	}
+	glob := line[:end]
+	rule.Pattern = glob
+	if strings.HasPrefix(glob, "!") {
+		rule.negate = true
+		glob = glob[1:]
+	}
+	if strings.HasSuffix(glob, "/") {
+		rule.dirOnly = true
+		glob = strings.TrimSuffix(glob, "/")
+	}
+	if strings.Contains(glob, "/") {
+		// a separator at the start or middle makes the pattern relative to
+		// the directory of the .gitignore file
+		rule.anchored = true
+		glob = strings.TrimPrefix(glob, "/")
+	}
+	if glob == "" {
+		return nil
+	}
+	rule.glob = glob
+	return rule
+}
 
-		if dirMatch {
-			if path[len(path)-1] == '/' {
-				return true
-			}
+// matchIgnoreRules returns the last of rules that matches name, a slash
+// separated path relative to the working tree, or nil
+func matchIgnoreRules(rules []*IgnoreRule, name string, isDir bool, fold bool) *IgnoreRule {
+	for i := len(rules) - 1; i >= 0; i-- {
+		if rules[i].matches(name, isDir, fold) {
+			return rules[i]
 		}
+	}
+	return nil
+}
 
-		if prefixMatch {
-			if bytes.HasPrefix([]byte(path), v) {
-				return true
-			}
+func (rule *IgnoreRule) matches(name string, isDir bool, fold bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	if rule.base != "" {
+		rest, ok := strings.CutPrefix(name, rule.base+"/")
+		if !ok {
+			return false
 		}
+		name = rest
 	}
-	return false
+	if !rule.anchored {
+		name = path.Base(name)
+	}
+	return wildmatch(rule.glob, name, fold)
+}
+
+// IsNegated returns true when the rule re-includes the paths it matches
+func (rule *IgnoreRule) IsNegated() bool {
+	return rule.negate
 }
@@ -2,6 +2,9 @@ package g
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -15,7 +18,6 @@ func TestIsIgnored(t *testing.T) {
 		// A blank line matches no files, so it can serve as a separator for
 		// readability.
 		{Pattern: "", Path: "/test/hello", Expect: false},
-		{Pattern: "", Path: "/.git/HEAD", Expect: true},
 
 		// A line starting with # serves as a comment. Put a backslash ("\") in
 		// front of the first hash for patterns that begin with a hash.
@@ -23,7 +25,9 @@ func TestIsIgnored(t *testing.T) {
 		{Pattern: `\#test`, Path: "/test/#test", Expect: true},
 		// Trailing spaces are ignored unless they are quoted with backslash
 		// ("\").
-		// @todo
+		{Pattern: "a  ", Path: "/a", Expect: true},
+		{Pattern: `a\ `, Path: "/a", Expect: false},
+		{Pattern: `a\ `, Path: "/a ", Expect: true},
 
 		// An optional prefix "!" which negates the pattern; any matching file
 		// excluded by a previous pattern will become included again. It is not
@@ -33,7 +37,11 @@ func TestIsIgnored(t *testing.T) {
 		// where they are defined. Put a backslash ("\") in front of the first
 		// "!" for patterns that begin with a literal "!", for example,
 		// "\!important!.txt".
-		// @todo
+		{Pattern: "*.txt\n!b.txt", Path: "/a.txt", Expect: true},
+		{Pattern: "*.txt\n!b.txt", Path: "/b.txt", Expect: false},
+		{Pattern: "!b.txt\n*.txt", Path: "/b.txt", Expect: true},
+		{Pattern: "d/\n!d/b.txt", Path: "/d/b.txt", Expect: true},
+		{Pattern: `\!important!.txt`, Path: "/!important!.txt", Expect: true},
 
 		// The slash "/" is used as the directory separator. Separators may
 		// occur at the beginning, middle or end of the .gitignore search
@@ -54,7 +62,9 @@ func TestIsIgnored(t *testing.T) {
 		// If there is a separator at the end of the pattern then the pattern
 		// will only match directories, otherwise the pattern can match both
 		// files and directories.
-		//{Pattern: "/a/b/", Path: "/a/b", Expect: true},
+		{Pattern: "/a/b/", Path: "/a/b/", Expect: true},
+		{Pattern: "/a/b/", Path: "/a/b", Expect: false},
+		{Pattern: "b/", Path: "/a/b/c", Expect: true},
 
 		// For example, a pattern doc/frotz/ matches doc/frotz directory, but
 		// not a/doc/frotz directory; however frotz/ matches frotz and a/frotz
@@ -69,37 +79,128 @@ func TestIsIgnored(t *testing.T) {
 		// [a-zA-Z], can be used to match one of the characters in a range. See
 		// fnmatch(3) and the  FNM_PATHNAME flag for a more detailed description
 		// .
-		// @todo
+		{Pattern: "*.o", Path: "/a/b.o", Expect: true},
+		{Pattern: "*.o", Path: "/a.o/b", Expect: true},
+		{Pattern: "a/*.o", Path: "/a/b/c.o", Expect: false},
+		{Pattern: "?.o", Path: "/ab.o", Expect: false},
+		{Pattern: "[a-c].o", Path: "/b.o", Expect: true},
+		{Pattern: "[!a-c].o", Path: "/b.o", Expect: false},
 
 		// Two consecutive asterisks ("**") in patterns matched against full
 		// pathname may have special meaning:
-		// @todo
 
 		// A leading "**" followed by a slash means match in all directories.
 		// For example, "**/foo" matches file or directory "foo" anywhere, the
 		// same as pattern "foo". "**/foo/bar" matches file or directory "bar"
 		// anywhere that is directly under directory "foo".
-		// @todo
+		{Pattern: "**/foo", Path: "/foo", Expect: true},
+		{Pattern: "**/foo", Path: "/a/b/foo", Expect: true},
+		{Pattern: "**/foo/bar", Path: "/a/foo/bar", Expect: true},
+		{Pattern: "**/foo/bar", Path: "/foo/a/bar", Expect: false},
 
 		// A trailing "/**" matches everything inside. For example, "abc/**"
 		// matches all files inside directory "abc", relative to the location of
 		// the .gitignore file, with infinite depth.
-		// @todo
+		{Pattern: "abc/**", Path: "/abc/a/b", Expect: true},
+		{Pattern: "abc/**", Path: "/abc/", Expect: false},
+		{Pattern: "abc/**", Path: "/x/abc/a", Expect: false},
 
 		// A slash followed by two consecutive asterisks then a slash matches
 		// zero or more directories. For example, "a/**/b" matches "a/b",
 		// "a/x/b", "a/x/y/b" and so on.
-		// @todo
+		{Pattern: "a/**/b", Path: "/a/b", Expect: true},
+		{Pattern: "a/**/b", Path: "/a/x/y/b", Expect: true},
 
 		// Other consecutive asterisks are considered regular asterisks and will
 		// match according to the previous rules.
-		// @todo
+		{Pattern: "a**b", Path: "/axxb", Expect: true},
+		{Pattern: "a**b", Path: "/ax/xb", Expect: false},
 	} {
 		t.Run(fmt.Sprintf("%s with %s", tt.Pattern, tt.Path), func(t *testing.T) {
-			actual := IsIgnored(tt.Path, [][]byte{[]byte(tt.Pattern)})
+			rules := parseIgnoreRules([]byte(tt.Pattern), DefaultGitIgnoreFileName, "")
+			actual := isIgnoredBy(rules, tt.Path)
 			if actual != tt.Expect {
 				t.Errorf("got %v, want %v", actual, tt.Expect)
 			}
 		})
 	}
 }
+
+// isIgnoredBy returns true when path is ignored by rules, as for a single
+// .gitignore file. A path ending in / is a directory.
+func isIgnoredBy(rules []*IgnoreRule, path string) bool {
+	isDir := strings.HasSuffix(path, "/")
+	components := strings.Split(strings.Trim(path, "/"), "/")
+	for i := range components {
+		rule := matchIgnoreRules(rules, strings.Join(components[:i+1], "/"), i < len(components)-1 || isDir, false)
+		if rule != nil && !rule.negate {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLsIgnored(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Init(dir, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+	excludes := filepath.Join(t.TempDir(), "ignore")
+	e(r.SetConfig("core.excludesFile", excludes), t)
+	for path, content := range map[string]string{
+		excludes:                       "*.swp\n",
+		r.InfoExcludeFile():            "local\n",
+		".gitignore":                   "*.log\nbuild/\n",
+		"a/.gitignore":                 "!keep.log\n/only-here\n",
+		"a/keep.log":                   "",
+		"a/x.log":                      "",
+		"a/only-here":                  "",
+		"a/b/only-here":                "",
+		"a/b/.x.swp":                   "",
+		"build/out":                    "",
+		"build/.gitignore":             "!out\n",
+		"local":                        "",
+		"src/main.go":                  "",
+		"src/build/deep/out":           "",
+		filepath.Join("src", "keep.c"): "",
+	} {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		e(os.MkdirAll(filepath.Dir(path), 0755), t)
+		e(os.WriteFile(path, []byte(content), 0644), t)
+	}
+	files, err := r.Ls(dir)
+	e(err, t)
+	var actual []string
+	for _, v := range files {
+		actual = append(actual, filepath.ToSlash(v.Path()))
+	}
+	expected := []string{".gitignore", "a/.gitignore", "a/b/only-here", "a/keep.log", "src/keep.c", "src/main.go"}
+	if strings.Join(actual, ",") != strings.Join(expected, ",") {
+		t.Errorf("got %v, want %v", actual, expected)
+	}
+	for path, expected := range map[string]string{
+		"build/out":       ".gitignore:2:build/",
+		"a/keep.log":      "a/.gitignore:1:!keep.log",
+		"a/only-here":     "a/.gitignore:2:/only-here",
+		"local":           ".git/info/exclude:1:local",
+		"a/b/.x.swp":      excludes + ":1:*.swp",
+		"src/main.go":     "",
+		"src/build/deep/": ".gitignore:2:build/",
+	} {
+		ignored, rule, err := r.IsIgnored(path, strings.HasSuffix(path, "/"))
+		e(err, t)
+		var actual string
+		if rule != nil {
+			actual = fmt.Sprintf("%s:%d:%s", rule.Source, rule.Line, rule.Pattern)
+		}
+		if actual != expected || ignored != (rule != nil && !rule.IsNegated()) {
+			t.Errorf("%s matched %q ignored %v, want %q", path, actual, ignored, expected)
+		}
+	}
+	ignored, _, err := r.IsIgnored(filepath.Join(DefaultGitDirectory, "HEAD"), false)
+	e(err, t)
+	if !ignored {
+		t.Error("expected the git directory to be ignored")
+	}
+}
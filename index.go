@@ -12,14 +12,19 @@ import (
 	"runtime"
 	"sort"
 	"syscall"
+	"time"
 )
 
 type (
 	// Index represents the Git Index
 	Index struct {
+		repo   *Repository
 		header *indexHeader
 		items  []*indexItem
 		sig    [20]byte
+		// modTime is the modification time of the index file when it was
+		// read, entries not older than it are racy
+		modTime time.Time
 	}
 	indexHeader struct {
 		Sig        [4]byte
@@ -46,43 +51,54 @@ type (
 	}
 )
 
-// Files lists the files in the index
+// Files lists the files in the index. The entries of a path left in conflict
+// by a merge are listed as one file with its stages rather than an index
+// entry.
 func (idx *Index) Files() []*FileStatus {
 	var files []*FileStatus
+	unmerged := make(map[string]*FileStatus)
 	for _, v := range idx.items {
 		s, _ := NewSha(v.Sha[:])
-		idx := &FileStatus{
-			path:  string(v.Name),
-			index: &fileInfo{Sha: s, Finfo: fromIndexItemP(v.indexItemP)},
+		info := &fileInfo{Sha: s, Mode: FileMode(v.Mode), Finfo: fromIndexItemP(v.indexItemP)}
+		stage := v.stage()
+		if stage == 0 {
+			files = append(files, &FileStatus{path: string(v.Name), index: info})
+			continue
 		}
-		files = append(files, idx)
+		f, ok := unmerged[string(v.Name)]
+		if !ok {
+			f = &FileStatus{path: string(v.Name)}
+			unmerged[f.path] = f
+			files = append(files, f)
+		}
+		f.stages[stage-1] = info
 	}
 	return files
 }
 
 func (idx *Index) File(path string) *FileStatus {
-	for _, v := range idx.items {
-		if string(v.Name) == path {
-			s, _ := NewSha(v.Sha[:])
-			return &FileStatus{
-				path:  string(v.Name),
-				index: &fileInfo{Sha: s, Finfo: fromIndexItemP(v.indexItemP)},
-			}
+	for _, v := range idx.Files() {
+		if v.path == path {
+			return v
 		}
 	}
 	return nil
 }
 
-// Rm removes a item from the Index
+// Rm removes a item from the Index, at every merge stage
 // A call to idx.Write is required to persist the change.
 func (idx *Index) Rm(path string) error {
-	for i, v := range idx.items {
-		if string(v.Name) == path {
-			idx.items = append(idx.items[:i], idx.items[i+1:]...)
-			idx.header.NumEntries--
-			return nil
+	items := idx.items[:0]
+	for _, v := range idx.items {
+		if string(v.Name) != path {
+			items = append(items, v)
 		}
 	}
+	if len(items) < len(idx.items) {
+		idx.header.NumEntries = uint32(len(items))
+		idx.items = items
+		return nil
+	}
 	return fmt.Errorf("error: pathspec '%s' did not match any file(s) known to git", path)
 }
 
@@ -103,31 +119,63 @@ func newItem(fi os.FileInfo, sha Sha, path string) (*indexItem, error) {
 		item.Ino = fi.Ino
 		item.Mode = fi.MMode
 		item.Uid = fi.Uid
+		item.Gid = fi.Gid
+		item.Size = fi.SSize
 	default:
 		setItemOsSpecificStat(fi, item)
 		item.Dev = uint32(fi.Sys().(*syscall.Stat_t).Dev)
 		item.Ino = uint32(fi.Sys().(*syscall.Stat_t).Ino)
-		if fi.IsDir() {
-			item.Mode = uint32(040000)
-		} else {
-			item.Mode = uint32(0100644)
-		}
+		item.Mode = uint32(fileModeOf(fi))
 		item.Uid = fi.Sys().(*syscall.Stat_t).Uid
 		item.Gid = fi.Sys().(*syscall.Stat_t).Gid
 		item.Size = uint32(fi.Size())
 	}
 	item.Sha = sha.AsArray()
-	nameLen := len(path)
-	if nameLen < 0xFFF {
-		item.Flags = uint16(len(path))
-	} else {
-		item.Flags = 0xFFF
-	}
+	item.Flags = nameFlags(path)
 	item.Name = []byte(path)
 
 	return item, nil
 }
 
+// nameFlags returns the flags of an entry for path at stage 0, holding the
+// length of the name
+func nameFlags(path string) uint16 {
+	if len(path) < 0xFFF {
+		return uint16(len(path))
+	}
+	return 0xFFF
+}
+
+// stage returns the merge stage of the entry: 0 when it is merged, or 1, 2
+// and 3 for the common ancestor, ours and theirs versions of a conflict
+func (i *indexItem) stage() int {
+	return int(i.Flags >> 12 & 0b11)
+}
+
+// addStage adds the version f of path at a merge stage, or merged at stage 0,
+// without stat data. A call to idx.Write is required to persist the change.
+func (idx *Index) addStage(path string, stage int, f *fileInfo) {
+	item := &indexItem{
+		indexItemP: &indexItemP{Mode: uint32(f.Mode), Sha: f.Sha.AsArray(), Flags: nameFlags(path) | uint16(stage)<<12},
+		Name:       []byte(path),
+	}
+	idx.addItem(item)
+}
+
+// Unmerged returns the paths with entries at a merge stage, left in conflict
+// by a merge
+func (idx *Index) Unmerged() []string {
+	var paths []string
+	seen := make(map[string]bool)
+	for _, v := range idx.items {
+		if v.stage() != 0 && !seen[string(v.Name)] {
+			seen[string(v.Name)] = true
+			paths = append(paths, string(v.Name))
+		}
+	}
+	return paths
+}
+
 func (idx *Index) addFromIndex(f *FileStatus) error {
 	item, err := newItem(f.index.Finfo, f.index.Sha, f.Path())
 	if err != nil {
@@ -138,7 +186,7 @@ func (idx *Index) addFromIndex(f *FileStatus) error {
 }
 
 func (idx *Index) addFromCommit(f *FileStatus) error {
-	finfo, err := os.Stat(filepath.Join(Path(), f.Path()))
+	finfo, err := os.Lstat(filepath.Join(idx.repo.Path(), f.Path()))
 	if err != nil {
 		return err
 	}
@@ -146,6 +194,7 @@ func (idx *Index) addFromCommit(f *FileStatus) error {
 	if err != nil {
 		return err
 	}
+	item.Mode = uint32(f.commit.Mode)
 	// addFromCommit is used to recreate index when switching branch so only
 	// ever needs to be an add.
 	idx.addItem(item)
@@ -153,7 +202,17 @@ func (idx *Index) addFromCommit(f *FileStatus) error {
 }
 
 func (idx *Index) addFromWorkTree(f *FileStatus) error {
-	o, err := WriteBlob(f.Path())
+	if f.wd == nil || f.Unmerged() != 0 {
+		// a file deleted from the working tree is removed from the index,
+		// and a conflict is resolved by replacing its stages with the file
+		if err := idx.Rm(f.Path()); err != nil || f.wd == nil {
+			return err
+		}
+	}
+	if f.wd.Mode == ModeGitlink {
+		return idx.addSubmodule(f)
+	}
+	o, err := idx.repo.WriteBlob(f.Path())
 	if err != nil {
 		return err
 	}
@@ -162,6 +221,7 @@ func (idx *Index) addFromWorkTree(f *FileStatus) error {
 	if err != nil {
 		return err
 	}
+	item.Mode = uint32(o.Mode)
 	if f.index == nil {
 		idx.addItem(item)
 	} else {
@@ -170,6 +230,30 @@ func (idx *Index) addFromWorkTree(f *FileStatus) error {
 	return nil
 }
 
+// addSubmodule adds the nested repository f as a gitlink to the commit it
+// has checked out
+func (idx *Index) addSubmodule(f *FileStatus) error {
+	sub, err := Open(filepath.Join(idx.repo.Path(), f.Path()))
+	if err != nil {
+		return err
+	}
+	sha, err := sub.CurrentCommit()
+	if err != nil {
+		return err
+	}
+	if !sha.IsSet() {
+		return fmt.Errorf("error: '%s' does not have a commit checked out", f.Path())
+	}
+	f.wd.Sha = sha
+	item, err := newItem(f.wd.Finfo, sha, f.Path())
+	if err != nil {
+		return err
+	}
+	item.Mode = uint32(ModeGitlink)
+	item.Size = 0
+	return idx.upsertItem(item)
+}
+
 func (idx *Index) upsertItem(item *indexItem) error {
 	if err := idx.updateItem(item); err != nil {
 		idx.addItem(item)
@@ -180,7 +264,7 @@ func (idx *Index) upsertItem(item *indexItem) error {
 func (idx *Index) updateItem(i *indexItem) error {
 	found := false
 	for k, v := range idx.items {
-		if bytes.Equal(v.Name, i.Name) {
+		if bytes.Equal(v.Name, i.Name) && v.stage() == i.stage() {
 			idx.items[k] = i
 			found = true
 		}
@@ -202,8 +286,35 @@ func (idx *Index) Add(f *FileStatus) error {
 	return idx.addFromWorkTree(f)
 }
 
-// Write writes an Index struct to the Git Index
+// Write writes an Index struct to the Git Index, holding index.lock whilst
+// it is written
 func (idx *Index) Write() error {
+	l, err := newLockFile(idx.repo.IndexFilePath())
+	if err != nil {
+		return err
+	}
+	return idx.writeLocked(l)
+}
+
+// writeLocked writes idx to l, the lock of the Git Index, and commits it,
+// replacing the index file
+func (idx *Index) writeLocked(l *lockFile) error {
+	if err := idx.write(l); err != nil {
+		l.Rollback()
+		return err
+	}
+	if err := l.Commit(); err != nil {
+		return err
+	}
+	finfo, err := os.Stat(idx.repo.IndexFilePath())
+	if err != nil {
+		return err
+	}
+	idx.modTime = finfo.ModTime()
+	return nil
+}
+
+func (idx *Index) write(w io.Writer) error {
 
 	if idx.header.NumEntries != uint32(len(idx.items)) {
 		return errors.New("index numEntries and length of items inconsistent")
@@ -211,19 +322,20 @@ func (idx *Index) Write() error {
 
 	// and sort @todo more efficient
 	sort.Slice(idx.items, func(i, j int) bool {
-		return string(idx.items[i].Name) < string(idx.items[j].Name)
+		if c := bytes.Compare(idx.items[i].Name, idx.items[j].Name); c != 0 {
+			return c < 0
+		}
+		return idx.items[i].stage() < idx.items[j].stage()
 	})
 
-	path := IndexFilePath()
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_TRUNC|os.O_CREATE, 0644)
-	if err != nil {
+	if err := idx.smudgeRacilyCleanItems(); err != nil {
 		return err
 	}
-	defer func() { _ = f.Close() }()
+
 	// use a multi-writer to allow both writing the file whilst incrementally generating
 	// a Sha hash of the content as it is written
 	h := sha1.New()
-	mw := io.MultiWriter(f, h)
+	mw := io.MultiWriter(w, h)
 
 	// write header
 	if err := binary.Write(mw, binary.BigEndian, idx.header); err != nil {
@@ -248,15 +360,46 @@ func (idx *Index) Write() error {
 	sha := h.Sum(nil)
 	copy(idx.sig[:], sha)
 	// write Sha hash of Index
-	if err := binary.Write(f, binary.BigEndian, &sha); err != nil {
-		return err
-	}
+	return binary.Write(w, binary.BigEndian, &sha)
+}
 
-	return f.Close()
+// smudgeRacilyCleanItems clears the size of racy entries whose stat data
+// matches the working tree but whose content does not, as git does, so that
+// they are compared by content once the index written is no longer newer
+// than them.
+func (idx *Index) smudgeRacilyCleanItems() error {
+	if idx.modTime.IsZero() {
+		// nothing is racy in an index that has not been written
+		return nil
+	}
+	for _, item := range idx.items {
+		if item.stage() != 0 || item.Size == 0 || FileMode(item.Mode) == ModeGitlink {
+			continue
+		}
+		finfo := fromIndexItemP(item.indexItemP)
+		if finfo.ModTime().Before(idx.modTime) {
+			continue
+		}
+		wd, err := os.Lstat(filepath.Join(idx.repo.Path(), string(item.Name)))
+		if err != nil {
+			continue
+		}
+		if changed, _ := compareStat(finfo, wd); changed {
+			continue
+		}
+		sha, err := idx.repo.HashBlob(string(item.Name))
+		if err != nil {
+			return err
+		}
+		if sha.AsArray() != item.Sha {
+			item.Size = 0
+		}
+	}
+	return nil
 }
 
-func NewIndex() *Index {
-	return &Index{header: &indexHeader{
+func (r *Repository) NewIndex() *Index {
+	return &Index{repo: r, header: &indexHeader{
 		Sig:        [4]byte{'D', 'I', 'R', 'C'},
 		Version:    2,
 		NumEntries: 0,
@@ -282,32 +425,120 @@ func fromIndexItemP(p *indexItemP) *Finfo {
 
 // FsStatus returns a FfileSet containing all files from the index and working directory
 // with the corresponding status.
-func FsStatus(path string) (*FfileSet, error) {
-	idx, err := ReadIndex()
+func (r *Repository) FsStatus(path string) (*FfileSet, error) {
+	idx, err := r.ReadIndex()
 	if err != nil {
 		return nil, err
 	}
 	idxFiles := idx.Files()
-	files, err := Ls(path)
+	files, err := r.Ls(path)
 	if err != nil {
 		return nil, err
 	}
-	return NewFfileSet(nil, idxFiles, files)
+	return newFfileSet(nil, idxFiles, files, r.worktreeStatus(idx))
+}
+
+// worktreeStatus returns a function deciding whether a working tree file
+// has been modified since it was added to idx. The modes are compared first,
+// then the stat data, and the content is hashed only when it is ambiguous:
+// when stat data other than the size has changed, or when the entry is racy
+// because it was modified no earlier than the index file was written, as a
+// later change in the same instant would leave the stat data unchanged.
+func (r *Repository) worktreeStatus(idx *Index) func(*FileStatus) (WDStatus, error) {
+	return func(f *FileStatus) (WDStatus, error) {
+		if status, ok := modeStatus(f.index.Mode, f.wd.Mode); ok {
+			return status, nil
+		}
+		if f.index.Mode == ModeGitlink {
+			// the commit checked out in a submodule is not compared
+			return IndexAndWorkingTreeMatch, nil
+		}
+		changed, sizeChanged := compareStat(f.index.Finfo, f.wd.Finfo)
+		if sizeChanged && f.index.Finfo.Size() != 0 {
+			// an entry without a size, such as one from a commit, has to be
+			// compared by content
+			return WorktreeChangedSinceIndex, nil
+		}
+		racy := !f.index.Finfo.ModTime().Before(idx.modTime)
+		if !changed && !racy {
+			return IndexAndWorkingTreeMatch, nil
+		}
+		sha, err := r.HashBlob(f.path)
+		if err != nil {
+			return 0, err
+		}
+		if !sha.Matches(f.index.Sha) {
+			return WorktreeChangedSinceIndex, nil
+		}
+		f.stale = changed
+		return IndexAndWorkingTreeMatch, nil
+	}
+}
+
+// RefreshIndex updates the stat data of index entries whose working tree file
+// has changed stat data but the same content, so that later status checks do
+// not need to hash the file again. The index is only written when an entry
+// was updated.
+func (r *Repository) RefreshIndex() error {
+	l, err := newLockFile(r.IndexFilePath())
+	if err != nil {
+		var lockErr *LockError
+		if errors.As(err, &lockErr) {
+			// the refresh is optional, another process is updating the index
+			return nil
+		}
+		return err
+	}
+	defer l.Rollback()
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return err
+	}
+	files, err := r.Ls(r.Path())
+	if err != nil {
+		return err
+	}
+	status, err := newFfileSet(nil, idx.Files(), files, r.worktreeStatus(idx))
+	if err != nil {
+		return err
+	}
+	refreshed := false
+	for _, v := range status.Files() {
+		if !v.stale {
+			continue
+		}
+		item, err := newItem(v.wd.Finfo, v.index.Sha, v.path)
+		if err != nil {
+			return err
+		}
+		if err := idx.updateItem(item); err != nil {
+			return err
+		}
+		refreshed = true
+	}
+	if !refreshed {
+		return nil
+	}
+	return idx.writeLocked(l)
 }
 
 // ReadIndex reads the Git Index into an Index struct
-func ReadIndex() (*Index, error) {
-	path := IndexFilePath()
+func (r *Repository) ReadIndex() (*Index, error) {
+	path := r.IndexFilePath()
 	f, err := os.Open(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return NewIndex(), nil
+			return r.NewIndex(), nil
 		}
 		return nil, err
 	}
 	defer func() { _ = f.Close() }()
+	finfo, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
 	// populate indexHeader
-	index := &Index{header: &indexHeader{}}
+	index := &Index{repo: r, header: &indexHeader{}, modTime: finfo.ModTime()}
 	if err := binary.Read(f, binary.BigEndian, index.header); err != nil {
 		return nil, err
 	}
@@ -5,21 +5,34 @@ import (
 	"os"
 )
 
-// Init initializes a git repository
-func Init() error {
-	path := GitPath()
-	if err := os.MkdirAll(path, 0755); err != nil {
+// Init initializes a git repository with its working directory at path and
+// returns it
+func Init(path string, opts ...Opt) (*Repository, error) {
+	cnf, err := newConfig(path, opts...)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newRepository(cnf)
+	if err != nil {
+		return nil, err
+	}
+	return r, r.init()
+}
+
+func (r *Repository) init() error {
+	if err := os.MkdirAll(r.GitPath(), 0755); err != nil {
 		return err
 	}
 	for _, v := range []string{
-		ObjectPath(),
-		RefsDirectory(),
-		RefsHeadsDirectory(),
+		r.ObjectPath(),
+		r.RefsDirectory(),
+		r.RefsHeadsDirectory(),
+		r.RefsTagsDirectory(),
 	} {
 		if err := os.MkdirAll(v, 0755); err != nil {
 			log.Fatalln(err)
 		}
 	}
 	// set default main branch
-	return UpdateHead(DefaultBranch())
+	return r.UpdateHead(r.DefaultBranch())
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 )
@@ -21,24 +22,22 @@ func Test_Integration(t *testing.T) {
 	e(os.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644), t)
 	e(os.WriteFile(filepath.Join(dir, "b"), []byte("b"), 0644), t)
 
-	// configure with dir working directory
-	e(Configure(WithPath(dir)), t)
-
-	// init, creating a .git folder
-	e(Init(), t)
+	// init with dir working directory, creating a .git folder
+	r, err := Init(dir)
+	e(err, t)
 
 	// commit 'a' to branch 'main'
 	{
 		// check branch is main
-		assertCurrentBranch(t, "main")
+		assertCurrentBranch(t, r, "main")
 		// check that file 'a' is recorded as untracked in the current status,
-		assertStatus(t, map[string]IndexStatus{"a": UntrackedInIndex}, map[string]WDStatus{"a": Untracked})
+		assertStatus(t, r, map[string]IndexStatus{"a": UntrackedInIndex}, map[string]WDStatus{"a": Untracked})
 		// add 'a' to the index
-		assertAddFiles(t, []string{"a"})
+		assertAddFiles(t, r, []string{"a"})
 		// check its status is correct
-		assertStatus(t, map[string]IndexStatus{"a": AddedInIndex}, map[string]WDStatus{"a": IndexAndWorkingTreeMatch})
+		assertStatus(t, r, map[string]IndexStatus{"a": AddedInIndex}, map[string]WDStatus{"a": IndexAndWorkingTreeMatch})
 		// create a commit
-		commitSha := assertCreateCommit(t, &Commit{
+		commitSha := assertCreateCommit(t, r, &Commit{
 			Author:        fmt.Sprintf("%s <%s>", "tester", "tester@test.com"),
 			AuthoredTime:  time.Now(),
 			Committer:     fmt.Sprintf("%s <%s>", "tester", "tester@test.com"),
@@ -46,11 +45,11 @@ func Test_Integration(t *testing.T) {
 			Message:       []byte("this is a commit message"),
 		})
 		// check branch is still main
-		assertCurrentBranch(t, "main")
+		assertCurrentBranch(t, r, "main")
 		// check current HEAD sha matches the new commit sha
-		assertCurrentCommit(t, commitSha)
+		assertCurrentCommit(t, r, commitSha)
 		// check last commit message matches the created commit message
-		assertLookupCommit(t, commitSha, func(t *testing.T, commit *Commit) {
+		assertLookupCommit(t, r, commitSha, func(t *testing.T, commit *Commit) {
 			if string(commit.Message) != "this is a commit message\n" {
 				t.Errorf("expected commit message to be 'this is a commit message'")
 			}
@@ -67,9 +66,9 @@ func Test_Integration(t *testing.T) {
 		// modify file a
 		e(os.WriteFile(filepath.Join(dir, "a"), []byte("aa"), 0644), t)
 		// add 'a' to the index
-		assertAddFiles(t, []string{"a"})
+		assertAddFiles(t, r, []string{"a"})
 		// create a commit
-		commitSha := assertCreateCommit(t, &Commit{
+		commitSha := assertCreateCommit(t, r, &Commit{
 			Author:        fmt.Sprintf("%s <%s>", "tester", "tester@test.com"),
 			AuthoredTime:  time.Now(),
 			Committer:     fmt.Sprintf("%s <%s>", "tester", "tester@test.com"),
@@ -77,25 +76,25 @@ func Test_Integration(t *testing.T) {
 			Message:       []byte("this is a another commit message"),
 		})
 		// check last commit message matches the created commit message
-		assertLookupCommit(t, commitSha, func(t *testing.T, commit *Commit) {
+		assertLookupCommit(t, r, commitSha, func(t *testing.T, commit *Commit) {
 			if string(commit.Message) != "this is a another commit message\n" {
 				t.Errorf("expected commit message to be 'this is a another commit message'")
 			}
 		})
 		// check 'a' is still correct
-		assertStatus(t, map[string]IndexStatus{"a": NotUpdated}, map[string]WDStatus{"a": IndexAndWorkingTreeMatch})
+		assertStatus(t, r, map[string]IndexStatus{"a": NotUpdated}, map[string]WDStatus{"a": IndexAndWorkingTreeMatch})
 		// change to a new branch
-		e(CreateBranch("test"), t)
+		e(r.CreateBranch("test"), t)
 		// switch to the new branch
-		assertSwitchBranch(t, "test", assertNoErrorFiles)
+		assertSwitchBranch(t, r, "test", assertNoErrorFiles)
 		// check branch is now test
-		assertCurrentBranch(t, "test")
+		assertCurrentBranch(t, r, "test")
 		// check current commit is the last commit sha
-		assertCurrentCommit(t, commitSha)
+		assertCurrentCommit(t, r, commitSha)
 		// check 'a' is still correct
-		assertStatus(t, map[string]IndexStatus{"a": NotUpdated}, map[string]WDStatus{"a": IndexAndWorkingTreeMatch})
+		assertStatus(t, r, map[string]IndexStatus{"a": NotUpdated}, map[string]WDStatus{"a": IndexAndWorkingTreeMatch})
 		// check 'b' is still correct
-		assertStatus(t, map[string]IndexStatus{"b": UntrackedInIndex}, map[string]WDStatus{"b": Untracked})
+		assertStatus(t, r, map[string]IndexStatus{"b": UntrackedInIndex}, map[string]WDStatus{"b": Untracked})
 	}
 
 	// commit b
@@ -103,9 +102,9 @@ func Test_Integration(t *testing.T) {
 	// check 'b' is no longer in the working directory
 	{
 		// add 'b' to the index
-		assertAddFiles(t, []string{"b"})
+		assertAddFiles(t, r, []string{"b"})
 		// commit
-		commitSha := assertCreateCommit(t, &Commit{
+		commitSha := assertCreateCommit(t, r, &Commit{
 			Author:        fmt.Sprintf("%s <%s>", "tester", "tester@test.com"),
 			AuthoredTime:  time.Now(),
 			Committer:     fmt.Sprintf("%s <%s>", "tester", "tester@test.com"),
@@ -113,17 +112,17 @@ func Test_Integration(t *testing.T) {
 			Message:       []byte("this is yet another commit message"),
 		})
 		// check commit
-		assertLookupCommit(t, commitSha, func(t *testing.T, commit *Commit) {
+		assertLookupCommit(t, r, commitSha, func(t *testing.T, commit *Commit) {
 			if string(commit.Message) != "this is yet another commit message\n" {
 				t.Errorf("expected commit message to be 'this is yet another commit message'")
 			}
 		})
 		// check status of 'b'
-		assertStatus(t, map[string]IndexStatus{"b": NotUpdated}, map[string]WDStatus{"b": IndexAndWorkingTreeMatch})
+		assertStatus(t, r, map[string]IndexStatus{"b": NotUpdated}, map[string]WDStatus{"b": IndexAndWorkingTreeMatch})
 		// switch to the main branch
-		assertSwitchBranch(t, "main", assertNoErrorFiles)
+		assertSwitchBranch(t, r, "main", assertNoErrorFiles)
 		// check file 'b' is not in the status
-		assertNotInStatus(t, []string{"b"})
+		assertNotInStatus(t, r, []string{"b"})
 	}
 
 	// switch back to branch 'test'
@@ -133,17 +132,17 @@ func Test_Integration(t *testing.T) {
 	// 'c' should still be in the index
 	{
 		// switch back to branch 'test'
-		assertSwitchBranch(t, "test", assertNoErrorFiles)
+		assertSwitchBranch(t, r, "test", assertNoErrorFiles)
 		// create a new file 'c'
 		e(os.WriteFile(filepath.Join(dir, "c"), []byte("c"), 0644), t)
 		// check 'c' has the correct status
-		assertStatus(t, map[string]IndexStatus{"c": UntrackedInIndex}, map[string]WDStatus{"c": Untracked})
+		assertStatus(t, r, map[string]IndexStatus{"c": UntrackedInIndex}, map[string]WDStatus{"c": Untracked})
 		// add 'c' to the index
-		assertAddFiles(t, []string{"c"})
+		assertAddFiles(t, r, []string{"c"})
 		// switch to branch 'main'
-		assertSwitchBranch(t, "main", assertNoErrorFiles)
+		assertSwitchBranch(t, r, "main", assertNoErrorFiles)
 		// check 'c' has the correct status
-		assertStatus(t, map[string]IndexStatus{"c": AddedInIndex}, map[string]WDStatus{"c": IndexAndWorkingTreeMatch})
+		assertStatus(t, r, map[string]IndexStatus{"c": AddedInIndex}, map[string]WDStatus{"c": IndexAndWorkingTreeMatch})
 	}
 
 	// restore --staged a file that is commited, has been modified, added to
@@ -151,7 +150,7 @@ func Test_Integration(t *testing.T) {
 	// restore a working tree file that is in a previous commit
 	{
 		// commit change to 'c'
-		_ = assertCreateCommit(t, &Commit{
+		_ = assertCreateCommit(t, r, &Commit{
 			Author:        fmt.Sprintf("%s <%s>", "tester", "tester@test.com"),
 			AuthoredTime:  time.Now(),
 			Committer:     fmt.Sprintf("%s <%s>", "tester", "tester@test.com"),
@@ -161,19 +160,19 @@ func Test_Integration(t *testing.T) {
 		// change 'c'
 		e(os.WriteFile(filepath.Join(dir, "c"), []byte("cc"), 0644), t)
 		// check status is correct
-		assertStatus(t, map[string]IndexStatus{"c": NotUpdated}, map[string]WDStatus{"c": WorktreeChangedSinceIndex})
+		assertStatus(t, r, map[string]IndexStatus{"c": NotUpdated}, map[string]WDStatus{"c": WorktreeChangedSinceIndex})
 		// add to index
-		assertAddFiles(t, []string{"c"})
+		assertAddFiles(t, r, []string{"c"})
 		// check status
-		assertStatus(t, map[string]IndexStatus{"c": UpdatedInIndex}, map[string]WDStatus{"c": IndexAndWorkingTreeMatch})
+		assertStatus(t, r, map[string]IndexStatus{"c": UpdatedInIndex}, map[string]WDStatus{"c": IndexAndWorkingTreeMatch})
 		// restore --staged c
-		assertRestore(t, "c", true)
+		assertRestore(t, r, "c", true)
 		// check status
-		assertStatus(t, map[string]IndexStatus{"c": NotUpdated}, map[string]WDStatus{"c": WorktreeChangedSinceIndex})
+		assertStatus(t, r, map[string]IndexStatus{"c": NotUpdated}, map[string]WDStatus{"c": WorktreeChangedSinceIndex})
 		// git restore c
-		assertRestore(t, "c", false)
+		assertRestore(t, r, "c", false)
 		// check status
-		assertStatus(t, map[string]IndexStatus{"c": NotUpdated}, map[string]WDStatus{"c": IndexAndWorkingTreeMatch})
+		assertStatus(t, r, map[string]IndexStatus{"c": NotUpdated}, map[string]WDStatus{"c": IndexAndWorkingTreeMatch})
 	}
 
 }
@@ -185,33 +184,33 @@ func e(err error, t *testing.T) {
 	}
 }
 
-func assertRestore(t *testing.T, path string, staged bool) {
-	if err := Restore(path, staged); err != nil {
+func assertRestore(t *testing.T, r *Repository, path string, staged bool) {
+	if err := r.Restore(path, staged); err != nil {
 		t.Fatal(err)
 	}
 }
 
-func assertLookupCommit(t *testing.T, sha Sha, f func(*testing.T, *Commit)) {
+func assertLookupCommit(t *testing.T, r *Repository, sha Sha, f func(*testing.T, *Commit)) {
 	t.Helper()
-	commit, err := ReadCommit(sha)
+	commit, err := r.ReadCommit(sha)
 	e(err, t)
 	f(t, commit)
 }
 
-func assertCurrentCommit(t *testing.T, commitSha Sha) {
+func assertCurrentCommit(t *testing.T, r *Repository, commitSha Sha) {
 	t.Helper()
-	branch, err := CurrentBranch()
+	branch, err := r.CurrentBranch()
 	e(err, t)
-	sha, err := HeadSHA(branch)
+	sha, err := r.HeadSHA(branch)
 	e(err, t)
 	if sha.String() != commitSha.String() {
 		e(fmt.Errorf("expected current commit SHA %s to match SHA %s", sha, commitSha), t)
 	}
 }
 
-func assertCreateCommit(t *testing.T, commit *Commit) Sha {
+func assertCreateCommit(t *testing.T, r *Repository, commit *Commit) Sha {
 	t.Helper()
-	commitSha, err := CreateCommit(commit)
+	commitSha, err := r.CreateCommit(commit)
 	e(err, t)
 	if !commitSha.IsSet() {
 		e(errors.New("expected commit SHA to be set"), t)
@@ -219,11 +218,11 @@ func assertCreateCommit(t *testing.T, commit *Commit) Sha {
 	return commitSha
 }
 
-func assertAddFiles(t *testing.T, filePaths []string) {
+func assertAddFiles(t *testing.T, r *Repository, filePaths []string) {
 	t.Helper()
-	idx, err := ReadIndex()
+	idx, err := r.ReadIndex()
 	e(err, t)
-	fh, err := CurrentStatus()
+	fh, err := r.CurrentStatus()
 	e(err, t)
 	for _, v := range filePaths {
 		f, ok := fh.idx[v]
@@ -235,18 +234,18 @@ func assertAddFiles(t *testing.T, filePaths []string) {
 	e(idx.Write(), t)
 }
 
-func assertCurrentBranch(t *testing.T, expected string) {
+func assertCurrentBranch(t *testing.T, r *Repository, expected string) {
 	t.Helper()
-	branch, err := CurrentBranch()
+	branch, err := r.CurrentBranch()
 	e(err, t)
 	if branch != expected {
 		t.Errorf("expected branch to be '%s' got '%s'", expected, branch)
 	}
 }
 
-func assertNotInStatus(t *testing.T, filePaths []string) {
+func assertNotInStatus(t *testing.T, r *Repository, filePaths []string) {
 	t.Helper()
-	fh, err := CurrentStatus()
+	fh, err := r.CurrentStatus()
 	e(err, t)
 	for _, v := range filePaths {
 		if _, ok := fh.idx[v]; ok {
@@ -261,18 +260,18 @@ var assertNoErrorFiles = func(t *testing.T, paths []string) {
 	}
 }
 
-func assertSwitchBranch(t *testing.T, name string, f func(t *testing.T, fh []string)) {
+func assertSwitchBranch(t *testing.T, r *Repository, name string, f func(t *testing.T, fh []string)) {
 	t.Helper()
-	errFiles, err := SwitchBranch(name)
+	errFiles, err := r.SwitchBranch(name)
 	if err != nil {
 		t.Error(err)
 	}
 	f(t, errFiles)
 }
 
-func assertStatus(t *testing.T, i map[string]IndexStatus, w map[string]WDStatus) {
+func assertStatus(t *testing.T, r *Repository, i map[string]IndexStatus, w map[string]WDStatus) {
 	t.Helper()
-	fs, err := CurrentStatus()
+	fs, err := r.CurrentStatus()
 	e(err, t)
 	for k, v := range i {
 		f, ok := fs.Contains(k)
@@ -293,3 +292,73 @@ func assertStatus(t *testing.T, i map[string]IndexStatus, w map[string]WDStatus)
 		}
 	}
 }
+
+func TestRepositoriesConcurrently(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		dir := t.TempDir()
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r, err := Init(dir)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			name := fmt.Sprintf("file%d", i)
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+				t.Error(err)
+				return
+			}
+			idx, err := r.ReadIndex()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			files, err := r.FsStatus(r.Path())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for _, v := range files.Files() {
+				if err := idx.Add(v); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+			if err := idx.Write(); err != nil {
+				t.Error(err)
+				return
+			}
+			sha, err := r.CreateCommit(&Commit{
+				Author:        "tester <tester@test.com>",
+				AuthoredTime:  time.Now(),
+				Committer:     "tester <tester@test.com>",
+				CommittedTime: time.Now(),
+				Message:       []byte(name),
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			// each repository only sees its own commit and files
+			files, err = r.CurrentStatus()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if len(files.Files()) != 1 || files.Files()[0].Path() != name {
+				t.Errorf("expected only %s in the status of %s", name, dir)
+			}
+			commit, err := r.ReadCommit(sha)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if string(commit.Message) != name+"\n" {
+				t.Errorf("expected commit message %s, got %s", name, commit.Message)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
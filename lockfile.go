@@ -0,0 +1,93 @@
+package g
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const lockFileSuffix = ".lock"
+
+type (
+	// lockFile is an exclusive <path>.lock file. Content is written to the
+	// lock file and renamed over path on commit, so that readers of path
+	// never see a partial write.
+	lockFile struct {
+		path string
+		f    *os.File
+	}
+	// LockError is returned when a lock file already exists, because another
+	// process is updating the same file or crashed whilst doing so.
+	LockError struct {
+		Path string
+	}
+)
+
+func (e *LockError) Error() string {
+	return fmt.Sprintf("fatal: Unable to create '%s': File exists", e.Path)
+}
+
+// newLockFile takes the lock for path by creating <path>.lock, creating any
+// missing parent directories.
+func newLockFile(path string) (*lockFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path+lockFileSuffix, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return nil, &LockError{Path: path + lockFileSuffix}
+		}
+		return nil, err
+	}
+	return &lockFile{path: path, f: f}, nil
+}
+
+func (l *lockFile) Write(b []byte) (int, error) {
+	return l.f.Write(b)
+}
+
+// Commit flushes the lock file to disk and renames it over path, releasing
+// the lock.
+func (l *lockFile) Commit() error {
+	if err := l.f.Sync(); err != nil {
+		l.Rollback()
+		return err
+	}
+	if err := l.f.Close(); err != nil {
+		l.Rollback()
+		return err
+	}
+	if err := os.Rename(l.path+lockFileSuffix, l.path); err != nil {
+		l.Rollback()
+		return err
+	}
+	l.f = nil
+	return nil
+}
+
+// Rollback releases the lock leaving path unchanged. It does nothing once
+// the lock has been committed.
+func (l *lockFile) Rollback() {
+	if l.f == nil {
+		return
+	}
+	_ = l.f.Close()
+	_ = os.Remove(l.path + lockFileSuffix)
+	l.f = nil
+}
+
+// writeFileLocked replaces the content of path whilst holding its lock
+func writeFileLocked(path string, content []byte) error {
+	l, err := newLockFile(path)
+	if err != nil {
+		return err
+	}
+	if _, err := l.Write(content); err != nil {
+		l.Rollback()
+		return err
+	}
+	return l.Commit()
+}
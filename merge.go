@@ -0,0 +1,531 @@
+package g
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/richardjennings/g/diff"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type (
+	// MergeOptions configures Merge
+	MergeOptions struct {
+		// Name names the merged commit in messages, such as the branch
+		// being merged. It defaults to the Sha of the commit.
+		Name string
+		// NoFastForward creates a merge commit even when HEAD could be
+		// fast-forwarded
+		NoFastForward bool
+		// FastForwardOnly refuses to merge unless HEAD can be fast-forwarded
+		FastForwardOnly bool
+		// Algorithm is the diff algorithm used to merge the content of
+		// files
+		Algorithm diff.Algorithm
+		// Style is how conflicts are written to the working tree
+		Style diff.ConflictStyle
+	}
+	// MergeResult is the outcome of Merge
+	MergeResult struct {
+		// UpToDate is true when the commit was already reachable from HEAD
+		UpToDate bool
+		// FastForward is true when HEAD was moved to the commit without a
+		// merge commit
+		FastForward bool
+		// Commit is the merge commit, or the commit HEAD was fast-forwarded
+		// to. It is unset when there are conflicts.
+		Commit Sha
+		// Messages report the files merged by content and the conflicts, as
+		// git merge prints them
+		Messages []string
+		// Conflicts are the paths left in conflict
+		Conflicts []string
+	}
+	// mergedFile is the outcome of merging the versions of a path in the
+	// merge base, ours and theirs, any of which may be missing
+	mergedFile struct {
+		path   string
+		base   *fileInfo
+		ours   *fileInfo
+		theirs *fileInfo
+		// result is the merged version, or nil when the path is deleted or
+		// in conflict
+		result   *fileInfo
+		conflict bool
+		// content is written to the working tree for a conflict of the
+		// content of a file
+		content []byte
+		message string
+	}
+)
+
+// Merge merges commit sha into HEAD. When HEAD is an ancestor of sha it is
+// fast-forwarded. Otherwise the trees of the two commits are merged with the
+// tree of their merge base, file by file and then line by line, and a commit
+// with both as parents is written from commit, which provides the author,
+// committer and message. When the merge bases are a criss-cross they are
+// first merged into a virtual merge base. Paths are not followed through
+// renames.
+//
+// Conflicts are written to the working tree with conflict markers and to the
+// index as stages 1, 2 and 3 for the base, ours and theirs. The merge is then
+// left in progress for CreateCommit to conclude, with MERGE_HEAD naming sha.
+// Nothing is changed when the merge would overwrite local changes.
+func (r *Repository) Merge(sha Sha, commit *Commit, opts MergeOptions) (*MergeResult, error) {
+	if _, err := os.Stat(r.MergeHeadPath()); err == nil {
+		return nil, errors.New("fatal: You have not concluded your merge (MERGE_HEAD exists).")
+	}
+	if idx, err := r.ReadIndex(); err != nil {
+		return nil, err
+	} else if len(idx.Unmerged()) > 0 {
+		return nil, errors.New("error: Merging is not possible because you have unmerged files.")
+	}
+	if opts.Name == "" {
+		opts.Name = sha.AsHexString()
+	}
+	head, err := r.CurrentCommit()
+	if err != nil {
+		return nil, err
+	}
+	if !head.IsSet() {
+		return r.fastForward(head, sha, opts)
+	}
+	if upToDate, err := r.IsAncestor(sha, head); err != nil {
+		return nil, err
+	} else if upToDate {
+		return &MergeResult{UpToDate: true, Commit: head}, nil
+	}
+	if ff, err := r.IsAncestor(head, sha); err != nil {
+		return nil, err
+	} else if ff && !opts.NoFastForward {
+		return r.fastForward(head, sha, opts)
+	}
+	if opts.FastForwardOnly {
+		return nil, errors.New("fatal: Not possible to fast-forward, aborting.")
+	}
+
+	// the index must match HEAD, so that the merge can rebuild it
+	status, err := r.CurrentStatus()
+	if err != nil {
+		return nil, err
+	}
+	var staged []string
+	for _, v := range status.Files() {
+		if v.idxStatus != NotUpdated && v.idxStatus != UntrackedInIndex {
+			staged = append(staged, v.path)
+		}
+	}
+	if len(staged) > 0 {
+		return nil, localChangesError(staged)
+	}
+
+	bases, err := r.MergeBase(head, sha)
+	if err != nil {
+		return nil, err
+	}
+	if len(bases) == 0 {
+		return nil, errors.New("fatal: refusing to merge unrelated histories")
+	}
+	base, err := r.mergeBaseFiles(bases, opts)
+	if err != nil {
+		return nil, err
+	}
+	ours, err := r.treeFiles(head)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := r.treeFiles(sha)
+	if err != nil {
+		return nil, err
+	}
+	labels := diff.MergeOptions{Algorithm: opts.Algorithm, Style: opts.Style, Ours: "HEAD", Theirs: opts.Name}
+	labels.Base = bases[0].AsHexString()[:7]
+	if len(bases) > 1 {
+		labels.Base = "merged common ancestors"
+	}
+	merged, err := r.mergeFiles(base, ours, theirs, labels, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// refuse to overwrite changes in the working tree
+	if err := checkMerged(status, merged); err != nil {
+		return nil, err
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	result, err := r.writeMerged(idx, merged)
+	if err != nil {
+		return nil, err
+	}
+	if err := idx.Write(); err != nil {
+		return nil, err
+	}
+	if err := r.writeOrigHead(head); err != nil {
+		return nil, err
+	}
+
+	message := commit.Message
+	if len(message) == 0 {
+		message = []byte(fmt.Sprintf("Merge commit '%s'", opts.Name))
+	}
+	if len(result.Conflicts) > 0 {
+		// leave the merge in progress for CreateCommit to conclude
+		msg := string(message) + "\n\n# Conflicts:\n"
+		for _, v := range result.Conflicts {
+			msg += "#\t" + v + "\n"
+		}
+		if err := os.WriteFile(r.MergeMsgPath(), []byte(msg), 0644); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(filepath.Join(r.GitPath(), DefaultMergeModeFile), nil, 0644); err != nil {
+			return nil, err
+		}
+		return result, os.WriteFile(r.MergeHeadPath(), []byte(sha.AsHexString()+"\n"), 0644)
+	}
+
+	tree, err := r.WriteTree(r.ObjectTree(idx.Files()))
+	if err != nil {
+		return nil, err
+	}
+	commit.Tree = tree
+	commit.Parents = []Sha{head, sha}
+	commit.Message = message
+	if result.Commit, err = r.writeCommit(commit, fmt.Sprintf("merge %s: Merge made by the 'ort' strategy.", opts.Name)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// MergeHeads returns the commits being merged while a merge is in progress
+func (r *Repository) MergeHeads() ([]Sha, error) {
+	b, err := os.ReadFile(r.MergeHeadPath())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var shas []Sha
+	for _, v := range bytes.Fields(b) {
+		sha, err := NewSha(v)
+		if err != nil {
+			return nil, fmt.Errorf("error: invalid MERGE_HEAD: %w", err)
+		}
+		shas = append(shas, sha)
+	}
+	return shas, nil
+}
+
+// MergeMessage returns the message prepared for the commit concluding a merge
+// in progress, or nil
+func (r *Repository) MergeMessage() ([]byte, error) {
+	b, err := os.ReadFile(r.MergeMsgPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// removeMergeState removes the files recording a merge in progress
+func (r *Repository) removeMergeState() error {
+	for _, v := range []string{r.MergeHeadPath(), r.MergeMsgPath(), filepath.Join(r.GitPath(), DefaultMergeModeFile)} {
+		if err := os.Remove(v); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// fastForward updates the working tree and index to sha and moves HEAD from
+// head to it
+func (r *Repository) fastForward(head Sha, sha Sha, opts MergeOptions) (*MergeResult, error) {
+	errFiles, err := r.checkoutCommit(sha)
+	if err != nil {
+		return nil, err
+	}
+	if len(errFiles) > 0 {
+		return nil, localChangesError(errFiles)
+	}
+	if head.IsSet() {
+		if err := r.writeOrigHead(head); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.moveHead(sha, head, fmt.Sprintf("merge %s: Fast-forward", opts.Name)); err != nil {
+		return nil, err
+	}
+	return &MergeResult{FastForward: true, Commit: sha}, nil
+}
+
+func (r *Repository) writeOrigHead(head Sha) error {
+	return writeFileLocked(filepath.Join(r.GitPath(), DefaultOrigHeadFile), []byte(head.AsHexString()+"\n"))
+}
+
+func localChangesError(paths []string) error {
+	return fmt.Errorf("error: Your local changes to the following files would be overwritten by merge:\n\t%s\nPlease commit your changes or stash them before you merge.\nAborting", strings.Join(paths, "\n\t"))
+}
+
+// mergeBaseFiles returns the files of the merge base of a merge. Several
+// merge bases are merged, in turn, into a virtual merge base, using the merge
+// bases of those already merged and the next as their own merge base.
+func (r *Repository) mergeBaseFiles(bases []Sha, opts MergeOptions) (map[string]*fileInfo, error) {
+	if len(bases) == 0 {
+		return make(map[string]*fileInfo), nil
+	}
+	files, err := r.treeFiles(bases[0])
+	if err != nil {
+		return nil, err
+	}
+	labels := diff.MergeOptions{
+		Algorithm: opts.Algorithm,
+		Style:     opts.Style,
+		Ours:      "Temporary merge branch 1",
+		Base:      "merged common ancestors",
+		Theirs:    "Temporary merge branch 2",
+	}
+	merged := []Sha{bases[0]}
+	for _, next := range bases[1:] {
+		inner, err := r.mergeBases(merged, []Sha{next})
+		if err != nil {
+			return nil, err
+		}
+		base, err := r.mergeBaseFiles(inner, opts)
+		if err != nil {
+			return nil, err
+		}
+		theirs, err := r.treeFiles(next)
+		if err != nil {
+			return nil, err
+		}
+		entries, err := r.mergeFiles(base, files, theirs, labels, true)
+		if err != nil {
+			return nil, err
+		}
+		files = make(map[string]*fileInfo)
+		for _, v := range entries {
+			if v.result != nil {
+				files[v.path] = v.result
+			}
+		}
+		merged = append(merged, next)
+	}
+	return files, nil
+}
+
+// mergeFiles merges the files of ours and theirs with those of base, sorted by
+// path. When virtual is true the result is a virtual merge base, where a
+// conflict of content is kept with its conflict markers and any other
+// conflict takes the version of base.
+func (r *Repository) mergeFiles(base map[string]*fileInfo, ours map[string]*fileInfo, theirs map[string]*fileInfo, labels diff.MergeOptions, virtual bool) ([]*mergedFile, error) {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, side := range []map[string]*fileInfo{base, ours, theirs} {
+		for path := range side {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	var merged []*mergedFile
+	for _, path := range paths {
+		m := &mergedFile{path: path, base: base[path], ours: ours[path], theirs: theirs[path]}
+		switch {
+		case sameFile(m.ours, m.theirs), sameFile(m.base, m.theirs):
+			m.result = m.ours
+		case sameFile(m.base, m.ours):
+			m.result = m.theirs
+		default:
+			if err := r.mergeFile(m, labels, virtual); err != nil {
+				return nil, err
+			}
+		}
+		merged = append(merged, m)
+	}
+	return merged, nil
+}
+
+// mergeFile merges a path changed differently by ours and theirs, merging the
+// lines of regular files. Binary files are not merged, leaving ours in the
+// working tree, or taking the base for a virtual merge base, as git does.
+func (r *Repository) mergeFile(m *mergedFile, labels diff.MergeOptions, virtual bool) error {
+	o, a, b := m.base, m.ours, m.theirs
+	switch {
+	case a != nil && b != nil && a.Mode.fileType() == ModeRegular && b.Mode.fileType() == ModeRegular &&
+		(o == nil || o.Mode.fileType() == ModeRegular):
+		var content [3][]byte
+		for i, v := range []*fileInfo{o, a, b} {
+			if v == nil {
+				continue
+			}
+			var err error
+			if content[i], err = r.readBlob(v.Sha); err != nil {
+				return err
+			}
+		}
+		if diff.IsBinary(content[0]) || diff.IsBinary(content[1]) || diff.IsBinary(content[2]) {
+			if virtual {
+				m.result = o
+				return nil
+			}
+			m.conflict = true
+			m.message = fmt.Sprintf("warning: Cannot merge binary files: %s (%s vs. %s)\nAuto-merging %s\nCONFLICT (content): Merge conflict in %s", m.path, labels.Ours, labels.Theirs, m.path, m.path)
+			return nil
+		}
+		merged, conflicts := diff.Merge(diff.SplitLines(content[0]), diff.SplitLines(content[1]), diff.SplitLines(content[2]), labels)
+		// the executable bit is merged as a change of its own
+		mode := a.Mode
+		if o != nil && a.Mode == o.Mode {
+			mode = b.Mode
+		}
+		m.message = "Auto-merging " + m.path
+		if conflicts == 0 || virtual {
+			sha, err := r.writeBlobContent(merged)
+			if err != nil {
+				return err
+			}
+			m.result = &fileInfo{Sha: sha, Mode: mode}
+			return nil
+		}
+		kind := "content"
+		if o == nil {
+			kind = "add/add"
+		}
+		m.conflict = true
+		m.content = merged
+		m.message += fmt.Sprintf("\nCONFLICT (%s): Merge conflict in %s", kind, m.path)
+	case virtual:
+		m.result = o
+	case a == nil || b == nil:
+		deleted, modified := labels.Theirs, labels.Ours
+		if a == nil {
+			deleted, modified = labels.Ours, labels.Theirs
+		}
+		m.conflict = true
+		m.message = fmt.Sprintf("CONFLICT (modify/delete): %s deleted in %s and modified in %s.  Version %s of %s left in tree.", m.path, deleted, modified, modified, m.path)
+	default:
+		m.conflict = true
+		m.message = "CONFLICT (content): Merge conflict in " + m.path
+	}
+	return nil
+}
+
+// changesOurs reports whether the merge changes the path from the version of
+// ours, which is what the working tree and index hold
+func (m *mergedFile) changesOurs() bool {
+	return m.conflict || !sameFile(m.result, m.ours)
+}
+
+// checkMerged returns an error when writing merged would overwrite changes in
+// the working tree, of the files in status, that are not in the index, or
+// untracked files
+func checkMerged(status *FfileSet, merged []*mergedFile) error {
+	var dirty, untracked []string
+	for _, m := range merged {
+		f, ok := status.Contains(m.path)
+		if !ok || !m.changesOurs() {
+			continue
+		}
+		switch {
+		case f.index == nil && f.wd != nil:
+			untracked = append(untracked, m.path)
+		case f.index != nil && f.wdStatus != IndexAndWorkingTreeMatch:
+			dirty = append(dirty, m.path)
+		}
+	}
+	if len(dirty) > 0 {
+		return localChangesError(dirty)
+	}
+	if len(untracked) > 0 {
+		return fmt.Errorf("error: The following untracked working tree files would be overwritten by merge:\n\t%s\nPlease move or remove them before you merge.\nAborting", strings.Join(untracked, "\n\t"))
+	}
+	return nil
+}
+
+// writeMerged writes the files merged to the working tree and to idx, where
+// a conflict is written as its stages, returning the messages and conflicts
+// of the merge. A call to idx.Write is required to persist the index.
+func (r *Repository) writeMerged(idx *Index, merged []*mergedFile) (*MergeResult, error) {
+	result := &MergeResult{}
+	for _, m := range merged {
+		if m.message != "" {
+			result.Messages = append(result.Messages, m.message)
+		}
+		if !m.changesOurs() {
+			continue
+		}
+		if m.ours != nil {
+			if err := idx.Rm(m.path); err != nil {
+				return nil, err
+			}
+		}
+		switch {
+		case m.conflict:
+			result.Conflicts = append(result.Conflicts, m.path)
+			for i, v := range []*fileInfo{m.base, m.ours, m.theirs} {
+				if v != nil {
+					idx.addStage(m.path, i+1, v)
+				}
+			}
+			if err := r.writeConflict(m); err != nil {
+				return nil, err
+			}
+		case m.result == nil:
+			if err := os.Remove(filepath.Join(r.Path(), m.path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+		default:
+			if err := r.writeObjectToWorkingTree(m.result.Sha, m.path, m.result.Mode); err != nil {
+				return nil, err
+			}
+			info, err := os.Lstat(filepath.Join(r.Path(), m.path))
+			if err != nil {
+				return nil, err
+			}
+			item, err := newItem(info, m.result.Sha, m.path)
+			if err != nil {
+				return nil, err
+			}
+			item.Mode = uint32(m.result.Mode)
+			idx.addItem(item)
+		}
+	}
+	return result, nil
+}
+
+// writeConflict writes a path in conflict to the working tree: the merged
+// content with conflict markers, or the version of theirs when ours has none
+func (r *Repository) writeConflict(m *mergedFile) error {
+	switch {
+	case m.content != nil:
+		path := filepath.Join(r.Path(), m.path)
+		perm := os.FileMode(0644)
+		if m.ours.Mode == ModeExecutable {
+			perm = 0755
+		}
+		if err := os.WriteFile(path, m.content, perm); err != nil {
+			return err
+		}
+		return os.Chmod(path, perm)
+	case m.ours == nil && m.theirs != nil:
+		return r.writeObjectToWorkingTree(m.theirs.Sha, m.path, m.theirs.Mode)
+	}
+	return nil
+}
+
+// sameFile reports whether a and b are the same version of a path, where nil
+// is a missing path
+func sameFile(a *fileInfo, b *fileInfo) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Sha.Matches(b.Sha) && a.Mode == b.Mode
+}
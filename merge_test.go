@@ -0,0 +1,262 @@
+package g
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	r, dir := newTestRepository(t)
+	commit := func(message string, paths ...string) Sha {
+		t.Helper()
+		assertAddFiles(t, r, paths)
+		return assertCreateCommit(t, r, newTestCommit(message))
+	}
+	switchBranch := func(name string) {
+		t.Helper()
+		errFiles, err := r.SwitchBranch(name)
+		e(err, t)
+		if len(errFiles) > 0 {
+			t.Fatalf("expected to switch to %s, got %v", name, errFiles)
+		}
+	}
+
+	writeTestFile(t, dir, "a", "1\n2\n3\n4\n5\n6\n7\n8\n9\n")
+	writeTestFile(t, dir, "b", "b\n")
+	base := commit("base", "a", "b")
+	e(r.CreateBranch("topic"), t)
+	writeTestFile(t, dir, "a", "1\nours\n3\n4\n5\n6\n7\n8\n9\n")
+	ours := commit("ours", "a")
+	switchBranch("topic")
+	writeTestFile(t, dir, "a", "1\n2\n3\n4\n5\n6\n7\ntheirs\n9\n")
+	writeTestFile(t, dir, "c", "c\n")
+	theirs := commit("theirs", "a", "c")
+
+	bases, err := r.MergeBase(ours, theirs)
+	e(err, t)
+	if !slices.Equal(bases, []Sha{base}) {
+		t.Errorf("expected merge base %s, got %v", base, bases)
+	}
+	for _, tt := range []struct {
+		a, b     Sha
+		expected bool
+	}{{base, ours, true}, {ours, ours, true}, {ours, base, false}, {ours, theirs, false}} {
+		actual, err := r.IsAncestor(tt.a, tt.b)
+		e(err, t)
+		if actual != tt.expected {
+			t.Errorf("expected IsAncestor(%s, %s) to be %t", tt.a, tt.b, tt.expected)
+		}
+	}
+
+	// a merge of diverged branches is committed with both as parents
+	switchBranch("main")
+	result, err := r.Merge(theirs, newTestCommit("Merge branch 'topic'"), MergeOptions{Name: "topic"})
+	e(err, t)
+	if len(result.Conflicts) > 0 || !result.Commit.IsSet() {
+		t.Fatalf("expected a merge commit, got %+v", result)
+	}
+	assertCurrentCommit(t, r, result.Commit)
+	assertLookupCommit(t, r, result.Commit, func(t *testing.T, c *Commit) {
+		if !slices.Equal(c.Parents, []Sha{ours, theirs}) {
+			t.Errorf("expected parents %s and %s, got %v", ours, theirs, c.Parents)
+		}
+	})
+	assertFileContent(t, dir, "a", "1\nours\n3\n4\n5\n6\n7\ntheirs\n9\n")
+	assertFileContent(t, dir, "c", "c\n")
+	merged := result.Commit
+
+	// merging an ancestor changes nothing
+	result, err = r.Merge(theirs, newTestCommit(""), MergeOptions{})
+	e(err, t)
+	if !result.UpToDate {
+		t.Errorf("expected already up to date, got %+v", result)
+	}
+
+	// the other branch is fast-forwarded to the merge
+	switchBranch("topic")
+	result, err = r.Merge(merged, newTestCommit(""), MergeOptions{Name: "main"})
+	e(err, t)
+	if !result.FastForward {
+		t.Errorf("expected a fast-forward, got %+v", result)
+	}
+	assertCurrentCommit(t, r, merged)
+	assertFileContent(t, dir, "a", "1\nours\n3\n4\n5\n6\n7\ntheirs\n9\n")
+
+	// changes to the same lines conflict
+	writeTestFile(t, dir, "a", "1\nours\n3\n4\ntheirs\n6\n7\ntheirs\n9\n")
+	theirs = commit("theirs", "a")
+	switchBranch("main")
+	writeTestFile(t, dir, "a", "1\nours\n3\n4\nours\n6\n7\ntheirs\n9\n")
+	ours = commit("ours", "a")
+	result, err = r.Merge(theirs, newTestCommit("Merge branch 'topic'"), MergeOptions{Name: "topic"})
+	e(err, t)
+	if !slices.Equal(result.Conflicts, []string{"a"}) || result.Commit.IsSet() {
+		t.Fatalf("expected a conflict in a, got %+v", result)
+	}
+	assertFileContent(t, dir, "a", "1\nours\n3\n4\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> topic\n6\n7\ntheirs\n9\n")
+	idx, err := r.ReadIndex()
+	e(err, t)
+	var stages []string
+	for _, v := range idx.items {
+		stages = append(stages, string(v.Name)+string(rune('0'+v.stage())))
+	}
+	if strings.Join(stages, " ") != "a1 a2 a3 b0 c0" {
+		t.Errorf("expected the stages of a, got %v", stages)
+	}
+	heads, err := r.MergeHeads()
+	e(err, t)
+	if !slices.Equal(heads, []Sha{theirs}) {
+		t.Errorf("expected MERGE_HEAD %s, got %v", theirs, heads)
+	}
+	if _, err := r.Merge(theirs, newTestCommit(""), MergeOptions{}); err == nil {
+		t.Error("expected a merge in progress to refuse another")
+	}
+	if _, err := r.CreateCommit(newTestCommit("unmerged")); err == nil {
+		t.Error("expected a commit with unmerged entries to be refused")
+	}
+
+	// the resolved merge is concluded by a commit
+	writeTestFile(t, dir, "a", "1\nours\n3\n4\nboth\n6\n7\ntheirs\n9\n")
+	sha := commit("resolved", "a")
+	assertLookupCommit(t, r, sha, func(t *testing.T, c *Commit) {
+		if !slices.Equal(c.Parents, []Sha{ours, theirs}) {
+			t.Errorf("expected parents %s and %s, got %v", ours, theirs, c.Parents)
+		}
+	})
+	if heads, err := r.MergeHeads(); err != nil || len(heads) > 0 {
+		t.Errorf("expected the merge to be concluded, got %v %v", heads, err)
+	}
+}
+
+func TestMergeBinary(t *testing.T) {
+	r, dir := newTestRepository(t)
+	writeTestFile(t, dir, "bin", "\x00\n1\n2\n3\n4\n5\n")
+	assertAddFiles(t, r, []string{"bin"})
+	assertCreateCommit(t, r, newTestCommit("base"))
+	e(r.CreateBranch("topic"), t)
+	writeTestFile(t, dir, "bin", "\x00\nours\n2\n3\n4\n5\n")
+	assertAddFiles(t, r, []string{"bin"})
+	assertCreateCommit(t, r, newTestCommit("ours"))
+	_, err := r.SwitchBranch("topic")
+	e(err, t)
+	writeTestFile(t, dir, "bin", "\x00\n1\n2\n3\n4\ntheirs\n")
+	assertAddFiles(t, r, []string{"bin"})
+	theirs := assertCreateCommit(t, r, newTestCommit("theirs"))
+	_, err = r.SwitchBranch("main")
+	e(err, t)
+
+	// changes that do not overlap line by line still conflict, leaving
+	// ours in the working tree
+	result, err := r.Merge(theirs, newTestCommit("Merge branch 'topic'"), MergeOptions{Name: "topic"})
+	e(err, t)
+	if !slices.Equal(result.Conflicts, []string{"bin"}) {
+		t.Fatalf("expected a conflict in bin, got %+v", result)
+	}
+	expected := "warning: Cannot merge binary files: bin (HEAD vs. topic)\nAuto-merging bin\nCONFLICT (content): Merge conflict in bin"
+	if !slices.Equal(result.Messages, []string{expected}) {
+		t.Errorf("expected messages %q, got %q", expected, result.Messages)
+	}
+	assertFileContent(t, dir, "bin", "\x00\nours\n2\n3\n4\n5\n")
+	idx, err := r.ReadIndex()
+	e(err, t)
+	var stages []string
+	for _, v := range idx.items {
+		stages = append(stages, string(v.Name)+string(rune('0'+v.stage())))
+	}
+	if strings.Join(stages, " ") != "bin1 bin2 bin3" {
+		t.Errorf("expected the stages of bin, got %v", stages)
+	}
+}
+
+func TestMergeBaseCrissCross(t *testing.T) {
+	r, dir := newTestRepository(t)
+	commit := func(path string) Sha {
+		t.Helper()
+		e(os.WriteFile(filepath.Join(dir, path), []byte(path+"\n"), 0644), t)
+		assertAddFiles(t, r, []string{path})
+		return assertCreateCommit(t, r, newTestCommit(path))
+	}
+	merge := func(sha Sha) Sha {
+		t.Helper()
+		result, err := r.Merge(sha, newTestCommit("merge"), MergeOptions{NoFastForward: true})
+		e(err, t)
+		return result.Commit
+	}
+	commit("base")
+	e(r.CreateBranch("topic"), t)
+	a := commit("a")
+	_, err := r.SwitchBranch("topic")
+	e(err, t)
+	b := commit("b")
+	x := merge(a)
+	_, err = r.SwitchBranch("main")
+	e(err, t)
+	y := merge(b)
+
+	// each merge has both a and b as ancestors, neither of which is the
+	// best
+	bases, err := r.MergeBase(x, y)
+	e(err, t)
+	slices.SortFunc(bases, func(i, j Sha) int {
+		return strings.Compare(i.AsHexString(), j.AsHexString())
+	})
+	expected := []Sha{a, b}
+	slices.SortFunc(expected, func(i, j Sha) int {
+		return strings.Compare(i.AsHexString(), j.AsHexString())
+	})
+	if !slices.Equal(bases, expected) {
+		t.Errorf("expected merge bases %v, got %v", expected, bases)
+	}
+
+	// the merge bases are merged into a virtual base
+	e(os.WriteFile(filepath.Join(dir, "a"), []byte("changed\n"), 0644), t)
+	assertAddFiles(t, r, []string{"a"})
+	assertCreateCommit(t, r, newTestCommit("changed"))
+	result, err := r.Merge(x, newTestCommit("merge"), MergeOptions{})
+	e(err, t)
+	if len(result.Conflicts) > 0 || !result.Commit.IsSet() {
+		t.Errorf("expected a merge commit, got %+v", result)
+	}
+	assertFileContent(t, dir, "a", "changed\n")
+}
+
+// newTestRepository returns a repository initialised in a temporary
+// directory, and the directory
+func newTestRepository(t *testing.T) (*Repository, string) {
+	t.Helper()
+	dir := t.TempDir()
+	r, err := Init(dir, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+	return r, dir
+}
+
+// writeTestFile writes content to path in dir, creating the directories of
+// path as needed
+func writeTestFile(t *testing.T, dir string, path string, content string) {
+	t.Helper()
+	e(os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0755), t)
+	e(os.WriteFile(filepath.Join(dir, path), []byte(content), 0644), t)
+}
+
+func newTestCommit(message string) *Commit {
+	return &Commit{
+		Author:        "tester <tester@test.com>",
+		AuthoredTime:  time.Now(),
+		Committer:     "tester <tester@test.com>",
+		CommittedTime: time.Now(),
+		Message:       []byte(message),
+	}
+}
+
+func assertFileContent(t *testing.T, dir string, path string, expected string) {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(dir, path))
+	e(err, t)
+	if string(b) != expected {
+		t.Errorf("expected %s to contain %q, got %q", path, expected, b)
+	}
+}
@@ -0,0 +1,95 @@
+package g
+
+import (
+	"sort"
+)
+
+// MergeBase returns the best common ancestors of commits a and b: the commits
+// reachable from both that are not an ancestor of another such commit. There
+// is more than one after criss-cross merges, and none when the histories are
+// unrelated. The most recently committed is first.
+func (r *Repository) MergeBase(a Sha, b Sha) ([]Sha, error) {
+	return r.mergeBases([]Sha{a}, []Sha{b})
+}
+
+// IsAncestor reports whether commit a is reachable from commit b, including
+// when they are the same commit
+func (r *Repository) IsAncestor(a Sha, b Sha) (bool, error) {
+	ancestors, err := r.ancestors([]Sha{b}, nil)
+	if err != nil {
+		return false, err
+	}
+	_, ok := ancestors[a]
+	return ok, nil
+}
+
+// mergeBases returns the best common ancestors of any of as and any of bs
+func (r *Repository) mergeBases(as []Sha, bs []Sha) ([]Sha, error) {
+	cache := make(map[Sha]*Commit)
+	fromA, err := r.ancestors(as, cache)
+	if err != nil {
+		return nil, err
+	}
+	fromB, err := r.ancestors(bs, cache)
+	if err != nil {
+		return nil, err
+	}
+	var common []*Commit
+	var parents []Sha
+	for sha, c := range fromB {
+		if _, ok := fromA[sha]; ok {
+			common = append(common, c)
+			parents = append(parents, c.Parents...)
+		}
+	}
+	// a common ancestor of another common ancestor is not one of the best
+	stale, err := r.ancestors(parents, cache)
+	if err != nil {
+		return nil, err
+	}
+	var best []*Commit
+	for _, c := range common {
+		if _, ok := stale[c.Sha]; !ok {
+			best = append(best, c)
+		}
+	}
+	sort.Slice(best, func(i, j int) bool {
+		if !best[i].CommittedTime.Equal(best[j].CommittedTime) {
+			return best[i].CommittedTime.After(best[j].CommittedTime)
+		}
+		return best[i].Sha.AsHexString() < best[j].Sha.AsHexString()
+	})
+	shas := make([]Sha, len(best))
+	for i, v := range best {
+		shas[i] = v.Sha
+	}
+	return shas, nil
+}
+
+// ancestors returns the commits reachable from starts, including starts,
+// reading each commit once across calls sharing cache
+func (r *Repository) ancestors(starts []Sha, cache map[Sha]*Commit) (map[Sha]*Commit, error) {
+	if cache == nil {
+		cache = make(map[Sha]*Commit)
+	}
+	seen := make(map[Sha]*Commit)
+	queue := append([]Sha(nil), starts...)
+	for len(queue) > 0 {
+		sha := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		if _, ok := seen[sha]; ok {
+			continue
+		}
+		c, ok := cache[sha]
+		if !ok {
+			var err error
+			if c, err = r.ReadCommit(sha); err != nil {
+				return nil, err
+			}
+			cache[sha] = c
+		}
+		seen[sha] = c
+		queue = append(queue, c.Parents...)
+	}
+	return seen, nil
+}
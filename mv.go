@@ -0,0 +1,71 @@
+package g
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Mv moves the file or directory src to dst, or inside dst when it is an
+// existing directory, both resolved by Pathspec, and renames the index
+// entries of the files moved, keeping their stat data. Unless force, an
+// existing destination is not overwritten.
+func (r *Repository) Mv(src string, dst string, force bool) error {
+	info, err := os.Lstat(filepath.Join(r.Path(), src))
+	if err != nil {
+		return fmt.Errorf("fatal: bad source, source=%s, destination=%s", src, dst)
+	}
+	if fi, err := os.Stat(filepath.Join(r.Path(), dst)); err == nil && fi.IsDir() {
+		dst = filepath.Join(dst, filepath.Base(src))
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return err
+	}
+	// the entries moved, a directory being moved with the files inside it
+	// unless it is a submodule
+	var items []*indexItem
+	for _, v := range idx.items {
+		if string(v.Name) == src || (info.IsDir() && strings.HasPrefix(string(v.Name), src+string(filepath.Separator))) {
+			items = append(items, v)
+		}
+	}
+	dir := info.IsDir() && (len(items) != 1 || string(items[0].Name) != src)
+	switch {
+	case dst == src || strings.HasPrefix(dst, src+string(filepath.Separator)):
+		return fmt.Errorf("fatal: can not move directory into itself, source=%s, destination=%s", src, dst)
+	case dir && len(items) == 0:
+		return fmt.Errorf("fatal: source directory is empty, source=%s, destination=%s", src, dst)
+	case len(items) == 0:
+		return fmt.Errorf("fatal: not under version control, source=%s, destination=%s", src, dst)
+	case !dir && items[0].stage() != 0:
+		return fmt.Errorf("fatal: conflicted, source=%s, destination=%s", src, dst)
+	}
+	target, err := os.Lstat(filepath.Join(r.Path(), dst))
+	if err == nil || idx.File(dst) != nil {
+		// only a file is overwritten, and only when forced
+		if !force || dir || (target != nil && target.IsDir()) {
+			return fmt.Errorf("fatal: destination exists, source=%s, destination=%s", src, dst)
+		}
+		if idx.File(dst) != nil {
+			if err := idx.Rm(dst); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Rename(filepath.Join(r.Path(), src), filepath.Join(r.Path(), dst)); err != nil {
+		var linkErr *os.LinkError
+		if errors.As(err, &linkErr) {
+			err = linkErr.Err
+		}
+		return fmt.Errorf("fatal: renaming '%s' failed: %w", src, err)
+	}
+	for _, v := range items {
+		name := dst + strings.TrimPrefix(string(v.Name), src)
+		v.Name = []byte(name)
+		v.Flags = v.Flags&^0xFFF | nameFlags(name)
+	}
+	return idx.Write()
+}
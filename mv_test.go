@@ -0,0 +1,66 @@
+package g
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestMv(t *testing.T) {
+	r, dir := newTestRepository(t)
+	writeTestFile(t, dir, "a", "a\n")
+	writeTestFile(t, dir, "b", "b\n")
+	writeTestFile(t, dir, "d/c", "c\n")
+	writeTestFile(t, dir, "u", "u\n")
+	assertAddFiles(t, r, []string{"a", "b", "d/c"})
+	assertCreateCommit(t, r, newTestCommit("first"))
+
+	for _, tt := range []struct {
+		src, dst string
+	}{
+		{"a", "b"},
+		{"u", "v"},
+		{"missing", "v"},
+		{"d", "d/e"},
+	} {
+		if err := r.Mv(tt.src, tt.dst, false); err == nil {
+			t.Errorf("expected mv %s %s to be refused", tt.src, tt.dst)
+		}
+	}
+
+	// the entry of a file moved keeps its stat data
+	idx, err := r.ReadIndex()
+	e(err, t)
+	before := *idx.File("a").index.Finfo.(*Finfo)
+	e(r.Mv("a", "d", false), t)
+	idx, err = r.ReadIndex()
+	e(err, t)
+	f := idx.File(filepath.Join("d", "a"))
+	if f == nil {
+		t.Fatal("expected d/a in the index")
+	}
+	if after := *f.index.Finfo.(*Finfo); after.MTimeS != before.MTimeS || after.MTimeN != before.MTimeN || after.Ino != before.Ino {
+		t.Errorf("expected the stat data of a to be kept, got %+v", after)
+	}
+	assertFileContent(t, dir, "d/a", "a\n")
+
+	// a directory is moved with the files inside it
+	e(r.Mv("d", "e", false), t)
+	var names [][]byte
+	idx, err = r.ReadIndex()
+	e(err, t)
+	for _, v := range idx.items {
+		names = append(names, v.Name)
+	}
+	if !bytes.Equal(bytes.Join(names, []byte(" ")), []byte("b e/a e/c")) {
+		t.Errorf("expected b e/a e/c in the index, got %s", bytes.Join(names, []byte(" ")))
+	}
+	assertStatus(t, r,
+		map[string]IndexStatus{"a": DeletedInIndex, "b": NotUpdated, "d/c": DeletedInIndex, "e/a": AddedInIndex, "e/c": AddedInIndex},
+		map[string]WDStatus{"b": IndexAndWorkingTreeMatch, "e/a": IndexAndWorkingTreeMatch, "e/c": IndexAndWorkingTreeMatch, "u": Untracked},
+	)
+
+	// a file is overwritten only when forced
+	e(r.Mv("e/a", "b", true), t)
+	assertFileContent(t, dir, "b", "a\n")
+}
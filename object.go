@@ -26,10 +26,13 @@ type (
 		Length       int
 		HeaderLength int
 		ReadCloser   func() (io.ReadCloser, error)
-		//mode    string
+		// Mode is the mode of the object as an entry of its tree
+		Mode FileMode
 	}
 	objectType int
-	Commit     struct {
+	// FileMode is the mode of a tree entry or index entry
+	FileMode uint32
+	Commit   struct {
 		Sha            Sha
 		Tree           Sha
 		Parents        []Sha
@@ -52,16 +55,70 @@ type (
 		Sha  []byte
 		Typ  objectType
 		Path string
+		Mode FileMode
 	}
 )
 
+const (
+	ModeTree       FileMode = 0040000
+	ModeRegular    FileMode = 0100644
+	ModeExecutable FileMode = 0100755
+	ModeSymlink    FileMode = 0120000
+	ModeGitlink    FileMode = 0160000
+)
+
 const (
 	ObjectTypeInvalid objectType = iota
 	ObjectTypeBlob
 	ObjectTypeTree
 	ObjectTypeCommit
+	ObjectTypeTag
 )
 
+func (t objectType) String() string {
+	switch t {
+	case ObjectTypeBlob:
+		return "blob"
+	case ObjectTypeTree:
+		return "tree"
+	case ObjectTypeCommit:
+		return "commit"
+	case ObjectTypeTag:
+		return "tag"
+	default:
+		return "invalid"
+	}
+}
+
+// String returns the mode as it is written in a tree object, such as 100644
+func (m FileMode) String() string {
+	return strconv.FormatUint(uint64(m), 8)
+}
+
+// fileType returns the mode without the permission bits, so that a regular
+// file and an executable have the same type
+func (m FileMode) fileType() FileMode {
+	if m == ModeExecutable {
+		return ModeRegular
+	}
+	return m
+}
+
+// fileModeOf returns the mode recorded for a file in the working tree with
+// info from os.Lstat
+func fileModeOf(info os.FileInfo) FileMode {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		return ModeSymlink
+	case info.IsDir():
+		return ModeTree
+	case info.Mode()&0111 != 0:
+		return ModeExecutable
+	default:
+		return ModeRegular
+	}
+}
+
 func (c Commit) String() string {
 	var o string
 	o += fmt.Sprintf("commit: %s\n", c.Sha.AsHexString())
@@ -77,7 +134,7 @@ func (c Commit) String() string {
 
 // ObjectTree creates a Tree Object with child Objects representing the files and
 // paths in the provided files.
-func ObjectTree(files []*FileStatus) *Object {
+func (r *Repository) ObjectTree(files []*FileStatus) *Object {
 	root := &Object{
 		Typ: ObjectTypeTree,
 	}
@@ -86,15 +143,19 @@ func ObjectTree(files []*FileStatus) *Object {
 	// mp holds a cache of file paths to objectTree nodes
 	mp := make(map[string]*Object)
 	for _, v := range files {
-		parts := strings.Split(strings.TrimPrefix(v.path, WorkingDirectory()), string(filepath.Separator))
+		parts := strings.Split(strings.TrimPrefix(v.path, r.WorkingDirectory()), string(filepath.Separator))
+		leaf := &Object{Typ: ObjectTypeBlob, Path: v.path, Sha: v.index.Sha, Mode: v.index.Mode}
+		if v.index.Mode == ModeGitlink {
+			leaf.Typ = ObjectTypeCommit
+		}
 		if len(parts) == 1 {
-			root.Objects = append(root.Objects, &Object{Typ: ObjectTypeBlob, Path: v.path, Sha: v.index.Sha})
+			root.Objects = append(root.Objects, leaf)
 			continue // top level file
 		}
 		pn = root
 		for i, p := range parts {
 			if i == len(parts)-1 {
-				pn.Objects = append(pn.Objects, &Object{Typ: ObjectTypeBlob, Path: v.path, Sha: v.index.Sha})
+				pn.Objects = append(pn.Objects, leaf)
 				continue // leaf
 			}
 			// key for cached nodes
@@ -117,8 +178,8 @@ func ObjectTree(files []*FileStatus) *Object {
 // FlattenTree turns a TreeObject structure into a flat list of file paths
 func (o *Object) FlattenTree() []*FileStatus {
 	var objFiles []*FileStatus
-	if o.Typ == ObjectTypeBlob {
-		f := []*FileStatus{{path: o.Path, commit: &fileInfo{Sha: o.Sha}}}
+	if o.Typ == ObjectTypeBlob || o.Mode == ModeGitlink {
+		f := []*FileStatus{{path: o.Path, commit: &fileInfo{Sha: o.Sha, Mode: o.Mode}}}
 		return f
 	}
 	for _, v := range o.Objects {
@@ -132,25 +193,25 @@ func (o *Object) FlattenTree() []*FileStatus {
 	return objFiles
 }
 
-func objectPath(sha Sha) string {
-	return filepath.Join(ObjectPath(), sha.AsHexString()[0:2], sha.AsHexString()[2:])
+func (r *Repository) objectPath(sha Sha) string {
+	return filepath.Join(r.ObjectPath(), sha.AsHexString()[0:2], sha.AsHexString()[2:])
 }
 
-func ReadObject(sha Sha) (*Object, error) {
+func (r *Repository) ReadObject(sha Sha) (*Object, error) {
 	var err error
 	var o *Object
 
 	// check if a loose file or in a packfile
-	if _, err := os.Stat(objectPath(sha)); err != nil {
+	if _, err := os.Stat(r.objectPath(sha)); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return lookupInPackfiles(sha)
+			return r.lookupInPackfiles(sha)
 		} else {
 			return nil, err
 		}
 	}
 
 	o = &Object{Sha: sha}
-	o.ReadCloser = ObjectReadCloser(sha.AsHexBytes())
+	o.ReadCloser = r.ObjectReadCloser(sha.AsHexBytes())
 	z, err := o.ReadCloser()
 	if err != nil {
 		return o, err
@@ -171,6 +232,8 @@ func ReadObject(sha Sha) (*Object, error) {
 		o.Typ = ObjectTypeTree
 	case "blob":
 		o.Typ = ObjectTypeBlob
+	case "tag":
+		o.Typ = ObjectTypeTag
 	default:
 		return nil, fmt.Errorf("unknown %s", string(header[0]))
 	}
@@ -179,21 +242,52 @@ func ReadObject(sha Sha) (*Object, error) {
 	return o, err
 }
 
-func ObjectReadCloser(sha []byte) func() (io.ReadCloser, error) {
+func (r *Repository) ObjectReadCloser(sha []byte) func() (io.ReadCloser, error) {
 	return func() (io.ReadCloser, error) {
-		path := filepath.Join(ObjectPath(), string(sha[0:2]), string(sha[2:]))
+		path := filepath.Join(r.ObjectPath(), string(sha[0:2]), string(sha[2:]))
 		f, err := os.OpenFile(path, os.O_RDONLY, 0644)
 		if err != nil {
 			return nil, err
 		}
-		defer func() { _ = f.Close() }()
-		return zlib.NewReader(f)
+		z, err := zlib.NewReader(bufio.NewReader(f))
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		return &fileReadCloser{ReadCloser: z, f: f}, nil
+	}
+}
+
+// fileReadCloser closes the file it streams from when it is closed.
+type fileReadCloser struct {
+	io.ReadCloser
+	f *os.File
+}
+
+func (r *fileReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	if ferr := r.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// readObjectContent reads the content of an Object, discarding any header.
+func readObjectContent(obj *Object) ([]byte, error) {
+	r, err := obj.ReadCloser()
+	if err != nil {
+		return nil, err
 	}
+	defer func() { _ = r.Close() }()
+	if _, err := io.CopyN(io.Discard, r, int64(obj.HeaderLength)); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
 }
 
 // ReadObjectTree reads an object from the object store
-func ReadObjectTree(sha Sha) (*Object, error) {
-	obj, err := ReadObject(sha)
+func (r *Repository) ReadObjectTree(sha Sha) (*Object, error) {
+	obj, err := r.ReadObject(sha)
 	if err != nil {
 		return nil, err
 	}
@@ -206,7 +300,7 @@ func ReadObjectTree(sha Sha) (*Object, error) {
 		if err != nil {
 			return obj, err
 		}
-		co, err := ReadObjectTree(commit.Tree)
+		co, err := r.ReadObjectTree(commit.Tree)
 		if err != nil {
 			return nil, err
 		}
@@ -222,18 +316,24 @@ func ReadObjectTree(sha Sha) (*Object, error) {
 			if err != nil {
 				return obj, err
 			}
-			o, err := ReadObjectTree(sha)
+			if v.Mode == ModeGitlink {
+				// the commit of a submodule is not in this repository
+				obj.Objects = append(obj.Objects, &Object{Typ: ObjectTypeCommit, Sha: sha, Path: v.Path, Mode: v.Mode})
+				continue
+			}
+			o, err := r.ReadObjectTree(sha)
 			if err != nil {
 				return nil, err
 			}
 			o.Path = v.Path
+			o.Mode = v.Mode
 			if o.Typ != v.Typ {
 				return nil, errors.New("types did not match somehow")
 			}
 			obj.Objects = append(obj.Objects, o)
 		}
 		return obj, nil
-	case ObjectTypeBlob:
+	case ObjectTypeBlob, ObjectTypeTag:
 		// lets not read the whole blob
 		return obj, nil
 	default:
@@ -278,12 +378,20 @@ func ReadTree(obj *Object) (*Tree, error) {
 		_, err = io.ReadFull(buf, sha)
 		item := bytes.Fields(p)
 		itm.Sha = []byte(hex.EncodeToString(sha))
-		if string(item[0]) == "40000" {
+		mode, perr := strconv.ParseUint(string(item[0]), 8, 32)
+		if perr != nil {
+			return nil, fmt.Errorf("fatal: invalid mode in tree %s: %s", obj.Sha, item[0])
+		}
+		itm.Mode = FileMode(mode)
+		switch itm.Mode {
+		case ModeTree:
 			itm.Typ = ObjectTypeTree
 			if err != nil {
 				return nil, err
 			}
-		} else {
+		case ModeGitlink:
+			itm.Typ = ObjectTypeCommit
+		default:
 			itm.Typ = ObjectTypeBlob
 		}
 		itm.Path = string(item[1][:len(item[1])-1])
@@ -307,11 +415,14 @@ func ReadHeadBytes(r io.ReadCloser, obj *Object) error {
 	return nil
 }
 
-func ReadCommit(sha Sha) (*Commit, error) {
-	o, err := ReadObject(sha)
+func (r *Repository) ReadCommit(sha Sha) (*Commit, error) {
+	o, err := r.ReadObject(sha)
 	if err != nil {
 		return nil, err
 	}
+	if o == nil {
+		return nil, fmt.Errorf("fatal: bad object %s", sha)
+	}
 	return readCommit(o)
 }
 
@@ -439,21 +550,25 @@ func readCommitter(b []byte, c *Commit) error {
 	return nil
 }
 
-func CommittedFilesForBranchHead(name string) (*FfileSet, error) {
+func (r *Repository) CommittedFilesForBranchHead(name string) (*FfileSet, error) {
 	// get all files in new commit
-	commitSha, err := HeadSHA(name)
+	commitSha, err := r.HeadSHA(name)
 	if err != nil {
 		return nil, err
 	}
-	fs, err := CommittedFiles(commitSha)
+	return r.CommittedFilesForCommit(commitSha)
+}
+
+func (r *Repository) CommittedFilesForCommit(commitSha Sha) (*FfileSet, error) {
+	fs, err := r.CommittedFiles(commitSha)
 	if err != nil {
 		return nil, err
 	}
 	return NewFfileSet(fs, nil, nil)
 }
 
-func CommittedFiles(sha Sha) ([]*FileStatus, error) {
-	obj, err := ReadObjectTree(sha)
+func (r *Repository) CommittedFiles(sha Sha) ([]*FileStatus, error) {
+	obj, err := r.ReadObjectTree(sha)
 	if err != nil {
 		return nil, err
 	}
@@ -461,13 +576,13 @@ func CommittedFiles(sha Sha) ([]*FileStatus, error) {
 }
 
 // WriteTree writes an Object Tree to the object store.
-func (o *Object) WriteTree() (Sha, error) {
+func (r *Repository) WriteTree(o *Object) (Sha, error) {
 	// resolve child tree Objects
 	for i, v := range o.Objects {
 		if v.Typ == ObjectTypeTree {
 			// if the tree only has blobs, write them and then
 			// add the corresponding tree returning the Sha
-			sha, err := v.WriteTree()
+			sha, err := r.WriteTree(v)
 			if err != nil {
 				return Sha{}, err
 			}
@@ -475,24 +590,41 @@ func (o *Object) WriteTree() (Sha, error) {
 		}
 	}
 	// write a tree obj with the resolved children
-	return o.writeTree()
+	return r.writeTree(o)
 }
 
-func (o *Object) writeTree() (Sha, error) {
+func (r *Repository) writeTree(o *Object) (Sha, error) {
 	var content []byte
-	var mode string
 	for _, fo := range o.Objects {
-		// @todo add executable support
+		mode := fo.Mode
 		if fo.Typ == ObjectTypeTree {
-			mode = "40000"
-		} else {
-			mode = "100644"
+			mode = ModeTree
+		} else if mode == 0 {
+			mode = ModeRegular
 		}
 		// @todo replace base..
 		content = append(content, []byte(fmt.Sprintf("%s %s%s%s", mode, filepath.Base(fo.Path), string(byte(0)), fo.Sha.AsByteSlice()))...)
 	}
 	header := []byte(fmt.Sprintf("tree %d%s", len(content), string(byte(0))))
-	return WriteObject(header, content, "", ObjectPath())
+	return WriteObject(header, content, "", r.ObjectPath())
+}
+
+// writeBlobContent writes content to the object store as a blob
+func (r *Repository) writeBlobContent(content []byte) (Sha, error) {
+	header := []byte(fmt.Sprintf("blob %d%s", len(content), string(byte(0))))
+	return WriteObject(header, content, "", r.ObjectPath())
+}
+
+// readBlob returns the content of the blob sha
+func (r *Repository) readBlob(sha Sha) ([]byte, error) {
+	obj, err := r.ReadObject(sha)
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("fatal: unable to read %s", sha)
+	}
+	return readObjectContent(obj)
 }
 
 // WriteObject writes an object to the object store
@@ -548,19 +680,90 @@ func WriteObject(header []byte, content []byte, contentFile string, path string)
 }
 
 // WriteBlob writes a file to the object store as a blob and returns
-// a Blob Object representation.
-func WriteBlob(path string) (*Object, error) {
-	path = filepath.Join(Path(), path)
-	finfo, err := os.Stat(path)
+// a Blob Object representation. A symlink is stored as its target.
+func (r *Repository) WriteBlob(path string) (*Object, error) {
+	path = filepath.Join(r.Path(), path)
+	finfo, err := os.Lstat(path)
 	if err != nil {
 		return nil, err
 	}
+	mode := fileModeOf(finfo)
+	if mode == ModeSymlink {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, err
+		}
+		header := []byte(fmt.Sprintf("blob %d%s", len(target), string(byte(0))))
+		sha, err := WriteObject(header, []byte(target), "", r.ObjectPath())
+		return &Object{Sha: sha, Path: path, Typ: ObjectTypeBlob, Mode: mode}, err
+	}
 	header := []byte(fmt.Sprintf("blob %d%s", finfo.Size(), string(byte(0))))
-	sha, err := WriteObject(header, nil, path, ObjectPath())
-	return &Object{Sha: sha, Path: path, Typ: ObjectTypeBlob}, err
+	sha, err := WriteObject(header, nil, path, r.ObjectPath())
+	return &Object{Sha: sha, Path: path, Typ: ObjectTypeBlob, Mode: mode}, err
 }
 
-func writeCommit(c *Commit) (Sha, error) {
+// HashBlob returns the Sha of the working tree file at path as a blob without
+// writing it to the object store
+func (r *Repository) HashBlob(path string) (Sha, error) {
+	path = filepath.Join(r.Path(), path)
+	if finfo, err := os.Lstat(path); err == nil && fileModeOf(finfo) == ModeSymlink {
+		target, err := os.Readlink(path)
+		if err != nil {
+			return Sha{}, err
+		}
+		h := sha1.New()
+		_, _ = fmt.Fprintf(h, "blob %d%s%s", len(target), string(byte(0)), target)
+		return NewSha(h.Sum(nil))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return Sha{}, err
+	}
+	defer func() { _ = f.Close() }()
+	finfo, err := f.Stat()
+	if err != nil {
+		return Sha{}, err
+	}
+	h := sha1.New()
+	if _, err := fmt.Fprintf(h, "blob %d%s", finfo.Size(), string(byte(0))); err != nil {
+		return Sha{}, err
+	}
+	if _, err := io.Copy(h, f); err != nil {
+		return Sha{}, err
+	}
+	return NewSha(h.Sum(nil))
+}
+
+// writeCommit writes c to the object store and moves HEAD, or the branch it
+// refers to, to it, recording reflog in the reflog. When reflog is empty the
+// subject of the commit is recorded as git commit does.
+func (r *Repository) writeCommit(c *Commit, reflog string) (Sha, error) {
+	sha, err := r.writeCommitObject(c)
+	if err != nil {
+		return Sha{}, err
+	}
+	if reflog == "" {
+		switch len(c.Parents) {
+		case 0:
+			reflog = "commit (initial): "
+		case 1:
+			reflog = "commit: "
+		default:
+			reflog = "commit (merge): "
+		}
+		subject, _, _ := bytes.Cut(bytes.TrimSpace(c.Message), []byte("\n"))
+		reflog += string(subject)
+	}
+	// the commit only moves the ref if it still points to the first parent
+	var parent Sha
+	if len(c.Parents) > 0 {
+		parent = c.Parents[0]
+	}
+	return sha, r.moveHead(sha, parent, reflog)
+}
+
+// writeCommitObject writes c to the object store without moving any ref
+func (r *Repository) writeCommitObject(c *Commit) (Sha, error) {
 	var parentCommits string
 	for _, v := range c.Parents {
 		parentCommits += fmt.Sprintf("parent %s\n", v)
@@ -576,44 +779,85 @@ func writeCommit(c *Commit) (Sha, error) {
 		c.Message,
 	))
 	header := []byte(fmt.Sprintf("commit %d%s", len(content), string(byte(0))))
-	sha, err := WriteObject(header, content, "", ObjectPath())
+	return WriteObject(header, content, "", r.ObjectPath())
+}
+
+// moveHead points HEAD, or the branch it refers to, at sha, recording message
+// in the reflog. When old is set the ref is only moved if it points to old,
+// otherwise it must not exist.
+func (r *Repository) moveHead(sha Sha, old Sha, message string) error {
+	branch, err := r.CurrentBranch()
 	if err != nil {
-		return Sha{}, err
+		return err
 	}
-	branch, err := CurrentBranch()
-	if err != nil {
-		return Sha{}, err
+	ref := DefaultHeadFile
+	if branch != "" {
+		ref = filepath.Join(DefaultRefsDirectory, DefaultRefsHeadsDirectory, branch)
+	}
+	tx := r.NewRefTransaction()
+	if old.IsSet() {
+		tx.Update(ref, sha, old, message)
+	} else {
+		tx.Create(ref, sha, message)
 	}
-	return sha, UpdateBranchHead(branch, sha)
+	return tx.Commit()
 }
 
-func writeObjectToWorkingTree(sha Sha, path string) error {
-	obj, err := ReadObject(sha)
+// writeObjectToWorkingTree writes the blob sha to path in the working tree
+// as a file with mode, or as a symlink to the content of the blob. A
+// submodule is written as an empty directory.
+func (r *Repository) writeObjectToWorkingTree(sha Sha, path string, mode FileMode) error {
+	path = filepath.Join(r.Path(), path)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if mode == ModeGitlink {
+		return os.MkdirAll(path, 0755)
+	}
+	// replace rather than write through a symlink, or a file of another type
+	if info, err := os.Lstat(path); err == nil && fileModeOf(info).fileType() != mode.fileType() {
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	obj, err := r.ReadObject(sha)
 	if err != nil {
 		return err
 	}
-	r, err := obj.ReadCloser()
+	rc, err := obj.ReadCloser()
 	if err != nil {
 		return err
 	}
+	defer func() { _ = rc.Close() }()
 	buf := make([]byte, obj.HeaderLength)
-	if _, err := r.Read(buf); err != nil {
+	if _, err := rc.Read(buf); err != nil {
 		return err
 	}
-	f, err := os.OpenFile(filepath.Join(Path(), path), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0655)
-	if err != nil {
-		return err
+	if mode == ModeSymlink {
+		target, err := io.ReadAll(rc)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return os.Symlink(string(target), path)
 	}
-
-	if _, err := io.Copy(f, r); err != nil {
+	perm := os.FileMode(0644)
+	if mode == ModeExecutable {
+		perm = 0755
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
 		return err
 	}
-	if err := r.Close(); err != nil {
+	if _, err := io.Copy(f, rc); err != nil {
+		_ = f.Close()
 		return err
 	}
 	if err := f.Close(); err != nil {
 		return err
 	}
-
-	return nil
+	// the permissions of an existing file are not changed by OpenFile
+	return os.Chmod(path, perm)
 }
@@ -0,0 +1,238 @@
+package g
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const packedRefsHeader = "# pack-refs with: peeled fully-peeled sorted \n"
+
+type (
+	// packedRef is a ref stored in the packed-refs file. Peeled is the
+	// object an annotated tag ultimately points to.
+	packedRef struct {
+		Sha    Sha
+		Peeled Sha
+	}
+)
+
+// readPackedRefs reads the packed-refs file into a map keyed by full ref
+// name. A missing packed-refs file has no refs.
+func (r *Repository) readPackedRefs() (map[string]packedRef, error) {
+	refs := make(map[string]packedRef)
+	fh, err := os.Open(r.PackedRefsFile())
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return refs, nil
+		}
+		return nil, err
+	}
+	defer func() { _ = fh.Close() }()
+	var last string
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := bytes.TrimRight(scanner.Bytes(), "\r")
+		switch {
+		case len(line) == 0, line[0] == '#':
+			continue
+		case line[0] == '^':
+			// the peeled value of the preceding annotated tag
+			ref, ok := refs[last]
+			if !ok || len(line) != 41 {
+				return nil, fmt.Errorf("fatal: unexpected line in %s: %s", r.PackedRefsFile(), line)
+			}
+			if ref.Peeled, err = NewSha(line[1:]); err != nil {
+				return nil, err
+			}
+			refs[last] = ref
+		default:
+			if len(line) < 42 || line[40] != ' ' {
+				return nil, fmt.Errorf("fatal: unexpected line in %s: %s", r.PackedRefsFile(), line)
+			}
+			sha, err := NewSha(line[0:40])
+			if err != nil {
+				return nil, err
+			}
+			last = string(line[41:])
+			refs[last] = packedRef{Sha: sha}
+		}
+	}
+	return refs, scanner.Err()
+}
+
+// writePackedRefs writes refs to the packed-refs file held by lock, sorted by
+// name with the peeled value of annotated tags.
+func writePackedRefs(lock *lockFile, refs map[string]packedRef) error {
+	names := make([]string, 0, len(refs))
+	for k := range refs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	w := bufio.NewWriter(lock)
+	if _, err := w.WriteString(packedRefsHeader); err != nil {
+		return err
+	}
+	for _, name := range names {
+		ref := refs[name]
+		if _, err := fmt.Fprintf(w, "%s %s\n", ref.Sha, name); err != nil {
+			return err
+		}
+		if ref.Peeled.IsSet() {
+			if _, err := fmt.Fprintf(w, "^%s\n", ref.Peeled); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
+
+// peelRef returns the object that sha ultimately refers to when it is an
+// annotated tag, otherwise an unset Sha.
+func (r *Repository) peelRef(sha Sha) (Sha, error) {
+	var peeled Sha
+	for {
+		obj, err := r.ReadObject(sha)
+		if err != nil {
+			return Sha{}, err
+		}
+		if obj == nil || obj.Typ != ObjectTypeTag {
+			return peeled, nil
+		}
+		tag, err := readTag(obj)
+		if err != nil {
+			return Sha{}, err
+		}
+		sha = tag.Object
+		peeled = sha
+	}
+}
+
+// listRefs returns the full names of the loose and packed refs that start
+// with prefix, such as refs/tags/, sorted alphabetically.
+func (r *Repository) listRefs(prefix string) ([]string, error) {
+	names := make(map[string]struct{})
+	packed, err := r.readPackedRefs()
+	if err != nil {
+		return nil, err
+	}
+	for k := range packed {
+		if strings.HasPrefix(k, prefix) {
+			names[k] = struct{}{}
+		}
+	}
+	loose, err := r.looseRefs(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range loose {
+		names[k] = struct{}{}
+	}
+	refs := make([]string, 0, len(names))
+	for k := range names {
+		refs = append(refs, k)
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// looseRefs returns the full names of the loose ref files under the
+// directory prefix, such as refs/tags/
+func (r *Repository) looseRefs(prefix string) ([]string, error) {
+	var refs []string
+	dir := filepath.Join(r.GitPath(), prefix)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, lockFileSuffix) {
+			return nil
+		}
+		if path == dir {
+			// prefix names a ref file rather than a directory of refs
+			return nil
+		}
+		rel, err := filepath.Rel(r.GitPath(), path)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, filepath.ToSlash(rel))
+		return nil
+	})
+	return refs, err
+}
+
+// PackRefs moves every loose ref under refs/ into the packed-refs file,
+// recording the peeled value of annotated tags, and removes the loose files.
+func (r *Repository) PackRefs() error {
+	packedLock, err := newLockFile(r.PackedRefsFile())
+	if err != nil {
+		return err
+	}
+	defer packedLock.Rollback()
+	packed, err := r.readPackedRefs()
+	if err != nil {
+		return err
+	}
+	loose, err := r.looseRefs(DefaultRefsDirectory + "/")
+	if err != nil {
+		return err
+	}
+	// hold the lock of each loose ref so that it can not be updated between
+	// being packed and being removed
+	var locks []*lockFile
+	defer func() {
+		for _, v := range locks {
+			v.Rollback()
+		}
+	}()
+	var packedNames []string
+	for _, name := range loose {
+		lock, err := newLockFile(filepath.Join(r.GitPath(), name))
+		if err != nil {
+			return err
+		}
+		locks = append(locks, lock)
+		sha, found, err := r.readRefValue(name)
+		if err != nil {
+			return err
+		}
+		if !found {
+			// symbolic refs are not packed
+			continue
+		}
+		peeled, err := r.peelRef(sha)
+		if err != nil {
+			return err
+		}
+		packed[name] = packedRef{Sha: sha, Peeled: peeled}
+		packedNames = append(packedNames, name)
+	}
+	if err := writePackedRefs(packedLock, packed); err != nil {
+		return err
+	}
+	if err := packedLock.Commit(); err != nil {
+		return err
+	}
+	for _, name := range packedNames {
+		if err := os.Remove(filepath.Join(r.GitPath(), name)); err != nil {
+			return err
+		}
+	}
+	for _, v := range locks {
+		v.Rollback()
+	}
+	for _, name := range packedNames {
+		removeEmptyRefDirectories(r.GitPath(), name)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package g
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadPackedRefs(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Init(dir, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+	content := "# pack-refs with: peeled fully-peeled sorted \n" +
+		"d25650d7e43226b49a2ccb27eb0ee6b76771fff3 refs/heads/main\n" +
+		"5a8ef5b3cb8632a84b4045989513d22317b99698 refs/remotes/origin/main\n" +
+		"3e73f902e27e1f9cc38c65b6e63068891d1d6fd4 refs/stash\n" +
+		"70b600a5f108fb552019fb396d9b6a1d51f04d4f refs/tags/v1\n" +
+		"^82ba613f9c084daceb7213e3ebd9e0e082174baa\n"
+	e(os.WriteFile(r.PackedRefsFile(), []byte(content), 0644), t)
+	refs, err := r.readPackedRefs()
+	e(err, t)
+	sha := func(s string) Sha {
+		v, err := ShaFromHexString(s)
+		e(err, t)
+		return v
+	}
+	expected := map[string]packedRef{
+		"refs/heads/main":          {Sha: sha("d25650d7e43226b49a2ccb27eb0ee6b76771fff3")},
+		"refs/remotes/origin/main": {Sha: sha("5a8ef5b3cb8632a84b4045989513d22317b99698")},
+		"refs/tags/v1":             {Sha: sha("70b600a5f108fb552019fb396d9b6a1d51f04d4f"), Peeled: sha("82ba613f9c084daceb7213e3ebd9e0e082174baa")},
+		"refs/stash":               {Sha: sha("3e73f902e27e1f9cc38c65b6e63068891d1d6fd4")},
+	}
+	if !reflect.DeepEqual(refs, expected) {
+		t.Errorf("refs = %v, want %v", refs, expected)
+	}
+
+	// writing the refs back gives the same file
+	lock, err := newLockFile(r.PackedRefsFile())
+	e(err, t)
+	e(writePackedRefs(lock, refs), t)
+	e(lock.Commit(), t)
+	b, err := os.ReadFile(r.PackedRefsFile())
+	e(err, t)
+	if string(b) != content {
+		t.Errorf("packed-refs = %q, want %q", b, content)
+	}
+
+	// every namespace resolves from packed-refs, loose refs take priority
+	for ref, want := range map[string]Sha{
+		"refs/remotes/origin/main": sha("5a8ef5b3cb8632a84b4045989513d22317b99698"),
+		"refs/tags/v1":             sha("70b600a5f108fb552019fb396d9b6a1d51f04d4f"),
+		"refs/stash":               sha("3e73f902e27e1f9cc38c65b6e63068891d1d6fd4"),
+	} {
+		v, found, err := r.resolveRef(ref)
+		e(err, t)
+		if !found || v != want {
+			t.Errorf("%s = %s, want %s", ref, v, want)
+		}
+	}
+	e(os.WriteFile(filepath.Join(r.RefsHeadsDirectory(), "main"), []byte("ff4b7dca3de76d0a44ccd73052be08c0d9f82677\n"), 0644), t)
+	head, err := r.HeadSHA("main")
+	e(err, t)
+	if head != sha("ff4b7dca3de76d0a44ccd73052be08c0d9f82677") {
+		t.Errorf("expected the loose ref to take priority, got %s", head)
+	}
+
+	e(os.WriteFile(r.PackedRefsFile(), []byte("^82ba613f9c084daceb7213e3ebd9e0e082174baa\n"), 0644), t)
+	if _, err := r.readPackedRefs(); err == nil {
+		t.Error("expected an error for a peel line without a ref")
+	}
+}
+
+func TestPackRefs(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Init(dir, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+	e(os.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644), t)
+	assertAddFiles(t, r, []string{"a"})
+	commitSha := assertCreateCommit(t, r, &Commit{
+		Author:        "tester <tester@test.com>",
+		AuthoredTime:  time.Now(),
+		Committer:     "tester <tester@test.com>",
+		CommittedTime: time.Now(),
+		Message:       []byte("first"),
+	})
+	e(r.CreateBranch("dev"), t)
+	e(r.CreateTag("light", commitSha, nil), t)
+	e(r.CreateTag("v1", commitSha, &Tag{
+		Tagger:      "tagger",
+		TaggerEmail: "tagger@test.com",
+		TaggedTime:  time.Now(),
+		Message:     []byte("version 1"),
+	}), t)
+	tagSha, err := r.TagSHA("v1")
+	e(err, t)
+
+	e(r.PackRefs(), t)
+	refs, err := r.readPackedRefs()
+	e(err, t)
+	expected := map[string]packedRef{
+		"refs/heads/dev":  {Sha: commitSha},
+		"refs/heads/main": {Sha: commitSha},
+		"refs/tags/light": {Sha: commitSha},
+		"refs/tags/v1":    {Sha: tagSha, Peeled: commitSha},
+	}
+	if !reflect.DeepEqual(refs, expected) {
+		t.Errorf("refs = %v, want %v", refs, expected)
+	}
+	for name := range expected {
+		if _, err := os.Stat(filepath.Join(r.GitPath(), name)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected loose ref %s to be removed", name)
+		}
+	}
+
+	// packed refs are listed and resolved
+	branches, err := r.ListBranches()
+	e(err, t)
+	if !reflect.DeepEqual(branches, []string{"dev", "main"}) {
+		t.Errorf("branches = %v", branches)
+	}
+	tags, err := r.ListTags()
+	e(err, t)
+	if !reflect.DeepEqual(tags, []string{"light", "v1"}) {
+		t.Errorf("tags = %v", tags)
+	}
+	peeled, err := r.ResolveRevision("v1^{}")
+	e(err, t)
+	if peeled != commitSha {
+		t.Errorf("v1^{} = %s, want %s", peeled, commitSha)
+	}
+
+	// deleting a packed ref removes it from packed-refs
+	e(r.DeleteTag("light"), t)
+	e(r.DeleteBranch("dev"), t)
+	refs, err = r.readPackedRefs()
+	e(err, t)
+	if _, ok := refs["refs/tags/light"]; ok {
+		t.Error("expected refs/tags/light to be removed from packed-refs")
+	}
+	if _, ok := refs["refs/heads/dev"]; ok {
+		t.Error("expected refs/heads/dev to be removed from packed-refs")
+	}
+	if _, err := r.TagSHA("light"); err == nil {
+		t.Error("expected deleted tag not to be found")
+	}
+
+	// a commit on a packed branch writes a loose ref that takes priority
+	second := assertCreateCommit(t, r, &Commit{
+		Author:        "tester <tester@test.com>",
+		AuthoredTime:  time.Now(),
+		Committer:     "tester <tester@test.com>",
+		CommittedTime: time.Now(),
+		Message:       []byte("second"),
+	})
+	assertCurrentCommit(t, r, second)
+}
@@ -1,13 +1,17 @@
 package g
 
 import (
+	"bufio"
+	"bytes"
 	"compress/zlib"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 type (
@@ -20,6 +24,7 @@ const (
 	ObjTree
 	ObjBlob
 	ObjTag
+	_ // 5 is reserved
 	ObjOfsDelta
 	ObjRefDelta
 )
@@ -32,32 +37,71 @@ var PackFileReadCloser = func(path string, offset int64) func() (io.ReadCloser,
 		if err != nil {
 			return nil, err
 		}
-		defer func() { _ = fh.Close() }()
-		_, err = fh.Seek(offset, io.SeekStart)
+		if _, err = fh.Seek(offset, io.SeekStart); err != nil {
+			_ = fh.Close()
+			return nil, err
+		}
+		z, err := zlib.NewReader(bufio.NewReader(fh))
 		if err != nil {
+			_ = fh.Close()
 			return nil, err
 		}
-		return zlib.NewReader(fh)
+		return &fileReadCloser{ReadCloser: z, f: fh}, nil
 	}
 }
 
-var PackFileReadCloserRefDelta = func(path string, offset int64) func() (io.ReadCloser, error) {
+// PackFileReadCloserRefDelta is a Factory that creates a ReadCloser for
+// reading Object content from a Pack File entry deltified against a base
+// object identified by Sha. offset is the position of the entry header.
+func (r *Repository) PackFileReadCloserRefDelta(path string, offset int64) func() (io.ReadCloser, error) {
 	return func() (io.ReadCloser, error) {
-		return nil, errors.New("not implemented")
+		entry, err := readPackEntryAt(path, offset)
+		if err != nil {
+			return nil, err
+		}
+		base, err := r.ReadObject(entry.baseSha)
+		if err != nil {
+			return nil, err
+		}
+		if base == nil {
+			return nil, fmt.Errorf("delta base %s not found", entry.baseSha)
+		}
+		content, err := readObjectContent(base)
+		if err != nil {
+			return nil, err
+		}
+		return newDeltaReader(content, PackFileReadCloser(path, entry.dataOffset))
 	}
 }
 
-var PackFileReadCloserOfsDelta = func(path string, offset int64) func() (io.ReadCloser, error) {
+// PackFileReadCloserOfsDelta is a Factory that creates a ReadCloser for
+// reading Object content from a Pack File entry deltified against a base
+// object earlier in the same Pack File. offset is the position of the entry
+// header.
+func (r *Repository) PackFileReadCloserOfsDelta(path string, offset int64) func() (io.ReadCloser, error) {
 	return func() (io.ReadCloser, error) {
-		return nil, errors.New("not implemented")
+		entry, err := readPackEntryAt(path, offset)
+		if err != nil {
+			return nil, err
+		}
+		_, _, baseReadCloser, err := r.resolvePackEntry(path, entry.baseOffset)
+		if err != nil {
+			return nil, err
+		}
+		content, err := readObjectContent(&Object{ReadCloser: baseReadCloser})
+		if err != nil {
+			return nil, err
+		}
+		return newDeltaReader(content, PackFileReadCloser(path, entry.dataOffset))
 	}
 }
 
-func lookupInPackfiles(sha Sha) (*Object, error) {
+// packfiles lists the names of the available pack files, without the pack-
+// prefix or extension.
+func (r *Repository) packfiles() ([]string, error) {
 	var packFiles []string
-	// find the available pack files
 	if err := filepath.Walk(
-		ObjectPackfileDirectory(),
+		r.ObjectPackfileDirectory(),
 		func(path string, info os.FileInfo, err error) error {
 			if info == nil {
 				return nil
@@ -74,19 +118,91 @@ func lookupInPackfiles(sha Sha) (*Object, error) {
 	); err != nil {
 		return nil, err
 	}
+	return packFiles, nil
+}
+
+func (r *Repository) lookupInPackfiles(sha Sha) (*Object, error) {
+	// find the available pack files
+	packFiles, err := r.packfiles()
+	if err != nil {
+		return nil, err
+	}
 	// check each pack file index for the sha
 	for _, v := range packFiles {
-		offset, found, err := findOffsetInIdx(sha, filepath.Join(ObjectPackfileDirectory(), fmt.Sprintf("pack-%s.idx", v)))
+		offset, found, err := findOffsetInIdx(sha, filepath.Join(r.ObjectPackfileDirectory(), fmt.Sprintf("pack-%s.idx", v)))
 		if err != nil {
 			return nil, err
 		}
 		if found {
-			return findObjectInPack(offset, filepath.Join(ObjectPackfileDirectory(), fmt.Sprintf("pack-%s.pack", v)), sha)
+			return r.findObjectInPack(offset, filepath.Join(r.ObjectPackfileDirectory(), fmt.Sprintf("pack-%s.pack", v)), sha)
 		}
 	}
 	return nil, nil
 }
 
+// findPrefixInPackfiles lists the Sha of every packed object whose hex
+// encoding starts with prefix. The prefix must be at least 2 characters.
+func (r *Repository) findPrefixInPackfiles(prefix string) ([]Sha, error) {
+	packFiles, err := r.packfiles()
+	if err != nil {
+		return nil, err
+	}
+	first, err := hex.DecodeString(prefix[:2])
+	if err != nil {
+		return nil, err
+	}
+	var shas []Sha
+	for _, v := range packFiles {
+		found, err := findPrefixInIdx(first[0], prefix, filepath.Join(r.ObjectPackfileDirectory(), fmt.Sprintf("pack-%s.idx", v)))
+		if err != nil {
+			return nil, err
+		}
+		shas = append(shas, found...)
+	}
+	return shas, nil
+}
+
+func findPrefixInIdx(first byte, prefix string, path string) ([]Sha, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = fh.Close() }()
+	if err := readIdxMagic(fh); err != nil {
+		return nil, err
+	}
+	if format, err := readIdxFormat(fh); err != nil || format != 2 {
+		if err != nil {
+			return nil, err
+		} else {
+			return nil, errors.New("invalid pack file idx format, expected 2")
+		}
+	}
+	fanout, err := readFanout(fh)
+	if err != nil {
+		return nil, err
+	}
+	var start uint32
+	if first > 0 {
+		start = fanout[first-1]
+	}
+	var shas []Sha
+	var hash [20]byte
+	for i := start; i < fanout[first]; i++ {
+		if _, err := fh.ReadAt(hash[:], int64(idxHeaderLength)+int64(i)*20); err != nil {
+			return nil, err
+		}
+		sha, err := NewSha(hash[:])
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(sha.AsHexString(), prefix) {
+			shas = append(shas, sha)
+		}
+	}
+	return shas, nil
+}
+
 func readIdxMagic(fh *os.File) error {
 	magic := make([]byte, 4)
 	if err := binary.Read(fh, binary.BigEndian, magic); err != nil {
@@ -135,42 +251,55 @@ func readFanout(fh *os.File) ([256]uint32, error) {
 	return fanout, err
 }
 
-func findObjectName(items uint32, fh *os.File, sha Sha) (uint32, bool, error) {
+// idxHeaderLength is the length of the magic bytes, version and fanout table
+// at the start of a version 2 pack file index
+const idxHeaderLength = 4 + 4 + (256 * 4)
+
+// findObjectName binary searches the sorted object names table of a version
+// 2 pack file index between positions start and end for sha.
+func findObjectName(start uint32, end uint32, fh *os.File, sha Sha) (uint32, bool, error) {
 	var hash [20]byte
-	// should be an efficiently implemented binary search,
-	// for now a blunt force string trauma
-	for i := uint32(0); i < items; i++ {
-		if err := binary.Read(fh, binary.BigEndian, &hash); err != nil {
-			return i, false, err
-		}
-		h, err := NewSha(hash[:])
-		if err != nil {
-			return i, false, err
+	for start < end {
+		mid := start + (end-start)/2
+		if _, err := fh.ReadAt(hash[:], int64(idxHeaderLength)+int64(mid)*20); err != nil {
+			return 0, false, err
 		}
-		if h.AsHexString() == sha.AsHexString() {
-			return i, true, nil
+		switch bytes.Compare(hash[:], sha.hash[:]) {
+		case 0:
+			return mid, true, nil
+		case -1:
+			start = mid + 1
+		default:
+			end = mid
 		}
 	}
 	return 0, false, nil
 }
 
-func readObjectOffset(size uint32, fh *os.File, i uint32) (uint32, error) {
-	// skip remaining sorted object names
+func readObjectOffset(size uint32, fh *os.File, i uint32) (int64, error) {
+	// skip sorted object names (*size)
 	// skip 4-byte CRC32 values (*size)
 	// skip to i offset in 4 byte offset values
-	// @todo if offset most significant bit is set, lookupInPackfiles in long offset table
-	if _, err := fh.Seek(int64(4+4+(256*4)+(20*size)+(4*size)+(4*i)), io.SeekStart); err != nil {
+	offsetsTable := int64(idxHeaderLength) + int64(size)*20 + int64(size)*4
+	var offset uint32
+	if err := binary.Read(io.NewSectionReader(fh, offsetsTable+int64(i)*4, 4), binary.BigEndian, &offset); err != nil {
 		return 0, err
 	}
-	var offset uint32
-	if err := binary.Read(fh, binary.BigEndian, &offset); err != nil {
+	if offset&0x80000000 == 0 {
+		return int64(offset), nil
+	}
+	// when the most significant bit is set, the remaining bits are the
+	// position of the offset in the 8-byte large offset table which follows
+	// the 4-byte offset values.
+	var large uint64
+	largeOffsetsTable := offsetsTable + int64(size)*4
+	if err := binary.Read(io.NewSectionReader(fh, largeOffsetsTable+int64(offset&0x7fffffff)*8, 8), binary.BigEndian, &large); err != nil {
 		return 0, err
 	}
-	// we now have the offset to lookupInPackfiles in the pack
-	return offset, nil
+	return int64(large), nil
 }
 
-func findOffsetInIdx(sha Sha, path string) (uint32, bool, error) {
+func findOffsetInIdx(sha Sha, path string) (int64, bool, error) {
 	fh, err := os.Open(path)
 	if err != nil {
 		return 0, false, err
@@ -193,7 +322,8 @@ func findOffsetInIdx(sha Sha, path string) (uint32, bool, error) {
 	if err != nil {
 		return 0, false, err
 	}
-	// lookupInPackfiles search bounds
+	// the fanout entry for the first byte of sha bounds the search to the
+	// names starting with that byte.
 	var startOffset uint32
 	if sha.hash[0] == 0 {
 		startOffset = 0
@@ -203,13 +333,7 @@ func findOffsetInIdx(sha Sha, path string) (uint32, bool, error) {
 	endOffset := fanout[sha.hash[0]]
 	size := fanout[255]
 
-	// to make the search more efficient, we can jump to the start
-	// address of this sha 1st byte bucket.
-	if _, err := fh.Seek(int64(startOffset*20), io.SeekCurrent); err != nil {
-		return 0, false, err
-	}
-
-	i, found, err := findObjectName(endOffset-startOffset, fh, sha)
+	i, found, err := findObjectName(startOffset, endOffset, fh, sha)
 	if err != nil {
 		return 0, false, err
 	}
@@ -217,11 +341,11 @@ func findOffsetInIdx(sha Sha, path string) (uint32, bool, error) {
 		return 0, false, nil
 	}
 
-	offset, err := readObjectOffset(size, fh, i+startOffset)
+	offset, err := readObjectOffset(size, fh, i)
 	return offset, found, err
 }
 
-func findObjectInPack(offset uint32, path string, sha Sha) (*Object, error) {
+func (r *Repository) findObjectInPack(offset int64, path string, sha Sha) (*Object, error) {
 	fh, err := os.Open(path)
 	if err != nil {
 		return nil, err
@@ -241,60 +365,144 @@ func findObjectInPack(offset uint32, path string, sha Sha) (*Object, error) {
 		}
 	}
 
-	var size uint32
-	if err := binary.Read(fh, binary.BigEndian, &size); err != nil {
-		return nil, err
-	}
-
-	if _, err := fh.Seek(int64(offset), io.SeekStart); err != nil {
-		return nil, err
-	}
-
-	typ, length, err := readPackTypeLength(fh)
+	typ, length, readCloser, err := r.resolvePackEntry(path, offset)
 	if err != nil {
 		return nil, err
 	}
 
 	obj := &Object{}
-	switch typ {
-	case ObjBlob, ObjOfsDelta, ObjRefDelta:
-		obj.Typ = ObjectTypeBlob
-	case ObjCommit, ObjTag:
-		obj.Typ = ObjectTypeCommit
-	case ObjTree:
-		obj.Typ = ObjectTypeTree
-	}
+	obj.Typ = typ
 	obj.Sha = sha
-	obj.Length = int(length)
+	obj.Length = length
 	// This HeaderLength was added before I knew about pack files,
 	// the purpose was to create a factory that allowed a reader to
 	// be initialized if required. The HeaderLength bytes are discarded
 	// before a ReadCloser implementation streams object content via zlib.
 	// For pack files this still makes sense but here we set it to 0 and
 	// include the seeking as part of the ReadCloser factory config.
-	p, err := fh.Seek(0, io.SeekCurrent)
+	obj.HeaderLength = 0
+	obj.ReadCloser = readCloser
+
+	return obj, nil
+}
+
+// packEntry describes the header of an object entry in a Pack File
+type packEntry struct {
+	typ        PackObjectType
+	length     uint64 // inflated length of the entry data
+	dataOffset int64  // offset of the zlib compressed entry data
+	baseOffset int64  // offset of the base entry for ObjOfsDelta
+	baseSha    Sha    // Sha of the base object for ObjRefDelta
+}
+
+func readPackEntryAt(path string, offset int64) (*packEntry, error) {
+	fh, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
-	obj.HeaderLength = 0
+	defer func() { _ = fh.Close() }()
+	if _, err := fh.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r := &countingReader{r: bufio.NewReader(fh)}
+	typ, length, err := readPackTypeLength(r)
+	if err != nil {
+		return nil, err
+	}
+	entry := &packEntry{typ: typ, length: length}
 	switch typ {
 	case ObjOfsDelta:
-		obj.ReadCloser = PackFileReadCloserOfsDelta(path, p)
+		// the base offset is encoded as a negative offset relative to the
+		// start of this entry, using a big endian base 128 encoding where
+		// each continuation adds one.
+		var c byte
+		if c, err = r.ReadByte(); err != nil {
+			return nil, err
+		}
+		rel := int64(c & 0b01111111)
+		for c&0b10000000 != 0 {
+			if c, err = r.ReadByte(); err != nil {
+				return nil, err
+			}
+			rel = ((rel + 1) << 7) | int64(c&0b01111111)
+		}
+		if rel <= 0 || rel > offset {
+			return nil, fmt.Errorf("invalid delta base offset %d at %d", rel, offset)
+		}
+		entry.baseOffset = offset - rel
+	case ObjRefDelta:
+		hash := make([]byte, 20)
+		if _, err := io.ReadFull(r, hash); err != nil {
+			return nil, err
+		}
+		if entry.baseSha, err = NewSha(hash); err != nil {
+			return nil, err
+		}
+	}
+	entry.dataOffset = offset + r.n
+	return entry, nil
+}
+
+// resolvePackEntry follows the delta chain of the entry at offset returning
+// the type and inflated length of the resolved Object along with a factory
+// for a ReadCloser that streams its content.
+func (r *Repository) resolvePackEntry(path string, offset int64) (objectType, int, func() (io.ReadCloser, error), error) {
+	entry, err := readPackEntryAt(path, offset)
+	if err != nil {
+		return ObjectTypeInvalid, 0, nil, err
+	}
+	switch entry.typ {
+	case ObjCommit, ObjTree, ObjBlob, ObjTag:
+		return entry.typ.objectType(), int(entry.length), PackFileReadCloser(path, entry.dataOffset), nil
+	case ObjOfsDelta:
+		typ, _, _, err := r.resolvePackEntry(path, entry.baseOffset)
+		if err != nil {
+			return ObjectTypeInvalid, 0, nil, err
+		}
+		length, err := readDeltaTargetLength(PackFileReadCloser(path, entry.dataOffset))
+		if err != nil {
+			return ObjectTypeInvalid, 0, nil, err
+		}
+		return typ, length, r.PackFileReadCloserOfsDelta(path, offset), nil
 	case ObjRefDelta:
-		obj.ReadCloser = PackFileReadCloserRefDelta(path, p)
+		base, err := r.ReadObject(entry.baseSha)
+		if err != nil {
+			return ObjectTypeInvalid, 0, nil, err
+		}
+		if base == nil {
+			return ObjectTypeInvalid, 0, nil, fmt.Errorf("delta base %s not found", entry.baseSha)
+		}
+		length, err := readDeltaTargetLength(PackFileReadCloser(path, entry.dataOffset))
+		if err != nil {
+			return ObjectTypeInvalid, 0, nil, err
+		}
+		return base.Typ, length, r.PackFileReadCloserRefDelta(path, offset), nil
 	default:
-		obj.ReadCloser = PackFileReadCloser(path, p)
+		return ObjectTypeInvalid, 0, nil, fmt.Errorf("invalid pack object type %d at %d", entry.typ, offset)
 	}
+}
 
-	return obj, nil
+func (t PackObjectType) objectType() objectType {
+	switch t {
+	case ObjCommit:
+		return ObjectTypeCommit
+	case ObjTree:
+		return ObjectTypeTree
+	case ObjBlob:
+		return ObjectTypeBlob
+	case ObjTag:
+		return ObjectTypeTag
+	default:
+		return ObjectTypeInvalid
+	}
 }
 
-func readPackTypeLength(fh *os.File) (PackObjectType, uint64, error) {
-	var v uint8
+func readPackTypeLength(r io.ByteReader) (PackObjectType, uint64, error) {
 	var t PackObjectType
 	var l uint64
-	for i := 0; i < 9; i++ {
-		if err := binary.Read(fh, binary.BigEndian, &v); err != nil {
+	for i := 0; i < 10; i++ {
+		v, err := r.ReadByte()
+		if err != nil {
 			return 0, 0, err
 		}
 		if i == 0 {
@@ -310,3 +518,24 @@ func readPackTypeLength(fh *os.File) (PackObjectType, uint64, error) {
 	}
 	return t, l, nil
 }
+
+// countingReader counts the bytes read through it so that the offset of
+// entry data following a variable length header can be determined.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
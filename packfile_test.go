@@ -1,21 +1,29 @@
 package g
 
 import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
 	"testing"
 )
 
 func TestPackfile_lookupInPackfiles(t *testing.T) {
-	if err := Configure(
-		WithPath("./test_assets/repo/test-pack-file"),
-		WithGitDirectory(".gitg"),
-	); err != nil {
+	r, err := Open("./test_assets/repo/test-pack-file", WithGitDirectory(".gitg"))
+	if err != nil {
 		t.Fatal(err)
 	}
 	sha, err := ShaFromHexString("d78ccc12bfbd1e6e0a53a9dd503cdec24f1866d6")
 	if err != nil {
 		t.Fatal(err)
 	}
-	obj, err := lookupInPackfiles(sha)
+	obj, err := r.lookupInPackfiles(sha)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -25,7 +33,7 @@ func TestPackfile_lookupInPackfiles(t *testing.T) {
 	if obj.Typ != ObjectTypeCommit {
 		t.Errorf("typ = %d, want %d", obj.Typ, ObjectTypeCommit)
 	}
-	files, err := CurrentStatus()
+	files, err := r.CurrentStatus()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -33,3 +41,259 @@ func TestPackfile_lookupInPackfiles(t *testing.T) {
 		t.Errorf("idxStatus = %d, want %d", files.Files()[0].idxStatus, NotUpdated)
 	}
 }
+
+func TestPackfile_deltas(t *testing.T) {
+	for _, repo := range []string{"test-delta-ofs", "test-delta-ref"} {
+		t.Run(repo, func(t *testing.T) {
+			r, err := Open("./test_assets/repo/"+repo, WithGitDirectory(".gitg"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			head, err := ShaFromHexString("d25650d7e43226b49a2ccb27eb0ee6b76771fff3")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// walk every commit, tree and blob checking that the resolved
+			// content hashes back to the Sha it was looked up by
+			seen := make(map[string]bool)
+			commits := 0
+			for sha := head; sha.IsSet(); {
+				commit, err := r.ReadCommit(sha)
+				if err != nil {
+					t.Fatal(err)
+				}
+				commits++
+				assertPackedObject(t, r, sha, ObjectTypeCommit, seen)
+				assertPackedTree(t, r, commit.Tree, seen)
+				sha = Sha{}
+				if len(commit.Parents) > 0 {
+					sha = commit.Parents[0]
+				}
+			}
+			if commits != 6 {
+				t.Errorf("commits = %d, want 6", commits)
+			}
+		})
+	}
+}
+
+func assertPackedTree(t *testing.T, r *Repository, sha Sha, seen map[string]bool) {
+	t.Helper()
+	obj := assertPackedObject(t, r, sha, ObjectTypeTree, seen)
+	tree, err := ReadTree(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range tree.Items {
+		s, err := NewSha(v.Sha)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertPackedObject(t, r, s, ObjectTypeBlob, seen)
+	}
+}
+
+func assertPackedObject(t *testing.T, r *Repository, sha Sha, typ objectType, seen map[string]bool) *Object {
+	t.Helper()
+	obj, err := r.ReadObject(sha)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj == nil {
+		t.Fatalf("object %s not found", sha)
+	}
+	if seen[sha.String()] {
+		return obj
+	}
+	seen[sha.String()] = true
+	if obj.Typ != typ {
+		t.Errorf("%s typ = %d, want %d", sha, obj.Typ, typ)
+	}
+	content, err := readObjectContent(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(content) != obj.Length {
+		t.Errorf("%s length = %d, want %d", sha, len(content), obj.Length)
+	}
+	h := sha1.New()
+	_, _ = fmt.Fprintf(h, "%s %d\x00", typ, len(content))
+	h.Write(content)
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != sha.String() {
+		t.Errorf("content of %s hashes to %s", sha, actual)
+	}
+	return obj
+}
+
+func TestPackfile_largeOffsets(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Init(dir, WithGitDirectory(DefaultGitDirectory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(r.ObjectPackfileDirectory(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	pack, err := os.Create(filepath.Join(r.ObjectPackfileDirectory(), "pack-test.pack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = pack.Close() }()
+	if _, err := pack.Write([]byte{'P', 'A', 'C', 'K', 0, 0, 0, 2, 0, 0, 0, 3}); err != nil {
+		t.Fatal(err)
+	}
+	// the pack is a sparse file with objects written either side of the 2GiB
+	// boundary of 4 byte offsets, and beyond 4GiB
+	contents := map[int64]string{
+		12:      "below",
+		3 << 30: "above 2GiB",
+		5 << 30: "above 4GiB",
+	}
+	offsets := make(map[string]int64)
+	for offset, content := range contents {
+		buf := bytes.NewBuffer(nil)
+		buf.WriteByte(byte(ObjBlob)<<4 | byte(len(content)&0b1111) | 0b10000000)
+		buf.WriteByte(byte(len(content) >> 4))
+		z := zlib.NewWriter(buf)
+		_, _ = z.Write([]byte(content))
+		_ = z.Close()
+		if _, err := pack.WriteAt(buf.Bytes(), offset); err != nil {
+			t.Fatal(err)
+		}
+		h := sha1.New()
+		_, _ = fmt.Fprintf(h, "blob %d\x00%s", len(content), content)
+		offsets[hex.EncodeToString(h.Sum(nil))] = offset
+	}
+	writeTestIdx(t, filepath.Join(r.ObjectPackfileDirectory(), "pack-test.idx"), offsets)
+
+	for name, offset := range offsets {
+		sha, err := ShaFromHexString(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, found, err := findOffsetInIdx(sha, filepath.Join(r.ObjectPackfileDirectory(), "pack-test.idx"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found || actual != offset {
+			t.Errorf("offset of %s = %d (found %v), want %d", name, actual, found, offset)
+		}
+		obj, err := r.ReadObject(sha)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := readObjectContent(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != contents[offset] {
+			t.Errorf("content = %q, want %q", content, contents[offset])
+		}
+	}
+	missing, _ := ShaFromHexString("ffffffffffffffffffffffffffffffffffffffff")
+	if _, found, err := findOffsetInIdx(missing, filepath.Join(r.ObjectPackfileDirectory(), "pack-test.idx")); err != nil || found {
+		t.Errorf("expected %s not to be found, err %v", missing, err)
+	}
+}
+
+func TestPackfile_writePackIndex(t *testing.T) {
+	offsets := map[string]int64{
+		"0123456789abcdef0123456789abcdef01234567": 12,
+		"0f00000000000000000000000000000000000000": 1 << 31,
+		"80d5f0b1a8f4bb6f2b3a4aa4e6bbd3b6ca1a9c0e": 0x7fffffff,
+		"ffffffffffffffffffffffffffffffffffffffff": 5 << 30,
+	}
+	var entries []packIndexEntry
+	for name, offset := range offsets {
+		sha, _ := ShaFromHexString(name)
+		entries = append(entries, packIndexEntry{name: sha, offset: offset})
+	}
+	packSum := bytes.Repeat([]byte{0xab}, 20)
+	actual := bytes.NewBuffer(nil)
+	if err := writePackIndex(actual, entries, packSum); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "pack-test.idx")
+	writeTestIdx(t, path, offsets)
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the index ends with the checksum of the pack and its own checksum
+	expected = append(expected, packSum...)
+	sum := sha1.Sum(expected)
+	expected = append(expected, sum[:]...)
+	if !bytes.Equal(actual.Bytes(), expected) {
+		t.Errorf("writePackIndex wrote\n%x\nwant\n%x", actual.Bytes(), expected)
+	}
+}
+
+func TestPackfile_computeDelta(t *testing.T) {
+	var base []byte
+	for i := 0; i < 5000; i++ {
+		base = append(base, fmt.Sprintf("line %d\n", i)...)
+	}
+	for name, target := range map[string][]byte{
+		"identical": base,
+		"empty":     {},
+		"prefix":    append([]byte("inserted at the start\n"), base...),
+		"suffix":    append(append([]byte{}, base...), "appended to the end\n"...),
+		"middle":    append(append(append([]byte{}, base[:20000]...), "replaced"...), base[20100:]...),
+		"unrelated": []byte("nothing in common with the base at all"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			delta := computeDelta(base, target)
+			r, err := newDeltaReader(base, func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(delta)), nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(actual, target) {
+				t.Errorf("applying delta produced %d bytes that do not match the %d byte target", len(actual), len(target))
+			}
+		})
+	}
+}
+
+// writeTestIdx writes a version 2 pack file index for the object names and
+// offsets provided, using the large offset table for offsets >= 2GiB.
+func writeTestIdx(t *testing.T, path string, offsets map[string]int64) {
+	t.Helper()
+	var names []string
+	for k := range offsets {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var fanout [256]uint32
+	for _, v := range names {
+		b, _ := hex.DecodeString(v[:2])
+		for i := int(b[0]); i < 256; i++ {
+			fanout[i]++
+		}
+	}
+	buf := bytes.NewBuffer([]byte{255, 't', 'O', 'c', 0, 0, 0, 2})
+	_ = binary.Write(buf, binary.BigEndian, fanout)
+	for _, v := range names {
+		b, _ := hex.DecodeString(v)
+		buf.Write(b)
+	}
+	buf.Write(make([]byte, 4*len(names))) // crc32
+	var large []uint64
+	for _, v := range names {
+		if offsets[v] < 0x80000000 {
+			_ = binary.Write(buf, binary.BigEndian, uint32(offsets[v]))
+			continue
+		}
+		_ = binary.Write(buf, binary.BigEndian, uint32(len(large))|0x80000000)
+		large = append(large, uint64(offsets[v]))
+	}
+	_ = binary.Write(buf, binary.BigEndian, large)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,276 @@
+package g
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	// packDeltaWindow is how many of the preceding similar objects are tried
+	// as a delta base for each object.
+	packDeltaWindow = 10
+	// packDeltaMaxDepth limits the length of delta chains so that reading an
+	// object does not have to resolve too many bases.
+	packDeltaMaxDepth = 50
+	// packDeltaMinLength is the smallest object that is worth deltifying.
+	packDeltaMinLength = 64
+)
+
+type (
+	// packWriterEntry is an Object being written to a Pack File
+	packWriterEntry struct {
+		sha     Sha
+		typ     objectType
+		content []byte
+		base    *packWriterEntry // delta base, when deltified
+		delta   []byte
+		depth   int
+		packIndexEntry
+	}
+	// packIndexEntry is an entry in a Pack File index
+	packIndexEntry struct {
+		name   Sha
+		crc    uint32
+		offset int64
+	}
+)
+
+// WritePack writes the Objects identified by shas to a new Pack File and
+// version 2 index in the pack directory and returns the pack name. When
+// deltas is true, blobs are stored as deltas of similar blobs where that
+// saves space.
+func (r *Repository) WritePack(shas []Sha, deltas bool) (string, error) {
+	var entries, blobs []*packWriterEntry
+	for _, sha := range shas {
+		obj, err := r.ReadObject(sha)
+		if err != nil {
+			return "", err
+		}
+		if obj == nil {
+			return "", fmt.Errorf("object %s not found", sha)
+		}
+		content, err := readObjectContent(obj)
+		if err != nil {
+			return "", err
+		}
+		entry := &packWriterEntry{sha: sha, typ: obj.Typ, content: content}
+		if obj.Typ == ObjectTypeBlob {
+			blobs = append(blobs, entry)
+		} else {
+			entries = append(entries, entry)
+		}
+	}
+	if deltas {
+		findPackDeltas(blobs)
+	}
+	// bases are always ordered before the deltas that refer to them
+	entries = append(entries, blobs...)
+
+	if err := os.MkdirAll(r.ObjectPackfileDirectory(), 0755); err != nil {
+		return "", err
+	}
+	pack, err := os.CreateTemp(r.ObjectPackfileDirectory(), "tmp_pack_")
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = os.Remove(pack.Name()) }()
+	packSum, err := writePackEntries(pack, entries)
+	if err != nil {
+		_ = pack.Close()
+		return "", err
+	}
+	if err := pack.Sync(); err != nil {
+		_ = pack.Close()
+		return "", err
+	}
+	if err := pack.Close(); err != nil {
+		return "", err
+	}
+
+	idx, err := os.CreateTemp(r.ObjectPackfileDirectory(), "tmp_idx_")
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = os.Remove(idx.Name()) }()
+	indexEntries := make([]packIndexEntry, len(entries))
+	for i, v := range entries {
+		indexEntries[i] = v.packIndexEntry
+	}
+	if err := writePackIndex(idx, indexEntries, packSum); err != nil {
+		_ = idx.Close()
+		return "", err
+	}
+	if err := idx.Sync(); err != nil {
+		_ = idx.Close()
+		return "", err
+	}
+	if err := idx.Close(); err != nil {
+		return "", err
+	}
+
+	// the pack is moved into place before the index so that the index is
+	// never found without its pack
+	name := fmt.Sprintf("pack-%x", packSum)
+	if err := os.Rename(pack.Name(), filepath.Join(r.ObjectPackfileDirectory(), name+".pack")); err != nil {
+		return "", err
+	}
+	if err := os.Rename(idx.Name(), filepath.Join(r.ObjectPackfileDirectory(), name+".idx")); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// findPackDeltas chooses delta bases for blobs. Blobs are ordered by
+// decreasing size and each is compared with the preceding blobs in the
+// window, keeping the smallest delta that is less than half the blob size.
+func findPackDeltas(blobs []*packWriterEntry) {
+	sort.SliceStable(blobs, func(i, j int) bool {
+		return len(blobs[i].content) > len(blobs[j].content)
+	})
+	for i, target := range blobs {
+		if len(target.content) < packDeltaMinLength {
+			continue
+		}
+		for _, base := range blobs[max(0, i-packDeltaWindow):i] {
+			if base.depth >= packDeltaMaxDepth || len(base.content) < packDeltaMinLength {
+				continue
+			}
+			delta := computeDelta(base.content, target.content)
+			if len(delta) >= len(target.content)/2 {
+				continue
+			}
+			if target.delta == nil || len(delta) < len(target.delta) {
+				target.base = base
+				target.delta = delta
+				target.depth = base.depth + 1
+			}
+		}
+	}
+}
+
+// writePackEntries writes a version 2 Pack File containing entries to w,
+// recording the offset and crc32 of each entry, and returns the pack checksum.
+func writePackEntries(w io.Writer, entries []*packWriterEntry) ([]byte, error) {
+	h := sha1.New()
+	mw := io.MultiWriter(w, h)
+	header := []byte{'P', 'A', 'C', 'K', 0, 0, 0, 2}
+	header = binary.BigEndian.AppendUint32(header, uint32(len(entries)))
+	if _, err := mw.Write(header); err != nil {
+		return nil, err
+	}
+	offset := int64(len(header))
+	for _, v := range entries {
+		buf := bytes.NewBuffer(nil)
+		content := v.content
+		if v.base != nil {
+			content = v.delta
+			buf.Write(appendPackTypeLength(nil, ObjOfsDelta, uint64(len(content))))
+			buf.Write(appendPackOfsDelta(nil, offset-v.base.offset))
+		} else {
+			buf.Write(appendPackTypeLength(nil, v.typ.packObjectType(), uint64(len(content))))
+		}
+		z := zlib.NewWriter(buf)
+		if _, err := z.Write(content); err != nil {
+			return nil, err
+		}
+		if err := z.Close(); err != nil {
+			return nil, err
+		}
+		v.name = v.sha
+		v.offset = offset
+		v.crc = crc32.ChecksumIEEE(buf.Bytes())
+		n, err := mw.Write(buf.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		offset += int64(n)
+	}
+	sum := h.Sum(nil)
+	_, err := w.Write(sum)
+	return sum, err
+}
+
+// writePackIndex writes a version 2 Pack File index for entries to w.
+// Offsets that do not fit in 31 bits are written to the large offset table.
+func writePackIndex(w io.Writer, entries []packIndexEntry, packSum []byte) error {
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].name.hash[:], entries[j].name.hash[:]) < 0
+	})
+	h := sha1.New()
+	mw := io.MultiWriter(w, h)
+	var fanout [256]uint32
+	for _, v := range entries {
+		for i := int(v.name.hash[0]); i < 256; i++ {
+			fanout[i]++
+		}
+	}
+	buf := bytes.NewBuffer([]byte{255, 't', 'O', 'c', 0, 0, 0, 2})
+	for _, v := range fanout {
+		buf.Write(binary.BigEndian.AppendUint32(nil, v))
+	}
+	for _, v := range entries {
+		buf.Write(v.name.hash[:])
+	}
+	for _, v := range entries {
+		buf.Write(binary.BigEndian.AppendUint32(nil, v.crc))
+	}
+	var large []byte
+	for _, v := range entries {
+		if v.offset < 0x80000000 {
+			buf.Write(binary.BigEndian.AppendUint32(nil, uint32(v.offset)))
+			continue
+		}
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(len(large)/8)|0x80000000))
+		large = binary.BigEndian.AppendUint64(large, uint64(v.offset))
+	}
+	buf.Write(large)
+	buf.Write(packSum)
+	if _, err := mw.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(h.Sum(nil))
+	return err
+}
+
+// appendPackTypeLength appends the type and length header of a Pack File entry
+func appendPackTypeLength(b []byte, t PackObjectType, l uint64) []byte {
+	v := byte(t)<<4 | byte(l&0b1111)
+	for l >>= 4; l > 0; l >>= 7 {
+		b = append(b, v|0b10000000)
+		v = byte(l & 0b01111111)
+	}
+	return append(b, v)
+}
+
+// appendPackOfsDelta appends the negative offset of an ObjOfsDelta base
+func appendPackOfsDelta(b []byte, rel int64) []byte {
+	enc := []byte{byte(rel & 0b01111111)}
+	for rel >>= 7; rel > 0; rel >>= 7 {
+		rel--
+		enc = append([]byte{byte(rel&0b01111111) | 0b10000000}, enc...)
+	}
+	return append(b, enc...)
+}
+
+func (t objectType) packObjectType() PackObjectType {
+	switch t {
+	case ObjectTypeCommit:
+		return ObjCommit
+	case ObjectTypeTree:
+		return ObjTree
+	case ObjectTypeBlob:
+		return ObjBlob
+	case ObjectTypeTag:
+		return ObjTag
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,236 @@
+package g
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// ReflogEntry is a single update of a ref as recorded in its reflog
+	ReflogEntry struct {
+		Old       Sha
+		New       Sha
+		Committer string
+		Time      time.Time
+		Message   string
+	}
+)
+
+// reflogPath returns the path of the reflog for a full ref name such as HEAD
+// or refs/heads/main
+func (r *Repository) reflogPath(ref string) string {
+	return filepath.Join(r.GitPath(), DefaultLogsDirectory, ref)
+}
+
+// appendReflog records an update of ref from old to new in the reflog of ref.
+// old is unset when the ref is created.
+func (r *Repository) appendReflog(ref string, old Sha, new Sha, message string) error {
+	path := r.reflogPath(ref)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	// a reflog message is a single line
+	message = strings.Join(strings.Fields(message), " ")
+	_, err = fmt.Fprintf(
+		f,
+		"%s %s %s <%s> %d +0000\t%s\n",
+		old.AsHexString(),
+		new.AsHexString(),
+		r.CommitterName(),
+		r.CommitterEmail(),
+		time.Now().Unix(),
+		message,
+	)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// deleteReflog removes the reflog of ref, as when the ref is deleted
+func (r *Repository) deleteReflog(ref string) error {
+	if err := os.Remove(r.reflogPath(ref)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	removeEmptyRefDirectories(filepath.Join(r.GitPath(), DefaultLogsDirectory), ref)
+	return nil
+}
+
+// deleteReflogEntry removes ref@{n} from the reflog of ref. The entry
+// recorded after it takes its old Sha, so that each entry still follows
+// from the one before.
+func (r *Repository) deleteReflogEntry(ref string, n int) error {
+	b, err := os.ReadFile(r.reflogPath(ref))
+	if err != nil {
+		return err
+	}
+	lines := bytes.SplitAfter(b, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	i := len(lines) - 1 - n
+	if n < 0 || i < 0 {
+		return fmt.Errorf("fatal: log for '%s' only has %d entries", ref, len(lines))
+	}
+	if i+1 < len(lines) && len(lines[i]) > 40 && len(lines[i+1]) > 40 {
+		copy(lines[i+1][:40], lines[i][:40])
+	}
+	lines = append(lines[:i], lines[i+1:]...)
+	return writeFileLocked(r.reflogPath(ref), bytes.Join(lines, nil))
+}
+
+// ReadReflog returns the reflog entries of a full ref name such as HEAD or
+// refs/heads/main, most recent first so that entry n is ref@{n}. A ref
+// without a reflog has no entries.
+func (r *Repository) ReadReflog(ref string) ([]*ReflogEntry, error) {
+	f, err := os.Open(r.reflogPath(ref))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	var entries []*ReflogEntry
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		entry, err := readReflogEntry(s.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		entries = append([]*ReflogEntry{entry}, entries...)
+	}
+	return entries, s.Err()
+}
+
+// readReflogEntry parses a reflog line of the form
+// <old> <new> <name> <<email>> <timestamp> <zone><TAB><message>
+func readReflogEntry(line []byte) (*ReflogEntry, error) {
+	header, message, _ := bytes.Cut(line, []byte("\t"))
+	if len(header) < 82 || header[40] != ' ' || header[81] != ' ' {
+		return nil, fmt.Errorf("invalid reflog entry %s", line)
+	}
+	entry := &ReflogEntry{Message: string(message)}
+	for i, v := range []*Sha{&entry.Old, &entry.New} {
+		hex := header[i*41 : i*41+40]
+		if bytes.Equal(hex, bytes.Repeat([]byte("0"), 40)) {
+			continue
+		}
+		sha, err := NewSha(hex)
+		if err != nil {
+			return nil, err
+		}
+		*v = sha
+	}
+	who := header[82:]
+	end := bytes.LastIndexByte(who, '>')
+	if end < 0 {
+		return nil, fmt.Errorf("invalid reflog entry %s", line)
+	}
+	entry.Committer = string(who[:end+1])
+	fields := bytes.Fields(who[end+1:])
+	if len(fields) > 0 {
+		ts, err := strconv.ParseInt(string(fields[0]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reflog entry %s", line)
+		}
+		entry.Time = time.Unix(ts, 0)
+	}
+	return entry, nil
+}
+
+// ReflogRef returns the full ref name whose reflog is meant by name, trying
+// name as given then as a tag, branch and remote.
+func (r *Repository) ReflogRef(name string) (string, error) {
+	if name == "" || name == "@" {
+		return DefaultHeadFile, nil
+	}
+	for _, ref := range []string{
+		name,
+		filepath.Join(DefaultRefsDirectory, name),
+		filepath.Join(DefaultRefsDirectory, DefaultRefsTagsDirectory, name),
+		filepath.Join(DefaultRefsDirectory, DefaultRefsHeadsDirectory, name),
+		filepath.Join(DefaultRefsDirectory, "remotes", name),
+	} {
+		if ref == name && !strings.HasPrefix(name, DefaultRefsDirectory+"/") && (strings.ToUpper(name) != name || strings.Contains(name, "/")) {
+			continue
+		}
+		if strings.Contains(ref, "..") {
+			continue
+		}
+		if _, err := os.Stat(r.reflogPath(ref)); err == nil {
+			return ref, nil
+		}
+		if _, found, err := r.resolveRef(ref); err != nil {
+			return "", err
+		} else if found {
+			return ref, nil
+		}
+	}
+	return "", unknownRevisionError(name)
+}
+
+// resolveReflogEntry returns the Sha that ref pointed to n updates ago.
+func (r *Repository) resolveReflogEntry(rev string, ref string, n int) (Sha, error) {
+	entries, err := r.ReadReflog(ref)
+	if err != nil {
+		return Sha{}, err
+	}
+	if n == 0 && len(entries) == 0 {
+		// the current value of a ref without a reflog
+		sha, found, err := r.resolveRef(ref)
+		if err != nil {
+			return Sha{}, err
+		}
+		if found {
+			return sha, nil
+		}
+	}
+	if n >= len(entries) {
+		return Sha{}, fmt.Errorf("fatal: log for '%s' only has %d entries", ref, len(entries))
+	}
+	if !entries[n].New.IsSet() {
+		return Sha{}, unknownRevisionError(rev)
+	}
+	return entries[n].New, nil
+}
+
+// previousCheckout returns the branch, or Sha when detached, that was checked
+// out n switches ago according to the HEAD reflog.
+func (r *Repository) previousCheckout(n int) (string, error) {
+	entries, err := r.ReadReflog(DefaultHeadFile)
+	if err != nil {
+		return "", err
+	}
+	var found int
+	for _, v := range entries {
+		moved, ok := strings.CutPrefix(v.Message, "checkout: moving from ")
+		if !ok {
+			continue
+		}
+		name, _, ok := strings.Cut(moved, " to ")
+		if !ok {
+			continue
+		}
+		if found++; found == n {
+			return name, nil
+		}
+	}
+	if found == 0 {
+		return "", fmt.Errorf("fatal: @{-%d}: no previous checkout", n)
+	}
+	return "", fmt.Errorf("fatal: @{-%d}: only %d checkouts found", n, found)
+}
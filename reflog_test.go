@@ -0,0 +1,94 @@
+package g
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReflog(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Init(dir, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+	commit := func(message string) Sha {
+		return assertCreateCommit(t, r, &Commit{
+			Author:        "tester <tester@test.com>",
+			AuthoredTime:  time.Now(),
+			Committer:     "tester <tester@test.com>",
+			CommittedTime: time.Now(),
+			Message:       []byte(message),
+		})
+	}
+	e(os.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644), t)
+	assertAddFiles(t, r, []string{"a"})
+	first := commit("first\n\nwith a body")
+	e(r.CreateBranch("dev"), t)
+	assertSwitchBranch(t, r, "dev", func(t *testing.T, fh []string) {})
+	e(os.WriteFile(filepath.Join(dir, "b"), []byte("b"), 0644), t)
+	assertAddFiles(t, r, []string{"b"})
+	second := commit("second")
+	assertSwitchBranch(t, r, "main", func(t *testing.T, fh []string) {})
+
+	assertReflog := func(ref string, expected []ReflogEntry) {
+		t.Helper()
+		entries, err := r.ReadReflog(ref)
+		e(err, t)
+		var actual []ReflogEntry
+		for _, v := range entries {
+			actual = append(actual, ReflogEntry{Old: v.Old, New: v.New, Message: v.Message})
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%s reflog = %v, want %v", ref, actual, expected)
+		}
+	}
+	assertReflog("HEAD", []ReflogEntry{
+		{Old: second, New: first, Message: "checkout: moving from dev to main"},
+		{Old: first, New: second, Message: "commit: second"},
+		{Old: first, New: first, Message: "checkout: moving from main to dev"},
+		{New: first, Message: "commit (initial): first"},
+	})
+	assertReflog("refs/heads/dev", []ReflogEntry{
+		{Old: first, New: second, Message: "commit: second"},
+		{New: first, Message: "branch: Created from HEAD"},
+	})
+	assertReflog("refs/heads/main", []ReflogEntry{
+		{New: first, Message: "commit (initial): first"},
+	})
+
+	for rev, want := range map[string]Sha{
+		"HEAD@{0}":  first,
+		"HEAD@{1}":  second,
+		"HEAD@{1}^": first,
+		"@{0}":      first,
+		"dev@{1}":   first,
+		"dev@{0}":   second,
+		"@{-1}":     second,
+		"@{-2}":     first,
+		"HEAD@{3}":  first,
+		"main@{0}":  first,
+	} {
+		sha, err := r.ResolveRevision(rev)
+		if err != nil {
+			t.Errorf("r.ResolveRevision(%q): %s", rev, err)
+			continue
+		}
+		if sha != want {
+			t.Errorf("r.ResolveRevision(%q) = %s, want %s", rev, sha, want)
+		}
+	}
+	for _, rev := range []string{"HEAD@{4}", "main@{1}", "@{1}", "missing@{0}", "@{-3}", "HEAD@{yesterday}"} {
+		if _, err := r.ResolveRevision(rev); err == nil {
+			t.Errorf("r.ResolveRevision(%q) expected an error", rev)
+		}
+	}
+
+	// deleting a branch deletes its reflog
+	e(r.DeleteBranch("dev"), t)
+	entries, err := r.ReadReflog("refs/heads/dev")
+	e(err, t)
+	if len(entries) != 0 {
+		t.Errorf("expected no reflog entries for a deleted branch, got %d", len(entries))
+	}
+}
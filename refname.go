@@ -0,0 +1,67 @@
+package g
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CheckRefFormat returns an error when ref is not a valid full ref name
+// according to the rules of git check-ref-format. A name with a single
+// component, such as HEAD, is only allowed when allowOneLevel is true.
+func CheckRefFormat(ref string, allowOneLevel bool) error {
+	invalid := fmt.Errorf("fatal: '%s' is not a valid ref name", ref)
+	if ref == "" || ref == "@" {
+		return invalid
+	}
+	if strings.HasPrefix(ref, "/") || strings.HasSuffix(ref, "/") || strings.HasSuffix(ref, ".") {
+		return invalid
+	}
+	if strings.Contains(ref, "..") || strings.Contains(ref, "@{") || strings.Contains(ref, "//") {
+		return invalid
+	}
+	for _, c := range ref {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\", c) {
+			return invalid
+		}
+	}
+	components := strings.Split(ref, "/")
+	if len(components) < 2 && !allowOneLevel {
+		return invalid
+	}
+	for _, v := range components {
+		if strings.HasPrefix(v, ".") || strings.HasSuffix(v, lockFileSuffix) {
+			return invalid
+		}
+	}
+	return nil
+}
+
+// CheckBranchName returns an error when name can not be used as a branch
+func CheckBranchName(name string) error {
+	if name == "HEAD" || strings.HasPrefix(name, "-") || CheckRefFormat(DefaultRefsDirectory+"/"+DefaultRefsHeadsDirectory+"/"+name, false) != nil {
+		return fmt.Errorf("fatal: '%s' is not a valid branch name", name)
+	}
+	return nil
+}
+
+// CheckTagName returns an error when name can not be used as a tag
+func CheckTagName(name string) error {
+	if strings.HasPrefix(name, "-") || CheckRefFormat(DefaultRefsDirectory+"/"+DefaultRefsTagsDirectory+"/"+name, false) != nil {
+		return fmt.Errorf("fatal: '%s' is not a valid tag name", name)
+	}
+	return nil
+}
+
+// isPseudoRef returns true for the all capital names in the git directory,
+// such as HEAD and ORIG_HEAD, that are refs outside of refs/
+func isPseudoRef(ref string) bool {
+	if ref == "" {
+		return false
+	}
+	for _, c := range ref {
+		if (c < 'A' || c > 'Z') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
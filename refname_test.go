@@ -0,0 +1,149 @@
+package g
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckRefFormat(t *testing.T) {
+	for _, ref := range []string{
+		"refs/heads/main",
+		"refs/heads/feature/login",
+		"refs/tags/v1.0",
+		"refs/heads/a-b_c",
+		"refs/heads/@",
+	} {
+		if err := CheckRefFormat(ref, false); err != nil {
+			t.Errorf("CheckRefFormat(%q): %s", ref, err)
+		}
+	}
+	for _, ref := range []string{
+		"",
+		"@",
+		"main",
+		"refs/heads/",
+		"/refs/heads/main",
+		"refs//heads",
+		"refs/heads/.hidden",
+		"refs/heads/a/.b",
+		"refs/heads/main.lock",
+		"refs/heads/a..b",
+		"refs/heads/a.",
+		"refs/heads/a b",
+		"refs/heads/a~1",
+		"refs/heads/a^",
+		"refs/heads/a:b",
+		"refs/heads/a?",
+		"refs/heads/a*",
+		"refs/heads/a[b",
+		"refs/heads/a\\b",
+		"refs/heads/a@{1}",
+		"refs/heads/a\x01",
+		"refs/heads/a\x7f",
+	} {
+		if err := CheckRefFormat(ref, false); err == nil {
+			t.Errorf("CheckRefFormat(%q) expected an error", ref)
+		}
+	}
+	if err := CheckRefFormat("HEAD", true); err != nil {
+		t.Error(err)
+	}
+	for _, name := range []string{"HEAD", "-b", "a..b"} {
+		if err := CheckBranchName(name); err == nil {
+			t.Errorf("CheckBranchName(%q) expected an error", name)
+		}
+	}
+}
+
+func TestHierarchicalBranches(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Init(dir, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+	e(os.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644), t)
+	assertAddFiles(t, r, []string{"a"})
+	first := assertCreateCommit(t, r, &Commit{
+		Author:        "tester <tester@test.com>",
+		AuthoredTime:  time.Now(),
+		Committer:     "tester <tester@test.com>",
+		CommittedTime: time.Now(),
+		Message:       []byte("first"),
+	})
+
+	e(r.CreateBranch("feature/login"), t)
+	e(r.CreateBranch("feature/deep/name"), t)
+	e(r.CreateBranch("fix"), t)
+	if err := r.CreateBranch("feature"); err == nil {
+		t.Error("expected an error creating a branch where a directory of branches exists")
+	}
+	if err := r.CreateBranch("fix/one"); err == nil {
+		t.Error("expected an error creating a branch below an existing branch")
+	}
+	if err := r.CreateBranch("bad..name"); err == nil {
+		t.Error("expected an error creating an invalid branch name")
+	}
+	branches, err := r.ListBranches()
+	e(err, t)
+	if !reflect.DeepEqual(branches, []string{"feature/deep/name", "feature/login", "fix", "main"}) {
+		t.Errorf("branches = %v", branches)
+	}
+
+	// switch to and commit on a hierarchical branch
+	assertSwitchBranch(t, r, "feature/login", func(t *testing.T, fh []string) {})
+	assertCurrentBranch(t, r, "feature/login")
+	e(os.WriteFile(filepath.Join(dir, "b"), []byte("b"), 0644), t)
+	assertAddFiles(t, r, []string{"b"})
+	second := assertCreateCommit(t, r, &Commit{
+		Author:        "tester <tester@test.com>",
+		AuthoredTime:  time.Now(),
+		Committer:     "tester <tester@test.com>",
+		CommittedTime: time.Now(),
+		Message:       []byte("second"),
+	})
+	head, err := r.HeadSHA("feature/login")
+	e(err, t)
+	if head != second {
+		t.Errorf("feature/login = %s, want %s", head, second)
+	}
+	assertSwitchBranch(t, r, "main", func(t *testing.T, fh []string) {})
+
+	// packed hierarchical branches are listed, resolved and deleted
+	e(r.PackRefs(), t)
+	if _, err := os.Stat(filepath.Join(r.RefsHeadsDirectory(), "feature")); !errors.Is(err, os.ErrNotExist) {
+		t.Error("expected empty branch directories to be removed by pack-refs")
+	}
+	branches, err = r.ListBranches()
+	e(err, t)
+	if !reflect.DeepEqual(branches, []string{"feature/deep/name", "feature/login", "fix", "main"}) {
+		t.Errorf("branches = %v", branches)
+	}
+	sha, err := r.ResolveRevision("feature/login~1")
+	e(err, t)
+	if sha != first {
+		t.Errorf("feature/login~1 = %s, want %s", sha, first)
+	}
+	if err := r.CreateBranch("feature"); err == nil {
+		t.Error("expected an error creating a branch where packed branches exist")
+	}
+	e(r.DeleteBranch("feature/login"), t)
+	e(r.DeleteBranch("feature/deep/name"), t)
+	e(r.CreateBranch("feature"), t)
+
+	// deleting a loose hierarchical branch removes empty directories
+	e(r.CreateBranch("topic/a/b"), t)
+	e(r.DeleteBranch("topic/a/b"), t)
+	for _, path := range []string{
+		filepath.Join(r.RefsHeadsDirectory(), "topic"),
+		filepath.Join(r.GitPath(), DefaultLogsDirectory, "refs", "heads", "topic"),
+	} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected %s to be removed", path)
+		}
+	}
+	if _, err := os.Stat(r.RefsHeadsDirectory()); err != nil {
+		t.Error("expected refs/heads to be kept")
+	}
+}
@@ -1,40 +1,42 @@
 package g
 
 import (
-	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 )
 
 // UpdateHead writes branch name as a reference in the Git HEAD file
-func UpdateHead(branch string) error {
-	return os.WriteFile(GitHeadPath(), []byte(fmt.Sprintf("ref: refs/heads/%s\n", branch)), 0655)
+func (r *Repository) UpdateHead(branch string) error {
+	return writeFileLocked(r.GitHeadPath(), []byte(fmt.Sprintf("ref: refs/heads/%s\n", branch)))
 }
 
-// UpdateBranchHead updates the sha hash pointed to by a branch
-func UpdateBranchHead(branch string, sha Sha) error {
-	path := filepath.Join(RefsHeadsDirectory(), branch)
-	return os.WriteFile(path, []byte(sha.AsHexString()+"\n"), 0755)
+// UpdateBranchHead updates the sha hash pointed to by a branch, recording
+// message in the reflog of the branch and of HEAD when it refers to the
+// branch.
+func (r *Repository) UpdateBranchHead(branch string, sha Sha, message string) error {
+	tx := r.NewRefTransaction()
+	tx.Update(filepath.Join(DefaultRefsDirectory, DefaultRefsHeadsDirectory, branch), sha, Sha{}, message)
+	return tx.Commit()
 }
 
 // HeadSHA returns the hash pointed to by a branch
-func HeadSHA(currentBranch string) (Sha, error) {
-	path := filepath.Join(RefsHeadsDirectory(), currentBranch)
+func (r *Repository) HeadSHA(currentBranch string) (Sha, error) {
+	path := filepath.Join(r.RefsHeadsDirectory(), currentBranch)
 	bytes, err := os.ReadFile(path)
 	if err != nil && errors.Is(err, fs.ErrNotExist) {
 		// the branch does not exist in refs/heads when there are no commits
 		// lets check packed-refs
-		branchMap, err := packedrefs()
+		packed, err := r.readPackedRefs()
 		if err != nil {
 			return Sha{}, err
 		}
-		if v, ok := branchMap[currentBranch]; ok {
-			return v, nil
+		if v, ok := packed[r.RefsHeadPrefix()+currentBranch]; ok {
+			return v.Sha, nil
 		}
 		return Sha{}, nil
 	} else if err != nil {
@@ -46,128 +48,158 @@ func HeadSHA(currentBranch string) (Sha, error) {
 	return sha, err
 }
 
-// CurrentBranch returns the name of the current branch
-func CurrentBranch() (string, error) {
-	f, err := os.Open(GitHeadPath())
+// DetachHead writes sha directly to the Git HEAD file, detaching HEAD from
+// any branch
+func (r *Repository) DetachHead(sha Sha) error {
+	return writeFileLocked(r.GitHeadPath(), []byte(sha.AsHexString()+"\n"))
+}
+
+// readHead reads the Git HEAD file returning either the name of the branch it
+// refers to, or when HEAD is detached the Sha it holds.
+func (r *Repository) readHead() (string, Sha, error) {
+	b, err := os.ReadFile(r.GitHeadPath())
 	if err != nil {
-		return "", err
+		return "", Sha{}, err
 	}
-	defer func() { _ = f.Close() }()
-	r := bufio.NewReader(f)
-	b, err := r.ReadBytes('\n')
-	if err != nil {
-		return "", err
+	b = bytes.TrimSpace(b)
+	if ref, ok := bytes.CutPrefix(b, []byte("ref: ")); ok {
+		branch, ok := strings.CutPrefix(string(ref), r.RefsHeadPrefix())
+		if !ok {
+			return "", Sha{}, fmt.Errorf("invalid HEAD file, unexpected ref %s", ref)
+		}
+		return branch, Sha{}, nil
 	}
-	if len(b) < 12 {
-		return "", errors.New("invalid HEAD file, expected > 12 bytes")
+	if len(b) != 40 {
+		return "", Sha{}, errors.New("invalid HEAD file, expected a ref or a sha")
 	}
+	sha, err := NewSha(b)
+	return "", sha, err
+}
 
-	return string(b[16 : len(b)-1]), nil
+// resolveRef returns the Sha that a ref such as HEAD or refs/heads/main
+// points to, following symbolic refs. The returned bool is false when the ref
+// does not exist.
+func (r *Repository) resolveRef(name string) (Sha, bool, error) {
+	for depth := 0; depth < 5; depth++ {
+		if name == "" || strings.Contains(name, "..") {
+			return Sha{}, false, nil
+		}
+		path := filepath.Join(r.GitPath(), name)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			return Sha{}, false, nil
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				return Sha{}, false, err
+			}
+			// the ref may be packed
+			packed, err := r.readPackedRefs()
+			if err != nil {
+				return Sha{}, false, err
+			}
+			ref, ok := packed[name]
+			return ref.Sha, ok, nil
+		}
+		b = bytes.TrimSpace(b)
+		if ref, ok := bytes.CutPrefix(b, []byte("ref: ")); ok {
+			name = string(ref)
+			continue
+		}
+		if len(b) != 40 {
+			return Sha{}, false, fmt.Errorf("invalid ref %s", name)
+		}
+		sha, err := NewSha(b)
+		return sha, err == nil, err
+	}
+	return Sha{}, false, fmt.Errorf("symbolic ref %s is nested too deeply", name)
+}
+
+// CurrentBranch returns the name of the current branch. When HEAD is
+// detached the name is empty.
+func (r *Repository) CurrentBranch() (string, error) {
+	branch, _, err := r.readHead()
+	return branch, err
+}
+
+// IsDetachedHead returns true when HEAD holds a Sha rather than referring to
+// a branch.
+func (r *Repository) IsDetachedHead() (bool, error) {
+	branch, _, err := r.readHead()
+	return branch == "", err
 }
 
 // CurrentCommit return the current commit SHA
-// @todo this probably breaks in detached head...
-func CurrentCommit() (Sha, error) {
-	currentBranch, err := CurrentBranch()
+func (r *Repository) CurrentCommit() (Sha, error) {
+	currentBranch, sha, err := r.readHead()
 	if err != nil {
 		return Sha{}, err
 	}
-	sha, err := HeadSHA(currentBranch)
+	if currentBranch == "" {
+		return sha, nil
+	}
+	sha, err = r.HeadSHA(currentBranch)
 	if err != nil {
 		return Sha{}, err
 	}
 	return sha, nil
 }
 
-func PreviousCommits() ([]Sha, error) {
-	previousCommit, err := CurrentCommit()
+// PreviousCommits returns the parents of the next commit: the current commit
+// if any, followed by the commits being merged while a merge is in progress
+func (r *Repository) PreviousCommits() ([]Sha, error) {
+	var parents []Sha
+	previousCommit, err := r.CurrentCommit()
 	if err != nil {
 		return nil, err
 	}
 	if previousCommit.IsSet() {
-		return []Sha{previousCommit}, nil
+		parents = append(parents, previousCommit)
 	}
-	return nil, nil
-}
-
-// ListBranches lists Git branches from refs/heads and info/refs
-// It does not currently allow listing remote tracking branches
-func ListBranches() ([]string, error) {
-	var branches []string
-	branchMap := make(map[string]struct{})
-
-	// check for packed refs
-	packed, err := packedrefs()
+	merging, err := r.MergeHeads()
 	if err != nil {
 		return nil, err
 	}
-	for k := range packed {
-		branchMap[k] = struct{}{}
-	}
+	return append(parents, merging...), nil
+}
 
-	f, err := os.ReadDir(RefsHeadsDirectory())
+// ListBranches lists Git branches from refs/heads and packed-refs, including
+// branches with hierarchical names such as feature/login.
+// It does not currently allow listing remote tracking branches
+func (r *Repository) ListBranches() ([]string, error) {
+	refs, err := r.listRefs(r.RefsHeadPrefix())
 	if err != nil {
-		return branches, err
-	}
-	for _, v := range f {
-		if v.IsDir() {
-			continue
-		}
-		branchMap[v.Name()] = struct{}{}
+		return nil, err
 	}
-	// return branches sorted alphabetically
-	for k := range branchMap {
-		branches = append(branches, k)
+	branches := make([]string, len(refs))
+	for i, v := range refs {
+		branches[i] = strings.TrimPrefix(v, r.RefsHeadPrefix())
 	}
-	sort.Strings(branches)
 	return branches, nil
 }
 
-func CreateBranch(name string) error {
-	currentBranch, err := CurrentBranch()
-	if err != nil {
+func (r *Repository) CreateBranch(name string) error {
+	if err := CheckBranchName(name); err != nil {
 		return err
 	}
-	head, err := HeadSHA(currentBranch)
+	head, err := r.CurrentCommit()
 	if err != nil {
 		return err
 	}
 
-	return UpdateBranchHead(name, head)
-}
-
-func DeleteBranch(name string) error {
-	return os.Remove(filepath.Join(RefsHeadsDirectory(), name))
+	ref := filepath.Join(DefaultRefsDirectory, DefaultRefsHeadsDirectory, name)
+	if _, found, err := r.resolveRef(ref); err != nil {
+		return err
+	} else if found {
+		return fmt.Errorf("fatal: a branch named '%s' already exists", name)
+	}
+	tx := r.NewRefTransaction()
+	tx.Create(ref, head, "branch: Created from HEAD")
+	return tx.Commit()
 }
 
-func packedrefs() (map[string]Sha, error) {
-	branchMap := make(map[string]Sha)
-
-	fh, err := os.Open(PackedRefsFile())
-	defer func() {
-		if fh != nil {
-			_ = fh.Close()
-		}
-	}()
-	if err == nil {
-		// we have a packed refs file to parse into a list of branches
-		scanner := bufio.NewScanner(fh)
-		for scanner.Scan() {
-			line := scanner.Bytes()
-			hash := line[0:40]
-			path := string(line[41:])
-			// path can have multiple prefixes
-			// refs/heads/
-			// refs (for stash)
-			// refs/remotes/.../
-			// for now just use refs/heads/
-			if path, ok := strings.CutPrefix(path, RefsHeadPrefix()); ok {
-				branchMap[path], err = NewSha(hash)
-				if err != nil {
-					return nil, err
-				}
-			}
-		}
-	}
-	return branchMap, nil
+func (r *Repository) DeleteBranch(name string) error {
+	tx := r.NewRefTransaction()
+	tx.Delete(filepath.Join(DefaultRefsDirectory, DefaultRefsHeadsDirectory, name), Sha{})
+	return tx.Commit()
 }
@@ -0,0 +1,281 @@
+package g
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type (
+	// RefTransaction updates several refs atomically. Every ref is locked and
+	// checked against its expected value before any ref is changed, so either
+	// all of the updates are made or none are.
+	RefTransaction struct {
+		repo    *Repository
+		updates []*refUpdate
+	}
+	// refUpdate is a single change to a ref within a RefTransaction
+	refUpdate struct {
+		ref      string
+		new      Sha
+		old      Sha
+		checkOld bool
+		delete   bool
+		message  string
+		lock     *lockFile
+	}
+	// RefMismatchError is returned when a ref does not have the value that a
+	// RefTransaction expected. An unset Sha means the ref does not exist.
+	RefMismatchError struct {
+		Ref      string
+		Expected Sha
+		Actual   Sha
+	}
+)
+
+func (e *RefMismatchError) Error() string {
+	if !e.Expected.IsSet() {
+		return fmt.Sprintf("error: cannot lock ref '%s': reference already exists", e.Ref)
+	}
+	if !e.Actual.IsSet() {
+		return fmt.Sprintf("error: cannot lock ref '%s': unable to resolve reference '%s'", e.Ref, e.Ref)
+	}
+	return fmt.Sprintf("error: cannot lock ref '%s': is at %s but expected %s", e.Ref, e.Actual, e.Expected)
+}
+
+// NewRefTransaction returns an empty RefTransaction for the refs of r
+func (r *Repository) NewRefTransaction() *RefTransaction {
+	return &RefTransaction{repo: r}
+}
+
+// Update sets ref to new, recording message in its reflog. When old is set
+// the update only succeeds if ref currently points to old.
+func (t *RefTransaction) Update(ref string, new Sha, old Sha, message string) {
+	t.updates = append(t.updates, &refUpdate{ref: ref, new: new, old: old, checkOld: old.IsSet(), message: message})
+}
+
+// Create sets ref to new, recording message in its reflog. The update only
+// succeeds if ref does not already exist.
+func (t *RefTransaction) Create(ref string, new Sha, message string) {
+	t.updates = append(t.updates, &refUpdate{ref: ref, new: new, checkOld: true, message: message})
+}
+
+// Delete removes ref and its reflog. When old is set the delete only
+// succeeds if ref currently points to old.
+func (t *RefTransaction) Delete(ref string, old Sha) {
+	t.updates = append(t.updates, &refUpdate{ref: ref, old: old, checkOld: old.IsSet(), delete: true})
+}
+
+// Commit applies the updates. Each ref is locked by creating <ref>.lock, a
+// *LockError is returned if a lock is already held and a *RefMismatchError if
+// a ref does not have its expected value, leaving every ref unchanged.
+func (t *RefTransaction) Commit() error {
+	sort.SliceStable(t.updates, func(i, j int) bool { return t.updates[i].ref < t.updates[j].ref })
+	for i, u := range t.updates {
+		if i > 0 && t.updates[i-1].ref == u.ref {
+			return fmt.Errorf("fatal: multiple updates for ref '%s' not allowed", u.ref)
+		}
+		if !isPseudoRef(u.ref) && (!strings.HasPrefix(u.ref, DefaultRefsDirectory+"/") || CheckRefFormat(u.ref, false) != nil) {
+			return fmt.Errorf("fatal: invalid ref name '%s'", u.ref)
+		}
+	}
+	if err := t.checkConflicts(); err != nil {
+		return err
+	}
+	defer t.rollback()
+
+	// take every lock, then check every expected value whilst they are held
+	for _, u := range t.updates {
+		lock, err := newLockFile(filepath.Join(t.repo.GitPath(), u.ref))
+		if err != nil {
+			return err
+		}
+		u.lock = lock
+	}
+	var previous []Sha
+	for _, u := range t.updates {
+		current, found, err := t.repo.readRefValue(u.ref)
+		if err != nil {
+			return err
+		}
+		if u.checkOld && (found != u.old.IsSet() || (found && !current.Matches(u.old))) {
+			return &RefMismatchError{Ref: u.ref, Expected: u.old, Actual: current}
+		}
+		if u.delete && !found {
+			return &RefMismatchError{Ref: u.ref, Expected: u.old}
+		}
+		previous = append(previous, current)
+	}
+
+	for _, u := range t.updates {
+		if u.delete {
+			continue
+		}
+		if _, err := u.lock.Write([]byte(u.new.AsHexString() + "\n")); err != nil {
+			return err
+		}
+	}
+	if err := t.deletePacked(); err != nil {
+		return err
+	}
+	branch, err := t.repo.CurrentBranch()
+	if err != nil {
+		return err
+	}
+	head := filepath.Join(DefaultRefsDirectory, DefaultRefsHeadsDirectory, branch)
+	for i, u := range t.updates {
+		lock := u.lock
+		u.lock = nil
+		if u.delete {
+			err := os.Remove(filepath.Join(t.repo.GitPath(), u.ref))
+			lock.Rollback()
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			removeEmptyRefDirectories(t.repo.GitPath(), u.ref)
+			if err := t.repo.deleteReflog(u.ref); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := lock.Commit(); err != nil {
+			return err
+		}
+		if u.message == "" {
+			continue
+		}
+		if err := t.repo.appendReflog(u.ref, previous[i], u.new, u.message); err != nil {
+			return err
+		}
+		// HEAD records the updates of the branch that it refers to
+		if branch != "" && u.ref == head {
+			if err := t.repo.appendReflog(DefaultHeadFile, previous[i], u.new, u.message); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkConflicts returns an error when a ref being written would need a
+// directory where a ref exists, such as refs/heads/a/b when refs/heads/a
+// exists, or the reverse. Refs deleted by the transaction do not conflict.
+func (t *RefTransaction) checkConflicts() error {
+	deleted := make(map[string]bool)
+	for _, u := range t.updates {
+		if u.delete {
+			deleted[u.ref] = true
+		}
+	}
+	for _, u := range t.updates {
+		if u.delete {
+			continue
+		}
+		components := strings.Split(u.ref, "/")
+		for i := 2; i < len(components); i++ {
+			parent := strings.Join(components[:i], "/")
+			if deleted[parent] {
+				continue
+			}
+			if _, found, err := t.repo.resolveRef(parent); err != nil {
+				return err
+			} else if found {
+				return fmt.Errorf("error: cannot lock ref '%s': '%s' exists; cannot create '%s'", u.ref, parent, u.ref)
+			}
+		}
+		children, err := t.repo.listRefs(u.ref + "/")
+		if err != nil {
+			return err
+		}
+		for _, v := range children {
+			if !deleted[v] {
+				return fmt.Errorf("error: cannot lock ref '%s': '%s' exists; cannot create '%s'", u.ref, v, u.ref)
+			}
+		}
+	}
+	return nil
+}
+
+// deletePacked removes the refs being deleted from the packed-refs file, so
+// that they are not found once their loose files are removed.
+func (t *RefTransaction) deletePacked() error {
+	var deletes []string
+	for _, u := range t.updates {
+		if u.delete {
+			deletes = append(deletes, u.ref)
+		}
+	}
+	if len(deletes) == 0 {
+		return nil
+	}
+	lock, err := newLockFile(t.repo.PackedRefsFile())
+	if err != nil {
+		return err
+	}
+	defer lock.Rollback()
+	packed, err := t.repo.readPackedRefs()
+	if err != nil {
+		return err
+	}
+	var changed bool
+	for _, v := range deletes {
+		if _, ok := packed[v]; ok {
+			delete(packed, v)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	if err := writePackedRefs(lock, packed); err != nil {
+		return err
+	}
+	return lock.Commit()
+}
+
+// rollback releases any locks that are still held
+func (t *RefTransaction) rollback() {
+	for _, u := range t.updates {
+		if u.lock != nil {
+			u.lock.Rollback()
+			u.lock = nil
+		}
+	}
+}
+
+// readRefValue reads the Sha held by ref without following symbolic refs.
+// The returned bool is false when the ref does not exist, or is symbolic.
+func (r *Repository) readRefValue(ref string) (Sha, bool, error) {
+	b, err := os.ReadFile(filepath.Join(r.GitPath(), ref))
+	if errors.Is(err, fs.ErrNotExist) {
+		return r.resolveRef(ref)
+	}
+	if err != nil {
+		return Sha{}, false, err
+	}
+	b = []byte(strings.TrimSpace(string(b)))
+	if strings.HasPrefix(string(b), "ref: ") {
+		return Sha{}, false, nil
+	}
+	if len(b) != 40 {
+		return Sha{}, false, fmt.Errorf("invalid ref %s", ref)
+	}
+	sha, err := NewSha(b)
+	return sha, err == nil, err
+}
+
+// removeEmptyRefDirectories removes the directories of ref below root that
+// are left empty once ref has been removed. The namespace directories, such
+// as refs/heads, are kept.
+func removeEmptyRefDirectories(root string, ref string) {
+	components := strings.Split(ref, "/")
+	for i := len(components) - 1; i > 2; i-- {
+		if err := os.Remove(filepath.Join(root, filepath.Join(components[:i]...))); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package g
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRefTransaction(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Init(dir, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+	e(os.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644), t)
+	assertAddFiles(t, r, []string{"a"})
+	first := assertCreateCommit(t, r, &Commit{
+		Author:        "tester <tester@test.com>",
+		AuthoredTime:  time.Now(),
+		Committer:     "tester <tester@test.com>",
+		CommittedTime: time.Now(),
+		Message:       []byte("first"),
+	})
+	second := assertCreateCommit(t, r, &Commit{
+		Author:        "tester <tester@test.com>",
+		AuthoredTime:  time.Now(),
+		Committer:     "tester <tester@test.com>",
+		CommittedTime: time.Now(),
+		Message:       []byte("second"),
+	})
+
+	assertRef := func(ref string, expected Sha) {
+		t.Helper()
+		sha, found, err := r.resolveRef(ref)
+		e(err, t)
+		if found != expected.IsSet() || sha != expected {
+			t.Errorf("%s = %s (found %v), want %s", ref, sha, found, expected)
+		}
+		if _, err := os.Stat(filepath.Join(r.GitPath(), ref+lockFileSuffix)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected the lock for %s to be released", ref)
+		}
+	}
+
+	// several refs are updated together
+	tx := r.NewRefTransaction()
+	tx.Create("refs/heads/a", first, "create a")
+	tx.Create("refs/heads/b", first, "create b")
+	tx.Update("refs/heads/main", first, second, "move main")
+	e(tx.Commit(), t)
+	assertRef("refs/heads/a", first)
+	assertRef("refs/heads/b", first)
+	assertRef("refs/heads/main", first)
+	b, err := os.ReadFile(filepath.Join(r.GitPath(), "refs/heads/a"))
+	e(err, t)
+	if string(b) != first.AsHexString()+"\n" {
+		t.Errorf("refs/heads/a = %q", b)
+	}
+	entries, err := r.ReadReflog("HEAD")
+	e(err, t)
+	if entries[0].Message != "move main" || entries[0].Old != second || entries[0].New != first {
+		t.Errorf("unexpected HEAD reflog entry %v", entries[0])
+	}
+
+	// a mismatch on any ref leaves every ref unchanged
+	tx = r.NewRefTransaction()
+	tx.Update("refs/heads/a", second, first, "")
+	tx.Update("refs/heads/b", second, second, "")
+	err = tx.Commit()
+	var mismatch *RefMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected RefMismatchError, got %v", err)
+	}
+	if mismatch.Ref != "refs/heads/b" || mismatch.Expected != second || mismatch.Actual != first {
+		t.Errorf("unexpected mismatch %v", mismatch)
+	}
+	assertRef("refs/heads/a", first)
+	assertRef("refs/heads/b", first)
+
+	// creating a ref that exists fails
+	tx = r.NewRefTransaction()
+	tx.Create("refs/heads/a", second, "")
+	if err := tx.Commit(); !errors.As(err, &mismatch) {
+		t.Errorf("expected RefMismatchError, got %v", err)
+	}
+
+	// a held lock is reported and nothing is changed
+	e(os.WriteFile(filepath.Join(r.GitPath(), "refs/heads/b.lock"), nil, 0644), t)
+	tx = r.NewRefTransaction()
+	tx.Update("refs/heads/a", second, first, "")
+	tx.Update("refs/heads/b", second, first, "")
+	err = tx.Commit()
+	var lock *LockError
+	if !errors.As(err, &lock) {
+		t.Fatalf("expected LockError, got %v", err)
+	}
+	if lock.Path != filepath.Join(r.GitPath(), "refs/heads/b.lock") {
+		t.Errorf("lock path = %s", lock.Path)
+	}
+	e(os.Remove(filepath.Join(r.GitPath(), "refs/heads/b.lock")), t)
+	assertRef("refs/heads/a", first)
+	assertRef("refs/heads/b", first)
+
+	// the same ref can not be updated twice
+	tx = r.NewRefTransaction()
+	tx.Update("refs/heads/a", second, Sha{}, "")
+	tx.Delete("refs/heads/a", Sha{})
+	if err := tx.Commit(); err == nil {
+		t.Error("expected an error updating a ref twice")
+	}
+
+	// delete
+	tx = r.NewRefTransaction()
+	tx.Delete("refs/heads/a", first)
+	tx.Delete("refs/heads/b", Sha{})
+	e(tx.Commit(), t)
+	assertRef("refs/heads/a", Sha{})
+	assertRef("refs/heads/b", Sha{})
+
+	// concurrent compare and swap updates of one ref, only one succeeds
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tx := r.NewRefTransaction()
+			tx.Update("refs/heads/main", second, first, "")
+			errs[i] = tx.Commit()
+		}(i)
+	}
+	wg.Wait()
+	var succeeded int
+	for _, err := range errs {
+		if err == nil {
+			succeeded++
+		} else if !errors.As(err, &lock) && !errors.As(err, &mismatch) {
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d concurrent updates succeeded, want 1", succeeded)
+	}
+	assertRef("refs/heads/main", second)
+}
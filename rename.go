@@ -0,0 +1,247 @@
+package g
+
+import (
+	"github.com/richardjennings/g/diff"
+	"path/filepath"
+	"sort"
+)
+
+// DefaultRenameThreshold is the similarity, as a percentage, from which an
+// added file is paired with the file it was renamed or copied from
+const DefaultRenameThreshold = 50
+
+// DefaultRenameLimit is the rename limit of git diff and git status when
+// diff.renameLimit is not set
+const DefaultRenameLimit = 1000
+
+type (
+	// renameSource is a file of the old side that an added file may have
+	// been renamed or copied from
+	renameSource struct {
+		path string
+		sha  Sha
+		mode FileMode
+		// deleted is the entry of a source that is not on the new side
+		deleted *DiffEntry
+		// unmodified is set for a source only found by FindCopiesHarder
+		unmodified bool
+		// used is the number of added files paired with the source
+		used int
+		// chunks is the content of the source, split once to be compared
+		// with each added file
+		chunks *diff.Chunks
+	}
+	// renamePair is an added file and a source it is similar to
+	renamePair struct {
+		dst        *DiffEntry
+		src        *renameSource
+		similarity int
+		sameName   bool
+	}
+)
+
+// findRenames pairs the added entries of entries, the differences between
+// old and new, with the deleted entries they were renamed from and, when
+// opts.Copies is set, with the modified files they were copied from. Exact
+// copies are paired first, then the most similar files. A deleted file
+// paired with more than one added file is renamed to the last of them by
+// path and copied to the others, as git reports it. As in git, similar files
+// are not looked for when there are more added files or sources left than
+// opts.RenameLimit, unless leaving out unmodified sources is enough.
+func (r *Repository) findRenames(entries []*DiffEntry, old map[string]*fileInfo, opts DiffOptions) ([]*DiffEntry, error) {
+	threshold := opts.Threshold
+	if threshold <= 0 {
+		threshold = DefaultRenameThreshold
+	}
+	var dsts []*DiffEntry
+	var srcs []*renameSource
+	changed := make(map[string]bool)
+	for _, v := range entries {
+		changed[v.OldPath] = true
+		switch {
+		case v.Status == DiffAdded:
+			dsts = append(dsts, v)
+		case v.Status == DiffDeleted:
+			srcs = append(srcs, &renameSource{path: v.OldPath, sha: v.OldSha, mode: v.OldMode, deleted: v})
+		case v.Status == DiffModified && opts.Copies:
+			srcs = append(srcs, &renameSource{path: v.OldPath, sha: v.OldSha, mode: v.OldMode})
+		}
+	}
+	if opts.Copies && opts.FindCopiesHarder {
+		for path, v := range old {
+			if !changed[path] {
+				srcs = append(srcs, &renameSource{path: path, sha: v.Sha, mode: v.Mode, unmodified: true})
+			}
+		}
+	}
+	if len(dsts) == 0 || len(srcs) == 0 {
+		return entries, nil
+	}
+	sort.Slice(srcs, func(i, j int) bool {
+		return srcs[i].path < srcs[j].path
+	})
+
+	pairs := make(map[*DiffEntry]renamePair)
+	pair := func(p renamePair) {
+		pairs[p.dst] = p
+		p.src.used++
+	}
+	// exact copies, preferring an unused source with the same name
+	for _, d := range dsts {
+		var best *renameSource
+		bestScore := -1
+		for _, s := range srcs {
+			if !s.sha.Matches(d.NewSha) || s.mode.fileType() != d.NewMode.fileType() {
+				continue
+			}
+			if s.used > 0 && !opts.Copies {
+				continue
+			}
+			score := 0
+			if s.used == 0 {
+				score++
+			}
+			if sameBaseName(s.path, d.NewPath) {
+				score++
+			}
+			if score > bestScore {
+				best, bestScore = s, score
+			}
+		}
+		if best != nil {
+			pair(renamePair{dst: d, src: best, similarity: 100})
+		}
+	}
+
+	// similar regular files
+	srcs = similaritySources(dsts, srcs, pairs, opts)
+	var candidates []renamePair
+	for _, d := range dsts {
+		if _, ok := pairs[d]; ok || d.NewMode.fileType() != ModeRegular {
+			continue
+		}
+		var chunks *diff.Chunks
+		for _, s := range srcs {
+			if s.mode.fileType() != ModeRegular {
+				continue
+			}
+			if s.chunks == nil {
+				content, err := r.diffSideContent(s.path, s.sha, s.mode, false)
+				if err != nil {
+					return nil, err
+				}
+				s.chunks = diff.NewChunks(content)
+			}
+			if chunks == nil {
+				content, err := r.diffSideContent(d.NewPath, d.NewSha, d.NewMode, d.worktree)
+				if err != nil {
+					return nil, err
+				}
+				chunks = diff.NewChunks(content)
+			}
+			// the similarity can be no more than the smaller size
+			// relative to the larger
+			larger, smaller := max(s.chunks.Size(), chunks.Size()), min(s.chunks.Size(), chunks.Size())
+			if larger*(100-threshold) < (larger-smaller)*100 {
+				continue
+			}
+			if similarity := s.chunks.Similarity(chunks); similarity >= threshold {
+				candidates = append(candidates, renamePair{dst: d, src: s, similarity: similarity, sameName: sameBaseName(s.path, d.NewPath)})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].similarity != candidates[j].similarity {
+			return candidates[i].similarity > candidates[j].similarity
+		}
+		return candidates[i].sameName && !candidates[j].sameName
+	})
+	// each source is paired once before any is paired again as a copy
+	for _, copies := range []bool{false, true} {
+		if copies && !opts.Copies {
+			break
+		}
+		for _, c := range candidates {
+			if _, ok := pairs[c.dst]; ok || (!copies && c.src.used > 0) {
+				continue
+			}
+			pair(c)
+		}
+	}
+	if len(pairs) == 0 {
+		return entries, nil
+	}
+
+	renamed := make(map[*DiffEntry]bool)
+	for _, v := range pairs {
+		if v.src.deleted != nil {
+			renamed[v.src.deleted] = true
+		}
+	}
+	var found []*DiffEntry
+	for _, v := range entries {
+		p, ok := pairs[v]
+		if !ok {
+			if !renamed[v] {
+				found = append(found, v)
+			}
+			continue
+		}
+		e := &DiffEntry{
+			Status:     DiffCopied,
+			OldPath:    p.src.path,
+			NewPath:    v.NewPath,
+			OldSha:     p.src.sha,
+			NewSha:     v.NewSha,
+			OldMode:    p.src.mode,
+			NewMode:    v.NewMode,
+			Similarity: p.similarity,
+			worktree:   v.worktree,
+		}
+		if p.src.deleted != nil {
+			p.src.used--
+			if p.src.used == 0 {
+				e.Status = DiffRenamed
+			}
+		}
+		found = append(found, e)
+	}
+	return found, nil
+}
+
+// similaritySources returns the sources that the added files of dsts not
+// already paired are compared with. Like git, it returns none when there are
+// more of either than opts.RenameLimit, unless leaving out the unmodified
+// sources brings them under it.
+func similaritySources(dsts []*DiffEntry, srcs []*renameSource, pairs map[*DiffEntry]renamePair, opts DiffOptions) []*renameSource {
+	limit := opts.RenameLimit
+	if limit == 0 {
+		limit = DefaultRenameLimit
+	}
+	if limit < 0 {
+		return srcs
+	}
+	left := len(dsts) - len(pairs)
+	var candidates, modified []*renameSource
+	for _, v := range srcs {
+		// without copies a source already renamed is not used again
+		if v.used > 0 && !opts.Copies {
+			continue
+		}
+		candidates = append(candidates, v)
+		if !v.unmodified {
+			modified = append(modified, v)
+		}
+	}
+	switch {
+	case left <= limit && len(candidates) <= limit:
+		return srcs
+	case opts.FindCopiesHarder && left <= limit && len(modified) <= limit:
+		return modified
+	}
+	return nil
+}
+
+func sameBaseName(a string, b string) bool {
+	return filepath.Base(a) == filepath.Base(b)
+}
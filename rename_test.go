@@ -0,0 +1,109 @@
+package g
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiffRenames(t *testing.T) {
+	r, dir := newTestRepository(t)
+	lines := func(from int, to int) string {
+		var b strings.Builder
+		for i := from; i <= to; i++ {
+			_, _ = fmt.Fprintf(&b, "%d\n", i)
+		}
+		return b.String()
+	}
+	writeTestFile(t, dir, "a", lines(1, 20))
+	writeTestFile(t, dir, "b", "b\n")
+	writeTestFile(t, dir, "c", lines(1, 30))
+	writeTestFile(t, dir, "d", lines(100, 130))
+	assertAddFiles(t, r, []string{"a", "b", "c", "d"})
+	commit := &Commit{
+		Author:        "tester <tester@test.com>",
+		AuthoredTime:  time.Now(),
+		Committer:     "tester <tester@test.com>",
+		CommittedTime: time.Now(),
+		Message:       []byte("first"),
+	}
+	first := assertCreateCommit(t, r, commit)
+
+	// a is renamed with an edit, b is renamed, c is modified and copied,
+	// and d is deleted
+	for _, v := range []string{"a", "b", "d"} {
+		e(os.Remove(filepath.Join(dir, v)), t)
+	}
+	writeTestFile(t, dir, "x", lines(1, 19))
+	writeTestFile(t, dir, "y", "b\n")
+	writeTestFile(t, dir, "c", lines(1, 31))
+	writeTestFile(t, dir, "c2", lines(1, 30))
+	idx, err := r.ReadIndex()
+	e(err, t)
+	for _, v := range []string{"a", "b", "d"} {
+		e(idx.Rm(v), t)
+	}
+	e(idx.Write(), t)
+	assertAddFiles(t, r, []string{"x", "y", "c", "c2"})
+
+	for _, tt := range []struct {
+		opts     DiffOptions
+		expected string
+	}{
+		{DiffOptions{}, "D a,D b,M c,A c2,D d,A x,A y"},
+		{DiffOptions{Renames: true}, "M c,A c2,D d,R a x 94,R b y 100"},
+		{DiffOptions{Renames: true, Threshold: 95}, "D a,M c,A c2,D d,A x,R b y 100"},
+		// with more added files left than the limit only exact renames
+		{DiffOptions{Renames: true, RenameLimit: 1}, "D a,M c,A c2,D d,A x,R b y 100"},
+		{DiffOptions{Copies: true}, "M c,C c c2 100,D d,R a x 94,R b y 100"},
+	} {
+		entries, err := r.DiffIndex(first, tt.opts)
+		e(err, t)
+		var actual []string
+		for _, v := range entries {
+			switch v.Status {
+			case DiffRenamed, DiffCopied:
+				actual = append(actual, fmt.Sprintf("%s %s %s %d", v.Status, v.OldPath, v.NewPath, v.Similarity))
+			default:
+				actual = append(actual, fmt.Sprintf("%s %s", v.Status, v.NewPath))
+			}
+		}
+		if strings.Join(actual, ",") != tt.expected {
+			t.Errorf("%+v: expected %s got %s", tt.opts, tt.expected, strings.Join(actual, ","))
+		}
+	}
+
+	// status reports renames in the index
+	files, err := r.CurrentStatus()
+	e(err, t)
+	e(r.DetectRenames(files, DiffOptions{Renames: true}), t)
+	for path, from := range map[string]string{"x": "a", "y": "b"} {
+		f, ok := files.Contains(path)
+		if !ok || f.IndexStatus() != RenamedInIndex || f.OrigPath() != from {
+			t.Errorf("expected %s to be renamed from %s", path, from)
+		}
+	}
+	for _, v := range []string{"a", "b"} {
+		if _, ok := files.Contains(v); ok {
+			t.Errorf("expected %s to be removed from the status", v)
+		}
+	}
+
+	// a deleted file that is copied twice is renamed to the last copy
+	writeTestFile(t, dir, "z", "b\n")
+	assertAddFiles(t, r, []string{"z"})
+	entries, err := r.DiffIndex(first, DiffOptions{Copies: true})
+	e(err, t)
+	var statuses []string
+	for _, v := range entries {
+		if v.OldPath == "b" {
+			statuses = append(statuses, fmt.Sprintf("%s %s", v.Status, v.NewPath))
+		}
+	}
+	if strings.Join(statuses, ",") != "C y,R z" {
+		t.Errorf("expected b copied to y and renamed to z, got %v", statuses)
+	}
+}
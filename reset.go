@@ -0,0 +1,201 @@
+package g
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ResetMode is how much of the index and working tree Reset makes match the
+// commit HEAD is moved to
+type ResetMode uint8
+
+const (
+	// ResetSoft only moves HEAD
+	ResetSoft ResetMode = iota
+
+	// ResetMixed also resets the index, keeping the changes in the working
+	// tree
+	ResetMixed
+
+	// ResetHard also resets the working tree, discarding the changes to
+	// tracked files. Untracked files are kept.
+	ResetHard
+)
+
+// Reset moves HEAD, or the branch it refers to, to the commit rev, HEAD when
+// rev is empty, resetting the index and working tree as mode asks. The
+// commit moved from is recorded in ORIG_HEAD, and a merge in progress is
+// abandoned.
+func (r *Repository) Reset(rev string, mode ResetMode) error {
+	sha, err := r.resetTarget(rev)
+	if err != nil {
+		return err
+	}
+	head, err := r.CurrentCommit()
+	if err != nil {
+		return err
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if mode == ResetSoft {
+		_, err := os.Stat(r.MergeHeadPath())
+		if err == nil || len(idx.Unmerged()) > 0 {
+			return errors.New("fatal: Cannot do a soft reset in the middle of a merge.")
+		}
+	}
+	switch mode {
+	case ResetMixed:
+		if err := r.resetIndex(idx, sha, nil); err != nil {
+			return err
+		}
+		if err := idx.Write(); err != nil {
+			return err
+		}
+	case ResetHard:
+		if err := r.resetWorktree(sha); err != nil {
+			return err
+		}
+	}
+	if head.IsSet() {
+		if err := r.writeOrigHead(head); err != nil {
+			return err
+		}
+	}
+	if sha.IsSet() {
+		if rev == "" {
+			rev = "HEAD"
+		}
+		if err := r.moveHead(sha, head, "reset: moving to "+rev); err != nil {
+			return err
+		}
+	}
+	if mode == ResetSoft {
+		return nil
+	}
+	return r.removeMergeState()
+}
+
+// ResetPaths sets the index entries of the paths matching pathspecs to their
+// version in the commit rev, HEAD when rev is empty, and removes those the
+// commit does not have, as git reset <rev> -- <pathspec> does. Neither HEAD
+// nor the working tree is changed.
+func (r *Repository) ResetPaths(rev string, pathspecs []string) error {
+	sha, err := r.resetTarget(rev)
+	if err != nil {
+		return err
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return err
+	}
+	if err := r.resetIndex(idx, sha, pathspecs); err != nil {
+		return err
+	}
+	return idx.Write()
+}
+
+// resetTarget resolves the commit rev to reset to, or HEAD when rev is empty,
+// which is unset on an unborn branch
+func (r *Repository) resetTarget(rev string) (Sha, error) {
+	if rev == "" {
+		return r.CurrentCommit()
+	}
+	commit, err := r.resolveRevisionCommit(rev)
+	if err != nil {
+		return Sha{}, err
+	}
+	return commit.Sha, nil
+}
+
+// resetIndex sets the entries of idx matching pathspecs, or every entry when
+// there are none, to the files of commit. An entry that has the version of
+// the commit keeps its stat data. Any other has none, so that the working
+// tree file is compared by content until the index is refreshed.
+func (r *Repository) resetIndex(idx *Index, commit Sha, pathspecs []string) error {
+	files, err := r.treeFiles(commit)
+	if err != nil {
+		return err
+	}
+	return resetIndexFiles(idx, files, pathspecs)
+}
+
+// resetIndexFiles sets the entries of idx matching pathspecs, or every entry
+// when there are none, to files, keyed by path, as resetIndex does
+func resetIndexFiles(idx *Index, files map[string]*fileInfo, pathspecs []string) error {
+	kept := make(map[string]bool)
+	for _, v := range idx.Files() {
+		if len(pathspecs) > 0 && !MatchPathspec(v.path, pathspecs) {
+			continue
+		}
+		if v.index != nil && sameFile(v.index, files[v.path]) {
+			kept[v.path] = true
+			continue
+		}
+		if err := idx.Rm(v.path); err != nil {
+			return err
+		}
+	}
+	for path, f := range files {
+		if kept[path] || (len(pathspecs) > 0 && !MatchPathspec(path, pathspecs)) {
+			continue
+		}
+		idx.addStage(path, 0, f)
+	}
+	return nil
+}
+
+// resetWorktree makes the index and the tracked files of the working tree
+// match the files of commit. Files that already match are not rewritten.
+func (r *Repository) resetWorktree(commit Sha) error {
+	files, err := r.treeFiles(commit)
+	if err != nil {
+		return err
+	}
+	status, err := r.FsStatus(r.Path())
+	if err != nil {
+		return err
+	}
+	// tracked files the commit does not have are removed, with the
+	// directories they leave empty, leaving the repository of a submodule
+	for _, v := range status.Files() {
+		if _, ok := files[v.path]; ok || v.wd == nil || v.wd.Mode == ModeGitlink || (v.index == nil && v.Unmerged() == 0) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(r.Path(), v.path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		r.removeEmptyDirectories(v.path)
+	}
+	idx := r.NewIndex()
+	for path, f := range files {
+		if v, ok := status.Contains(path); ok && sameFile(v.index, f) && v.wdStatus == IndexAndWorkingTreeMatch {
+			if err := idx.addFromIndex(v); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := r.writeObjectToWorkingTree(f.Sha, path, f.Mode); err != nil {
+			return err
+		}
+		if f.Mode == ModeGitlink {
+			// the commit checked out in a submodule is not recorded
+			idx.addStage(path, 0, f)
+			continue
+		}
+		info, err := os.Lstat(filepath.Join(r.Path(), path))
+		if err != nil {
+			return err
+		}
+		item, err := newItem(info, f.Sha, path)
+		if err != nil {
+			return err
+		}
+		item.Mode = uint32(f.Mode)
+		idx.addItem(item)
+	}
+	return idx.Write()
+}
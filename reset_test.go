@@ -0,0 +1,67 @@
+package g
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReset(t *testing.T) {
+	r, dir := newTestRepository(t)
+	writeTestFile(t, dir, "a", "a\n")
+	writeTestFile(t, dir, "b", "b\n")
+	assertAddFiles(t, r, []string{"a", "b"})
+	first := assertCreateCommit(t, r, newTestCommit("first"))
+	writeTestFile(t, dir, "a", "a2\n")
+	writeTestFile(t, dir, "c", "c\n")
+	assertAddFiles(t, r, []string{"a", "c"})
+	second := assertCreateCommit(t, r, newTestCommit("second"))
+
+	// a soft reset only moves HEAD
+	e(r.Reset(first.AsHexString(), ResetSoft), t)
+	assertCurrentCommit(t, r, first)
+	assertStatus(t, r, map[string]IndexStatus{"a": UpdatedInIndex, "b": NotUpdated, "c": AddedInIndex}, nil)
+
+	// a mixed reset also resets the index
+	e(r.Reset("", ResetMixed), t)
+	assertStatus(t, r,
+		map[string]IndexStatus{"a": NotUpdated, "b": NotUpdated, "c": UntrackedInIndex},
+		map[string]WDStatus{"a": WorktreeChangedSinceIndex, "b": IndexAndWorkingTreeMatch, "c": Untracked},
+	)
+	orig, err := os.ReadFile(filepath.Join(r.GitPath(), DefaultOrigHeadFile))
+	e(err, t)
+	if string(orig) != first.AsHexString()+"\n" {
+		t.Errorf("expected ORIG_HEAD %s, got %s", first, orig)
+	}
+
+	// a path is reset in the index alone
+	e(r.Reset(second.AsHexString(), ResetSoft), t)
+	e(r.ResetPaths("HEAD~1", []string{"a"}), t)
+	assertCurrentCommit(t, r, second)
+	assertStatus(t, r,
+		map[string]IndexStatus{"a": UpdatedInIndex, "c": DeletedInIndex},
+		map[string]WDStatus{"a": WorktreeChangedSinceIndex, "c": Untracked},
+	)
+
+	// a hard reset also resets the working tree, removing the tracked files
+	// the commit does not have, and the directories they leave empty, and
+	// keeping untracked files
+	writeTestFile(t, dir, "d/e", "e\n")
+	assertAddFiles(t, r, []string{"c", "d/e"})
+	writeTestFile(t, dir, "b", "changed\n")
+	writeTestFile(t, dir, "u", "untracked\n")
+	e(r.Reset("HEAD~1", ResetHard), t)
+	assertCurrentCommit(t, r, first)
+	assertFileContent(t, dir, "a", "a\n")
+	assertFileContent(t, dir, "b", "b\n")
+	assertFileContent(t, dir, "u", "untracked\n")
+	for _, v := range []string{"c", "d"} {
+		if _, err := os.Stat(filepath.Join(dir, v)); err == nil {
+			t.Errorf("expected %s to be removed", v)
+		}
+	}
+	assertStatus(t, r,
+		map[string]IndexStatus{"a": NotUpdated, "b": NotUpdated},
+		map[string]WDStatus{"a": IndexAndWorkingTreeMatch, "b": IndexAndWorkingTreeMatch, "u": Untracked},
+	)
+}
@@ -8,53 +8,39 @@ import (
 
 // RestoreStaged removes a staged change from the index.
 // If the file is in the previous commit, removing it from the index means
-// updating the index to specify the commit sha. The timestamp for which would
-// be the same as when the files were originally switched to.
+// updating the index to specify the commit sha, without stat data so that
+// the working tree file is compared by content.
 //
 // If the file is not in a previous commit, removing it from the index means
 // simply removing it from the index.
-func RestoreStaged(path string) error {
-	status, err := CurrentStatus()
+func (r *Repository) RestoreStaged(path string) error {
+	status, err := r.CurrentStatus()
 	if err != nil {
 		return err
 	}
-	f, ok := status.idx[path]
-	if !ok {
+	if _, ok := status.idx[path]; !ok {
 		return fmt.Errorf("file %s not found in index", path)
 	}
-	idx, err := ReadIndex()
+	head, err := r.CurrentCommit()
 	if err != nil {
 		return err
 	}
-	if f.commit == nil {
-		// if the file is not commited at all, the correct behaviour of staged
-		// is to simply remove the file form the index such that it is no longer
-		// being tracked
-		if err := idx.Rm(path); err != nil {
-			return err
-		}
-		return idx.Write()
-	}
-
-	item, err := newItem(f.wd.Finfo, f.commit.Sha, f.path)
+	idx, err := r.ReadIndex()
 	if err != nil {
 		return err
 	}
-	// @todo how does git handle this specfically ?
-	item.MTimeS = item.MTimeS - 100
-	item.CTimeS = item.CTimeS - 100
-	if err := idx.upsertItem(item); err != nil {
+	if err := r.resetIndex(idx, head, []string{path}); err != nil {
 		return err
 	}
 	return idx.Write()
 }
 
-func Restore(path string, staged bool) error {
+func (r *Repository) Restore(path string, staged bool) error {
 	if staged {
-		return RestoreStaged(path)
+		return r.RestoreStaged(path)
 	}
 
-	currentStatus, err := CurrentStatus()
+	currentStatus, err := r.CurrentStatus()
 	if err != nil {
 		return err
 	}
@@ -66,6 +52,10 @@ func Restore(path string, staged bool) error {
 		return fmt.Errorf("error: pathspec '%s' did not match any fileStatus(s) known to git", path)
 	}
 
+	if fileStatus.IndexStatus() == UnmergedInIndex {
+		return fmt.Errorf("error: path '%s' is unmerged", path)
+	}
+
 	// if in index but not committed
 	if fileStatus.IndexStatus() == AddedInIndex && fileStatus.WorkingDirectoryStatus() != WorktreeChangedSinceIndex {
 		// there is nothing to do
@@ -73,10 +63,14 @@ func Restore(path string, staged bool) error {
 	}
 
 	// write the file
-	if err := writeObjectToWorkingTree(fileStatus.index.Sha, fileStatus.Path()); err != nil {
+	if err := r.writeObjectToWorkingTree(fileStatus.index.Sha, fileStatus.Path(), fileStatus.index.Mode); err != nil {
 		return err
 	}
 
+	if fileStatus.index.Mode == ModeSymlink {
+		// Chtimes would follow the link
+		return nil
+	}
 	// update modification time to match index
-	return os.Chtimes(filepath.Join(Path(), path), fileStatus.index.Finfo.ModTime(), fileStatus.index.Finfo.ModTime())
+	return os.Chtimes(filepath.Join(r.Path(), path), fileStatus.index.Finfo.ModTime(), fileStatus.index.Finfo.ModTime())
 }
@@ -0,0 +1,572 @@
+package g
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// minimumAbbreviatedShaLength is the shortest hex prefix accepted as an
+// abbreviated Sha
+const minimumAbbreviatedShaLength = 4
+
+type (
+	// AmbiguousShaError is returned when an abbreviated Sha matches more than
+	// one object.
+	AmbiguousShaError struct {
+		Prefix     string
+		Candidates []Sha
+	}
+	// RevisionRange is the set of commits described by a range expression
+	// such as A..B, as the commits to include and those whose ancestors are
+	// excluded.
+	RevisionRange struct {
+		Include []Sha
+		Exclude []Sha
+	}
+	// revisionOp is a suffix operation applied to a revision such as ~2 or
+	// ^{tree}
+	revisionOp struct {
+		op  byte // one of '^', '~', '{' for ^{...} and '@' for @{...}
+		n   int
+		arg string
+	}
+)
+
+func (e *AmbiguousShaError) Error() string {
+	return fmt.Sprintf("error: short object ID %s is ambiguous", e.Prefix)
+}
+
+// unknownRevisionError is the error for a revision that cannot be resolved.
+func unknownRevisionError(rev string) error {
+	return fmt.Errorf("fatal: ambiguous argument '%s': unknown revision or path not in the working tree", rev)
+}
+
+// ResolveRevision resolves a single revision expression, following the rules
+// of gitrevisions(7), to a Sha. Supported forms are full and abbreviated
+// Shas, ref names, @, @{-n}, suffixes ^, ^n, ~, ~n, ^{type}, ^{}, ^{/regex}
+// and <rev>:<path>.
+func (r *Repository) ResolveRevision(rev string) (Sha, error) {
+	if rev == "" {
+		return Sha{}, unknownRevisionError(rev)
+	}
+	if i := revisionPathSeparator(rev); i >= 0 {
+		return r.resolveRevisionPath(rev[:i], rev[i+1:])
+	}
+	base, ops, err := parseRevision(rev)
+	if err != nil {
+		return Sha{}, err
+	}
+	sha, ops, err := r.resolveRevisionBase(rev, base, ops)
+	if err != nil {
+		return Sha{}, err
+	}
+	for _, op := range ops {
+		if sha, err = r.applyRevisionOp(rev, sha, op); err != nil {
+			return Sha{}, err
+		}
+	}
+	return sha, nil
+}
+
+// ResolveRange resolves a revision expression that may describe a range:
+// A..B, A...B, ^A, rev^@ and rev^!. A single revision is returned as the only
+// included commit.
+func (r *Repository) ResolveRange(rev string) (*RevisionRange, error) {
+	rr := &RevisionRange{}
+	if from, to, ok := strings.Cut(rev, "..."); ok {
+		// the symmetric difference excludes the merge bases of both sides
+		if from == "" {
+			from = "HEAD"
+		}
+		if to == "" {
+			to = "HEAD"
+		}
+		for _, v := range []string{from, to} {
+			sha, err := r.ResolveRevision(v)
+			if err != nil {
+				return nil, err
+			}
+			rr.Include = append(rr.Include, sha)
+		}
+		bases, err := r.MergeBase(rr.Include[0], rr.Include[1])
+		if err != nil {
+			return nil, err
+		}
+		rr.Exclude = append(rr.Exclude, bases...)
+		return rr, nil
+	}
+	if from, to, ok := strings.Cut(rev, ".."); ok {
+		if from == "" {
+			from = "HEAD"
+		}
+		if to == "" {
+			to = "HEAD"
+		}
+		exclude, err := r.ResolveRevision(from)
+		if err != nil {
+			return nil, err
+		}
+		include, err := r.ResolveRevision(to)
+		if err != nil {
+			return nil, err
+		}
+		rr.Include = append(rr.Include, include)
+		rr.Exclude = append(rr.Exclude, exclude)
+		return rr, nil
+	}
+	if exclude, ok := strings.CutPrefix(rev, "^"); ok {
+		sha, err := r.ResolveRevision(exclude)
+		if err != nil {
+			return nil, err
+		}
+		rr.Exclude = append(rr.Exclude, sha)
+		return rr, nil
+	}
+	if base, ok := strings.CutSuffix(rev, "^@"); ok {
+		commit, err := r.resolveRevisionCommit(base)
+		if err != nil {
+			return nil, err
+		}
+		rr.Include = append(rr.Include, commit.Parents...)
+		return rr, nil
+	}
+	if base, ok := strings.CutSuffix(rev, "^!"); ok {
+		commit, err := r.resolveRevisionCommit(base)
+		if err != nil {
+			return nil, err
+		}
+		rr.Include = append(rr.Include, commit.Sha)
+		rr.Exclude = append(rr.Exclude, commit.Parents...)
+		return rr, nil
+	}
+	sha, err := r.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	rr.Include = append(rr.Include, sha)
+	return rr, nil
+}
+
+func (r *Repository) resolveRevisionCommit(rev string) (*Commit, error) {
+	sha, err := r.ResolveRevision(rev)
+	if err != nil {
+		return nil, err
+	}
+	if sha, err = r.peelRevision(rev, sha, ObjectTypeCommit); err != nil {
+		return nil, err
+	}
+	return r.ReadCommit(sha)
+}
+
+// revisionPathSeparator returns the index of the : separating a revision
+// from a path, ignoring any : inside braces such as ^{/fix: bug}.
+func revisionPathSeparator(rev string) int {
+	depth := 0
+	for i, c := range rev {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ':':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// parseRevision splits a revision into the base name and the suffix
+// operations applied to it. Ref names can not contain ^, ~ or @{ so the base
+// ends at the first of them.
+func parseRevision(rev string) (string, []revisionOp, error) {
+	end := len(rev)
+	if i := strings.IndexAny(rev, "^~"); i >= 0 {
+		end = i
+	}
+	if i := strings.Index(rev, "@{"); i >= 0 && i < end {
+		end = i
+	}
+	base := rev[:end]
+	var ops []revisionOp
+	for i := end; i < len(rev); {
+		switch {
+		case strings.HasPrefix(rev[i:], "@{"), strings.HasPrefix(rev[i:], "^{"):
+			j := strings.IndexByte(rev[i:], '}')
+			if j < 0 {
+				return "", nil, unknownRevisionError(rev)
+			}
+			op := byte('@')
+			if rev[i] == '^' {
+				op = '{'
+			}
+			ops = append(ops, revisionOp{op: op, arg: rev[i+2 : i+j]})
+			i += j + 1
+		case rev[i] == '^' || rev[i] == '~':
+			j := i + 1
+			for j < len(rev) && rev[j] >= '0' && rev[j] <= '9' {
+				j++
+			}
+			n := 1
+			if j > i+1 {
+				var err error
+				if n, err = strconv.Atoi(rev[i+1 : j]); err != nil {
+					return "", nil, unknownRevisionError(rev)
+				}
+			}
+			ops = append(ops, revisionOp{op: rev[i], n: n})
+			i = j
+		default:
+			return "", nil, unknownRevisionError(rev)
+		}
+	}
+	return base, ops, nil
+}
+
+// resolveRevisionBase resolves the base name of a revision, returning the
+// operations that remain to be applied. A leading @{-n} is consumed as it
+// replaces the base.
+func (r *Repository) resolveRevisionBase(rev string, base string, ops []revisionOp) (Sha, []revisionOp, error) {
+	if base == "@" {
+		base = "HEAD"
+	}
+	if len(ops) > 0 && ops[0].op == '@' {
+		sha, err := r.resolveRevisionReflog(rev, base, ops[0].arg)
+		return sha, ops[1:], err
+	}
+	if base == "" {
+		return Sha{}, nil, unknownRevisionError(rev)
+	}
+	for _, op := range ops {
+		if op.op == '@' {
+			return Sha{}, nil, unknownRevisionError(rev)
+		}
+	}
+	sha, err := r.resolveRevisionName(rev, base)
+	return sha, ops, err
+}
+
+// resolveRevisionReflog resolves base@{arg}, where arg is either the number of
+// a reflog entry or a negative number of previous checkouts. An empty base is
+// the current branch, or HEAD when detached.
+func (r *Repository) resolveRevisionReflog(rev string, base string, arg string) (Sha, error) {
+	if n, ok := strings.CutPrefix(arg, "-"); ok {
+		i, err := strconv.Atoi(n)
+		if base != "" || err != nil || i < 1 {
+			return Sha{}, unknownRevisionError(rev)
+		}
+		name, err := r.previousCheckout(i)
+		if err != nil {
+			return Sha{}, err
+		}
+		return r.resolveRevisionName(rev, name)
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 0 {
+		return Sha{}, fmt.Errorf("fatal: reflog entries %s are not supported", rev)
+	}
+	if base == "" {
+		branch, err := r.CurrentBranch()
+		if err != nil {
+			return Sha{}, err
+		}
+		base = DefaultHeadFile
+		if branch != "" {
+			base = filepath.Join(DefaultRefsDirectory, DefaultRefsHeadsDirectory, branch)
+		}
+	}
+	ref, err := r.ReflogRef(base)
+	if err != nil {
+		return Sha{}, unknownRevisionError(rev)
+	}
+	return r.resolveReflogEntry(rev, ref, n)
+}
+
+// resolveRevisionName resolves a full Sha, ref name or abbreviated Sha. Ref
+// names are tried in the order described by gitrevisions(7) and take
+// precedence over abbreviated Shas.
+func (r *Repository) resolveRevisionName(rev string, name string) (Sha, error) {
+	if len(name) == 40 && isHex(name) {
+		return ShaFromHexString(name)
+	}
+	for _, ref := range []string{
+		name,
+		filepath.Join(DefaultRefsDirectory, name),
+		filepath.Join(DefaultRefsDirectory, DefaultRefsTagsDirectory, name),
+		filepath.Join(DefaultRefsDirectory, DefaultRefsHeadsDirectory, name),
+		filepath.Join(DefaultRefsDirectory, "remotes", name),
+		filepath.Join(DefaultRefsDirectory, "remotes", name, "HEAD"),
+	} {
+		// a name is only looked up directly in the git directory when it
+		// is a full ref name or all capitals, such as HEAD or ORIG_HEAD
+		if ref == name && !strings.HasPrefix(name, DefaultRefsDirectory+"/") && (strings.ToUpper(name) != name || strings.Contains(name, "/")) {
+			continue
+		}
+		sha, found, err := r.resolveRef(ref)
+		if err != nil {
+			return Sha{}, err
+		}
+		if found {
+			return sha, nil
+		}
+	}
+	if len(name) >= minimumAbbreviatedShaLength && isHex(name) {
+		return r.resolveAbbreviatedSha(strings.ToLower(name))
+	}
+	return Sha{}, unknownRevisionError(rev)
+}
+
+// resolveAbbreviatedSha finds the single object, loose or packed, whose Sha
+// starts with prefix.
+func (r *Repository) resolveAbbreviatedSha(prefix string) (Sha, error) {
+	candidates := make(map[string]Sha)
+	files, err := os.ReadDir(filepath.Join(r.ObjectPath(), prefix[:2]))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Sha{}, err
+	}
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), prefix[2:]) {
+			sha, err := ShaFromHexString(prefix[:2] + f.Name())
+			if err != nil {
+				continue
+			}
+			candidates[sha.AsHexString()] = sha
+		}
+	}
+	packed, err := r.findPrefixInPackfiles(prefix)
+	if err != nil {
+		return Sha{}, err
+	}
+	for _, sha := range packed {
+		candidates[sha.AsHexString()] = sha
+	}
+	switch len(candidates) {
+	case 0:
+		return Sha{}, unknownRevisionError(prefix)
+	case 1:
+		for _, sha := range candidates {
+			return sha, nil
+		}
+	}
+	e := &AmbiguousShaError{Prefix: prefix}
+	for _, sha := range candidates {
+		e.Candidates = append(e.Candidates, sha)
+	}
+	sort.Slice(e.Candidates, func(i, j int) bool {
+		return e.Candidates[i].AsHexString() < e.Candidates[j].AsHexString()
+	})
+	return Sha{}, e
+}
+
+func (r *Repository) applyRevisionOp(rev string, sha Sha, op revisionOp) (Sha, error) {
+	switch op.op {
+	case '^':
+		sha, err := r.peelRevision(rev, sha, ObjectTypeCommit)
+		if err != nil || op.n == 0 {
+			return sha, err
+		}
+		commit, err := r.ReadCommit(sha)
+		if err != nil {
+			return Sha{}, err
+		}
+		if op.n > len(commit.Parents) {
+			return Sha{}, unknownRevisionError(rev)
+		}
+		return commit.Parents[op.n-1], nil
+	case '~':
+		sha, err := r.peelRevision(rev, sha, ObjectTypeCommit)
+		if err != nil {
+			return Sha{}, err
+		}
+		for i := 0; i < op.n; i++ {
+			commit, err := r.ReadCommit(sha)
+			if err != nil {
+				return Sha{}, err
+			}
+			if len(commit.Parents) == 0 {
+				return Sha{}, unknownRevisionError(rev)
+			}
+			sha = commit.Parents[0]
+		}
+		return sha, nil
+	case '{':
+		switch op.arg {
+		case "":
+			return r.peelRevision(rev, sha, ObjectTypeInvalid)
+		case "object":
+			return sha, nil
+		case "commit":
+			return r.peelRevision(rev, sha, ObjectTypeCommit)
+		case "tree":
+			return r.peelRevision(rev, sha, ObjectTypeTree)
+		case "blob":
+			return r.peelRevision(rev, sha, ObjectTypeBlob)
+		case "tag":
+			return r.peelRevision(rev, sha, ObjectTypeTag)
+		}
+		if pattern, ok := strings.CutPrefix(op.arg, "/"); ok {
+			return r.searchCommitMessage(rev, sha, pattern)
+		}
+	}
+	return Sha{}, unknownRevisionError(rev)
+}
+
+// peelRevision dereferences tags, and commits to trees, until an object of
+// type typ is reached. With ObjectTypeInvalid tags are dereferenced until an
+// object that is not a tag is reached.
+func (r *Repository) peelRevision(rev string, sha Sha, typ objectType) (Sha, error) {
+	for {
+		obj, err := r.ReadObject(sha)
+		if err != nil {
+			return Sha{}, err
+		}
+		if obj == nil {
+			return Sha{}, unknownRevisionError(rev)
+		}
+		if obj.Typ == typ || (typ == ObjectTypeInvalid && obj.Typ != ObjectTypeTag) {
+			return sha, nil
+		}
+		switch {
+		case obj.Typ == ObjectTypeTag:
+			tag, err := readTag(obj)
+			if err != nil {
+				return Sha{}, err
+			}
+			sha = tag.Object
+		case obj.Typ == ObjectTypeCommit && typ == ObjectTypeTree:
+			commit, err := readCommit(obj)
+			if err != nil {
+				return Sha{}, err
+			}
+			sha = commit.Tree
+		default:
+			return Sha{}, fmt.Errorf("error: %s: expected %s type, but the object dereferences to %s type", rev, typ, obj.Typ)
+		}
+	}
+}
+
+// searchCommitMessage returns the youngest commit reachable from sha whose
+// message matches pattern.
+func (r *Repository) searchCommitMessage(rev string, sha Sha, pattern string) (Sha, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return Sha{}, err
+	}
+	sha, err = r.peelRevision(rev, sha, ObjectTypeCommit)
+	if err != nil {
+		return Sha{}, err
+	}
+	seen := map[string]bool{sha.AsHexString(): true}
+	queue := []*Commit{}
+	commit, err := r.ReadCommit(sha)
+	if err != nil {
+		return Sha{}, err
+	}
+	queue = append(queue, commit)
+	for len(queue) > 0 {
+		// visit the most recently committed first
+		sort.SliceStable(queue, func(i, j int) bool {
+			return queue[i].CommittedTime.After(queue[j].CommittedTime)
+		})
+		commit, queue = queue[0], queue[1:]
+		if re.Match(commit.Message) {
+			return commit.Sha, nil
+		}
+		for _, p := range commit.Parents {
+			if seen[p.AsHexString()] {
+				continue
+			}
+			seen[p.AsHexString()] = true
+			parent, err := r.ReadCommit(p)
+			if err != nil {
+				return Sha{}, err
+			}
+			queue = append(queue, parent)
+		}
+	}
+	return Sha{}, unknownRevisionError(rev)
+}
+
+// resolveRevisionPath resolves <rev>:<path> to the blob or tree at path in
+// the tree of rev. When rev is empty, :<path> and :<n>:<path> name the blob in
+// the index at stage n.
+func (r *Repository) resolveRevisionPath(rev string, path string) (Sha, error) {
+	if rev == "" {
+		return r.resolveIndexPath(path)
+	}
+	sha, err := r.ResolveRevision(rev)
+	if err != nil {
+		return Sha{}, err
+	}
+	if sha, err = r.peelRevision(rev, sha, ObjectTypeTree); err != nil {
+		return Sha{}, err
+	}
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return sha, nil
+	}
+	for _, name := range strings.Split(path, "/") {
+		obj, err := r.ReadObject(sha)
+		if err != nil {
+			return Sha{}, err
+		}
+		if obj == nil || obj.Typ != ObjectTypeTree {
+			return Sha{}, fmt.Errorf("fatal: path '%s' does not exist in '%s'", path, rev)
+		}
+		tree, err := ReadTree(obj)
+		if err != nil {
+			return Sha{}, err
+		}
+		found := false
+		for _, item := range tree.Items {
+			if item.Path == name {
+				if sha, err = NewSha(item.Sha); err != nil {
+					return Sha{}, err
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			return Sha{}, fmt.Errorf("fatal: path '%s' does not exist in '%s'", path, rev)
+		}
+	}
+	return sha, nil
+}
+
+func (r *Repository) resolveIndexPath(path string) (Sha, error) {
+	stage := 0
+	if len(path) > 2 && path[1] == ':' && path[0] >= '0' && path[0] <= '3' {
+		stage = int(path[0] - '0')
+		path = path[2:]
+	}
+	if strings.HasPrefix(path, "/") {
+		return Sha{}, fmt.Errorf("fatal: searching commit messages with :%s is not supported", path)
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return Sha{}, err
+	}
+	for _, item := range idx.items {
+		if string(item.Name) == path && item.stage() == stage {
+			return NewSha(item.Sha[:])
+		}
+	}
+	return Sha{}, fmt.Errorf("fatal: path '%s' does not exist (neither on disk nor in the index)", path)
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') && (c < 'A' || c > 'F') {
+			return false
+		}
+	}
+	return true
+}
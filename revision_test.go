@@ -0,0 +1,189 @@
+package g
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestResolveRevision(t *testing.T) {
+	r, err := Open("./test_assets/repo/test-delta-ofs", WithGitDirectory(".gitg"))
+	e(err, t)
+	tests := []struct {
+		rev  string
+		want string
+	}{
+		{"HEAD", "d25650d7e43226b49a2ccb27eb0ee6b76771fff3"},
+		{"@", "d25650d7e43226b49a2ccb27eb0ee6b76771fff3"},
+		{"main", "d25650d7e43226b49a2ccb27eb0ee6b76771fff3"},
+		{"refs/heads/main", "d25650d7e43226b49a2ccb27eb0ee6b76771fff3"},
+		{"d256", "d25650d7e43226b49a2ccb27eb0ee6b76771fff3"},
+		{"d25650d7e43226b49a2ccb27eb0ee6b76771fff3", "d25650d7e43226b49a2ccb27eb0ee6b76771fff3"},
+		{"HEAD^", "5a8ef5b3cb8632a84b4045989513d22317b99698"},
+		{"HEAD^1", "5a8ef5b3cb8632a84b4045989513d22317b99698"},
+		{"HEAD~", "5a8ef5b3cb8632a84b4045989513d22317b99698"},
+		{"HEAD~5", "ff4b7dca3de76d0a44ccd73052be08c0d9f82677"},
+		{"main~2^", "82ba613f9c084daceb7213e3ebd9e0e082174baa"},
+		{"HEAD^^~1", "82ba613f9c084daceb7213e3ebd9e0e082174baa"},
+		{"HEAD^0", "d25650d7e43226b49a2ccb27eb0ee6b76771fff3"},
+		{"HEAD^{commit}", "d25650d7e43226b49a2ccb27eb0ee6b76771fff3"},
+		{"HEAD^{tree}", "df4586db680b2bb38227e0ee3e234e7d6993aa3f"},
+		{"HEAD^{}", "d25650d7e43226b49a2ccb27eb0ee6b76771fff3"},
+		{"HEAD^{/commit 3}", "82ba613f9c084daceb7213e3ebd9e0e082174baa"},
+		{"HEAD:", "df4586db680b2bb38227e0ee3e234e7d6993aa3f"},
+		{"HEAD:b.txt", "b94085aa2c4c040c961131564265374f10a5ca91"},
+		{"HEAD~2:a.txt", "f8a7224483a7306ba7eb3d68335d6f2c2897ab9c"},
+		{":a.txt", "0e882d8052082973d523d564c8dbb71a816a455b"},
+		{":0:a.txt", "0e882d8052082973d523d564c8dbb71a816a455b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rev, func(t *testing.T) {
+			sha, err := r.ResolveRevision(tt.rev)
+			e(err, t)
+			if sha.AsHexString() != tt.want {
+				t.Errorf("r.ResolveRevision(%q) = %s, want %s", tt.rev, sha.AsHexString(), tt.want)
+			}
+		})
+	}
+	for _, rev := range []string{"HEAD~6", "HEAD^2", "missing", "HEAD:missing", "HEAD^{blob}", "HEAD^{/no such commit}", "d25", "zzzz"} {
+		if _, err := r.ResolveRevision(rev); err == nil {
+			t.Errorf("r.ResolveRevision(%q) expected an error", rev)
+		}
+	}
+}
+
+func TestResolveRange(t *testing.T) {
+	r, err := Open("./test_assets/repo/test-delta-ofs", WithGitDirectory(".gitg"))
+	e(err, t)
+	tests := []struct {
+		rev     string
+		include []string
+		exclude []string
+	}{
+		{"HEAD", []string{"d25650d7e43226b49a2ccb27eb0ee6b76771fff3"}, nil},
+		{"HEAD~3..main", []string{"d25650d7e43226b49a2ccb27eb0ee6b76771fff3"}, []string{"82ba613f9c084daceb7213e3ebd9e0e082174baa"}},
+		{"HEAD~5..", []string{"d25650d7e43226b49a2ccb27eb0ee6b76771fff3"}, []string{"ff4b7dca3de76d0a44ccd73052be08c0d9f82677"}},
+		{"HEAD~3...main", []string{"82ba613f9c084daceb7213e3ebd9e0e082174baa", "d25650d7e43226b49a2ccb27eb0ee6b76771fff3"}, []string{"82ba613f9c084daceb7213e3ebd9e0e082174baa"}},
+		{"^HEAD~1", nil, []string{"5a8ef5b3cb8632a84b4045989513d22317b99698"}},
+		{"HEAD^@", []string{"5a8ef5b3cb8632a84b4045989513d22317b99698"}, nil},
+		{"HEAD^!", []string{"d25650d7e43226b49a2ccb27eb0ee6b76771fff3"}, []string{"5a8ef5b3cb8632a84b4045989513d22317b99698"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rev, func(t *testing.T) {
+			rr, err := r.ResolveRange(tt.rev)
+			e(err, t)
+			var include, exclude []string
+			for _, v := range rr.Include {
+				include = append(include, v.AsHexString())
+			}
+			for _, v := range rr.Exclude {
+				exclude = append(exclude, v.AsHexString())
+			}
+			if !reflect.DeepEqual(include, tt.include) {
+				t.Errorf("include = %v, want %v", include, tt.include)
+			}
+			if !reflect.DeepEqual(exclude, tt.exclude) {
+				t.Errorf("exclude = %v, want %v", exclude, tt.exclude)
+			}
+		})
+	}
+}
+
+func TestResolveRevision_tags(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Init(dir, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+	e(os.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644), t)
+	assertAddFiles(t, r, []string{"a"})
+	commitSha := assertCreateCommit(t, r, &Commit{
+		Author:        "tester <tester@test.com>",
+		AuthoredTime:  time.Now(),
+		Committer:     "tester <tester@test.com>",
+		CommittedTime: time.Now(),
+		Message:       []byte("tagged commit"),
+	})
+	e(r.CreateTag("v1", commitSha, &Tag{
+		Tagger:      "tagger",
+		TaggerEmail: "tagger@test.com",
+		TaggedTime:  time.Now(),
+		Message:     []byte("version 1"),
+	}), t)
+	tagSha, err := r.TagSHA("v1")
+	e(err, t)
+
+	for rev, want := range map[string]Sha{
+		"v1":             tagSha,
+		"tags/v1":        tagSha,
+		"v1^{tag}":       tagSha,
+		"v1^{}":          commitSha,
+		"v1^{commit}":    commitSha,
+		"v1^0":           commitSha,
+		"refs/tags/v1~0": commitSha,
+	} {
+		sha, err := r.ResolveRevision(rev)
+		e(err, t)
+		if sha != want {
+			t.Errorf("r.ResolveRevision(%q) = %s, want %s", rev, sha.AsHexString(), want.AsHexString())
+		}
+	}
+}
+
+func TestResolveRevision_ambiguous(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Init(dir, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+	// write enough blobs that some share a four character prefix, packing
+	// half of them so that candidates are found in both places
+	var packed []Sha
+	byPrefix := make(map[string][]string)
+	for i := 0; i < 1000; i++ {
+		content := fmt.Sprintf("blob %d", i)
+		header := []byte(fmt.Sprintf("blob %d%s", len(content), string(byte(0))))
+		sha, err := WriteObject(header, []byte(content), "", r.ObjectPath())
+		e(err, t)
+		if i%2 == 0 {
+			packed = append(packed, sha)
+		}
+		byPrefix[sha.AsHexString()[:4]] = append(byPrefix[sha.AsHexString()[:4]], sha.AsHexString())
+	}
+	_, err = r.WritePack(packed, false)
+	e(err, t)
+	e(r.PruneLooseObjects(packed), t)
+
+	var prefix string
+	for k, v := range byPrefix {
+		if len(v) > 1 && (prefix == "" || k < prefix) {
+			prefix = k
+		}
+	}
+	if prefix == "" {
+		t.Fatal("expected blobs sharing a prefix")
+	}
+	_, err = r.ResolveRevision(prefix)
+	var ambiguous *AmbiguousShaError
+	if !errors.As(err, &ambiguous) {
+		t.Fatalf("expected AmbiguousShaError, got %v", err)
+	}
+	want := byPrefix[prefix]
+	sort.Strings(want)
+	var got []string
+	for _, v := range ambiguous.Candidates {
+		got = append(got, v.AsHexString())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("candidates = %v, want %v", got, want)
+	}
+	// the full names remain resolvable whether packed or loose
+	for _, v := range want {
+		sha, err := r.ResolveRevision(v[:12])
+		e(err, t)
+		if sha.AsHexString() != v {
+			t.Errorf("r.ResolveRevision(%q) = %s", v[:12], sha.AsHexString())
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package g
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// RmOptions are the options of Rm
+type RmOptions struct {
+	// Cached removes the files from the index only, keeping them in the
+	// working tree
+	Cached bool
+
+	// Recursive allows a pathspec naming a directory to remove the files
+	// inside it
+	Recursive bool
+
+	// Force skips the checks that the files removed have no changes that
+	// would be lost
+	Force bool
+}
+
+// Rm removes the files of the index matching pathspecs, resolved by
+// Pathspec, from the index and, unless opts.Cached, from the working tree,
+// returning the paths removed. As git rm does, Rm refuses to remove a file
+// whose staged or unstaged changes would be lost unless opts.Force.
+func (r *Repository) Rm(pathspecs []string, opts RmOptions) ([]string, error) {
+	status, err := r.CurrentStatus()
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	seen := make(map[string]bool)
+	for _, p := range pathspecs {
+		matched, recursive := false, false
+		for _, v := range status.Files() {
+			if (v.index == nil && v.Unmerged() == 0) || !MatchPathspec(v.path, []string{p}) {
+				continue
+			}
+			matched = true
+			if v.path != p {
+				recursive = true
+			}
+			if !seen[v.path] {
+				seen[v.path] = true
+				paths = append(paths, v.path)
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("fatal: pathspec '%s' did not match any files", p)
+		}
+		if recursive && !opts.Recursive {
+			return nil, fmt.Errorf("fatal: not removing '%s' recursively without -r", p)
+		}
+	}
+	// paths are removed in the order of the index
+	slices.Sort(paths)
+	if !opts.Force {
+		if err := checkRm(status, paths, opts.Cached); err != nil {
+			return nil, err
+		}
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		if err := idx.Rm(p); err != nil {
+			return nil, err
+		}
+	}
+	if !opts.Cached {
+		for _, p := range paths {
+			if f, _ := status.Contains(p); f.wd == nil || f.wd.Mode == ModeGitlink {
+				// a file already deleted has nothing to remove, and the
+				// repository of a submodule is left in place
+				continue
+			}
+			if err := os.Remove(filepath.Join(r.Path(), p)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+			r.removeEmptyDirectories(p)
+		}
+	}
+	return paths, idx.Write()
+}
+
+// checkRm returns an error listing the files of paths that have changes rm
+// would lose: staged changes that differ from both HEAD and the working
+// tree, and, unless only the index is changed, any staged change or
+// modification in the working tree. Files left in conflict and files
+// already deleted from the working tree can always be removed.
+func checkRm(status *FfileSet, paths []string, cached bool) error {
+	var staged, changed, modified []string
+	for _, p := range paths {
+		f, _ := status.Contains(p)
+		if f.index == nil || f.wd == nil {
+			continue
+		}
+		stagedChanges := !sameFile(f.index, f.commit)
+		localChanges := f.wdStatus != IndexAndWorkingTreeMatch
+		switch {
+		case stagedChanges && localChanges:
+			staged = append(staged, p)
+		case cached:
+		case stagedChanges:
+			changed = append(changed, p)
+		case localChanges:
+			modified = append(modified, p)
+		}
+	}
+	var msgs []string
+	for _, v := range []struct {
+		paths            []string
+		one, many, usage string
+	}{
+		{
+			staged,
+			"the following file has staged content different from both the\nfile and the HEAD:",
+			"the following files have staged content different from both the\nfile and the HEAD:",
+			"(use -f to force removal)",
+		},
+		{
+			changed,
+			"the following file has changes staged in the index:",
+			"the following files have changes staged in the index:",
+			"(use --cached to keep the file, or -f to force removal)",
+		},
+		{
+			modified,
+			"the following file has local modifications:",
+			"the following files have local modifications:",
+			"(use --cached to keep the file, or -f to force removal)",
+		},
+	} {
+		if len(v.paths) == 0 {
+			continue
+		}
+		heading := v.one
+		if len(v.paths) > 1 {
+			heading = v.many
+		}
+		msgs = append(msgs, fmt.Sprintf("error: %s\n    %s\n%s", heading, strings.Join(v.paths, "\n    "), v.usage))
+	}
+	if len(msgs) > 0 {
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+	return nil
+}
+
+// removeEmptyDirectories removes the directories of the working tree that
+// path was in and that are left empty once it has been removed
+func (r *Repository) removeEmptyDirectories(path string) {
+	for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+		if err := os.Remove(filepath.Join(r.Path(), dir)); err != nil {
+			return
+		}
+	}
+}
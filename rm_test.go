@@ -0,0 +1,61 @@
+package g
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestRm(t *testing.T) {
+	r, dir := newTestRepository(t)
+	writeTestFile(t, dir, "a", "a\n")
+	writeTestFile(t, dir, "b", "b\n")
+	writeTestFile(t, dir, "d/c", "c\n")
+	assertAddFiles(t, r, []string{"a", "b", "d/c"})
+	assertCreateCommit(t, r, newTestCommit("first"))
+
+	// a file with changes that would be lost is kept unless forced
+	writeTestFile(t, dir, "a", "staged\n")
+	assertAddFiles(t, r, []string{"a"})
+	writeTestFile(t, dir, "a", "modified\n")
+	writeTestFile(t, dir, "b", "modified\n")
+	for _, tt := range []struct {
+		paths []string
+		opts  RmOptions
+	}{
+		{[]string{"a"}, RmOptions{}},
+		{[]string{"a"}, RmOptions{Cached: true}},
+		{[]string{"b"}, RmOptions{}},
+		{[]string{"d"}, RmOptions{}},
+		{[]string{"missing"}, RmOptions{}},
+	} {
+		if _, err := r.Rm(tt.paths, tt.opts); err == nil {
+			t.Errorf("expected rm %v with %+v to be refused", tt.paths, tt.opts)
+		}
+	}
+
+	// a modified file is removed from the index alone
+	paths, err := r.Rm([]string{"b"}, RmOptions{Cached: true})
+	e(err, t)
+	if !slices.Equal(paths, []string{"b"}) {
+		t.Errorf("expected b to be removed, got %v", paths)
+	}
+	assertFileContent(t, dir, "b", "modified\n")
+
+	// a directory is removed recursively, along with the directory itself
+	paths, err = r.Rm([]string{"d", "a"}, RmOptions{Recursive: true, Force: true})
+	e(err, t)
+	if !slices.Equal(paths, []string{"a", "d/c"}) {
+		t.Errorf("expected a and d/c to be removed, got %v", paths)
+	}
+	for _, v := range []string{"a", "d"} {
+		if _, err := os.Stat(filepath.Join(dir, v)); err == nil {
+			t.Errorf("expected %s to be removed", v)
+		}
+	}
+	assertStatus(t, r,
+		map[string]IndexStatus{"a": DeletedInIndex, "b": DeletedInIndex, "d/c": DeletedInIndex},
+		map[string]WDStatus{"b": Untracked},
+	)
+}
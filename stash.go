@@ -0,0 +1,276 @@
+package g
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/richardjennings/g/diff"
+	"sort"
+	"strings"
+)
+
+// StashPush saves the changes of the index and of the tracked files in the
+// working tree as a stash entry, then resets both to HEAD, as git stash push
+// does. Untracked files are left alone. commit provides the author,
+// committer and message of the entry, which is described by HEAD when the
+// message is empty.
+//
+// The entry is a commit of the working tree whose parents are HEAD and a
+// commit of the index, the layout git uses, recorded by refs/stash and its
+// reflog. An unset Sha is returned when there are no local changes to save.
+func (r *Repository) StashPush(commit *Commit) (Sha, error) {
+	head, err := r.CurrentCommit()
+	if err != nil {
+		return Sha{}, err
+	}
+	if !head.IsSet() {
+		return Sha{}, errors.New("You do not have the initial commit yet")
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return Sha{}, err
+	}
+	if unmerged := idx.Unmerged(); len(unmerged) > 0 {
+		return Sha{}, fmt.Errorf("%s: needs merge", strings.Join(unmerged, ": needs merge\n"))
+	}
+	status, err := r.Status(idx, head)
+	if err != nil {
+		return Sha{}, err
+	}
+	changed := false
+	worktree := make(map[string]*fileInfo)
+	for _, v := range status.Files() {
+		if v.idxStatus != NotUpdated && v.idxStatus != UntrackedInIndex {
+			changed = true
+		}
+		if v.index == nil {
+			continue
+		}
+		switch v.wdStatus {
+		case IndexAndWorkingTreeMatch:
+			worktree[v.path] = v.index
+		case DeletedInWorktree:
+			changed = true
+		default:
+			changed = true
+			if v.wd.Mode == ModeGitlink {
+				// the commit checked out in a submodule is not saved
+				worktree[v.path] = v.index
+				continue
+			}
+			o, err := r.WriteBlob(v.path)
+			if err != nil {
+				return Sha{}, err
+			}
+			worktree[v.path] = &fileInfo{Sha: o.Sha, Mode: o.Mode}
+		}
+	}
+	if !changed {
+		return Sha{}, nil
+	}
+
+	branch, err := r.CurrentBranch()
+	if err != nil {
+		return Sha{}, err
+	}
+	if branch == "" {
+		branch = "(no branch)"
+	}
+	c, err := r.ReadCommit(head)
+	if err != nil {
+		return Sha{}, err
+	}
+	subject, _, _ := bytes.Cut(bytes.TrimSpace(c.Message), []byte("\n"))
+	described := fmt.Sprintf("%s: %s %s", branch, head.AsHexString()[:7], subject)
+
+	tree, err := r.WriteTree(r.ObjectTree(idx.Files()))
+	if err != nil {
+		return Sha{}, err
+	}
+	index, err := r.writeCommitObject(&Commit{
+		Tree:          tree,
+		Parents:       []Sha{head},
+		Author:        commit.Author,
+		AuthoredTime:  commit.AuthoredTime,
+		Committer:     commit.Committer,
+		CommittedTime: commit.CommittedTime,
+		Message:       []byte("index on " + described),
+	})
+	if err != nil {
+		return Sha{}, err
+	}
+	if tree, err = r.writeFilesTree(worktree); err != nil {
+		return Sha{}, err
+	}
+	message := "WIP on " + described
+	if len(commit.Message) > 0 {
+		message = fmt.Sprintf("On %s: %s", branch, commit.Message)
+	}
+	commit.Tree = tree
+	commit.Parents = []Sha{head, index}
+	commit.Message = []byte(message)
+	sha, err := r.writeCommitObject(commit)
+	if err != nil {
+		return Sha{}, err
+	}
+	tx := r.NewRefTransaction()
+	tx.Update(DefaultStashRef, sha, Sha{}, message)
+	if err := tx.Commit(); err != nil {
+		return Sha{}, err
+	}
+	return sha, r.resetWorktree(head)
+}
+
+// StashCommit returns the commit of the stash entry stash@{n}
+func (r *Repository) StashCommit(n int) (Sha, error) {
+	entries, err := r.ReadReflog(DefaultStashRef)
+	if err != nil {
+		return Sha{}, err
+	}
+	if len(entries) == 0 {
+		return Sha{}, errors.New("No stash entries found.")
+	}
+	if n < 0 || n >= len(entries) {
+		return Sha{}, fmt.Errorf("fatal: log for 'stash' only has %d entries", len(entries))
+	}
+	return entries[n].New, nil
+}
+
+// StashApply applies the changes saved by the stash entry stash@{n} to the
+// working tree, merging them with the tree of the index using the commit the
+// entry was saved on as the merge base. Files the entry added are added to
+// the index. When restoreIndex is true the changes saved from the index are
+// also applied to the index, which fails if they conflict. The content of
+// files is merged with the Algorithm and Style of opts.
+//
+// Conflicts are written as Merge writes them, leaving the index as merged.
+// Nothing is changed when applying would overwrite local changes.
+func (r *Repository) StashApply(n int, restoreIndex bool, opts MergeOptions) (*MergeResult, error) {
+	sha, err := r.StashCommit(n)
+	if err != nil {
+		return nil, err
+	}
+	c, err := r.ReadCommit(sha)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.Parents) < 2 {
+		return nil, fmt.Errorf("error: '%s' is not a stash-like commit", sha)
+	}
+	idx, err := r.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	if len(idx.Unmerged()) > 0 {
+		return nil, errors.New("error: cannot apply a stash in the middle of a merge")
+	}
+	head, err := r.CurrentCommit()
+	if err != nil {
+		return nil, err
+	}
+	status, err := r.Status(idx, head)
+	if err != nil {
+		return nil, err
+	}
+	base, err := r.treeFiles(c.Parents[0])
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := r.treeFiles(sha)
+	if err != nil {
+		return nil, err
+	}
+	ours := make(map[string]*fileInfo)
+	for _, v := range idx.Files() {
+		ours[v.path] = v.index
+	}
+	labels := diff.MergeOptions{Algorithm: opts.Algorithm, Style: opts.Style, Ours: "Updated upstream", Base: "Stash base", Theirs: "Stashed changes"}
+
+	// the index the entry is applied to, with the changes of the saved index
+	// when they are restored
+	files := ours
+	if restoreIndex {
+		staged, err := r.treeFiles(c.Parents[1])
+		if err != nil {
+			return nil, err
+		}
+		merged, err := r.mergeFiles(base, ours, staged, labels, false)
+		if err != nil {
+			return nil, err
+		}
+		files = make(map[string]*fileInfo)
+		for _, m := range merged {
+			if m.conflict {
+				return nil, errors.New("error: Conflicts in index. Try without --index.")
+			}
+			if m.result != nil {
+				files[m.path] = m.result
+			}
+		}
+	}
+
+	merged, err := r.mergeFiles(base, ours, theirs, labels, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkMerged(status, merged); err != nil {
+		return nil, err
+	}
+	result, err := r.writeMerged(idx, merged)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Conflicts) == 0 {
+		if !restoreIndex {
+			for _, m := range merged {
+				if m.ours == nil && m.result != nil {
+					files[m.path] = m.result
+				}
+			}
+		}
+		if err := resetIndexFiles(idx, files, nil); err != nil {
+			return nil, err
+		}
+	}
+	return result, idx.Write()
+}
+
+// StashDrop removes the stash entry stash@{n}, returning its commit. When the
+// most recent entry is removed refs/stash is moved to the next, and it is
+// deleted with the last.
+func (r *Repository) StashDrop(n int) (Sha, error) {
+	sha, err := r.StashCommit(n)
+	if err != nil {
+		return Sha{}, err
+	}
+	entries, err := r.ReadReflog(DefaultStashRef)
+	if err != nil {
+		return Sha{}, err
+	}
+	tx := r.NewRefTransaction()
+	if len(entries) == 1 {
+		tx.Delete(DefaultStashRef, sha)
+		return sha, tx.Commit()
+	}
+	// refs/stash is moved before the reflog is rewritten, so that the
+	// entries are left as they are when it cannot be
+	if n == 0 {
+		tx.Update(DefaultStashRef, entries[1].New, sha, "")
+		if err := tx.Commit(); err != nil {
+			return Sha{}, err
+		}
+	}
+	return sha, r.deleteReflogEntry(DefaultStashRef, n)
+}
+
+// writeFilesTree writes the tree of files keyed by path to the object store
+func (r *Repository) writeFilesTree(files map[string]*fileInfo) (Sha, error) {
+	var list []*FileStatus
+	for path, f := range files {
+		list = append(list, &FileStatus{path: path, index: f})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].path < list[j].path
+	})
+	return r.WriteTree(r.ObjectTree(list))
+}
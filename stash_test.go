@@ -0,0 +1,148 @@
+package g
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestStash(t *testing.T) {
+	r, dir := newTestRepository(t)
+	writeTestFile(t, dir, "a", "a\n")
+	writeTestFile(t, dir, "b", "b\n")
+	assertAddFiles(t, r, []string{"a", "b"})
+	head := assertCreateCommit(t, r, newTestCommit("first"))
+
+	sha, err := r.StashPush(newTestCommit(""))
+	e(err, t)
+	if sha.IsSet() {
+		t.Errorf("expected no local changes to save, got %s", sha)
+	}
+
+	// the index and working tree are saved and reset to HEAD
+	writeTestFile(t, dir, "a", "staged\n")
+	writeTestFile(t, dir, "n", "n\n")
+	assertAddFiles(t, r, []string{"a", "n"})
+	writeTestFile(t, dir, "a", "modified\n")
+	writeTestFile(t, dir, "u", "untracked\n")
+	first, err := r.StashPush(newTestCommit(""))
+	e(err, t)
+	assertLookupCommit(t, r, first, func(t *testing.T, c *Commit) {
+		if len(c.Parents) != 2 || c.Parents[0] != head {
+			t.Errorf("expected HEAD and the index as parents, got %v", c.Parents)
+		}
+		if string(bytes.TrimSpace(c.Message)) != "WIP on main: "+head.AsHexString()[:7]+" first" {
+			t.Errorf("expected the entry to be described by HEAD, got %q", c.Message)
+		}
+	})
+	assertFileContent(t, dir, "a", "a\n")
+	assertFileContent(t, dir, "u", "untracked\n")
+	if _, err := os.Stat(filepath.Join(dir, "n")); err == nil {
+		t.Error("expected n to be removed")
+	}
+	assertStatus(t, r, map[string]IndexStatus{"a": NotUpdated, "b": NotUpdated}, map[string]WDStatus{"u": Untracked})
+
+	writeTestFile(t, dir, "b", "b2\n")
+	second, err := r.StashPush(newTestCommit("second"))
+	e(err, t)
+	entries, err := r.ReadReflog(DefaultStashRef)
+	e(err, t)
+	if len(entries) != 2 || entries[0].New != second || entries[1].New != first || entries[0].Message != "On main: second" {
+		t.Errorf("expected the reflog of refs/stash to hold both entries, got %+v", entries)
+	}
+
+	// the working tree is restored with the added files in the index
+	_, err = r.StashApply(1, false, MergeOptions{})
+	e(err, t)
+	assertFileContent(t, dir, "a", "modified\n")
+	assertStatus(t, r,
+		map[string]IndexStatus{"a": NotUpdated, "n": AddedInIndex},
+		map[string]WDStatus{"a": WorktreeChangedSinceIndex, "n": IndexAndWorkingTreeMatch},
+	)
+	e(r.Reset("", ResetHard), t)
+
+	// with the index
+	_, err = r.StashApply(1, true, MergeOptions{})
+	e(err, t)
+	assertStatus(t, r,
+		map[string]IndexStatus{"a": UpdatedInIndex, "n": AddedInIndex},
+		map[string]WDStatus{"a": WorktreeChangedSinceIndex},
+	)
+	e(r.Reset("", ResetHard), t)
+
+	// an entry is kept in the reflog when refs/stash cannot be moved
+	lock := filepath.Join(r.GitPath(), DefaultStashRef+lockFileSuffix)
+	e(os.WriteFile(lock, nil, 0644), t)
+	if _, err := r.StashDrop(0); err == nil {
+		t.Error("expected refs/stash to be locked")
+	}
+	e(os.Remove(lock), t)
+	if entries, err := r.ReadReflog(DefaultStashRef); err != nil || len(entries) != 2 {
+		t.Errorf("expected the reflog of refs/stash to be kept, got %d entries %v", len(entries), err)
+	}
+
+	// dropping the most recent entry moves refs/stash to the next
+	dropped, err := r.StashDrop(0)
+	e(err, t)
+	if dropped != second {
+		t.Errorf("expected %s to be dropped, got %s", second, dropped)
+	}
+	sha, err = r.ResolveRevision("stash")
+	e(err, t)
+	if sha != first {
+		t.Errorf("expected refs/stash to be %s, got %s", first, sha)
+	}
+	_, err = r.StashDrop(0)
+	e(err, t)
+	if _, err := r.StashCommit(0); err == nil {
+		t.Error("expected no stash entries")
+	}
+	if refs, err := r.listRefs(DefaultRefsDirectory); err != nil || slices.Contains(refs, DefaultStashRef) {
+		t.Errorf("expected refs/stash to be deleted, got %v %v", refs, err)
+	}
+}
+
+func TestStashGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	r, dir := newTestRepository(t)
+	writeTestFile(t, dir, "a", "a\n")
+	writeTestFile(t, dir, "b", "b\n")
+	assertAddFiles(t, r, []string{"a", "b"})
+	assertCreateCommit(t, r, newTestCommit("first"))
+	writeTestFile(t, dir, "a", "staged\n")
+	writeTestFile(t, dir, "n", "n\n")
+	assertAddFiles(t, r, []string{"a", "n"})
+	writeTestFile(t, dir, "b", "modified\n")
+	_, err := r.StashPush(newTestCommit("saved"))
+	e(err, t)
+
+	// git lists, shows and applies the entry as one of its own
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s: %s %s", strings.Join(args, " "), err, out)
+		}
+		return string(out)
+	}
+	if out := git("stash", "list"); out != "stash@{0}: On main: saved\n" {
+		t.Errorf("expected git to list the entry, got %q", out)
+	}
+	if out := git("stash", "show", "--name-status"); out != "M\ta\nM\tb\nA\tn\n" {
+		t.Errorf("expected git to show the changes of the entry, got %q", out)
+	}
+	git("stash", "apply", "--index")
+	assertFileContent(t, dir, "a", "staged\n")
+	assertFileContent(t, dir, "b", "modified\n")
+	if out := git("status", "--porcelain"); out != "M  a\n M b\nA  n\n" {
+		t.Errorf("expected git to restore the index and working tree, got %q", out)
+	}
+}
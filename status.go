@@ -1,28 +1,28 @@
 package g
 
-func CurrentStatus() (*FfileSet, error) {
+func (r *Repository) CurrentStatus() (*FfileSet, error) {
 	// index
-	idx, err := ReadIndex()
+	idx, err := r.ReadIndex()
 	if err != nil {
 		return nil, err
 	}
 
-	commitSha, err := CurrentCommit()
+	commitSha, err := r.CurrentCommit()
 	if err != nil {
 		return nil, err
 	}
-	return Status(idx, commitSha)
+	return r.Status(idx, commitSha)
 }
 
 // Status returns a FfileSet containing all files from commit, index and working directory
 // with the corresponding status.
-func Status(idx *Index, commitSha Sha) (*FfileSet, error) {
+func (r *Repository) Status(idx *Index, commitSha Sha) (*FfileSet, error) {
 	var commitFiles, indexFiles, wtFiles []*FileStatus
 	var err error
 
 	// set commit files
 	if commitSha.IsSet() {
-		commitFiles, err = CommittedFiles(commitSha)
+		commitFiles, err = r.CommittedFiles(commitSha)
 		if err != nil {
 			return nil, err
 		}
@@ -31,10 +31,58 @@ func Status(idx *Index, commitSha Sha) (*FfileSet, error) {
 	indexFiles = idx.Files()
 
 	// set working tree files
-	wtFiles, err = Ls(Path())
+	wtFiles, err = r.Ls(r.Path())
 	if err != nil {
 		return nil, err
 	}
 
-	return NewFfileSet(commitFiles, indexFiles, wtFiles)
+	return newFfileSet(commitFiles, indexFiles, wtFiles, r.worktreeStatus(idx))
+}
+
+// DetectRenames marks the files of files added to the index that were
+// renamed or copied from a file of the commit, as git status reports them,
+// with pairs found as opts asks. A file renamed from is no longer in the
+// set unless it is untracked in the working tree.
+func (r *Repository) DetectRenames(files *FfileSet, opts DiffOptions) error {
+	old := make(map[string]*fileInfo)
+	new := make(map[string]*fileInfo)
+	for _, v := range files.Files() {
+		if v.Unmerged() != 0 {
+			// a file in conflict is neither renamed nor a source of one
+			continue
+		}
+		if v.commit != nil {
+			old[v.path] = v.commit
+		}
+		if v.index != nil {
+			new[v.path] = v.index
+		}
+	}
+	entries, err := r.diffFiles(old, new, opts)
+	if err != nil {
+		return err
+	}
+	for _, v := range entries {
+		if v.Status != DiffRenamed && v.Status != DiffCopied {
+			continue
+		}
+		f, ok := files.Contains(v.NewPath)
+		if !ok {
+			continue
+		}
+		f.origPath = v.OldPath
+		f.idxStatus = CopiedInIndex
+		if v.Status != DiffRenamed {
+			continue
+		}
+		f.idxStatus = RenamedInIndex
+		if from, ok := files.Contains(v.OldPath); ok {
+			if from.wd == nil {
+				files.remove(v.OldPath)
+			} else {
+				from.idxStatus = UntrackedInIndex
+			}
+		}
+	}
+	return nil
 }
@@ -0,0 +1,150 @@
+package g
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStatusStatThenHash(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Init(dir, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+	path := filepath.Join(dir, "a")
+	e(os.WriteFile(path, []byte("aaa"), 0644), t)
+	assertAddFiles(t, r, []string{"a"})
+
+	// a touch changes the stat data but not the content
+	later := time.Now().Add(time.Hour)
+	e(os.Chtimes(path, later, later), t)
+	assertStatus(t, r, nil, map[string]WDStatus{"a": IndexAndWorkingTreeMatch})
+
+	// refreshing the index records the new stat data
+	e(r.RefreshIndex(), t)
+	idx, err := r.ReadIndex()
+	e(err, t)
+	if f := idx.File("a"); !f.index.Finfo.ModTime().Equal(later) {
+		t.Errorf("expected refreshed mtime %s got %s", later, f.index.Finfo.ModTime())
+	}
+	assertStatus(t, r, nil, map[string]WDStatus{"a": IndexAndWorkingTreeMatch})
+
+	// an edit of the same size that keeps the stat data is found because
+	// the entry is racy, its mtime is not older than the index file
+	e(os.WriteFile(path, []byte("bbb"), 0644), t)
+	e(os.Chtimes(path, later, later), t)
+	assertStatus(t, r, nil, map[string]WDStatus{"a": WorktreeChangedSinceIndex})
+
+	// an edit that changes the size is modified without hashing
+	e(os.WriteFile(path, []byte("cccc"), 0644), t)
+	assertStatus(t, r, nil, map[string]WDStatus{"a": WorktreeChangedSinceIndex})
+}
+
+func TestIndexWriteSmudgesRacilyCleanEntries(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Init(dir, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+	path := filepath.Join(dir, "a")
+	e(os.WriteFile(path, []byte("aaa"), 0644), t)
+	later := time.Now().Add(time.Hour)
+	e(os.Chtimes(path, later, later), t)
+	assertAddFiles(t, r, []string{"a"})
+
+	// the entry, for "bbb", matches the stat data of the file but not its
+	// content, as when a file is changed in the instant the index is written
+	idx, err := r.ReadIndex()
+	e(err, t)
+	other, err := ShaFromHexString("01f02e32ce8a128dd7b1d16a45f2eff66ec23c2d")
+	e(err, t)
+	idx.items[0].Sha = other.AsArray()
+	e(idx.Write(), t)
+	idx, err = r.ReadIndex()
+	e(err, t)
+	if idx.items[0].Size != 0 {
+		t.Errorf("expected the racily clean entry to be smudged, size %d", idx.items[0].Size)
+	}
+
+	// once the index is newer than the entry it is still found modified
+	e(os.Chtimes(r.IndexFilePath(), later.Add(time.Hour), later.Add(time.Hour)), t)
+	assertStatus(t, r, nil, map[string]WDStatus{"a": WorktreeChangedSinceIndex})
+}
+
+func TestRefreshIndexSkipsWhenLocked(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Init(dir, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+	path := filepath.Join(dir, "a")
+	e(os.WriteFile(path, []byte("aaa"), 0644), t)
+	assertAddFiles(t, r, []string{"a"})
+	before, err := os.ReadFile(r.IndexFilePath())
+	e(err, t)
+
+	later := time.Now().Add(time.Hour)
+	e(os.Chtimes(path, later, later), t)
+	e(os.WriteFile(r.IndexFilePath()+".lock", nil, 0644), t)
+	e(r.RefreshIndex(), t)
+	after, err := os.ReadFile(r.IndexFilePath())
+	e(err, t)
+	if !bytes.Equal(before, after) {
+		t.Error("expected the index not to be refreshed whilst it is locked")
+	}
+	idx, err := r.ReadIndex()
+	e(err, t)
+	var lockErr *LockError
+	if err := idx.Write(); !errors.As(err, &lockErr) {
+		t.Errorf("expected a lock error writing a locked index, got %v", err)
+	}
+}
+
+func TestStatusUnmerged(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Init(dir, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+	sha, err := r.writeBlobContent([]byte("a\n"))
+	e(err, t)
+	info := &fileInfo{Sha: sha, Mode: ModeRegular}
+
+	// a path for each set of stages, named by its status
+	expected := map[string]UnmergedStatus{}
+	idx, err := r.ReadIndex()
+	e(err, t)
+	for us := BothDeleted; us <= BothModified; us++ {
+		path := us.StatusString()
+		expected[path] = us
+		for stage := 1; stage <= 3; stage++ {
+			if us&(1<<(stage-1)) != 0 {
+				idx.addStage(path, stage, info)
+			}
+		}
+		e(os.WriteFile(filepath.Join(dir, path), []byte("a\n"), 0644), t)
+	}
+	e(idx.Write(), t)
+
+	files, err := r.CurrentStatus()
+	e(err, t)
+	for path, us := range expected {
+		f, ok := files.Contains(path)
+		if !ok || f.IndexStatus() != UnmergedInIndex || f.Unmerged() != us {
+			t.Errorf("expected %s to be %s", path, us)
+		}
+	}
+
+	// adding a file resolves its conflict
+	files, err = r.FsStatus(r.Path())
+	e(err, t)
+	f, _ := files.Contains("UU")
+	idx, err = r.ReadIndex()
+	e(err, t)
+	e(idx.Add(f), t)
+	e(idx.Write(), t)
+	idx, err = r.ReadIndex()
+	e(err, t)
+	if len(idx.Unmerged()) != 6 {
+		t.Errorf("expected 6 unmerged paths, got %v", idx.Unmerged())
+	}
+	if f := idx.File("UU"); f == nil || f.Unmerged() != 0 || f.index == nil {
+		t.Error("expected UU to be merged at stage 0")
+	}
+}
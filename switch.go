@@ -1,8 +1,11 @@
 package g
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // switchBranchDelta describes the changes need to move between two branches
@@ -16,19 +19,19 @@ type switchBranchDelta struct {
 	errorFiles []*FileStatus // The following untracked working tree files would be overwritten by checkout ...
 }
 
-func newSwitchBranchDelta(name string) (*switchBranchDelta, error) {
+func (r *Repository) newSwitchBranchDelta(commitSha Sha) (*switchBranchDelta, error) {
 	// the delta
 	delta := &switchBranchDelta{}
 
 	// get all files in working directory, index and current commit with the
 	// index and wd statuses set.
-	curFiles, err := CurrentStatus()
+	curFiles, err := r.CurrentStatus()
 	if err != nil {
 		return nil, err
 	}
 
-	// get all the files in the branch HEAD commit being switched to
-	commitFiles, err := CommittedFilesForBranchHead(name)
+	// get all the files in the commit being switched to
+	commitFiles, err := r.CommittedFilesForCommit(commitSha)
 	if err != nil {
 		return nil, err
 	}
@@ -76,9 +79,9 @@ func newSwitchBranchDelta(name string) (*switchBranchDelta, error) {
 
 		// if the file has both local changes and has a different version in the new
 		// commit, record as errorFile so as not to lose local changes.
-		if c.wdStatus == WorktreeChangedSinceIndex {
+		if c.wdStatus == WorktreeChangedSinceIndex || c.wdStatus == TypeChangedInWorktreeSinceIndex {
 			// now how to tell
-			if c.commit.Sha.String() != n.commit.Sha.String() {
+			if c.commit.Sha.String() != n.commit.Sha.String() || c.commit.Mode != n.commit.Mode {
 				delta.errorFiles = append(delta.errorFiles, c)
 			}
 		}
@@ -91,7 +94,7 @@ func newSwitchBranchDelta(name string) (*switchBranchDelta, error) {
 			// if the current branch has the same hash for the same commited
 			// file - add to addSkip. @todo What about if the same hash is in
 			// the index ?
-			if c.commit != nil && c.commit.Sha.Matches(n.commit.Sha) {
+			if c.commit != nil && c.commit.Sha.Matches(n.commit.Sha) && c.commit.Mode == n.commit.Mode {
 				// and the file is consistent with the commit
 				if c.wdStatus == IndexAndWorkingTreeMatch && c.idxStatus == NotUpdated {
 					// no need to delete/recreate it
@@ -107,8 +110,76 @@ func newSwitchBranchDelta(name string) (*switchBranchDelta, error) {
 	return delta, nil
 }
 
-func SwitchBranch(name string) ([]string, error) {
-	delta, err := newSwitchBranchDelta(name)
+// SwitchBranch updates the working directory and index to match the HEAD
+// commit of branch name and points HEAD at the branch. If local changes would
+// be lost the paths of the files are returned and nothing is changed.
+func (r *Repository) SwitchBranch(name string) ([]string, error) {
+	commitSha, err := r.HeadSHA(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.switchCommit(commitSha, name, func() error { return r.UpdateHead(name) })
+}
+
+// SwitchDetached updates the working directory and index to match commit sha
+// and detaches HEAD at it. If local changes would be lost the paths of the
+// files are returned and nothing is changed.
+func (r *Repository) SwitchDetached(sha Sha) ([]string, error) {
+	obj, err := r.ReadObject(sha)
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil || obj.Typ != ObjectTypeCommit {
+		return nil, fmt.Errorf("fatal: reference is not a commit: %s", sha)
+	}
+	return r.switchCommit(sha, sha.AsHexString(), func() error { return r.DetachHead(sha) })
+}
+
+// switchCommit updates the working directory and index to match commitSha,
+// calls updateHead to move HEAD and records the checkout of to in the HEAD
+// reflog.
+func (r *Repository) switchCommit(commitSha Sha, to string, updateHead func() error) ([]string, error) {
+	if _, err := os.Stat(r.MergeHeadPath()); err == nil {
+		return nil, errors.New("fatal: cannot switch branch while merging\nConsider \"git merge --quit\" or \"git worktree add\".")
+	}
+	errFiles, err := r.checkoutCommit(commitSha)
+	if err != nil || len(errFiles) != 0 {
+		return errFiles, err
+	}
+
+	// update HEAD
+	from, previous, err := r.readHead()
+	if err != nil {
+		return nil, err
+	}
+	if from == "" {
+		from = previous.AsHexString()
+	} else if previous, err = r.HeadSHA(from); err != nil {
+		return nil, err
+	}
+	if err := updateHead(); err != nil {
+		return nil, err
+	}
+	message := fmt.Sprintf("checkout: moving from %s to %s", from, to)
+	if err := r.appendReflog(DefaultHeadFile, previous, commitSha, message); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// checkoutCommit updates the working directory and index to match commitSha
+// without moving HEAD. If local changes would be lost the paths of the files
+// are returned and nothing is changed. The index must have no conflicts.
+func (r *Repository) checkoutCommit(commitSha Sha) ([]string, error) {
+	current, err := r.ReadIndex()
+	if err != nil {
+		return nil, err
+	}
+	if unmerged := current.Unmerged(); len(unmerged) > 0 {
+		return nil, fmt.Errorf("error: you need to resolve your current index first\n%s: needs merge", strings.Join(unmerged, ": needs merge\n"))
+	}
+	delta, err := r.newSwitchBranchDelta(commitSha)
 	if err != nil {
 		return nil, err
 	}
@@ -124,20 +195,20 @@ func SwitchBranch(name string) ([]string, error) {
 
 	// remove the files that need to be removed
 	for _, v := range delta.remove {
-		if err := os.Remove(filepath.Join(Path(), v.Path())); err != nil {
+		if err := os.Remove(filepath.Join(r.Path(), v.Path())); err != nil {
 			return nil, err
 		}
 	}
 
 	// add the files that need to be added
 	for _, v := range delta.add {
-		if err := writeObjectToWorkingTree(v.commit.Sha, v.Path()); err != nil {
+		if err := r.writeObjectToWorkingTree(v.commit.Sha, v.Path(), v.commit.Mode); err != nil {
 			return nil, err
 		}
 	}
 
 	// rebuild the index
-	idx := NewIndex()
+	idx := r.NewIndex()
 	for _, v := range delta.addSkip {
 		if err := idx.addFromCommit(v); err != nil {
 			return nil, err
@@ -154,14 +225,5 @@ func SwitchBranch(name string) ([]string, error) {
 		}
 	}
 
-	if err := idx.Write(); err != nil {
-		return nil, err
-	}
-
-	// update HEAD
-	if err := UpdateHead(name); err != nil {
-		return nil, err
-	}
-
-	return nil, nil
+	return nil, idx.Write()
 }
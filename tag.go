@@ -0,0 +1,224 @@
+package g
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tag is an annotated tag Object
+type Tag struct {
+	Sha         Sha
+	Object      Sha
+	Type        objectType
+	Tag         string
+	Tagger      string
+	TaggerEmail string
+	TaggedTime  time.Time
+	Message     []byte
+}
+
+func (t Tag) String() string {
+	var o string
+	o += fmt.Sprintf("tag: %s\n", t.Sha.AsHexString())
+	o += fmt.Sprintf("object: %s %s\n", t.Object.AsHexString(), t.Type)
+	o += fmt.Sprintf("name: %s\n", t.Tag)
+	o += fmt.Sprintf("%s <%s> %s\n", t.Tagger, t.TaggerEmail, t.TaggedTime.String())
+	o += fmt.Sprintf("message: \n%s\n", t.Message)
+	return o
+}
+
+func (r *Repository) ReadTag(sha Sha) (*Tag, error) {
+	o, err := r.ReadObject(sha)
+	if err != nil {
+		return nil, err
+	}
+	if o == nil {
+		return nil, fmt.Errorf("object %s not found", sha)
+	}
+	if o.Typ != ObjectTypeTag {
+		return nil, fmt.Errorf("object %s is a %s, not a tag", sha, o.Typ)
+	}
+	return readTag(o)
+}
+
+// The format for a tag object is a header of the object being tagged, its
+// type, the tag name and optionally the tagger, followed by a blank line and
+// the tag message.
+func readTag(obj *Object) (*Tag, error) {
+	r, err := obj.ReadCloser()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = r.Close() }()
+	if err := ReadHeadBytes(r, obj); err != nil {
+		return nil, err
+	}
+	t := &Tag{Sha: obj.Sha}
+	s := bufio.NewScanner(r)
+	header := true
+	for s.Scan() {
+		l := s.Bytes()
+		if !header {
+			t.Message = append(t.Message, l...)
+			t.Message = append(t.Message, '\n')
+			continue
+		}
+		if len(l) == 0 {
+			header = false
+			continue
+		}
+		p := bytes.SplitN(l, []byte(" "), 2)
+		if len(p) != 2 {
+			return nil, fmt.Errorf("invalid tag header %s", l)
+		}
+		switch string(p[0]) {
+		case "object":
+			if t.Object, err = NewSha(p[1]); err != nil {
+				return nil, err
+			}
+		case "type":
+			switch string(p[1]) {
+			case "commit":
+				t.Type = ObjectTypeCommit
+			case "tree":
+				t.Type = ObjectTypeTree
+			case "blob":
+				t.Type = ObjectTypeBlob
+			case "tag":
+				t.Type = ObjectTypeTag
+			default:
+				return nil, fmt.Errorf("unknown tag type %s", p[1])
+			}
+		case "tag":
+			t.Tag = string(p[1])
+		case "tagger":
+			if err := readTagger(p[1], t); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if !t.Object.IsSet() {
+		return nil, errors.New("expected tag object")
+	}
+	return t, nil
+}
+
+func readTagger(b []byte, t *Tag) error {
+	s := bytes.Index(b, []byte("<"))
+	e := bytes.Index(b, []byte(">"))
+	if s < 1 || e < s {
+		return fmt.Errorf("invalid tagger %s", b)
+	}
+	t.Tagger = string(b[0 : s-1])
+	t.TaggerEmail = string(b[s+1 : e])
+	ut, err := strconv.ParseInt(string(bytes.Fields(b[e+1:])[0]), 10, 64)
+	if err != nil {
+		return err
+	}
+	// @todo timezone part
+	t.TaggedTime = time.Unix(ut, 0)
+	return nil
+}
+
+// writeTag writes a Tag to the Object Store, tagged by Tagger and
+// TaggerEmail. As git does, a message is ended with a newline.
+func (r *Repository) writeTag(t *Tag) (Sha, error) {
+	message := t.Message
+	if len(message) > 0 && message[len(message)-1] != '\n' {
+		message = append(message[:len(message):len(message)], '\n')
+	}
+	content := []byte(fmt.Sprintf(
+		"object %s\ntype %s\ntag %s\ntagger %s <%s> %d +0000\n\n%s",
+		t.Object.AsHexString(),
+		t.Type,
+		t.Tag,
+		t.Tagger,
+		t.TaggerEmail,
+		t.TaggedTime.Unix(),
+		message,
+	))
+	header := []byte(fmt.Sprintf("tag %d%s", len(content), string(byte(0))))
+	return WriteObject(header, content, "", r.ObjectPath())
+}
+
+// CreateTag creates a tag called name under refs/tags. When tag is nil a
+// lightweight tag pointing directly at sha is created, otherwise an annotated
+// Tag object for sha is written and the ref points at that.
+func (r *Repository) CreateTag(name string, sha Sha, tag *Tag) error {
+	if err := CheckTagName(name); err != nil {
+		return err
+	}
+	ref := filepath.Join(DefaultRefsDirectory, DefaultRefsTagsDirectory, name)
+	if _, found, err := r.resolveRef(ref); err != nil {
+		return err
+	} else if found {
+		return fmt.Errorf("fatal: tag '%s' already exists", name)
+	}
+	obj, err := r.ReadObject(sha)
+	if err != nil {
+		return err
+	}
+	if obj == nil {
+		return fmt.Errorf("fatal: not a valid object name: '%s'", sha)
+	}
+	if tag != nil {
+		tag.Object = sha
+		tag.Type = obj.Typ
+		tag.Tag = name
+		if sha, err = r.writeTag(tag); err != nil {
+			return err
+		}
+		tag.Sha = sha
+	}
+	tx := r.NewRefTransaction()
+	tx.Create(ref, sha, "")
+	return tx.Commit()
+}
+
+// TagSHA returns the hash pointed to by a tag. For annotated tags this is the
+// Sha of the Tag object.
+func (r *Repository) TagSHA(name string) (Sha, error) {
+	sha, found, err := r.resolveRef(filepath.Join(DefaultRefsDirectory, DefaultRefsTagsDirectory, name))
+	if err != nil {
+		return Sha{}, err
+	}
+	if !found {
+		return Sha{}, fmt.Errorf("fatal: tag '%s' not found", name)
+	}
+	return sha, nil
+}
+
+// ListTags lists loose and packed tags sorted alphabetically
+func (r *Repository) ListTags() ([]string, error) {
+	prefix := DefaultRefsDirectory + "/" + DefaultRefsTagsDirectory + "/"
+	refs, err := r.listRefs(prefix)
+	if err != nil {
+		return nil, err
+	}
+	tags := make([]string, len(refs))
+	for i, v := range refs {
+		tags[i] = strings.TrimPrefix(v, prefix)
+	}
+	return tags, nil
+}
+
+func (r *Repository) DeleteTag(name string) error {
+	ref := filepath.Join(DefaultRefsDirectory, DefaultRefsTagsDirectory, name)
+	if _, found, err := r.resolveRef(ref); err != nil {
+		return err
+	} else if !found {
+		return fmt.Errorf("error: tag '%s' not found", name)
+	}
+	tx := r.NewRefTransaction()
+	tx.Delete(ref, Sha{})
+	return tx.Commit()
+}
@@ -0,0 +1,92 @@
+package g
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTag(t *testing.T) {
+	dir := t.TempDir()
+	r, err := Init(dir, WithGitDirectory(DefaultGitDirectory))
+	e(err, t)
+	e(os.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644), t)
+	assertAddFiles(t, r, []string{"a"})
+	commitSha := assertCreateCommit(t, r, &Commit{
+		Author:        "tester <tester@test.com>",
+		AuthoredTime:  time.Now(),
+		Committer:     "tester <tester@test.com>",
+		CommittedTime: time.Now(),
+		Message:       []byte("tagged commit"),
+	})
+
+	e(r.CreateTag("light", commitSha, nil), t)
+	e(r.CreateTag("release/v1", commitSha, &Tag{
+		Tagger:      "tagger",
+		TaggerEmail: "tagger@test.com",
+		TaggedTime:  time.Unix(1700000000, 0),
+		Message:     []byte("version 1"),
+	}), t)
+	if err := r.CreateTag("light", commitSha, nil); err == nil {
+		t.Error("expected an error creating a tag that already exists")
+	}
+
+	tags, err := r.ListTags()
+	e(err, t)
+	if !reflect.DeepEqual(tags, []string{"light", "release/v1"}) {
+		t.Errorf("tags = %v", tags)
+	}
+
+	light, err := r.TagSHA("light")
+	e(err, t)
+	if !light.Matches(commitSha) {
+		t.Errorf("lightweight tag = %s, want %s", light, commitSha)
+	}
+
+	assertTag := func(t *testing.T) {
+		t.Helper()
+		sha, err := r.TagSHA("release/v1")
+		e(err, t)
+		tag, err := r.ReadTag(sha)
+		e(err, t)
+		if !tag.Object.Matches(commitSha) || tag.Type != ObjectTypeCommit {
+			t.Errorf("tag object = %s %s, want %s commit", tag.Object, tag.Type, commitSha)
+		}
+		if tag.Tag != "release/v1" || string(tag.Message) != "version 1\n" {
+			t.Errorf("tag = %q, message = %q", tag.Tag, tag.Message)
+		}
+		if tag.Tagger != "tagger" || tag.TaggerEmail != "tagger@test.com" || tag.TaggedTime.Unix() != 1700000000 {
+			t.Errorf("tagger = %s <%s> %s", tag.Tagger, tag.TaggerEmail, tag.TaggedTime)
+		}
+		// the object is the one git tag -a writes, the message ending with a
+		// newline
+		obj, err := r.ReadObject(sha)
+		e(err, t)
+		content, err := readObjectContent(obj)
+		e(err, t)
+		expected := fmt.Sprintf("object %s\ntype commit\ntag release/v1\ntagger tagger <tagger@test.com> 1700000000 +0000\n\nversion 1\n", commitSha)
+		if string(content) != expected {
+			t.Errorf("tag object = %q, want %q", content, expected)
+		}
+		// a tag read back is written as the same object
+		rewritten, err := r.writeTag(tag)
+		e(err, t)
+		if !rewritten.Matches(sha) {
+			t.Errorf("rewritten tag = %s, want %s", rewritten, sha)
+		}
+	}
+	// read from a loose object and then from a pack file
+	assertTag(t)
+	e(r.GC(), t)
+	assertTag(t)
+
+	e(r.DeleteTag("light"), t)
+	tags, err = r.ListTags()
+	e(err, t)
+	if !reflect.DeepEqual(tags, []string{"release/v1"}) {
+		t.Errorf("tags = %v", tags)
+	}
+}
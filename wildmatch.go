@@ -0,0 +1,198 @@
+package g
+
+import (
+	"strings"
+	"unicode"
+)
+
+// wildmatch reports whether name matches the glob pattern using git's
+// wildmatch rules. * and ? do not match /, [...] matches a class of
+// characters and ** matches across directories when it is a whole path
+// component, as in **/a, a/** or a/**/b. A backslash escapes the following
+// character. When fold is true the match ignores case.
+func wildmatch(pattern string, name string, fold bool) bool {
+	return wildmatchAt(pattern, 0, name, fold)
+}
+
+func wildmatchAt(pattern string, pi int, name string, fold bool) bool {
+	for pi < len(pattern) {
+		c := pattern[pi]
+		switch c {
+		case '\\':
+			if pi+1 >= len(pattern) || len(name) == 0 || !wildmatchByte(pattern[pi+1], name[0], fold) {
+				return false
+			}
+			pi += 2
+			name = name[1:]
+		case '?':
+			if len(name) == 0 || name[0] == '/' {
+				return false
+			}
+			pi++
+			name = name[1:]
+		case '[':
+			n, ok, end := wildmatchClass(pattern[pi:], name, fold)
+			if !ok {
+				return false
+			}
+			if n < 0 {
+				// an unterminated class matches [ literally
+				if len(name) == 0 || name[0] != '[' {
+					return false
+				}
+				pi++
+				name = name[1:]
+				continue
+			}
+			pi += end
+			name = name[n:]
+		case '*':
+			start := pi
+			for pi < len(pattern) && pattern[pi] == '*' {
+				pi++
+			}
+			if pi-start >= 2 && (start == 0 || pattern[start-1] == '/') {
+				// ** as a whole component matches any number of directories
+				if pi == len(pattern) {
+					return true
+				}
+				if pattern[pi] == '/' {
+					if wildmatchAt(pattern, pi+1, name, fold) {
+						return true
+					}
+					for i := 0; i < len(name); i++ {
+						if name[i] == '/' && wildmatchAt(pattern, pi+1, name[i+1:], fold) {
+							return true
+						}
+					}
+					return false
+				}
+			}
+			if pi == len(pattern) {
+				return !strings.Contains(name, "/")
+			}
+			for i := 0; i <= len(name); i++ {
+				if wildmatchAt(pattern, pi, name[i:], fold) {
+					return true
+				}
+				if i < len(name) && name[i] == '/' {
+					return false
+				}
+			}
+			return false
+		default:
+			if len(name) == 0 || !wildmatchByte(c, name[0], fold) {
+				return false
+			}
+			pi++
+			name = name[1:]
+		}
+	}
+	return len(name) == 0
+}
+
+func wildmatchByte(a byte, b byte, fold bool) bool {
+	if fold {
+		return unicode.ToLower(rune(a)) == unicode.ToLower(rune(b))
+	}
+	return a == b
+}
+
+// wildmatchClass matches the bracket expression at the start of pattern
+// against the first byte of name. It returns the number of bytes of name
+// consumed, whether they matched and the length of the expression. A
+// negative count means the expression is not terminated.
+func wildmatchClass(pattern string, name string, fold bool) (int, bool, int) {
+	i := 1
+	negate := false
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		negate = true
+		i++
+	}
+	if len(name) == 0 {
+		if strings.IndexByte(pattern[i:], ']') < 0 {
+			return -1, true, 0
+		}
+		return 0, false, 0
+	}
+	c := name[0]
+	matched := false
+	for first := true; ; first = false {
+		if i >= len(pattern) {
+			return -1, true, 0
+		}
+		p := pattern[i]
+		if p == ']' && !first {
+			i++
+			break
+		}
+		if p == '[' && i+1 < len(pattern) && pattern[i+1] == ':' {
+			if end := strings.Index(pattern[i+2:], ":]"); end >= 0 {
+				if wildmatchCharClass(pattern[i+2:i+2+end], c) {
+					matched = true
+				}
+				i += end + 4
+				continue
+			}
+		}
+		if p == '\\' && i+1 < len(pattern) {
+			i++
+			p = pattern[i]
+		}
+		lo, hi := p, p
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			hi = pattern[i+2]
+			if hi == '\\' && i+3 < len(pattern) {
+				hi = pattern[i+3]
+				i++
+			}
+			i += 2
+		}
+		i++
+		if c >= lo && c <= hi {
+			matched = true
+		} else if fold {
+			l := byte(unicode.ToLower(rune(c)))
+			u := byte(unicode.ToUpper(rune(c)))
+			if (l >= lo && l <= hi) || (u >= lo && u <= hi) {
+				matched = true
+			}
+		}
+	}
+	if c == '/' {
+		return 0, false, i
+	}
+	return 1, matched != negate, i
+}
+
+// wildmatchCharClass matches c against a POSIX character class such as alpha
+func wildmatchCharClass(class string, c byte) bool {
+	r := rune(c)
+	switch class {
+	case "alnum":
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	case "alpha":
+		return unicode.IsLetter(r)
+	case "blank":
+		return c == ' ' || c == '\t'
+	case "cntrl":
+		return unicode.IsControl(r)
+	case "digit":
+		return unicode.IsDigit(r)
+	case "graph":
+		return unicode.IsGraphic(r) && c != ' '
+	case "lower":
+		return unicode.IsLower(r)
+	case "print":
+		return unicode.IsPrint(r)
+	case "punct":
+		return unicode.IsPunct(r) || unicode.IsSymbol(r)
+	case "space":
+		return unicode.IsSpace(r)
+	case "upper":
+		return unicode.IsUpper(r)
+	case "xdigit":
+		return strings.IndexByte("0123456789abcdefABCDEF", c) >= 0
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package g
+
+import "testing"
+
+func TestWildmatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		fold    bool
+		match   bool
+	}{
+		{"foo", "foo", false, true},
+		{"foo", "Foo", false, false},
+		{"foo", "Foo", true, true},
+		{"f?o", "foo", false, true},
+		{"f?o", "f/o", false, false},
+		{"*.txt", "a.txt", false, true},
+		{"*.txt", "dir/a.txt", false, false},
+		{"dir/*", "dir/a", false, true},
+		{"dir/*", "dir/a/b", false, false},
+		{"**/a", "a", false, true},
+		{"**/a", "x/y/a", false, true},
+		{"a/**", "a/x/y", false, true},
+		{"a/**", "b/x", false, false},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**/b", "a/x/c", false, false},
+		{"a**b", "axxb", false, true},
+		{"a**b", "ax/xb", false, false},
+		{"[abc]", "b", false, true},
+		{"[abc]", "d", false, false},
+		{"[!abc]", "d", false, true},
+		{"[^abc]", "a", false, false},
+		{"[a-c]x", "bx", false, true},
+		{"[a-c]x", "Bx", true, true},
+		{"[]]", "]", false, true},
+		{"[[:digit:]]", "5", false, true},
+		{"[[:alpha:]]", "5", false, false},
+		{"[a", "[a", false, true},
+		{"\\*", "*", false, true},
+		{"\\*", "a", false, false},
+		{"/home/**", "/home/user/.git", false, true},
+		{"**/repo/.git", "/work/repo/.git", false, true},
+	}
+	for _, tt := range tests {
+		if actual := wildmatch(tt.pattern, tt.name, tt.fold); actual != tt.match {
+			t.Errorf("wildmatch(%q, %q, %v) = %v, want %v", tt.pattern, tt.name, tt.fold, actual, tt.match)
+		}
+	}
+}